@@ -2,26 +2,48 @@ package configs
 
 import (
 	"fmt"
-	"os"
+	"net"
 	"strconv"
+	"strings"
 	"time"
 )
 
 const (
 	defaultGracefulShutdownDuration = 5
 	defaultSecretKeyLen             = 16
+	maxListenPort                   = 65535
 
 	defaultListenPort               = 9999
-	defaultSignupTokenExpire        = 1800 // 30 minutes
-	defaultSessionTokenExpire       = 3600 // 60 minutes
-	defaultResetPasswordTokenExpire = 600  // 10 minutes
+	defaultMetricsListenPort        = 9998
+	defaultSignupTokenExpire        = 1800    // 30 minutes
+	defaultSessionTokenExpire       = 3600    // 60 minutes
+	defaultRefreshTokenExpire       = 1209600 // 14 days
+	defaultSessionMaxLifetime       = 86400   // 1 day
+	defaultResetPasswordTokenExpire = 600     // 10 minutes
+	defaultAuthorizationCodeExpire  = 60      // 1 minute
+	defaultWebAuthnChallengeExpire  = 300     // 5 minutes
+	defaultEmailCodeExpire          = 300     // 5 minutes
+	defaultEmailCodeMaxAttempts     = 5
+	defaultMagicLinkTokenExpire     = 600 // 10 minutes
+	defaultSigninLockDuration       = 900 // 15 minutes
+	defaultSigninMaxDelay           = 60  // 1 minute
+	defaultSigninFreeFailures       = 3
+	defaultSigninMaxFailures        = 10
+	defaultSigninFreeFailuresPerIP  = 30
+	defaultSigninMaxFailuresPerIP   = 100
 	defaultJWTSigninKey             = "PlzSetYourSigninKey"
+	defaultJWTSigningMethod         = "HS256"
 	defaultOrg                      = "Auth"
 	defaultSupportEmail             = "auth@email.com"
 	defaultPageSize                 = "20"
+	defaultWebAuthnRPID             = "localhost"
 
+	defaultIssuerURL        = "http://localhost:%d"
+	defaultWebAuthnOrigins  = "http://localhost:%d"
 	defaultSignupURL        = "http://localhost:%d/signup/email/verification/%s"
-	defaultResetPasswordURL = "http://localhost:%d/reset_password/email/verification%s"
+	defaultResetPasswordURL = "http://localhost:%d/reset_password/email/verification/%s"
+	defaultMagicLinkURL     = "http://localhost:%d/signin/magic_link/%s"
+	defaultSigninUnlockURL  = "http://localhost:%d/signin/unlock/%s"
 )
 
 // AppConfig contains the values needed to operate application.
@@ -29,19 +51,70 @@ type AppConfig struct {
 	gracefulShutdownDuration time.Duration
 
 	ListenPort               int
+	MetricsListenPort        int // metrics are not served if it is zero
 	SignupTokenExpire        int
 	SessionTokenExpire       int
+	RefreshTokenExpire       int
+	SessionMaxLifetime       int
 	ResetPasswordTokenExpire int
+	AuthorizationCodeExpire  int
+	WebAuthnChallengeExpire  int
+	EmailCodeExpire          int
+	EmailCodeMaxAttempts     int
+	MagicLinkTokenExpire     int
+	SigninLockDuration       int
+	SigninMaxDelay           int
+	SigninFreeFailures       int
+	SigninMaxFailures        int
+	SigninFreeFailuresPerIP  int
+	SigninMaxFailuresPerIP   int
 	JWTSigninKey             string
+	JWTSigningMethod         string
+	JWTPrivateKeyFile        string
 	Org                      string
 	SupportEmail             string
 	PageSize                 string
 	PageSizeLimit            int
+	WebAuthnRPID             string
 
 	secretKeyLen int
 
+	issuerURL        string
+	webAuthnOrigins  string
+	trustedProxies   string
 	siginupURL       string
 	resetPasswordURL string
+	magicLinkURL     string
+	signinUnlockURL  string
+}
+
+// IssuerURL is returns url that identifies this application as OpenID provider.
+// Endpoints in discovery document are built on it.
+func (c *AppConfig) IssuerURL() string {
+	if c.issuerURL == defaultIssuerURL {
+		return fmt.Sprintf(c.issuerURL, c.ListenPort)
+	}
+	return strings.TrimRight(c.issuerURL, "/")
+}
+
+// WebAuthnOrigins is returns origins of the frontend allowed to run WebAuthn ceremonies.
+// Origins are set as space separated list.
+func (c *AppConfig) WebAuthnOrigins() []string {
+	if c.webAuthnOrigins == defaultWebAuthnOrigins {
+		return []string{fmt.Sprintf(c.webAuthnOrigins, c.ListenPort)}
+	}
+
+	origins := []string{}
+	for _, origin := range strings.Fields(c.webAuthnOrigins) {
+		origins = append(origins, strings.TrimRight(origin, "/"))
+	}
+	return origins
+}
+
+// TrustedProxies is returns proxies whose 'X-Forwarded-For' header is trusted as the client IP.
+// Proxies are set as space separated list of IP or CIDR. None is trusted by default.
+func (c *AppConfig) TrustedProxies() []string {
+	return strings.Fields(c.trustedProxies)
 }
 
 // SignupURL is returns signup url to be used by frontend.
@@ -78,6 +151,58 @@ func (c *AppConfig) ResetPasswordURL(token string) string {
 	return fmt.Sprintf("%s%s", c.resetPasswordURL, token)
 }
 
+// MagicLinkURL is returns signin url sent by email to be used by frontend.
+func (c *AppConfig) MagicLinkURL(token string) string {
+	if c.magicLinkURL == "" {
+		return ""
+	}
+
+	if c.magicLinkURL == defaultMagicLinkURL {
+		return fmt.Sprintf(c.magicLinkURL, c.ListenPort, token)
+	}
+
+	last := c.magicLinkURL[len(c.magicLinkURL)-1]
+	if string(last) != "/" {
+		token = "/" + token
+	}
+	return fmt.Sprintf("%s%s", c.magicLinkURL, token)
+}
+
+// SigninUnlockURL is returns url sent by email to unlock the account to be used by frontend.
+func (c *AppConfig) SigninUnlockURL(token string) string {
+	if c.signinUnlockURL == "" {
+		return ""
+	}
+
+	if c.signinUnlockURL == defaultSigninUnlockURL {
+		return fmt.Sprintf(c.signinUnlockURL, c.ListenPort, token)
+	}
+
+	last := c.signinUnlockURL[len(c.signinUnlockURL)-1]
+	if string(last) != "/" {
+		token = "/" + token
+	}
+	return fmt.Sprintf("%s%s", c.signinUnlockURL, token)
+}
+
+// LongestJWTExpire returns the longest lifetime of JWT signed by the application, in seconds.
+// Access token and ID token last as long as session token,
+// and signin unlock token lasts until the lock ends.
+func (c *AppConfig) LongestJWTExpire() int {
+	longest := c.SessionTokenExpire
+	for _, v := range []int{
+		c.SignupTokenExpire,
+		c.ResetPasswordTokenExpire,
+		c.MagicLinkTokenExpire,
+		c.SigninLockDuration,
+	} {
+		if v > longest {
+			longest = v
+		}
+	}
+	return longest
+}
+
 // SecretKeyLen is returns key length value required when creating a secretKey.
 func (c *AppConfig) SecretKeyLen() int {
 	return c.secretKeyLen
@@ -90,45 +215,148 @@ func (c *AppConfig) GracefulShutdownDuration() time.Duration {
 
 // App returns the Values needed to operate application.
 // Value not set in environment variable is set to fixed value.
+// After 'Load', the loaded values are returned.
 func App() *AppConfig {
+	if c := loadedConfig(); c != nil {
+		return c.App()
+	}
+	conf, _ := app()
+	return conf
+}
+
+// app builds the values, invalid values are kept as fixed value and returned as error.
+// The default signing key is refused except in test mode.
+func app() (*AppConfig, error) {
+	const fnApp = "App"
 	conf := AppConfig{
 		gracefulShutdownDuration: time.Second * defaultGracefulShutdownDuration,
 		secretKeyLen:             defaultSecretKeyLen,
 
 		ListenPort:               defaultListenPort,
+		MetricsListenPort:        defaultMetricsListenPort,
 		SignupTokenExpire:        defaultSignupTokenExpire,
 		SessionTokenExpire:       defaultSessionTokenExpire,
+		RefreshTokenExpire:       defaultRefreshTokenExpire,
+		SessionMaxLifetime:       defaultSessionMaxLifetime,
 		ResetPasswordTokenExpire: defaultResetPasswordTokenExpire,
+		AuthorizationCodeExpire:  defaultAuthorizationCodeExpire,
+		WebAuthnChallengeExpire:  defaultWebAuthnChallengeExpire,
+		EmailCodeExpire:          defaultEmailCodeExpire,
+		EmailCodeMaxAttempts:     defaultEmailCodeMaxAttempts,
+		MagicLinkTokenExpire:     defaultMagicLinkTokenExpire,
+		SigninLockDuration:       defaultSigninLockDuration,
+		SigninMaxDelay:           defaultSigninMaxDelay,
+		SigninFreeFailures:       defaultSigninFreeFailures,
+		SigninMaxFailures:        defaultSigninMaxFailures,
+		SigninFreeFailuresPerIP:  defaultSigninFreeFailuresPerIP,
+		SigninMaxFailuresPerIP:   defaultSigninMaxFailuresPerIP,
 		JWTSigninKey:             defaultJWTSigninKey,
+		JWTSigningMethod:         defaultJWTSigningMethod,
 		Org:                      defaultOrg,
 		SupportEmail:             defaultSupportEmail,
 		PageSize:                 defaultPageSize,
+		WebAuthnRPID:             defaultWebAuthnRPID,
+		issuerURL:                defaultIssuerURL,
+		webAuthnOrigins:          defaultWebAuthnOrigins,
 		siginupURL:               defaultSignupURL,
+		resetPasswordURL:         defaultResetPasswordURL,
+		magicLinkURL:             defaultMagicLinkURL,
+		signinUnlockURL:          defaultSigninUnlockURL,
 	}
 
-	for k, p := range map[string]interface{}{
+	errs := setValues(map[string]interface{}{
 		EnvPrefix + "LISTEN_PORT":                 &conf.ListenPort,
+		EnvPrefix + "METRICS_LISTEN_PORT":         &conf.MetricsListenPort,
 		EnvPrefix + "SIGNUP_TOKEN_EXPIRE":         &conf.SignupTokenExpire,
 		EnvPrefix + "SESSION_TOKEN_EXPIRE":        &conf.SessionTokenExpire,
+		EnvPrefix + "REFRESH_TOKEN_EXPIRE":        &conf.RefreshTokenExpire,
+		EnvPrefix + "SESSION_MAX_LIFETIME":        &conf.SessionMaxLifetime,
 		EnvPrefix + "RESET_PASSWORD_TOKEN_EXPIRE": &conf.ResetPasswordTokenExpire,
-		EnvPrefix + "JWT_SIGNIN_KEY":              &conf.JWTSigninKey,
+		EnvPrefix + "AUTHORIZATION_CODE_EXPIRE":   &conf.AuthorizationCodeExpire,
+		EnvPrefix + "WEBAUTHN_CHALLENGE_EXPIRE":   &conf.WebAuthnChallengeExpire,
+		EnvPrefix + "EMAIL_CODE_EXPIRE":           &conf.EmailCodeExpire,
+		EnvPrefix + "EMAIL_CODE_MAX_ATTEMPTS":     &conf.EmailCodeMaxAttempts,
+		EnvPrefix + "MAGIC_LINK_TOKEN_EXPIRE":     &conf.MagicLinkTokenExpire,
+		EnvPrefix + "SIGNIN_LOCK_DURATION":        &conf.SigninLockDuration,
+		EnvPrefix + "SIGNIN_MAX_DELAY":            &conf.SigninMaxDelay,
+		EnvPrefix + "SIGNIN_FREE_FAILURES":        &conf.SigninFreeFailures,
+		EnvPrefix + "SIGNIN_MAX_FAILURES":         &conf.SigninMaxFailures,
+		EnvPrefix + "SIGNIN_FREE_FAILURES_PER_IP": &conf.SigninFreeFailuresPerIP,
+		EnvPrefix + "SIGNIN_MAX_FAILURES_PER_IP":  &conf.SigninMaxFailuresPerIP,
+		EnvPrefix + "JWT_SIGNING_METHOD":          &conf.JWTSigningMethod,
+		EnvPrefix + "JWT_PRIVATE_KEY_FILE":        &conf.JWTPrivateKeyFile,
 		EnvPrefix + "ORG":                         &conf.Org,
 		EnvPrefix + "SUPPORT_EMAIL":               &conf.SupportEmail,
 		EnvPrefix + "PAGE_SIZE":                   &conf.PageSize,
 		EnvPrefix + "PAGE_SIZE_LIMIT":             &conf.PageSizeLimit,
+		EnvPrefix + "WEBAUTHN_RP_ID":              &conf.WebAuthnRPID,
+		EnvPrefix + "WEBAUTHN_ORIGINS":            &conf.webAuthnOrigins,
+		EnvPrefix + "TRUSTED_PROXIES":             &conf.trustedProxies,
+		EnvPrefix + "ISSUER_URL":                  &conf.issuerURL,
 		EnvPrefix + "SIGNUP_URL":                  &conf.siginupURL,
-	} {
-		if v, ok := os.LookupEnv(k); ok {
-			switch pt := p.(type) {
-			case *string:
-				*pt = v
-			case *int:
-				if i, err := strconv.Atoi(v); err == nil {
-					*pt = i
-				}
-			}
+		EnvPrefix + "RESET_PASSWORD_URL":          &conf.resetPasswordURL,
+		EnvPrefix + "MAGIC_LINK_URL":              &conf.magicLinkURL,
+		EnvPrefix + "SIGNIN_UNLOCK_URL":           &conf.signinUnlockURL,
+	})
+	if err := setSecret(EnvPrefix+"JWT_SIGNIN_KEY", &conf.JWTSigninKey); err != nil {
+		errs = append(errs, err)
+	}
+
+	errs = append(errs, checkPositive(map[string]int{
+		EnvPrefix + "LISTEN_PORT":                 conf.ListenPort,
+		EnvPrefix + "SIGNUP_TOKEN_EXPIRE":         conf.SignupTokenExpire,
+		EnvPrefix + "SESSION_TOKEN_EXPIRE":        conf.SessionTokenExpire,
+		EnvPrefix + "REFRESH_TOKEN_EXPIRE":        conf.RefreshTokenExpire,
+		EnvPrefix + "SESSION_MAX_LIFETIME":        conf.SessionMaxLifetime,
+		EnvPrefix + "RESET_PASSWORD_TOKEN_EXPIRE": conf.ResetPasswordTokenExpire,
+		EnvPrefix + "AUTHORIZATION_CODE_EXPIRE":   conf.AuthorizationCodeExpire,
+		EnvPrefix + "WEBAUTHN_CHALLENGE_EXPIRE":   conf.WebAuthnChallengeExpire,
+		EnvPrefix + "EMAIL_CODE_EXPIRE":           conf.EmailCodeExpire,
+		EnvPrefix + "EMAIL_CODE_MAX_ATTEMPTS":     conf.EmailCodeMaxAttempts,
+		EnvPrefix + "MAGIC_LINK_TOKEN_EXPIRE":     conf.MagicLinkTokenExpire,
+		EnvPrefix + "SIGNIN_LOCK_DURATION":        conf.SigninLockDuration,
+	})...)
+
+	if conf.ListenPort > maxListenPort {
+		errs = append(errs, fmt.Errorf(
+			"'%sLISTEN_PORT' must not be greater than %d", EnvPrefix, maxListenPort))
+	}
+
+	if conf.MetricsListenPort < 0 || conf.MetricsListenPort > maxListenPort {
+		errs = append(errs, fmt.Errorf(
+			"'%sMETRICS_LISTEN_PORT' must be between 0 and %d", EnvPrefix, maxListenPort))
+	}
+	if conf.MetricsListenPort == conf.ListenPort {
+		errs = append(errs, fmt.Errorf(
+			"'%sMETRICS_LISTEN_PORT' must not be the same as '%sLISTEN_PORT'", EnvPrefix, EnvPrefix))
+	}
+
+	if size, err := strconv.Atoi(conf.PageSize); err != nil || size < 1 {
+		errs = append(errs, fmt.Errorf(
+			"'%sPAGE_SIZE' must be a positive integer, not '%s'", EnvPrefix, conf.PageSize))
+	}
+
+	for _, proxy := range conf.TrustedProxies() {
+		if net.ParseIP(proxy) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(proxy); err != nil {
+			errs = append(errs, fmt.Errorf(
+				"'%sTRUSTED_PROXIES' must be IP or CIDR, not '%s'", EnvPrefix, proxy))
 		}
 	}
 
-	return &conf
+	if conf.SessionMaxLifetime < conf.SessionTokenExpire {
+		errs = append(errs, fmt.Errorf(
+			"'%sSESSION_MAX_LIFETIME' must not be less than '%sSESSION_TOKEN_EXPIRE'", EnvPrefix, EnvPrefix))
+	}
+
+	// 개인 키 파일이 없으면 서명 키로 서명하므로 기본값은 누구나 알 수 있다.
+	if Mode() != TestMode && conf.JWTPrivateKeyFile == "" &&
+		conf.JWTSigninKey == defaultJWTSigninKey {
+		errs = append(errs, fmt.Errorf(
+			"default '%sJWT_SIGNIN_KEY' must not be used", EnvPrefix))
+	}
+
+	return &conf, envError(fnApp, errs)
 }
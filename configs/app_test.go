@@ -22,6 +22,11 @@ func TestAppDefault(t *testing.T) {
 			defaultListenPort,
 			conf.ListenPort,
 		},
+		{
+			EnvPrefix + "METRICS_LISTEN_PORT",
+			defaultMetricsListenPort,
+			conf.MetricsListenPort,
+		},
 		{
 			EnvPrefix + "SIGNUP_TOKEN_EXPIRE",
 			defaultSignupTokenExpire,
@@ -32,11 +37,86 @@ func TestAppDefault(t *testing.T) {
 			defaultSessionTokenExpire,
 			conf.SessionTokenExpire,
 		},
+		{
+			EnvPrefix + "REFRESH_TOKEN_EXPIRE",
+			defaultRefreshTokenExpire,
+			conf.RefreshTokenExpire,
+		},
+		{
+			EnvPrefix + "AUTHORIZATION_CODE_EXPIRE",
+			defaultAuthorizationCodeExpire,
+			conf.AuthorizationCodeExpire,
+		},
+		{
+			EnvPrefix + "WEBAUTHN_CHALLENGE_EXPIRE",
+			defaultWebAuthnChallengeExpire,
+			conf.WebAuthnChallengeExpire,
+		},
+		{
+			EnvPrefix + "EMAIL_CODE_EXPIRE",
+			defaultEmailCodeExpire,
+			conf.EmailCodeExpire,
+		},
+		{
+			EnvPrefix + "EMAIL_CODE_MAX_ATTEMPTS",
+			defaultEmailCodeMaxAttempts,
+			conf.EmailCodeMaxAttempts,
+		},
+		{
+			EnvPrefix + "MAGIC_LINK_TOKEN_EXPIRE",
+			defaultMagicLinkTokenExpire,
+			conf.MagicLinkTokenExpire,
+		},
+		{
+			EnvPrefix + "SIGNIN_LOCK_DURATION",
+			defaultSigninLockDuration,
+			conf.SigninLockDuration,
+		},
+		{
+			EnvPrefix + "SIGNIN_MAX_DELAY",
+			defaultSigninMaxDelay,
+			conf.SigninMaxDelay,
+		},
+		{
+			EnvPrefix + "SIGNIN_FREE_FAILURES",
+			defaultSigninFreeFailures,
+			conf.SigninFreeFailures,
+		},
+		{
+			EnvPrefix + "SIGNIN_MAX_FAILURES",
+			defaultSigninMaxFailures,
+			conf.SigninMaxFailures,
+		},
+		{
+			EnvPrefix + "SIGNIN_FREE_FAILURES_PER_IP",
+			defaultSigninFreeFailuresPerIP,
+			conf.SigninFreeFailuresPerIP,
+		},
+		{
+			EnvPrefix + "SIGNIN_MAX_FAILURES_PER_IP",
+			defaultSigninMaxFailuresPerIP,
+			conf.SigninMaxFailuresPerIP,
+		},
+		{
+			EnvPrefix + "WEBAUTHN_RP_ID",
+			defaultWebAuthnRPID,
+			conf.WebAuthnRPID,
+		},
 		{
 			EnvPrefix + "JWT_SIGNIN_KEY",
 			defaultJWTSigninKey,
 			conf.JWTSigninKey,
 		},
+		{
+			EnvPrefix + "JWT_SIGNING_METHOD",
+			defaultJWTSigningMethod,
+			conf.JWTSigningMethod,
+		},
+		{
+			EnvPrefix + "JWT_PRIVATE_KEY_FILE",
+			"",
+			conf.JWTPrivateKeyFile,
+		},
 		{
 			EnvPrefix + "ORG",
 			defaultOrg,
@@ -76,8 +156,21 @@ func TestApp(t *testing.T) {
 		EnvPrefix + "LISTEN_PORT":                 "8080",
 		EnvPrefix + "SIGNUP_TOKEN_EXPIRE":         "3600",
 		EnvPrefix + "SESSION_TOKEN_EXPIRE":        "3600",
+		EnvPrefix + "REFRESH_TOKEN_EXPIRE":        "7200",
 		EnvPrefix + "RESET_PASSWORD_TOKEN_EXPIRE": "3600",
+		EnvPrefix + "AUTHORIZATION_CODE_EXPIRE":   "120",
+		EnvPrefix + "EMAIL_CODE_EXPIRE":           "600",
+		EnvPrefix + "EMAIL_CODE_MAX_ATTEMPTS":     "3",
+		EnvPrefix + "MAGIC_LINK_TOKEN_EXPIRE":     "300",
+		EnvPrefix + "SIGNIN_LOCK_DURATION":        "1800",
+		EnvPrefix + "SIGNIN_MAX_DELAY":            "30",
+		EnvPrefix + "SIGNIN_FREE_FAILURES":        "5",
+		EnvPrefix + "SIGNIN_MAX_FAILURES":         "20",
+		EnvPrefix + "SIGNIN_FREE_FAILURES_PER_IP": "50",
+		EnvPrefix + "SIGNIN_MAX_FAILURES_PER_IP":  "200",
 		EnvPrefix + "JWT_SIGNIN_KEY":              "testkey",
+		EnvPrefix + "JWT_SIGNING_METHOD":          "ES256",
+		EnvPrefix + "JWT_PRIVATE_KEY_FILE":        "/path/to/key.pem",
 		EnvPrefix + "ORG":                         "test org",
 		EnvPrefix + "SUPPORT_EMAIL":               "test.support@email.com",
 		EnvPrefix + "PAGE_SIZE":                   "50",
@@ -94,6 +187,8 @@ func TestApp(t *testing.T) {
 	assert.Equal(t, val, conf.ListenPort)
 
 	assert.Equal(t, data[EnvPrefix+"JWT_SIGNIN_KEY"], conf.JWTSigninKey)
+	assert.Equal(t, data[EnvPrefix+"JWT_SIGNING_METHOD"], conf.JWTSigningMethod)
+	assert.Equal(t, data[EnvPrefix+"JWT_PRIVATE_KEY_FILE"], conf.JWTPrivateKeyFile)
 
 	val, err = strconv.Atoi(data[EnvPrefix+"SIGNUP_TOKEN_EXPIRE"])
 	assert.NoError(t, err)
@@ -103,10 +198,54 @@ func TestApp(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, val, conf.SessionTokenExpire)
 
+	val, err = strconv.Atoi(data[EnvPrefix+"REFRESH_TOKEN_EXPIRE"])
+	assert.NoError(t, err)
+	assert.Equal(t, val, conf.RefreshTokenExpire)
+
 	val, err = strconv.Atoi(data[EnvPrefix+"RESET_PASSWORD_TOKEN_EXPIRE"])
 	assert.NoError(t, err)
 	assert.Equal(t, val, conf.ResetPasswordTokenExpire)
 
+	val, err = strconv.Atoi(data[EnvPrefix+"AUTHORIZATION_CODE_EXPIRE"])
+	assert.NoError(t, err)
+	assert.Equal(t, val, conf.AuthorizationCodeExpire)
+
+	val, err = strconv.Atoi(data[EnvPrefix+"EMAIL_CODE_EXPIRE"])
+	assert.NoError(t, err)
+	assert.Equal(t, val, conf.EmailCodeExpire)
+
+	val, err = strconv.Atoi(data[EnvPrefix+"EMAIL_CODE_MAX_ATTEMPTS"])
+	assert.NoError(t, err)
+	assert.Equal(t, val, conf.EmailCodeMaxAttempts)
+
+	val, err = strconv.Atoi(data[EnvPrefix+"MAGIC_LINK_TOKEN_EXPIRE"])
+	assert.NoError(t, err)
+	assert.Equal(t, val, conf.MagicLinkTokenExpire)
+
+	val, err = strconv.Atoi(data[EnvPrefix+"SIGNIN_LOCK_DURATION"])
+	assert.NoError(t, err)
+	assert.Equal(t, val, conf.SigninLockDuration)
+
+	val, err = strconv.Atoi(data[EnvPrefix+"SIGNIN_MAX_DELAY"])
+	assert.NoError(t, err)
+	assert.Equal(t, val, conf.SigninMaxDelay)
+
+	val, err = strconv.Atoi(data[EnvPrefix+"SIGNIN_FREE_FAILURES"])
+	assert.NoError(t, err)
+	assert.Equal(t, val, conf.SigninFreeFailures)
+
+	val, err = strconv.Atoi(data[EnvPrefix+"SIGNIN_MAX_FAILURES"])
+	assert.NoError(t, err)
+	assert.Equal(t, val, conf.SigninMaxFailures)
+
+	val, err = strconv.Atoi(data[EnvPrefix+"SIGNIN_FREE_FAILURES_PER_IP"])
+	assert.NoError(t, err)
+	assert.Equal(t, val, conf.SigninFreeFailuresPerIP)
+
+	val, err = strconv.Atoi(data[EnvPrefix+"SIGNIN_MAX_FAILURES_PER_IP"])
+	assert.NoError(t, err)
+	assert.Equal(t, val, conf.SigninMaxFailuresPerIP)
+
 	assert.Equal(t, data[EnvPrefix+"ORG"], conf.Org)
 
 	assert.Equal(t, data[EnvPrefix+"SUPPORT_EMAIL"], conf.SupportEmail)
@@ -118,6 +257,29 @@ func TestApp(t *testing.T) {
 	assert.Equal(t, val, conf.PageSizeLimit)
 }
 
+func TestIssuerURL(t *testing.T) {
+	conf := App()
+	expected := fmt.Sprintf(defaultIssuerURL, conf.ListenPort)
+	assert.Equal(t, expected, conf.IssuerURL())
+
+	os.Setenv(EnvPrefix+"ISSUER_URL", "https://auth.example.com/")
+	conf = App()
+	assert.Equal(t, "https://auth.example.com", conf.IssuerURL())
+	os.Unsetenv(EnvPrefix + "ISSUER_URL")
+}
+
+func TestWebAuthnOrigins(t *testing.T) {
+	conf := App()
+	expected := []string{fmt.Sprintf(defaultWebAuthnOrigins, conf.ListenPort)}
+	assert.Equal(t, expected, conf.WebAuthnOrigins())
+
+	os.Setenv(EnvPrefix+"WEBAUTHN_ORIGINS", "https://auth.example.com/ https://example.com")
+	conf = App()
+	expected = []string{"https://auth.example.com", "https://example.com"}
+	assert.Equal(t, expected, conf.WebAuthnOrigins())
+	os.Unsetenv(EnvPrefix + "WEBAUTHN_ORIGINS")
+}
+
 func TestSignupURL(t *testing.T) {
 	conf := App()
 	token := "testtoken"
@@ -144,3 +306,137 @@ func TestSignupURLWithSetEnv(t *testing.T) {
 		assert.Equal(t, v.Expected, url)
 	}
 }
+
+func TestResetPasswordURL(t *testing.T) {
+	conf := App()
+	token := "testtoken"
+	expected := fmt.Sprintf(defaultResetPasswordURL, conf.ListenPort, token)
+	url := conf.ResetPasswordURL(token)
+	assert.Equal(t, expected, url)
+}
+
+func TestResetPasswordURLWithSetEnv(t *testing.T) {
+	token := "testtoken"
+	table := []struct {
+		URL      string
+		Expected string
+	}{
+		{"", ""},
+		{"http://example.com/", "http://example.com/" + token},
+		{"http://example.com", "http://example.com/" + token},
+	}
+
+	for _, v := range table {
+		os.Setenv(EnvPrefix+"RESET_PASSWORD_URL", v.URL)
+		conf := App()
+		url := conf.ResetPasswordURL(token)
+		assert.Equal(t, v.Expected, url)
+	}
+	os.Unsetenv(EnvPrefix + "RESET_PASSWORD_URL")
+}
+
+func TestMagicLinkURL(t *testing.T) {
+	conf := App()
+	token := "testtoken"
+	expected := fmt.Sprintf(defaultMagicLinkURL, conf.ListenPort, token)
+	url := conf.MagicLinkURL(token)
+	assert.Equal(t, expected, url)
+}
+
+func TestMagicLinkURLWithSetEnv(t *testing.T) {
+	token := "testtoken"
+	table := []struct {
+		URL      string
+		Expected string
+	}{
+		{"", ""},
+		{"http://example.com/", "http://example.com/" + token},
+		{"http://example.com", "http://example.com/" + token},
+	}
+
+	for _, v := range table {
+		os.Setenv(EnvPrefix+"MAGIC_LINK_URL", v.URL)
+		conf := App()
+		url := conf.MagicLinkURL(token)
+		assert.Equal(t, v.Expected, url)
+	}
+	os.Unsetenv(EnvPrefix + "MAGIC_LINK_URL")
+}
+
+func TestSigninUnlockURL(t *testing.T) {
+	conf := App()
+	token := "testtoken"
+	expected := fmt.Sprintf(defaultSigninUnlockURL, conf.ListenPort, token)
+	url := conf.SigninUnlockURL(token)
+	assert.Equal(t, expected, url)
+}
+
+func TestSigninUnlockURLWithSetEnv(t *testing.T) {
+	token := "testtoken"
+	table := []struct {
+		URL      string
+		Expected string
+	}{
+		{"", ""},
+		{"http://example.com/", "http://example.com/" + token},
+		{"http://example.com", "http://example.com/" + token},
+	}
+
+	for _, v := range table {
+		os.Setenv(EnvPrefix+"SIGNIN_UNLOCK_URL", v.URL)
+		conf := App()
+		url := conf.SigninUnlockURL(token)
+		assert.Equal(t, v.Expected, url)
+	}
+	os.Unsetenv(EnvPrefix + "SIGNIN_UNLOCK_URL")
+}
+
+func TestLongestJWTExpire(t *testing.T) {
+	conf := AppConfig{
+		SignupTokenExpire:        1800,
+		SessionTokenExpire:       3600,
+		ResetPasswordTokenExpire: 600,
+		MagicLinkTokenExpire:     600,
+		SigninLockDuration:       900,
+	}
+	assert.Equal(t, 3600, conf.LongestJWTExpire())
+
+	conf.MagicLinkTokenExpire = 7200
+	assert.Equal(t, 7200, conf.LongestJWTExpire())
+
+	conf.SigninLockDuration = 86400
+	assert.Equal(t, 86400, conf.LongestJWTExpire())
+}
+
+func TestTrustedProxies(t *testing.T) {
+	assert.Empty(t, App().TrustedProxies())
+
+	os.Setenv(EnvPrefix+"TRUSTED_PROXIES", "10.0.0.1 10.1.0.0/16")
+	defer os.Unsetenv(EnvPrefix + "TRUSTED_PROXIES")
+	conf, err := app()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.1.0.0/16"}, conf.TrustedProxies())
+
+	os.Setenv(EnvPrefix+"TRUSTED_PROXIES", "10.0.0.1 proxy")
+	_, err = app()
+	assert.EqualError(t, err,
+		"configs.App: 'AUTH_TRUSTED_PROXIES' must be IP or CIDR, not 'proxy'")
+}
+
+func TestMetricsListenPort(t *testing.T) {
+	os.Setenv(EnvPrefix+"METRICS_LISTEN_PORT", "0")
+	defer os.Unsetenv(EnvPrefix + "METRICS_LISTEN_PORT")
+	conf, err := app()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, conf.MetricsListenPort)
+
+	os.Setenv(EnvPrefix+"METRICS_LISTEN_PORT", strconv.Itoa(conf.ListenPort))
+	_, err = app()
+	assert.EqualError(t, err,
+		"configs.App: 'AUTH_METRICS_LISTEN_PORT' must not be the same as 'AUTH_LISTEN_PORT'")
+
+	os.Setenv(EnvPrefix+"METRICS_LISTEN_PORT", "-1")
+	_, err = app()
+	assert.EqualError(t, err,
+		"configs.App: 'AUTH_METRICS_LISTEN_PORT' must be between 0 and 65535")
+}
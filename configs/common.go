@@ -1,15 +1,21 @@
 package configs
 
 import (
-	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 // EnvPrefix is prefix of environment variables to be used in the application.
 const EnvPrefix = "AUTH_"
 
-// EnvError is an error type returned when a required environment variable is not set.
+// secretFileSuffix is suffix of environment variable for the file having the secret.
+const secretFileSuffix = "_FILE"
+
+// EnvError is an error type returned when a required value is not set or a value is invalid.
 type EnvError struct {
 	Func string
 	Err  error
@@ -19,8 +25,132 @@ func (e *EnvError) Error() string {
 	return "configs." + e.Func + ": " + e.Err.Error()
 }
 
-func missingRequirementError(fn string, missed []string) *EnvError {
+// Errors is a list of errors reported at once.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// envError returns an error having all errors of the function, or nil if none.
+func envError(fn string, errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return &EnvError{fn, errs[0]}
+	}
+	return &EnvError{fn, Errors(errs)}
+}
+
+func missingRequirement(missed []string) error {
 	const errMessage = "must set '%s' environment variable"
-	err := fmt.Sprintf(errMessage, strings.Join(missed, ", "))
-	return &EnvError{fn, errors.New(err)}
+	return fmt.Errorf(errMessage, strings.Join(missed, ", "))
+}
+
+func missingRequirementError(fn string, missed []string) *EnvError {
+	return &EnvError{fn, missingRequirement(missed)}
+}
+
+// lookup returns the value of the variable.
+// Environment variable overrides the value of the config file.
+func lookup(name string) (string, bool) {
+	v, ok := lookupFile(name)
+	if env, okEnv := os.LookupEnv(name); okEnv {
+		return env, true
+	}
+	return v, ok
+}
+
+// setValues sets values of the variables to the pointers by type of the pointer.
+// Values not able to be parsed do not change the pointers, they are returned as errors.
+func setValues(vars map[string]interface{}) []error {
+	names := make([]string, 0, len(vars))
+	for k := range vars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, k := range names {
+		v, ok := lookup(k)
+		if !ok {
+			continue
+		}
+
+		switch pt := vars[k].(type) {
+		case *string:
+			*pt = v
+		case *int:
+			i, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("'%s' must be an integer, not '%s'", k, v))
+				continue
+			}
+			*pt = i
+		case *bool:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("'%s' must be a boolean, not '%s'", k, v))
+				continue
+			}
+			*pt = b
+		}
+	}
+	return errs
+}
+
+// setSecret sets the value of the variable, or content of the file
+// named by the variable with '_FILE' suffix, to the pointer.
+// Environment variables override the config file,
+// and setting both of them in the same place is an error.
+func setSecret(name string, p *string) error {
+	fileName := name + secretFileSuffix
+	type source struct {
+		value, path       string
+		hasValue, hasPath bool
+	}
+	var env, file source
+	env.value, env.hasValue = os.LookupEnv(name)
+	env.path, env.hasPath = os.LookupEnv(fileName)
+	file.value, file.hasValue = lookupFile(name)
+	file.path, file.hasPath = lookupFile(fileName)
+
+	for _, src := range []source{env, file} {
+		if src.hasValue && src.hasPath {
+			return fmt.Errorf("must set only one of '%s' and '%s'", name, fileName)
+		}
+		if src.hasPath {
+			b, err := ioutil.ReadFile(strings.TrimSpace(src.path))
+			if err != nil {
+				return fmt.Errorf("'%s': %w", fileName, err)
+			}
+			*p = strings.TrimRight(string(b), "\r\n")
+			return nil
+		}
+		if src.hasValue {
+			*p = src.value
+			return nil
+		}
+	}
+	return nil
+}
+
+// checkPositive returns an error for each variable whose value is not positive.
+func checkPositive(vars map[string]int) []error {
+	names := make([]string, 0, len(vars))
+	for k, v := range vars {
+		if v < 1 {
+			names = append(names, k)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	return []error{fmt.Errorf("'%s' must be positive", strings.Join(names, ", "))}
 }
@@ -2,6 +2,9 @@ package configs
 
 import (
 	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -14,3 +17,46 @@ func TestEnvError(t *testing.T) {
 	err := &EnvError{fnTest, errors.New(errMessage)}
 	assert.Equal(t, expected, err.Error())
 }
+
+func TestSetSecret(t *testing.T) {
+	const name = EnvPrefix + "TEST_SECRET"
+	path := filepath.Join(t.TempDir(), "secret")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("filesecret\n"), 0600))
+
+	secret := "default"
+	assert.NoError(t, setSecret(name, &secret))
+	assert.Equal(t, "default", secret)
+
+	os.Setenv(name+"_FILE", path)
+	defer os.Unsetenv(name + "_FILE")
+	assert.NoError(t, setSecret(name, &secret))
+	assert.Equal(t, "filesecret", secret)
+
+	os.Setenv(name, "envsecret")
+	defer os.Unsetenv(name)
+	assert.EqualError(t, setSecret(name, &secret),
+		"must set only one of 'AUTH_TEST_SECRET' and 'AUTH_TEST_SECRET_FILE'")
+
+	os.Unsetenv(name)
+	os.Setenv(name+"_FILE", path+".missing")
+	assert.Error(t, setSecret(name, &secret))
+	assert.Equal(t, "filesecret", secret)
+}
+
+func TestSetValues(t *testing.T) {
+	os.Setenv(EnvPrefix+"TEST_INT", "1a")
+	defer os.Unsetenv(EnvPrefix + "TEST_INT")
+	os.Setenv(EnvPrefix+"TEST_BOOL", "yes")
+	defer os.Unsetenv(EnvPrefix + "TEST_BOOL")
+
+	i, b := 3, true
+	errs := setValues(map[string]interface{}{
+		EnvPrefix + "TEST_INT":  &i,
+		EnvPrefix + "TEST_BOOL": &b,
+	})
+	assert.EqualError(t, Errors(errs),
+		"'AUTH_TEST_BOOL' must be a boolean, not 'yes'; "+
+			"'AUTH_TEST_INT' must be an integer, not '1a'")
+	assert.Equal(t, 3, i)
+	assert.True(t, b)
+}
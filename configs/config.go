@@ -0,0 +1,243 @@
+package configs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// EnvConfigFile indicates environment name for path of the config file.
+// The file is YAML or TOML decided by the extension.
+const EnvConfigFile = EnvPrefix + "CONFIG_FILE"
+
+// Config contains all values of the application, it is built once by 'Load'.
+// Values are returned as copies, so they can not be changed after loaded.
+type Config struct {
+	app       AppConfig
+	db        DatabaseConfig
+	rateLimit RateLimitConfig
+	event     EventConfig
+	webhook   WebhookConfig
+	trace     TraceConfig
+	health    HealthConfig
+}
+
+// App .
+func (c *Config) App() *AppConfig {
+	v := c.app
+	return &v
+}
+
+// DB .
+func (c *Config) DB() *DatabaseConfig {
+	v := c.db
+	return &v
+}
+
+// RateLimit .
+func (c *Config) RateLimit() *RateLimitConfig {
+	v := c.rateLimit
+	return &v
+}
+
+// Event .
+func (c *Config) Event() *EventConfig {
+	v := c.event
+	return &v
+}
+
+// Webhook .
+func (c *Config) Webhook() *WebhookConfig {
+	v := c.webhook
+	return &v
+}
+
+// Trace .
+func (c *Config) Trace() *TraceConfig {
+	v := c.trace
+	return &v
+}
+
+// Health .
+func (c *Config) Health() *HealthConfig {
+	v := c.health
+	return &v
+}
+
+// loaded is the config built by 'Load' and values of the config file.
+// Names of variables looked up in the file are recorded, the others are unknown.
+var loaded = struct {
+	sync.RWMutex
+	config *Config
+	file   map[string]string
+	used   map[string]bool
+}{}
+
+func loadedConfig() *Config {
+	loaded.RLock()
+	defer loaded.RUnlock()
+	return loaded.config
+}
+
+func lookupFile(name string) (string, bool) {
+	loaded.Lock()
+	defer loaded.Unlock()
+	if loaded.used != nil {
+		loaded.used[name] = true
+	}
+	v, ok := loaded.file[name]
+	return v, ok
+}
+
+// Load builds the config from the config file and environment variables,
+// environment variable overrides the same value of the file.
+// All invalid values are reported at once, and default secrets are refused in release mode.
+// After loaded, functions of each section like 'App' and 'DB' return the loaded values.
+func Load() (*Config, error) {
+	const fnLoad = "Load"
+	file := map[string]string{}
+	if path, ok := os.LookupEnv(EnvConfigFile); ok && path != "" {
+		var err error
+		if file, err = readConfigFile(path); err != nil {
+			return nil, &EnvError{fnLoad, err}
+		}
+	}
+
+	loaded.Lock()
+	loaded.config = nil
+	loaded.file = file
+	loaded.used = map[string]bool{}
+	loaded.Unlock()
+
+	var errs Errors
+	if v, ok := lookup(EnvMode); ok {
+		switch v {
+		case DebugMode, ReleaseMode, TestMode, "":
+			SetMode(v)
+		default:
+			errs = append(errs, &EnvError{fnLoad, fmt.Errorf("unknown mode '%s'", v)})
+		}
+	}
+
+	conf := Config{}
+	// 잘못된 값이 있어도 App 은 만들어지므로 다른 값도 모두 확인한다.
+	appConf, err := app()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	conf.app = *appConf
+
+	if db, err := DB(); err != nil {
+		errs = append(errs, err)
+	} else {
+		conf.db = *db
+	}
+	if rateLimit, err := RateLimit(); err != nil {
+		errs = append(errs, err)
+	} else {
+		conf.rateLimit = *rateLimit
+	}
+	if event, err := Event(); err != nil {
+		errs = append(errs, err)
+	} else {
+		conf.event = *event
+	}
+	if webhook, err := Webhook(); err != nil {
+		errs = append(errs, err)
+	} else {
+		conf.webhook = *webhook
+	}
+	if trace, err := Trace(); err != nil {
+		errs = append(errs, err)
+	} else {
+		conf.trace = *trace
+	}
+	if health, err := Health(); err != nil {
+		errs = append(errs, err)
+	} else {
+		conf.health = *health
+	}
+
+	loaded.Lock()
+	defer loaded.Unlock()
+	var unknown []string
+	for k := range loaded.file {
+		if !loaded.used[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		err := fmt.Errorf("unknown '%s' in config file", strings.Join(unknown, ", "))
+		errs = append(errs, &EnvError{fnLoad, err})
+	}
+
+	if len(errs) > 0 {
+		loaded.file = nil
+		loaded.used = nil
+		return nil, errs
+	}
+	loaded.config = &conf
+	return &conf, nil
+}
+
+// readConfigFile returns values of the file with names of environment variables.
+// Nested keys are joined by '_', so 'db: {name: auth}' is 'AUTH_DB_NAME',
+// and lists are joined by space.
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &values)
+	case ".toml":
+		err = toml.Unmarshal(b, &values)
+	default:
+		return nil, fmt.Errorf("unknown config file format '%s'", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file '%s': %w", path, err)
+	}
+
+	file := map[string]string{}
+	flatten(strings.TrimSuffix(EnvPrefix, "_"), values, file)
+	return file, nil
+}
+
+func flatten(name string, value interface{}, file map[string]string) {
+	key := func(k interface{}) string {
+		return name + "_" + strings.ToUpper(strings.ReplaceAll(fmt.Sprint(k), "-", "_"))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			flatten(key(k), item, file)
+		}
+	case map[interface{}]interface{}:
+		for k, item := range v {
+			flatten(key(k), item, file)
+		}
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		file[name] = strings.Join(items, " ")
+	case nil:
+		file[name] = ""
+	default:
+		file[name] = fmt.Sprint(v)
+	}
+}
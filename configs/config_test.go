@@ -0,0 +1,160 @@
+package configs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func unload() {
+	loaded.Lock()
+	defer loaded.Unlock()
+	loaded.config = nil
+	loaded.file = nil
+	loaded.used = nil
+}
+
+func writeFileForTest(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadWithYAMLFile(t *testing.T) {
+	defer unload()
+	pwFile := writeFileForTest(t, "db_pw", "secretpw\n")
+	path := writeFileForTest(t, "auth.yaml", `
+listen_port: 8081
+webauthn_origins:
+  - https://a.example.com
+  - https://b.example.com
+db:
+  driver: sqlite3
+  name: /tmp/auth
+  pw_file: `+pwFile+`
+  max_open_conns: 7
+webhook:
+  timeout: 3
+`)
+	os.Setenv(EnvConfigFile, path)
+	defer os.Unsetenv(EnvConfigFile)
+	// 환경 변수가 파일보다 우선한다.
+	os.Setenv(EnvPrefix+"WEBHOOK_TIMEOUT", "4")
+	defer os.Unsetenv(EnvPrefix + "WEBHOOK_TIMEOUT")
+	for _, k := range []string{"DB_DRIVER", "DB_NAME", "DB_PW", "LISTEN_PORT"} {
+		os.Unsetenv(EnvPrefix + k)
+	}
+
+	conf, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, 8081, conf.App().ListenPort)
+	assert.Equal(t,
+		[]string{"https://a.example.com", "https://b.example.com"},
+		conf.App().WebAuthnOrigins())
+	assert.Equal(t, DBDriverSQLite, conf.DB().Driver)
+	assert.Equal(t, "secretpw", conf.DB().pw)
+	assert.Equal(t, 7, conf.DB().MaxOpenConns)
+	assert.Equal(t, 4, conf.Webhook().Timeout)
+
+	// 한 번 만든 설정은 바뀌지 않는다.
+	App().ListenPort = 1
+	os.Setenv(EnvPrefix+"LISTEN_PORT", "8082")
+	defer os.Unsetenv(EnvPrefix + "LISTEN_PORT")
+	assert.Equal(t, 8081, App().ListenPort)
+	dbConf, err := DB()
+	assert.NoError(t, err)
+	assert.Equal(t, 7, dbConf.MaxOpenConns)
+}
+
+func TestLoadWithTOMLFile(t *testing.T) {
+	defer unload()
+	path := writeFileForTest(t, "auth.toml", `
+org = "toml org"
+
+[db]
+driver = "sqlite3"
+name = "/tmp/auth"
+echo = true
+`)
+	os.Setenv(EnvConfigFile, path)
+	defer os.Unsetenv(EnvConfigFile)
+	for _, k := range []string{"DB_DRIVER", "DB_NAME", "DB_ECHO", "ORG"} {
+		os.Unsetenv(EnvPrefix + k)
+	}
+
+	conf, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "toml org", conf.App().Org)
+	assert.Equal(t, DBDriverSQLite, conf.DB().Driver)
+	assert.True(t, conf.DB().Echo)
+}
+
+func TestLoadWithErrors(t *testing.T) {
+	defer unload()
+	path := writeFileForTest(t, "auth.yml", `
+listen_port: port
+signup_token_expire: 0
+unknown_key: 1
+db:
+  driver: sqlite3
+  name: ""
+event:
+  sink: rabbitmq
+`)
+	os.Setenv(EnvConfigFile, path)
+	defer os.Unsetenv(EnvConfigFile)
+	for _, k := range []string{"DB_DRIVER", "DB_NAME", "EVENT_SINK", "LISTEN_PORT", "SIGNUP_TOKEN_EXPIRE"} {
+		os.Unsetenv(EnvPrefix + k)
+	}
+
+	// 모든 잘못된 값을 한 번에 알린다.
+	conf, err := Load()
+	assert.Nil(t, conf)
+	assert.EqualError(t, err,
+		"configs.App: 'AUTH_LISTEN_PORT' must be an integer, not 'port'; "+
+			"'AUTH_SIGNUP_TOKEN_EXPIRE' must be positive; "+
+			"configs.DB: must set 'AUTH_DB_NAME' environment variable; "+
+			"configs.Event: unknown event sink 'rabbitmq'; "+
+			"configs.Load: unknown 'AUTH_UNKNOWN_KEY' in config file")
+
+	// 불러오지 못하면 환경 변수로 만든다.
+	assert.Equal(t, defaultListenPort, App().ListenPort)
+}
+
+func TestLoadWithUnknownFormat(t *testing.T) {
+	path := writeFileForTest(t, "auth.json", "{}")
+	os.Setenv(EnvConfigFile, path)
+	defer os.Unsetenv(EnvConfigFile)
+
+	conf, err := Load()
+	assert.Nil(t, conf)
+	assert.EqualError(t, err, "configs.Load: unknown config file format '"+path+"'")
+}
+
+func TestLoadWithDefaultSecret(t *testing.T) {
+	defer unload()
+	os.Setenv(EnvPrefix+"DB_DRIVER", "sqlite3")
+	defer os.Unsetenv(EnvPrefix + "DB_DRIVER")
+	os.Setenv(EnvPrefix+"DB_NAME", "/tmp/auth")
+	os.Unsetenv(EnvPrefix + "JWT_SIGNIN_KEY")
+	os.Unsetenv(EnvPrefix + "JWT_PRIVATE_KEY_FILE")
+
+	defer SetMode(TestMode)
+	for _, mode := range []string{ReleaseMode, DebugMode} {
+		SetMode(mode)
+		conf, err := Load()
+		assert.Nil(t, conf)
+		assert.EqualError(t, err,
+			"configs.App: default 'AUTH_JWT_SIGNIN_KEY' must not be used")
+	}
+
+	keyFile := writeFileForTest(t, "jwt_key", "releasekey\n")
+	os.Setenv(EnvPrefix+"JWT_SIGNIN_KEY_FILE", keyFile)
+	defer os.Unsetenv(EnvPrefix + "JWT_SIGNIN_KEY_FILE")
+	conf, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "releasekey", conf.App().JWTSigninKey)
+}
@@ -1,23 +1,53 @@
 package configs
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"strings"
+	"time"
+)
+
+// Drivers of database, they are dialect names of gorm.
+// MariaDB uses 'mysql' driver.
+const (
+	DBDriverMySQL    = "mysql"
+	DBDriverPostgres = "postgres"
+	DBDriverSQLite   = "sqlite3"
 )
 
 const (
 	dbConOpt = "charset=utf8mb4&parseTime=True&loc=Local&timeout=1s"
 	dbConStr = "%s:%s@(%s:%s)/%s?%s"
+
+	postgresConOpt = "connect_timeout=1"
+	postgresConStr = "host=%s port=%s user=%s password=%s dbname=%s sslmode=%s %s"
+
+	// 트랜잭션 시작 시 쓰기 잠금을 잡아야 동시에 쓸 때 바로 실패하지 않는다.
+	sqliteConOpt = "_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate&_loc=auto"
+	sqliteConStr = "file:%s.db?%s"
 )
 
 const (
-	defaultDBHost = "127.0.0.1"
-	defaultDBPort = "3306"
+	defaultDBDriver        = DBDriverMySQL
+	defaultDBHost          = "127.0.0.1"
+	defaultDBPort          = "3306"
+	defaultPostgresPort    = "5432"
+	defaultPostgresSSLMode = "disable"
+
+	defaultDBMaxOpenConns    = 25
+	defaultDBMaxIdleConns    = 25
+	defaultDBConnMaxLifetime = 300
+	defaultDBConnMaxIdleTime = 60
 )
 
 // DatabaseConfig contains values for database access.
+// For SQLite, 'DB_NAME' is path of the database file without '.db' extension,
+// and id, password, host and port are not used.
+// Pool values are passed to 'sql.DB', zero means unlimited,
+// and lifetimes are in seconds.
 type DatabaseConfig struct {
+	Driver     string
+	sslMode    string
 	id         string
 	pw         string
 	name       string
@@ -25,6 +55,21 @@ type DatabaseConfig struct {
 	port       string
 	Echo       bool
 	SyncModels bool
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime int
+	ConnMaxIdleTime int
+}
+
+// ConnMaxLifetimeDuration .
+func (c *DatabaseConfig) ConnMaxLifetimeDuration() time.Duration {
+	return time.Second * time.Duration(c.ConnMaxLifetime)
+}
+
+// ConnMaxIdleTimeDuration .
+func (c *DatabaseConfig) ConnMaxIdleTimeDuration() time.Duration {
+	return time.Second * time.Duration(c.ConnMaxIdleTime)
 }
 
 // DBName is returns database name to be used in the current application.
@@ -35,60 +80,107 @@ func (c *DatabaseConfig) DBName() string {
 	return c.name
 }
 
-// DSN is returns database source name.
+// DSN is returns database source name for the driver.
 func (c *DatabaseConfig) DSN() string {
+	switch c.Driver {
+	case DBDriverPostgres:
+		return fmt.Sprintf(
+			postgresConStr, c.host, c.port, c.id, c.pw, c.DBName(), c.sslMode, postgresConOpt)
+	case DBDriverSQLite:
+		return fmt.Sprintf(sqliteConStr, c.DBName(), sqliteConOpt)
+	}
 	return fmt.Sprintf(
 		dbConStr, c.id, c.pw, c.host, c.port, c.DBName(), dbConOpt)
 }
 
 // DB returns the values needed to access the database.
-// If required value constraint is not met, an error is returned.
+// If the driver is unknown or required value constraint is not met, an error is returned.
+// The password can be read from the file named by 'DB_PW_FILE'.
+// After 'Load', the loaded values are returned.
 func DB() (*DatabaseConfig, error) {
+	if c := loadedConfig(); c != nil {
+		return c.DB(), nil
+	}
+
 	const fnDB = "DB"
 	conf := DatabaseConfig{
-		host: defaultDBHost,
-		port: defaultDBPort,
+		Driver:  defaultDBDriver,
+		sslMode: defaultPostgresSSLMode,
+		host:    defaultDBHost,
+
+		MaxOpenConns:    defaultDBMaxOpenConns,
+		MaxIdleConns:    defaultDBMaxIdleConns,
+		ConnMaxLifetime: defaultDBConnMaxLifetime,
+		ConnMaxIdleTime: defaultDBConnMaxIdleTime,
+	}
+
+	errs := setValues(map[string]interface{}{
+		EnvPrefix + "DB_DRIVER":             &conf.Driver,
+		EnvPrefix + "DB_ID":                 &conf.id,
+		EnvPrefix + "DB_NAME":               &conf.name,
+		EnvPrefix + "DB_HOST":               &conf.host,
+		EnvPrefix + "DB_PORT":               &conf.port,
+		EnvPrefix + "DB_SSL_MODE":           &conf.sslMode,
+		EnvPrefix + "DB_ECHO":               &conf.Echo,
+		EnvPrefix + "DB_SYNC_MODELS":        &conf.SyncModels,
+		EnvPrefix + "DB_MAX_OPEN_CONNS":     &conf.MaxOpenConns,
+		EnvPrefix + "DB_MAX_IDLE_CONNS":     &conf.MaxIdleConns,
+		EnvPrefix + "DB_CONN_MAX_LIFETIME":  &conf.ConnMaxLifetime,
+		EnvPrefix + "DB_CONN_MAX_IDLE_TIME": &conf.ConnMaxIdleTime,
+	})
+	if err := setSecret(EnvPrefix+"DB_PW", &conf.pw); err != nil {
+		errs = append(errs, err)
+	}
+
+	conf.Driver = strings.ToLower(strings.TrimSpace(conf.Driver))
+	if conf.Driver == "" {
+		conf.Driver = defaultDBDriver
 	}
 
 	required := []struct {
 		EnvName string
-		ConfRef *string
+		Value   *string
 	}{
 		{EnvPrefix + "DB_ID", &conf.id},
 		{EnvPrefix + "DB_PW", &conf.pw},
 		{EnvPrefix + "DB_NAME", &conf.name},
 	}
 
-	missed := make([]string, 0, len(required))
+	// 드라이버를 모르면 어떤 값이 필요한지도 알 수 없다.
+	switch conf.Driver {
+	case DBDriverMySQL:
+	case DBDriverSQLite:
+		required = required[2:]
+	case DBDriverPostgres:
+		if conf.port == "" {
+			conf.port = defaultPostgresPort
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown db driver '%s'", conf.Driver))
+		required = nil
+	}
+	if conf.port == "" {
+		conf.port = defaultDBPort
+	}
+
+	missed := []string{}
 	for _, item := range required {
-		missed = append(missed, item.EnvName)
-		if v, ok := os.LookupEnv(item.EnvName); ok {
-			v = strings.TrimSpace(v)
-			if v != "" {
-				*item.ConfRef = v
-				missed = missed[:len(missed)-1]
-			}
+		*item.Value = strings.TrimSpace(*item.Value)
+		if *item.Value == "" {
+			missed = append(missed, item.EnvName)
 		}
 	}
 	if len(missed) > 0 {
-		return nil, missingRequirementError(fnDB, missed)
+		errs = append(errs, missingRequirement(missed))
 	}
 
-	for k, p := range map[string]interface{}{
-		EnvPrefix + "DB_HOST":        &conf.host,
-		EnvPrefix + "DB_PORT":        &conf.port,
-		EnvPrefix + "DB_ECHO":        &conf.Echo,
-		EnvPrefix + "DB_SYNC_MODELS": &conf.SyncModels,
-	} {
-		if v, ok := os.LookupEnv(k); ok {
-			switch pt := p.(type) {
-			case *string:
-				*pt = v
-			case *bool:
-				*pt = (v == "1" || strings.ToLower(v) == "true")
-			}
-		}
+	if conf.MaxOpenConns < 0 || conf.MaxIdleConns < 0 ||
+		conf.ConnMaxLifetime < 0 || conf.ConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("db pool values must not be negative"))
 	}
 
+	if err := envError(fnDB, errs); err != nil {
+		return nil, err
+	}
 	return &conf, nil
 }
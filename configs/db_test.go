@@ -3,6 +3,7 @@ package configs
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -13,6 +14,7 @@ func init() {
 
 func TestDB(t *testing.T) {
 	for k, v := range map[string]string{
+		EnvPrefix + "DB_DRIVER":      "mysql",
 		EnvPrefix + "DB_ID":          "test_db_id",
 		EnvPrefix + "DB_PW":          "test_db_pw",
 		EnvPrefix + "DB_NAME":        "test_db_name",
@@ -42,6 +44,7 @@ func TestDBWithDebugMode(t *testing.T) {
 	SetMode(DebugMode)
 
 	for k, v := range map[string]string{
+		EnvPrefix + "DB_DRIVER":      "mysql",
 		EnvPrefix + "DB_ID":          "test_db_id",
 		EnvPrefix + "DB_PW":          "test_db_pw",
 		EnvPrefix + "DB_NAME":        "test_db_name",
@@ -79,6 +82,7 @@ func TestDBWithMissingRequirement(t *testing.T) {
 	for _, v := range missed {
 		os.Setenv(v, "")
 	}
+	os.Setenv(EnvPrefix+"DB_DRIVER", "mysql")
 
 	conf, err := DB()
 	assert.Nil(t, conf)
@@ -86,3 +90,103 @@ func TestDBWithMissingRequirement(t *testing.T) {
 	expected := missingRequirementError("DB", missed)
 	assert.Equal(t, expected, err)
 }
+
+func TestDBWithPostgres(t *testing.T) {
+	for k, v := range map[string]string{
+		EnvPrefix + "DB_DRIVER": "postgres",
+		EnvPrefix + "DB_ID":     "test_db_id",
+		EnvPrefix + "DB_PW":     "test_db_pw",
+		EnvPrefix + "DB_NAME":   "test_db_name",
+		EnvPrefix + "DB_HOST":   "127.0.0.1",
+	} {
+		os.Setenv(k, v)
+	}
+	defer os.Unsetenv(EnvPrefix + "DB_DRIVER")
+	os.Unsetenv(EnvPrefix + "DB_PORT")
+
+	conf, err := DB()
+	assert.NoError(t, err)
+	assert.Equal(t, DBDriverPostgres, conf.Driver)
+
+	expected := "host=127.0.0.1 port=5432 user=test_db_id password=test_db_pw " +
+		"dbname=test_db_name_test sslmode=disable " + postgresConOpt
+	assert.Equal(t, expected, conf.DSN())
+
+	os.Setenv(EnvPrefix+"DB_SSL_MODE", "require")
+	defer os.Unsetenv(EnvPrefix + "DB_SSL_MODE")
+	conf, err = DB()
+	assert.NoError(t, err)
+	assert.Contains(t, conf.DSN(), "sslmode=require")
+}
+
+func TestDBWithSQLite(t *testing.T) {
+	os.Setenv(EnvPrefix+"DB_DRIVER", "sqlite3")
+	defer os.Unsetenv(EnvPrefix + "DB_DRIVER")
+	os.Setenv(EnvPrefix+"DB_NAME", "/tmp/auth")
+
+	// 파일 경로만 있으면 된다.
+	for _, k := range []string{EnvPrefix + "DB_ID", EnvPrefix + "DB_PW"} {
+		os.Setenv(k, "")
+	}
+
+	conf, err := DB()
+	assert.NoError(t, err)
+	assert.Equal(t, DBDriverSQLite, conf.Driver)
+	assert.Equal(t, "file:/tmp/auth_test.db?"+sqliteConOpt, conf.DSN())
+
+	os.Setenv(EnvPrefix+"DB_NAME", "")
+	conf, err = DB()
+	assert.Nil(t, conf)
+	assert.Equal(t, missingRequirementError("DB", []string{EnvPrefix + "DB_NAME"}), err)
+}
+
+func TestDBWithUnknownDriver(t *testing.T) {
+	os.Setenv(EnvPrefix+"DB_DRIVER", "oracle")
+	defer os.Unsetenv(EnvPrefix + "DB_DRIVER")
+
+	conf, err := DB()
+	assert.Nil(t, conf)
+	assert.EqualError(t, err, "configs.DB: unknown db driver 'oracle'")
+}
+
+func TestDBPoolDefault(t *testing.T) {
+	os.Setenv(EnvPrefix+"DB_DRIVER", "sqlite3")
+	defer os.Unsetenv(EnvPrefix + "DB_DRIVER")
+	os.Setenv(EnvPrefix+"DB_NAME", "/tmp/auth")
+
+	conf, err := DB()
+	assert.NoError(t, err)
+	assert.Equal(t, defaultDBMaxOpenConns, conf.MaxOpenConns)
+	assert.Equal(t, defaultDBMaxIdleConns, conf.MaxIdleConns)
+	assert.Equal(t, 300*time.Second, conf.ConnMaxLifetimeDuration())
+	assert.Equal(t, time.Minute, conf.ConnMaxIdleTimeDuration())
+}
+
+func TestDBPool(t *testing.T) {
+	os.Setenv(EnvPrefix+"DB_DRIVER", "sqlite3")
+	defer os.Unsetenv(EnvPrefix + "DB_DRIVER")
+	os.Setenv(EnvPrefix+"DB_NAME", "/tmp/auth")
+
+	envs := map[string]string{
+		EnvPrefix + "DB_MAX_OPEN_CONNS":     "10",
+		EnvPrefix + "DB_MAX_IDLE_CONNS":     "5",
+		EnvPrefix + "DB_CONN_MAX_LIFETIME":  "0",
+		EnvPrefix + "DB_CONN_MAX_IDLE_TIME": "30",
+	}
+	for k, v := range envs {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	conf, err := DB()
+	assert.NoError(t, err)
+	assert.Equal(t, 10, conf.MaxOpenConns)
+	assert.Equal(t, 5, conf.MaxIdleConns)
+	assert.Equal(t, time.Duration(0), conf.ConnMaxLifetimeDuration())
+	assert.Equal(t, 30*time.Second, conf.ConnMaxIdleTimeDuration())
+
+	os.Setenv(EnvPrefix+"DB_MAX_IDLE_CONNS", "-1")
+	conf, err = DB()
+	assert.Nil(t, conf)
+	assert.EqualError(t, err, "configs.DB: db pool values must not be negative")
+}
@@ -0,0 +1,107 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Sinks to publish domain events to.
+const (
+	EventFileSink  = "file"
+	EventKafkaSink = "kafka"
+	EventNATSSink  = "nats"
+)
+
+const (
+	defaultEventSink           = EventFileSink
+	defaultKafkaAddr           = "127.0.0.1:9092"
+	defaultKafkaTopic          = "auth-events"
+	defaultNATSAddr            = "127.0.0.1:4222"
+	defaultNATSSubjectPrefix   = "auth."
+	defaultEventRelayInterval  = 1
+	defaultEventRelayBatchSize = 100
+)
+
+// EventConfig contains values for relaying domain events in outbox to the sink.
+// Events are written to stdout as JSON lines unless 'Sink' or 'File' is set.
+type EventConfig struct {
+	Sink              string
+	File              string
+	KafkaAddr         string
+	KafkaTopic        string
+	KafkaPartition    int
+	NATSAddr          string
+	NATSSubjectPrefix string
+	NATSToken         string
+	// RelayInterval is seconds to wait when there is no event to relay.
+	RelayInterval  int
+	RelayBatchSize int
+}
+
+// KafkaBrokers returns addresses of brokers to look up the cluster.
+// 'KafkaAddr' is space separated list of host:port.
+func (c *EventConfig) KafkaBrokers() []string {
+	return strings.Fields(c.KafkaAddr)
+}
+
+// RelayIntervalDuration .
+func (c *EventConfig) RelayIntervalDuration() time.Duration {
+	return time.Second * time.Duration(c.RelayInterval)
+}
+
+// Event returns the values needed to relay domain events.
+// If the sink is unknown or relay values are not positive, an error is returned.
+// The nats token can be read from the file named by 'NATS_TOKEN_FILE'.
+// After 'Load', the loaded values are returned.
+func Event() (*EventConfig, error) {
+	if c := loadedConfig(); c != nil {
+		return c.Event(), nil
+	}
+
+	const fnEvent = "Event"
+	conf := EventConfig{
+		Sink:              defaultEventSink,
+		KafkaAddr:         defaultKafkaAddr,
+		KafkaTopic:        defaultKafkaTopic,
+		NATSAddr:          defaultNATSAddr,
+		NATSSubjectPrefix: defaultNATSSubjectPrefix,
+		RelayInterval:     defaultEventRelayInterval,
+		RelayBatchSize:    defaultEventRelayBatchSize,
+	}
+
+	errs := setValues(map[string]interface{}{
+		EnvPrefix + "EVENT_SINK":             &conf.Sink,
+		EnvPrefix + "EVENT_FILE":             &conf.File,
+		EnvPrefix + "KAFKA_ADDR":             &conf.KafkaAddr,
+		EnvPrefix + "KAFKA_TOPIC":            &conf.KafkaTopic,
+		EnvPrefix + "KAFKA_PARTITION":        &conf.KafkaPartition,
+		EnvPrefix + "NATS_ADDR":              &conf.NATSAddr,
+		EnvPrefix + "NATS_SUBJECT_PREFIX":    &conf.NATSSubjectPrefix,
+		EnvPrefix + "EVENT_RELAY_INTERVAL":   &conf.RelayInterval,
+		EnvPrefix + "EVENT_RELAY_BATCH_SIZE": &conf.RelayBatchSize,
+	})
+	if err := setSecret(EnvPrefix+"NATS_TOKEN", &conf.NATSToken); err != nil {
+		errs = append(errs, err)
+	}
+
+	switch conf.Sink {
+	case EventFileSink, EventKafkaSink, EventNATSSink:
+	default:
+		errs = append(errs, fmt.Errorf("unknown event sink '%s'", conf.Sink))
+	}
+
+	if conf.Sink == EventKafkaSink && len(conf.KafkaBrokers()) == 0 {
+		errs = append(errs, fmt.Errorf("'%sKAFKA_ADDR' must not be empty", EnvPrefix))
+	}
+
+	if conf.RelayInterval < 1 || conf.RelayBatchSize < 1 {
+		errs = append(errs, errors.New("event relay interval and batch size must be positive"))
+	}
+
+	if err := envError(fnEvent, errs); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
@@ -0,0 +1,65 @@
+package configs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventDefault(t *testing.T) {
+	conf, err := Event()
+	assert.NoError(t, err)
+	assert.Equal(t, EventFileSink, conf.Sink)
+	assert.Equal(t, "", conf.File)
+	assert.Equal(t, defaultKafkaAddr, conf.KafkaAddr)
+	assert.Equal(t, defaultKafkaTopic, conf.KafkaTopic)
+	assert.Equal(t, 0, conf.KafkaPartition)
+	assert.Equal(t, defaultNATSAddr, conf.NATSAddr)
+	assert.Equal(t, defaultNATSSubjectPrefix, conf.NATSSubjectPrefix)
+	assert.Equal(t, time.Second, conf.RelayIntervalDuration())
+	assert.Equal(t, defaultEventRelayBatchSize, conf.RelayBatchSize)
+}
+
+func TestEvent(t *testing.T) {
+	data := map[string]string{
+		EnvPrefix + "EVENT_SINK":             EventKafkaSink,
+		EnvPrefix + "EVENT_FILE":             "/tmp/events.log",
+		EnvPrefix + "KAFKA_ADDR":             "127.0.0.1:9093 127.0.0.1:9094",
+		EnvPrefix + "KAFKA_TOPIC":            "test-events",
+		EnvPrefix + "KAFKA_PARTITION":        "3",
+		EnvPrefix + "NATS_ADDR":              "127.0.0.1:4223",
+		EnvPrefix + "NATS_SUBJECT_PREFIX":    "test.",
+		EnvPrefix + "NATS_TOKEN":             "testtoken",
+		EnvPrefix + "EVENT_RELAY_INTERVAL":   "5",
+		EnvPrefix + "EVENT_RELAY_BATCH_SIZE": "10",
+	}
+	for k, v := range data {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	conf, err := Event()
+	assert.NoError(t, err)
+	assert.Equal(t, EventKafkaSink, conf.Sink)
+	assert.Equal(t, "/tmp/events.log", conf.File)
+	assert.Equal(t, []string{"127.0.0.1:9093", "127.0.0.1:9094"}, conf.KafkaBrokers())
+	assert.Equal(t, "test-events", conf.KafkaTopic)
+	assert.Equal(t, 3, conf.KafkaPartition)
+	assert.Equal(t, "127.0.0.1:4223", conf.NATSAddr)
+	assert.Equal(t, "test.", conf.NATSSubjectPrefix)
+	assert.Equal(t, "testtoken", conf.NATSToken)
+	assert.Equal(t, time.Second*5, conf.RelayIntervalDuration())
+	assert.Equal(t, 10, conf.RelayBatchSize)
+
+	os.Setenv(EnvPrefix+"EVENT_RELAY_BATCH_SIZE", "0")
+	_, err = Event()
+	assert.EqualError(t, err, "configs.Event: event relay interval and batch size must be positive")
+
+	// 잘못된 값은 한 번에 모두 알린다.
+	os.Setenv(EnvPrefix+"EVENT_SINK", "rabbitmq")
+	_, err = Event()
+	assert.EqualError(t, err, "configs.Event: unknown event sink 'rabbitmq'; "+
+		"event relay interval and batch size must be positive")
+}
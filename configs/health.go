@@ -0,0 +1,72 @@
+package configs
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	defaultReadyCheckTimeout  = 2
+	defaultReadyCacheTTL      = 3
+	defaultShutdownDrainDelay = 5
+)
+
+// HealthConfig contains values for readiness checks and draining on shutdown.
+// Durations are in seconds.
+type HealthConfig struct {
+	// ReadyCheckTimeout is time to wait each dependency like DB and smtp server.
+	ReadyCheckTimeout int
+	// ReadyCacheTTL is time to reuse the last result of checks, 0 checks every time.
+	ReadyCacheTTL int
+	// ShutdownDrainDelay is time to keep serving as not ready before shut down,
+	// so that load balancers stop sending requests first.
+	ShutdownDrainDelay int
+}
+
+// ReadyCheckTimeoutDuration .
+func (c *HealthConfig) ReadyCheckTimeoutDuration() time.Duration {
+	return time.Second * time.Duration(c.ReadyCheckTimeout)
+}
+
+// ReadyCacheTTLDuration .
+func (c *HealthConfig) ReadyCacheTTLDuration() time.Duration {
+	return time.Second * time.Duration(c.ReadyCacheTTL)
+}
+
+// ShutdownDrainDelayDuration .
+func (c *HealthConfig) ShutdownDrainDelayDuration() time.Duration {
+	return time.Second * time.Duration(c.ShutdownDrainDelay)
+}
+
+// Health returns the values needed to check readiness.
+// If the check timeout is not positive or the others are negative, an error is returned.
+// After 'Load', the loaded values are returned.
+func Health() (*HealthConfig, error) {
+	if c := loadedConfig(); c != nil {
+		return c.Health(), nil
+	}
+
+	const fnHealth = "Health"
+	conf := HealthConfig{
+		ReadyCheckTimeout:  defaultReadyCheckTimeout,
+		ReadyCacheTTL:      defaultReadyCacheTTL,
+		ShutdownDrainDelay: defaultShutdownDrainDelay,
+	}
+
+	errs := setValues(map[string]interface{}{
+		EnvPrefix + "READY_CHECK_TIMEOUT":  &conf.ReadyCheckTimeout,
+		EnvPrefix + "READY_CACHE_TTL":      &conf.ReadyCacheTTL,
+		EnvPrefix + "SHUTDOWN_DRAIN_DELAY": &conf.ShutdownDrainDelay,
+	})
+	errs = append(errs, checkPositive(map[string]int{
+		EnvPrefix + "READY_CHECK_TIMEOUT": conf.ReadyCheckTimeout,
+	})...)
+	if conf.ReadyCacheTTL < 0 || conf.ShutdownDrainDelay < 0 {
+		errs = append(errs, errors.New("ready cache ttl and shutdown drain delay must not be negative"))
+	}
+
+	if err := envError(fnHealth, errs); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
@@ -0,0 +1,42 @@
+package configs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthDefault(t *testing.T) {
+	conf, err := Health()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second*2, conf.ReadyCheckTimeoutDuration())
+	assert.Equal(t, time.Second*3, conf.ReadyCacheTTLDuration())
+	assert.Equal(t, time.Second*5, conf.ShutdownDrainDelayDuration())
+}
+
+func TestHealth(t *testing.T) {
+	data := map[string]string{
+		EnvPrefix + "READY_CHECK_TIMEOUT":  "1",
+		EnvPrefix + "READY_CACHE_TTL":      "0",
+		EnvPrefix + "SHUTDOWN_DRAIN_DELAY": "10",
+	}
+	for k, v := range data {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	conf, err := Health()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, conf.ReadyCheckTimeoutDuration())
+	assert.Equal(t, time.Duration(0), conf.ReadyCacheTTLDuration())
+	assert.Equal(t, time.Second*10, conf.ShutdownDrainDelayDuration())
+
+	// 잘못된 값은 한 번에 모두 알린다.
+	os.Setenv(EnvPrefix+"READY_CHECK_TIMEOUT", "0")
+	os.Setenv(EnvPrefix+"SHUTDOWN_DRAIN_DELAY", "-1")
+	_, err = Health()
+	assert.EqualError(t, err, "configs.Health: 'AUTH_READY_CHECK_TIMEOUT' must be positive; "+
+		"ready cache ttl and shutdown drain delay must not be negative")
+}
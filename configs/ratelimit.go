@@ -0,0 +1,63 @@
+package configs
+
+import (
+	"fmt"
+)
+
+// Stores to keep rate limit buckets.
+const (
+	RateLimitMemoryStore = "memory"
+	RateLimitRedisStore  = "redis"
+)
+
+const (
+	defaultRateLimitStore  = RateLimitMemoryStore
+	defaultRedisAddr       = "127.0.0.1:6379"
+	defaultRateLimitPrefix = "auth:ratelimit:"
+)
+
+// RateLimitConfig contains values for the store of rate limit buckets.
+// Buckets are kept in memory of each process unless 'Store' is "redis".
+type RateLimitConfig struct {
+	Store         string
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	Prefix        string
+}
+
+// RateLimit returns the values needed to keep rate limit buckets.
+// If the store is unknown, an error is returned.
+// The redis password can be read from the file named by 'REDIS_PASSWORD_FILE'.
+// After 'Load', the loaded values are returned.
+func RateLimit() (*RateLimitConfig, error) {
+	if c := loadedConfig(); c != nil {
+		return c.RateLimit(), nil
+	}
+
+	const fnRateLimit = "RateLimit"
+	conf := RateLimitConfig{
+		Store:     defaultRateLimitStore,
+		RedisAddr: defaultRedisAddr,
+		Prefix:    defaultRateLimitPrefix,
+	}
+
+	errs := setValues(map[string]interface{}{
+		EnvPrefix + "RATE_LIMIT_STORE":  &conf.Store,
+		EnvPrefix + "RATE_LIMIT_PREFIX": &conf.Prefix,
+		EnvPrefix + "REDIS_ADDR":        &conf.RedisAddr,
+		EnvPrefix + "REDIS_DB":          &conf.RedisDB,
+	})
+	if err := setSecret(EnvPrefix+"REDIS_PASSWORD", &conf.RedisPassword); err != nil {
+		errs = append(errs, err)
+	}
+
+	if conf.Store != RateLimitMemoryStore && conf.Store != RateLimitRedisStore {
+		errs = append(errs, fmt.Errorf("unknown rate limit store '%s'", conf.Store))
+	}
+
+	if err := envError(fnRateLimit, errs); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
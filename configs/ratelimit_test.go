@@ -0,0 +1,42 @@
+package configs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitDefault(t *testing.T) {
+	conf, err := RateLimit()
+	assert.NoError(t, err)
+	assert.Equal(t, RateLimitMemoryStore, conf.Store)
+	assert.Equal(t, defaultRedisAddr, conf.RedisAddr)
+	assert.Equal(t, defaultRateLimitPrefix, conf.Prefix)
+}
+
+func TestRateLimit(t *testing.T) {
+	data := map[string]string{
+		EnvPrefix + "RATE_LIMIT_STORE":  RateLimitRedisStore,
+		EnvPrefix + "RATE_LIMIT_PREFIX": "test:",
+		EnvPrefix + "REDIS_ADDR":        "127.0.0.1:7379",
+		EnvPrefix + "REDIS_PASSWORD":    "testpw",
+		EnvPrefix + "REDIS_DB":          "2",
+	}
+	for k, v := range data {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	conf, err := RateLimit()
+	assert.NoError(t, err)
+	assert.Equal(t, RateLimitRedisStore, conf.Store)
+	assert.Equal(t, "test:", conf.Prefix)
+	assert.Equal(t, "127.0.0.1:7379", conf.RedisAddr)
+	assert.Equal(t, "testpw", conf.RedisPassword)
+	assert.Equal(t, 2, conf.RedisDB)
+
+	os.Setenv(EnvPrefix+"RATE_LIMIT_STORE", "memcached")
+	_, err = RateLimit()
+	assert.EqualError(t, err, "configs.RateLimit: unknown rate limit store 'memcached'")
+}
@@ -1,6 +1,7 @@
 package configs
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/smtp"
@@ -28,11 +29,30 @@ func (c *SMTPConfig) Addr() string {
 // DialAndQuit is checks smtp server is running.
 // If not running, an error is returned.
 func (c *SMTPConfig) DialAndQuit() error {
-	con, err := smtp.Dial(c.Addr())
+	return c.DialAndQuitContext(context.Background())
+}
+
+// DialAndQuitContext is DialAndQuit giving up when the context is done.
+func (c *SMTPConfig) DialAndQuitContext(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.Addr())
+	if err != nil {
+		return fmt.Errorf("smtp server dial: %w", err)
+	}
+	// 응답이 없는 서버도 기다리지 않도록 연결에 기한을 둔다.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	con, err := smtp.NewClient(conn, c.host)
 	if err != nil {
+		conn.Close()
 		return fmt.Errorf("smtp server dial: %w", err)
 	}
-	defer con.Quit()
+	if err := con.Quit(); err != nil {
+		con.Close()
+		return fmt.Errorf("smtp server quit: %w", err)
+	}
 	return nil
 }
 
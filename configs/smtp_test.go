@@ -1,8 +1,10 @@
 package configs
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -46,3 +48,25 @@ func TestSMTPWithoutSMTPServer(t *testing.T) {
 		smtpConf.Addr())
 	assert.EqualError(t, err, expectedError)
 }
+
+func TestSMTPDialAndQuitContextWithSilentServer(t *testing.T) {
+	ln, err := utils.NewLocalListener(utils.MockSMTPPort)
+	assert.NoError(t, err)
+	defer ln.Close()
+	// 연결은 받지만 인사하지 않는 서버.
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			defer c.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+
+	SetSMTPPort(utils.MockSMTPPort)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = SMTP().DialAndQuitContext(ctx)
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
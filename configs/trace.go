@@ -0,0 +1,122 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Exporters to send spans to.
+const (
+	TraceStdoutExporter = "stdout"
+	TraceOTLPExporter   = "otlp"
+)
+
+const (
+	defaultTraceOTLPEndpoint  = "http://127.0.0.1:4318"
+	defaultTraceServiceName   = "auth"
+	defaultTraceSamplePercent = 100
+	defaultTraceExportTimeout = 10
+)
+
+// TraceConfig contains values for exporting OpenTelemetry spans.
+// Requests are not traced unless 'Exporter' is set.
+type TraceConfig struct {
+	Exporter string
+	// OTLPEndpoint is base url of OTLP/HTTP collector, spans are sent to '/v1/traces' of it.
+	OTLPEndpoint string
+	// OTLPHeaders are 'key=value' pairs separated by ',', sent with spans like API key.
+	OTLPHeaders string
+	ServiceName string
+	// SamplePercent is percent of traces started by this service to be exported.
+	// Traces started by the caller follow the decision of the caller.
+	SamplePercent int
+	// ExportTimeout is seconds to wait for the collector.
+	ExportTimeout int
+}
+
+// ExportTimeoutDuration .
+func (c *TraceConfig) ExportTimeoutDuration() time.Duration {
+	return time.Second * time.Duration(c.ExportTimeout)
+}
+
+// Headers returns 'OTLPHeaders' as a map.
+func (c *TraceConfig) Headers() map[string]string {
+	headers, _ := parseHeaders(c.OTLPHeaders)
+	return headers
+}
+
+func parseHeaders(value string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || key == "" {
+			// 헤더에는 비밀 값이 있을 수 있어 에러에 남기지 않는다.
+			return nil, errors.New("otlp headers must be 'key=value' pairs separated by ','")
+		}
+		headers[key] = strings.TrimSpace(kv[1])
+	}
+	return headers, nil
+}
+
+// Trace returns the values needed to export spans.
+// If the exporter is unknown, the endpoint or headers are invalid,
+// or the sample percent is out of 0 to 100, an error is returned.
+// The headers can be read from the file named by 'TRACE_OTLP_HEADERS_FILE'.
+// After 'Load', the loaded values are returned.
+func Trace() (*TraceConfig, error) {
+	if c := loadedConfig(); c != nil {
+		return c.Trace(), nil
+	}
+
+	const fnTrace = "Trace"
+	conf := TraceConfig{
+		OTLPEndpoint:  defaultTraceOTLPEndpoint,
+		ServiceName:   defaultTraceServiceName,
+		SamplePercent: defaultTraceSamplePercent,
+		ExportTimeout: defaultTraceExportTimeout,
+	}
+
+	errs := setValues(map[string]interface{}{
+		EnvPrefix + "TRACE_EXPORTER":       &conf.Exporter,
+		EnvPrefix + "TRACE_OTLP_ENDPOINT":  &conf.OTLPEndpoint,
+		EnvPrefix + "TRACE_SERVICE_NAME":   &conf.ServiceName,
+		EnvPrefix + "TRACE_SAMPLE_PERCENT": &conf.SamplePercent,
+		EnvPrefix + "TRACE_EXPORT_TIMEOUT": &conf.ExportTimeout,
+	})
+	if err := setSecret(EnvPrefix+"TRACE_OTLP_HEADERS", &conf.OTLPHeaders); err != nil {
+		errs = append(errs, err)
+	}
+
+	switch conf.Exporter {
+	case "", TraceStdoutExporter:
+	case TraceOTLPExporter:
+		u, err := url.Parse(conf.OTLPEndpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid otlp endpoint '%s'", conf.OTLPEndpoint))
+		}
+		if _, err := parseHeaders(conf.OTLPHeaders); err != nil {
+			errs = append(errs, err)
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown trace exporter '%s'", conf.Exporter))
+	}
+
+	if conf.SamplePercent < 0 || conf.SamplePercent > 100 {
+		errs = append(errs, errors.New("trace sample percent must be between 0 and 100"))
+	}
+	errs = append(errs, checkPositive(map[string]int{
+		EnvPrefix + "TRACE_EXPORT_TIMEOUT": conf.ExportTimeout,
+	})...)
+
+	if err := envError(fnTrace, errs); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
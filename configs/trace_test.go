@@ -0,0 +1,58 @@
+package configs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceDefault(t *testing.T) {
+	conf, err := Trace()
+	assert.NoError(t, err)
+	assert.Equal(t, "", conf.Exporter)
+	assert.Equal(t, defaultTraceOTLPEndpoint, conf.OTLPEndpoint)
+	assert.Equal(t, defaultTraceServiceName, conf.ServiceName)
+	assert.Equal(t, 100, conf.SamplePercent)
+	assert.Equal(t, time.Second*10, conf.ExportTimeoutDuration())
+	assert.Equal(t, map[string]string{}, conf.Headers())
+}
+
+func TestTrace(t *testing.T) {
+	data := map[string]string{
+		EnvPrefix + "TRACE_EXPORTER":       TraceOTLPExporter,
+		EnvPrefix + "TRACE_OTLP_ENDPOINT":  "https://otlp.example.com:4318",
+		EnvPrefix + "TRACE_OTLP_HEADERS":   "api-key=secret, x-team = auth",
+		EnvPrefix + "TRACE_SERVICE_NAME":   "auth-test",
+		EnvPrefix + "TRACE_SAMPLE_PERCENT": "10",
+		EnvPrefix + "TRACE_EXPORT_TIMEOUT": "3",
+	}
+	for k, v := range data {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	conf, err := Trace()
+	assert.NoError(t, err)
+	assert.Equal(t, TraceOTLPExporter, conf.Exporter)
+	assert.Equal(t, "https://otlp.example.com:4318", conf.OTLPEndpoint)
+	assert.Equal(t, map[string]string{"api-key": "secret", "x-team": "auth"}, conf.Headers())
+	assert.Equal(t, "auth-test", conf.ServiceName)
+	assert.Equal(t, 10, conf.SamplePercent)
+	assert.Equal(t, time.Second*3, conf.ExportTimeoutDuration())
+
+	// 잘못된 값은 한 번에 모두 알리고, 헤더 값은 에러에 남기지 않는다.
+	os.Setenv(EnvPrefix+"TRACE_OTLP_ENDPOINT", "127.0.0.1:4318")
+	os.Setenv(EnvPrefix+"TRACE_OTLP_HEADERS", "secret")
+	os.Setenv(EnvPrefix+"TRACE_SAMPLE_PERCENT", "101")
+	_, err = Trace()
+	assert.EqualError(t, err, "configs.Trace: invalid otlp endpoint '127.0.0.1:4318'; "+
+		"otlp headers must be 'key=value' pairs separated by ','; "+
+		"trace sample percent must be between 0 and 100")
+
+	os.Setenv(EnvPrefix+"TRACE_EXPORTER", "jaeger")
+	os.Setenv(EnvPrefix+"TRACE_SAMPLE_PERCENT", "10")
+	_, err = Trace()
+	assert.EqualError(t, err, "configs.Trace: unknown trace exporter 'jaeger'")
+}
@@ -0,0 +1,92 @@
+package configs
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	defaultWebhookTimeout          = 10
+	defaultWebhookMaxAttempts      = 8
+	defaultWebhookRetryBase        = 30
+	defaultWebhookRetryMax         = 3600
+	defaultWebhookDispatchInterval = 5
+	defaultWebhookBatchSize        = 50
+)
+
+// WebhookConfig contains values for delivering webhooks.
+// Durations are in seconds.
+// Failed delivery is retried after 'RetryBase' doubling for each attempt,
+// up to 'RetryMax', until it has been tried 'MaxAttempts' times.
+type WebhookConfig struct {
+	Timeout     int
+	MaxAttempts int
+	RetryBase   int
+	RetryMax    int
+	// DispatchInterval is seconds to wait when there is no delivery due.
+	DispatchInterval int
+	BatchSize        int
+}
+
+// TimeoutDuration .
+func (c *WebhookConfig) TimeoutDuration() time.Duration {
+	return time.Second * time.Duration(c.Timeout)
+}
+
+// RetryBaseDuration .
+func (c *WebhookConfig) RetryBaseDuration() time.Duration {
+	return time.Second * time.Duration(c.RetryBase)
+}
+
+// RetryMaxDuration .
+func (c *WebhookConfig) RetryMaxDuration() time.Duration {
+	return time.Second * time.Duration(c.RetryMax)
+}
+
+// DispatchIntervalDuration .
+func (c *WebhookConfig) DispatchIntervalDuration() time.Duration {
+	return time.Second * time.Duration(c.DispatchInterval)
+}
+
+// Webhook returns the values needed to deliver webhooks.
+// If any value is not positive or 'RetryMax' is less than 'RetryBase',
+// an error is returned.
+// After 'Load', the loaded values are returned.
+func Webhook() (*WebhookConfig, error) {
+	if c := loadedConfig(); c != nil {
+		return c.Webhook(), nil
+	}
+
+	const fnWebhook = "Webhook"
+	conf := WebhookConfig{
+		Timeout:          defaultWebhookTimeout,
+		MaxAttempts:      defaultWebhookMaxAttempts,
+		RetryBase:        defaultWebhookRetryBase,
+		RetryMax:         defaultWebhookRetryMax,
+		DispatchInterval: defaultWebhookDispatchInterval,
+		BatchSize:        defaultWebhookBatchSize,
+	}
+
+	errs := setValues(map[string]interface{}{
+		EnvPrefix + "WEBHOOK_TIMEOUT":           &conf.Timeout,
+		EnvPrefix + "WEBHOOK_MAX_ATTEMPTS":      &conf.MaxAttempts,
+		EnvPrefix + "WEBHOOK_RETRY_BASE":        &conf.RetryBase,
+		EnvPrefix + "WEBHOOK_RETRY_MAX":         &conf.RetryMax,
+		EnvPrefix + "WEBHOOK_DISPATCH_INTERVAL": &conf.DispatchInterval,
+		EnvPrefix + "WEBHOOK_BATCH_SIZE":        &conf.BatchSize,
+	})
+
+	if conf.Timeout < 1 || conf.MaxAttempts < 1 || conf.RetryBase < 1 ||
+		conf.DispatchInterval < 1 || conf.BatchSize < 1 {
+		errs = append(errs, errors.New("webhook values must be positive"))
+	}
+
+	if conf.RetryMax < conf.RetryBase {
+		errs = append(errs, errors.New("webhook retry max must not be less than retry base"))
+	}
+
+	if err := envError(fnWebhook, errs); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
@@ -0,0 +1,61 @@
+package configs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookDefault(t *testing.T) {
+	conf, err := Webhook()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second*10, conf.TimeoutDuration())
+	assert.Equal(t, defaultWebhookMaxAttempts, conf.MaxAttempts)
+	assert.Equal(t, time.Second*30, conf.RetryBaseDuration())
+	assert.Equal(t, time.Hour, conf.RetryMaxDuration())
+	assert.Equal(t, time.Second*5, conf.DispatchIntervalDuration())
+	assert.Equal(t, defaultWebhookBatchSize, conf.BatchSize)
+}
+
+func TestWebhook(t *testing.T) {
+	data := map[string]string{
+		EnvPrefix + "WEBHOOK_TIMEOUT":           "3",
+		EnvPrefix + "WEBHOOK_MAX_ATTEMPTS":      "4",
+		EnvPrefix + "WEBHOOK_RETRY_BASE":        "10",
+		EnvPrefix + "WEBHOOK_RETRY_MAX":         "60",
+		EnvPrefix + "WEBHOOK_DISPATCH_INTERVAL": "2",
+		EnvPrefix + "WEBHOOK_BATCH_SIZE":        "20",
+	}
+	for k, v := range data {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	conf, err := Webhook()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second*3, conf.TimeoutDuration())
+	assert.Equal(t, 4, conf.MaxAttempts)
+	assert.Equal(t, time.Second*10, conf.RetryBaseDuration())
+	assert.Equal(t, time.Minute, conf.RetryMaxDuration())
+	assert.Equal(t, time.Second*2, conf.DispatchIntervalDuration())
+	assert.Equal(t, 20, conf.BatchSize)
+
+	os.Setenv(EnvPrefix+"WEBHOOK_RETRY_MAX", "5")
+	_, err = Webhook()
+	assert.EqualError(t, err, "configs.Webhook: webhook retry max must not be less than retry base")
+
+	// 잘못된 값은 한 번에 모두 알린다.
+	os.Setenv(EnvPrefix+"WEBHOOK_MAX_ATTEMPTS", "0")
+	_, err = Webhook()
+	assert.EqualError(t, err, "configs.Webhook: webhook values must be positive; "+
+		"webhook retry max must not be less than retry base")
+
+	os.Setenv(EnvPrefix+"WEBHOOK_BATCH_SIZE", "many")
+	os.Setenv(EnvPrefix+"WEBHOOK_MAX_ATTEMPTS", "4")
+	os.Setenv(EnvPrefix+"WEBHOOK_RETRY_MAX", "60")
+	_, err = Webhook()
+	assert.EqualError(t, err,
+		"configs.Webhook: 'AUTH_WEBHOOK_BATCH_SIZE' must be an integer, not 'many'")
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Outcomes of audit event.
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEvent is ORM of security relevant request.
+// Actor is the authorized user or service account who made the request,
+// target is the user the request is about. Emails are kept with ids
+// so that the history is still readable after the user is deleted.
+type AuditEvent struct {
+	IDField
+	ActorID       uint   `gorm:"index"`
+	ActorEmail    string `gorm:"size:255"`
+	ActorClientID string `gorm:"size:255"`
+	TargetUserID  uint   `gorm:"index"`
+	TargetEmail   string `gorm:"size:255"`
+	Action        string `gorm:"size:64;index;not null"`
+	Outcome       string `gorm:"size:16;not null"`
+	Status        int
+	IP            string `gorm:"size:45"`
+	UserAgent     string `gorm:"size:255"`
+	RequestID     string `gorm:"size:36"`
+
+	DateTimeFields
+}
+
+// JSONAuditEvent is used when payload to a request.
+type JSONAuditEvent struct {
+	ID            uint   `json:"id"`
+	ActorEmail    string `json:"actor_email,omitempty"`
+	ActorClientID string `json:"actor_client_id,omitempty"`
+	TargetEmail   string `json:"target_email,omitempty"`
+	Action        string `json:"action"`
+	Outcome       string `json:"outcome"`
+	Status        int    `json:"status"`
+	IP            string `json:"ip"`
+	UserAgent     string `json:"user_agent"`
+	RequestID     string `json:"request_id"`
+	CreatedAt     int64  `json:"created_at"`
+}
+
+// MarshalJSON .
+func (e AuditEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&JSONAuditEvent{
+		ID:            e.ID,
+		ActorEmail:    e.ActorEmail,
+		ActorClientID: e.ActorClientID,
+		TargetEmail:   e.TargetEmail,
+		Action:        e.Action,
+		Outcome:       e.Outcome,
+		Status:        e.Status,
+		IP:            e.IP,
+		UserAgent:     e.UserAgent,
+		RequestID:     e.RequestID,
+		CreatedAt:     e.CreatedAt.Unix(),
+	})
+}
+
+// AuditEventFilter is conditions to find audit events.
+// Zero value fields are not used as condition.
+// 'UserID' matches events that the user is either actor or target of.
+type AuditEventFilter struct {
+	UserID      uint
+	ActorEmail  string
+	TargetEmail string
+	Action      string
+	Outcome     string
+	IP          string
+	Since       *time.Time
+	Until       *time.Time
+}
+
+// RecordAuditEvent stores the event.
+// Too long user agent and request id are cut not to fail recording.
+func RecordAuditEvent(con *gorm.DB, e *AuditEvent) error {
+	const (
+		userAgentMaxLen = 255
+		requestIDMaxLen = 36
+	)
+	if len(e.UserAgent) > userAgentMaxLen {
+		e.UserAgent = e.UserAgent[:userAgentMaxLen]
+	}
+	if len(e.RequestID) > requestIDMaxLen {
+		e.RequestID = e.RequestID[:requestIDMaxLen]
+	}
+	return con.Create(e).Error
+}
+
+// FindAuditEvents returns events matched with the filter, newest first.
+func FindAuditEvents(con *gorm.DB, f AuditEventFilter, offset, limit int) ([]AuditEvent, error) {
+	q := con.Model(&AuditEvent{})
+	if f.UserID != 0 {
+		q = q.Where("actor_id = ? OR target_user_id = ?", f.UserID, f.UserID)
+	}
+	if f.ActorEmail != "" {
+		q = q.Where("actor_email = ?", f.ActorEmail)
+	}
+	if f.TargetEmail != "" {
+		q = q.Where("target_email = ?", f.TargetEmail)
+	}
+	if f.Action != "" {
+		q = q.Where("action = ?", f.Action)
+	}
+	if f.Outcome != "" {
+		q = q.Where("outcome = ?", f.Outcome)
+	}
+	if f.IP != "" {
+		q = q.Where("ip = ?", f.IP)
+	}
+	if f.Since != nil {
+		q = q.Where("created_at >= ?", *f.Since)
+	}
+	if f.Until != nil {
+		q = q.Where("created_at < ?", *f.Until)
+	}
+
+	var events []AuditEvent
+	err := q.Order("id desc").Limit(limit).Offset(offset).Find(&events).Error
+	return events, err
+}
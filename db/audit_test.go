@@ -0,0 +1,91 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+)
+
+func TestFindAuditEvents(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	// 다른 테스트의 이벤트와 섞이지 않도록 고유한 IP 를 쓴다.
+	ip := uuid.New().String()[:15]
+	admin := User{Email: uuid.New().String() + "@mail.com"}
+	user := User{Email: uuid.New().String() + "@mail.com"}
+	assert.NoError(t, con.Create(&admin).Error)
+	assert.NoError(t, con.Create(&user).Error)
+
+	events := []AuditEvent{
+		{
+			ActorID: user.ID, ActorEmail: user.Email,
+			TargetUserID: user.ID, TargetEmail: user.Email,
+			Action: "signin", Outcome: AuditOutcomeSuccess, Status: 200, IP: ip,
+		},
+		{
+			TargetUserID: user.ID, TargetEmail: user.Email,
+			Action: "signin", Outcome: AuditOutcomeFailure, Status: 401, IP: ip,
+		},
+		{
+			ActorID: admin.ID, ActorEmail: admin.Email,
+			TargetUserID: user.ID, TargetEmail: user.Email,
+			Action: "otp.reset", Outcome: AuditOutcomeSuccess, Status: 204, IP: ip,
+			RequestID: strings.Repeat("r", 64),
+		},
+	}
+	for i := range events {
+		assert.NoError(t, RecordAuditEvent(con, &events[i]))
+	}
+
+	found, err := FindAuditEvents(con, AuditEventFilter{IP: ip}, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, found, 3)
+	// 최신 이벤트가 먼저 온다.
+	assert.Equal(t, events[2].ID, found[0].ID)
+	// 긴 요청 ID 는 잘라서 남긴다.
+	assert.Equal(t, strings.Repeat("r", 36), found[0].RequestID)
+
+	found, err = FindAuditEvents(con, AuditEventFilter{IP: ip}, 1, 1)
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, events[1].ID, found[0].ID)
+
+	found, err = FindAuditEvents(con, AuditEventFilter{
+		IP: ip, Action: "signin", Outcome: AuditOutcomeFailure}, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, 401, found[0].Status)
+
+	found, err = FindAuditEvents(con, AuditEventFilter{ActorEmail: admin.Email}, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, "otp.reset", found[0].Action)
+
+	found, err = FindAuditEvents(con, AuditEventFilter{UserID: admin.ID}, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+
+	found, err = FindAuditEvents(con, AuditEventFilter{UserID: user.ID}, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, found, 3)
+
+	until := time.Now().Add(-time.Hour)
+	found, err = FindAuditEvents(con, AuditEventFilter{IP: ip, Until: &until}, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, found, 0)
+
+	since := time.Now().Add(-time.Hour)
+	found, err = FindAuditEvents(con, AuditEventFilter{IP: ip, Since: &since}, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, found, 3)
+}
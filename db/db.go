@@ -1,15 +1,24 @@
 package db
 
 import (
+	"crypto/sha256"
 	"database/sql"
-	"errors"
+	"encoding/hex"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
-	_ "github.com/jinzhu/gorm/dialects/mysql" // driver
+	_ "github.com/jinzhu/gorm/dialects/mysql"    // driver
+	_ "github.com/jinzhu/gorm/dialects/postgres" // driver
+	_ "github.com/jinzhu/gorm/dialects/sqlite"   // driver
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/utils"
 )
 
 // IDField is primary key definition.
@@ -24,33 +33,32 @@ type DateTimeFields struct {
 	DeletedAt *time.Time
 }
 
+// hashToken returns the hash of opaque token given to the client.
+// Only the hash is stored, so leaked DB rows can not be used as tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // SyncModels is synchronize databases and models.
-func SyncModels(dataSourceName string, echo bool) (*gorm.DB, error) {
-	const maxWait = 1000
-	con, err := Connection(dataSourceName, echo)
+// It applies all migrations not applied yet, see 'MigrateUp'.
+func SyncModels(driver, dataSourceName string, echo bool) (*gorm.DB, error) {
+	con, err := Connection(driver, dataSourceName, echo)
 	if err != nil {
 		return nil, err
 	}
-	con.AutoMigrate(&User{})
-
-	wait := 0
-	for wait < maxWait {
-		if con.HasTable("users") {
-			break
-		}
-		time.Sleep(time.Microsecond * 1)
-		wait++
-	}
 
-	if wait == maxWait {
-		return nil, errors.New("sync models failed with timeout")
+	if _, err := MigrateUp(con, 0); err != nil {
+		con.Close()
+		return nil, err
 	}
 	return con, nil
 }
 
 // Connection .
-func Connection(dataSourceName string, echo bool) (*gorm.DB, error) {
-	db, err := gorm.Open("mysql", dataSourceName)
+// 'driver' is one of 'configs.DBDriver*'.
+func Connection(driver, dataSourceName string, echo bool) (*gorm.DB, error) {
+	db, err := gorm.Open(driver, dataSourceName)
 	if err != nil {
 		return nil, err
 	}
@@ -59,9 +67,19 @@ func Connection(dataSourceName string, echo bool) (*gorm.DB, error) {
 }
 
 // Reset is drop the database and create a new one.
-func Reset(dataSourceName string, dbname string) error {
+func Reset(driver, dataSourceName, dbname string) error {
+	switch driver {
+	case configs.DBDriverPostgres:
+		return resetPostgres(dataSourceName, dbname)
+	case configs.DBDriverSQLite:
+		return resetSQLite(dataSourceName)
+	}
+	return resetMySQL(dataSourceName, dbname)
+}
+
+func resetMySQL(dataSourceName, dbname string) error {
 	dataSourceName = strings.Split(dataSourceName, dbname)[0]
-	db, err := sql.Open("mysql", dataSourceName)
+	db, err := sql.Open(configs.DBDriverMySQL, dataSourceName)
 	if err != nil {
 		return fmt.Errorf("db connection failed: %w", err)
 	}
@@ -81,11 +99,75 @@ func Reset(dataSourceName string, dbname string) error {
 	return nil
 }
 
+// resetPostgres connects to 'postgres' database,
+// because the database to be dropped can not be connected.
+func resetPostgres(dataSourceName, dbname string) error {
+	dataSourceName = strings.Replace(
+		dataSourceName, "dbname="+dbname, "dbname=postgres", 1)
+	db, err := sql.Open(configs.DBDriverPostgres, dataSourceName)
+	if err != nil {
+		return fmt.Errorf("db connection failed: %w", err)
+	}
+	defer db.Close()
+
+	quoted := `"` + strings.Replace(dbname, `"`, `""`, -1) + `"`
+	_, err = db.Exec("DROP DATABASE IF EXISTS " + quoted)
+	if err != nil {
+		return fmt.Errorf("drop '%s' database failed: %w", dbname, err)
+	}
+
+	_, err = db.Exec("CREATE DATABASE " + quoted + " ENCODING 'UTF8'")
+	if err != nil {
+		return fmt.Errorf("create '%s' database failed: %w", dbname, err)
+	}
+
+	return nil
+}
+
+// resetSQLite removes the database file with its journal files.
+// The file is created again when it is connected.
+func resetSQLite(dataSourceName string) error {
+	path := strings.TrimPrefix(dataSourceName, "file:")
+	path = strings.SplitN(path, "?", 2)[0]
+	for _, p := range []string{path, path + "-wal", path + "-shm"} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove '%s' failed: %w", p, err)
+		}
+	}
+	return nil
+}
+
 // Do is executed between begin and commit in a transaction.
 type Do func(tx *gorm.DB) error
 
+// Outcomes of transaction, they are label of transaction duration.
+const (
+	transactionCommit   = "commit"
+	transactionRollback = "rollback"
+	transactionError    = "error"
+)
+
+var transactionDuration = utils.NewHistogramVec(
+	"auth_db_transaction_duration_seconds",
+	"Duration of DB transactions by outcome.",
+	utils.DefaultBuckets, "outcome")
+
 // Transaction apply work tied to one in 'Do' type function to DB.
+// The duration is observed as metric with the outcome,
+// and queries of 'do' are traced in a span of the transaction.
 func Transaction(db *gorm.DB, do Do) error {
+	start := time.Now()
+	outcome := transactionRollback
+	ctx, span := utils.StartChildSpan(contextOf(db), "transaction", trace.SpanKindInternal)
+	defer func() {
+		transactionDuration.Observe(time.Since(start).Seconds(), outcome)
+		span.SetAttributes(attribute.String("db.transaction.outcome", outcome))
+		span.End()
+	}()
+
+	if span.IsRecording() {
+		db = db.Set(contextKey, ctx)
+	}
 	tx := db.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -94,13 +176,22 @@ func Transaction(db *gorm.DB, do Do) error {
 	}()
 
 	if err := tx.Error; err != nil {
+		outcome = transactionError
+		span.RecordError(err)
 		return err
 	}
 
 	if err := do(tx); err != nil {
 		tx.Rollback()
+		span.RecordError(err)
 		return err
 	}
 
-	return tx.Commit().Error
+	if err := tx.Commit().Error; err != nil {
+		outcome = transactionError
+		span.RecordError(err)
+		return err
+	}
+	outcome = transactionCommit
+	return nil
 }
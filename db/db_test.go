@@ -1,6 +1,7 @@
 package db
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,13 +13,13 @@ func TestConnection(t *testing.T) {
 	configs.SetMode(configs.TestMode)
 	dbConf, err := configs.DB()
 	assert.NoError(t, err)
-	con, err := Connection(dbConf.DSN(), true)
+	con, err := Connection(dbConf.Driver, dbConf.DSN(), true)
 	assert.NotNil(t, con)
 }
 
 func TestConnectionWithBadDSN(t *testing.T) {
 	baddsn := "baddsn"
-	_, err := Connection(baddsn, true)
+	_, err := Connection(configs.DBDriverMySQL, baddsn, true)
 	expectedError := "invalid DSN: missing the slash separating the database name"
 	assert.EqualError(t, err, expectedError)
 }
@@ -27,13 +28,13 @@ func TestSyncModels(t *testing.T) {
 	configs.SetMode(configs.TestMode)
 	dbConf, err := configs.DB()
 	assert.NoError(t, err)
-	con, err := SyncModels(dbConf.DSN(), true)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), true)
 	assert.NotNil(t, con)
 }
 
 func TestSyncModelsWithBadDSN(t *testing.T) {
 	baddsn := "baddsn"
-	_, err := SyncModels(baddsn, true)
+	_, err := SyncModels(configs.DBDriverMySQL, baddsn, true)
 	expectedError := "invalid DSN: missing the slash separating the database name"
 	assert.EqualError(t, err, expectedError)
 }
@@ -41,12 +42,31 @@ func TestSyncModelsWithBadDSN(t *testing.T) {
 func TestReset(t *testing.T) {
 	configs.SetMode(configs.TestMode)
 	dbConf, err := configs.DB()
-	err = Reset(dbConf.DSN(), dbConf.DBName())
+	err = Reset(dbConf.Driver, dbConf.DSN(), dbConf.DBName())
 	assert.NoError(t, err)
 }
 
 func TestResetWithBadDSN(t *testing.T) {
-	err := Reset("baddsn", "badtable")
+	err := Reset(configs.DBDriverMySQL, "baddsn", "badtable")
 	expectedError := "db connection failed: invalid DSN: missing the slash separating the database name"
 	assert.EqualError(t, err, expectedError)
 }
+
+func TestResetWithSQLite(t *testing.T) {
+	dsn := "file:" + filepath.Join(t.TempDir(), "auth_test.db") + "?_busy_timeout=5000"
+	con, err := SyncModels(configs.DBDriverSQLite, dsn, false)
+	assert.NoError(t, err)
+	assert.NoError(t, con.Create(&User{Email: "test@mail.com"}).Error)
+	con.Close()
+
+	// 파일을 지우고 다시 만들면 빈 데이터베이스가 된다.
+	assert.NoError(t, Reset(configs.DBDriverSQLite, dsn, "auth_test"))
+	assert.NoError(t, Reset(configs.DBDriverSQLite, dsn, "auth_test"))
+	con, err = SyncModels(configs.DBDriverSQLite, dsn, false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	var count int
+	assert.NoError(t, con.Model(&User{}).Count(&count).Error)
+	assert.Equal(t, 0, count)
+}
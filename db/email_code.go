@@ -0,0 +1,121 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrorNotFoundEmailCode .
+	ErrorNotFoundEmailCode = errors.New("not found email code")
+	// ErrorExpiredEmailCode .
+	ErrorExpiredEmailCode = errors.New("expired email code")
+	// ErrorIncorrectEmailCode .
+	ErrorIncorrectEmailCode = errors.New("incorrect email code")
+	// ErrorTooManyEmailCodeAttempts .
+	ErrorTooManyEmailCodeAttempts = errors.New("too many email code attempts")
+)
+
+// EmailCode is ORM of one-time numeric code sent to the user by email.
+// Only the latest code of the user can be verified.
+// Code is short, so it is hashed with bcrypt and has limited attempts.
+type EmailCode struct {
+	IDField
+	UserID     uint   `gorm:"index;not null"`
+	HashedCode string `gorm:"not null"`
+	Attempts   int    `gorm:"not null;default:0"`
+	ExpiresAt  time.Time
+	UsedAt     *time.Time
+
+	DateTimeFields
+}
+
+// IssueEmailCode saves the code for the user.
+// Codes issued before are discarded.
+func IssueEmailCode(con *gorm.DB, userID uint, code string, expireAfterSec int) error {
+	hashedBytes, err := bcrypt.GenerateFromPassword(
+		[]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	c := EmailCode{
+		UserID:     userID,
+		HashedCode: string(hashedBytes),
+		ExpiresAt:  time.Now().Add(time.Second * time.Duration(expireAfterSec)),
+	}
+	do := func(tx *gorm.DB) error {
+		err := tx.Unscoped().
+			Where("user_id = ?", userID).
+			Delete(&EmailCode{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&c).Error
+	}
+	return Transaction(con, do)
+}
+
+// ConsumeEmailCode verifies the code and marks it used.
+// Each verification counts as an attempt before comparing the code,
+// so that guesses at the same time can not exceed 'maxAttempts'.
+func ConsumeEmailCode(con *gorm.DB, userID uint, code string, maxAttempts int) error {
+	c := EmailCode{}
+	if con.Where("user_id = ? AND used_at IS NULL", userID).
+		Order("id desc").First(&c).RecordNotFound() {
+		return ErrorNotFoundEmailCode
+	}
+
+	if time.Now().After(c.ExpiresAt) {
+		return ErrorExpiredEmailCode
+	}
+
+	// 조건부 갱신으로 남은 시도 횟수를 먼저 차지한 요청만 코드를 비교한다.
+	do := func(tx *gorm.DB) error {
+		result := tx.Model(&EmailCode{}).
+			Where("id = ? AND used_at IS NULL AND attempts < ?", c.ID, maxAttempts).
+			Update("attempts", gorm.Expr("attempts + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrorTooManyEmailCodeAttempts
+		}
+		return nil
+	}
+	if err := Transaction(con, do); err != nil {
+		if errors.Is(err, ErrorTooManyEmailCodeAttempts) && isEmailCodeUsed(con, c.ID) {
+			return ErrorNotFoundEmailCode
+		}
+		return err
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(c.HashedCode), []byte(code))
+	if err != nil {
+		return ErrorIncorrectEmailCode
+	}
+
+	do = func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&EmailCode{}).
+			Where("id = ? AND used_at IS NULL", c.ID).
+			Update("used_at", &now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrorNotFoundEmailCode
+		}
+		return nil
+	}
+	return Transaction(con, do)
+}
+
+func isEmailCodeUsed(con *gorm.DB, id uint) bool {
+	var count int
+	con.Model(&EmailCode{}).Where("id = ? AND used_at IS NOT NULL", id).Count(&count)
+	return count > 0
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+)
+
+func TestConsumeEmailCode(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	const userID = 1
+	const maxAttempts = 2
+
+	assert.Equal(t, ErrorNotFoundEmailCode, ConsumeEmailCode(con, 0, "123456", maxAttempts))
+
+	assert.NoError(t, IssueEmailCode(con, userID, "123456", 60))
+	assert.NoError(t, IssueEmailCode(con, userID, "654321", 60))
+
+	// 먼저 발급한 코드는 사용할 수 없다.
+	assert.Equal(t, ErrorIncorrectEmailCode, ConsumeEmailCode(con, userID, "123456", maxAttempts))
+	assert.NoError(t, ConsumeEmailCode(con, userID, "654321", maxAttempts))
+	assert.Equal(t, ErrorNotFoundEmailCode, ConsumeEmailCode(con, userID, "654321", maxAttempts))
+
+	assert.NoError(t, IssueEmailCode(con, userID, "111111", 60))
+	assert.Equal(t, ErrorIncorrectEmailCode, ConsumeEmailCode(con, userID, "000000", maxAttempts))
+	assert.Equal(t, ErrorIncorrectEmailCode, ConsumeEmailCode(con, userID, "000000", maxAttempts))
+	assert.Equal(t, ErrorTooManyEmailCodeAttempts, ConsumeEmailCode(con, userID, "111111", maxAttempts))
+
+	assert.NoError(t, IssueEmailCode(con, userID, "222222", -1))
+	assert.Equal(t, ErrorExpiredEmailCode, ConsumeEmailCode(con, userID, "222222", maxAttempts))
+}
+
+func TestConsumeEmailCodeConcurrently(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	const userID = 2
+	const maxAttempts = 3
+	assert.NoError(t, IssueEmailCode(con, userID, "123456", 60))
+
+	// 동시에 추측해도 최대 시도 횟수만큼만 코드를 비교한다.
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- ConsumeEmailCode(con, userID, "000000", maxAttempts)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	incorrect := 0
+	for err := range errs {
+		if err == ErrorIncorrectEmailCode {
+			incorrect++
+			continue
+		}
+		assert.Equal(t, ErrorTooManyEmailCodeAttempts, err)
+	}
+	assert.Equal(t, maxAttempts, incorrect)
+	assert.Equal(t, ErrorTooManyEmailCodeAttempts, ConsumeEmailCode(con, userID, "123456", maxAttempts))
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// JWTKey is ORM of the key to sign and verify JWT.
+// The most recently promoted key signs, keys not yet retired verify.
+type JWTKey struct {
+	IDField
+	Kid    string `gorm:"size:64;unique_index;not null"`
+	Method string `gorm:"size:16;not null"`
+	// Secret is HMAC secret key or PEM encoded private key.
+	// It is stored as it is, so access to the table must be limited like the key file.
+	Secret     string `gorm:"type:text;not null"`
+	PromotedAt *time.Time
+	RetireAt   *time.Time
+
+	DateTimeFields
+}
+
+// JSONJWTKey is used when payload to a request.
+// This is a structure with secret removed.
+type JSONJWTKey struct {
+	Kid        string `json:"kid"`
+	Method     string `json:"method"`
+	PromotedAt *int64 `json:"promoted_at"`
+	RetireAt   *int64 `json:"retire_at"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// MarshalJSON .
+func (k JWTKey) MarshalJSON() ([]byte, error) {
+	key := &JSONJWTKey{
+		Kid:       k.Kid,
+		Method:    k.Method,
+		CreatedAt: k.CreatedAt.Unix(),
+	}
+	if k.PromotedAt != nil {
+		ts := k.PromotedAt.Unix()
+		key.PromotedAt = &ts
+	}
+	if k.RetireAt != nil {
+		ts := k.RetireAt.Unix()
+		key.RetireAt = &ts
+	}
+	return json.Marshal(key)
+}
+
+// Retired reports whether the key can no longer verify JWT.
+func (k *JWTKey) Retired() bool {
+	return k.RetireAt != nil && !k.RetireAt.After(time.Now())
+}
+
+// Promote makes the key sign JWT from now on.
+// Applied when calling Save.
+func (k *JWTKey) Promote() {
+	now := time.Now()
+	k.PromotedAt = &now
+}
+
+// Retire stops the key verifying JWT after the duration.
+// Applied when calling Save.
+func (k *JWTKey) Retire(after time.Duration) {
+	// DB 의 datetime 은 초 단위이므로 반올림으로 폐기가 늦어지지 않도록 버린다.
+	retireAt := time.Now().Add(after).Truncate(time.Second)
+	k.RetireAt = &retireAt
+}
+
+// Save stores each attribute of JWTKey in DB.
+// If an error occurs while saving, rollback and return error.
+func (k *JWTKey) Save(con *gorm.DB) error {
+	do := func(tx *gorm.DB) error {
+		return tx.Save(k).Error
+	}
+	return Transaction(con, do)
+}
+
+// ActiveJWTKeys returns keys not yet retired.
+// The key to sign is first.
+func ActiveJWTKeys(con *gorm.DB) ([]JWTKey, error) {
+	var keys []JWTKey
+	err := con.
+		Where("retire_at IS NULL OR retire_at > ?", time.Now()).
+		Order("promoted_at IS NULL, promoted_at desc, id desc").
+		Find(&keys).Error
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// SigningJWTKey returns the key to sign.
+// Returns nil if no key has been promoted.
+func SigningJWTKey(keys []JWTKey) *JWTKey {
+	if len(keys) == 0 || keys[0].PromotedAt == nil {
+		return nil
+	}
+	return &keys[0]
+}
+
+// FirstJWTKeyPromotedAt returns when a key in DB was promoted for the first time,
+// that is when the configured key stopped signing.
+// Returns nil if no key has been promoted.
+func FirstJWTKeyPromotedAt(con *gorm.DB) (*time.Time, error) {
+	var key JWTKey
+	err := con.
+		Where("promoted_at IS NOT NULL").
+		Order("promoted_at").
+		First(&key).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key.PromotedAt, nil
+}
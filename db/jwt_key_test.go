@@ -0,0 +1,57 @@
+package db
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+)
+
+func TestActiveJWTKeys(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	promoted := JWTKey{Kid: uuid.New().String(), Method: "HS256", Secret: "promoted"}
+	promoted.Promote()
+	assert.NoError(t, promoted.Save(con))
+	defer con.Delete(&promoted)
+
+	retired := JWTKey{Kid: uuid.New().String(), Method: "HS256", Secret: "retired"}
+	retired.Retire(0)
+	assert.NoError(t, retired.Save(con))
+	defer con.Delete(&retired)
+	assert.True(t, retired.Retired())
+
+	created := JWTKey{Kid: uuid.New().String(), Method: "HS256", Secret: "created"}
+	assert.NoError(t, created.Save(con))
+	defer con.Delete(&created)
+
+	keys, err := ActiveJWTKeys(con)
+	assert.NoError(t, err)
+
+	kids := []string{}
+	for _, k := range keys {
+		kids = append(kids, k.Kid)
+	}
+	assert.Contains(t, kids, promoted.Kid)
+	assert.Contains(t, kids, created.Kid)
+	assert.NotContains(t, kids, retired.Kid)
+
+	assert.Equal(t, promoted.Kid, SigningJWTKey(keys).Kid)
+	assert.Nil(t, SigningJWTKey(nil))
+}
+
+func TestJWTKeyMarshalJSON(t *testing.T) {
+	key := JWTKey{Kid: "kid", Method: "HS256", Secret: "secret"}
+	v, err := json.Marshal(key)
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(string(v), key.Secret))
+}
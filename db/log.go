@@ -0,0 +1,41 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/loganstone/auth/utils"
+)
+
+// gormLogger writes logs of gorm with the logger of the context,
+// so queries of a request are logged with fields of the request.
+// Values of queries are not written, they may have secrets.
+type gormLogger struct {
+	ctx context.Context
+}
+
+// Print is called by gorm with level, source and values of the log.
+func (g gormLogger) Print(values ...interface{}) {
+	if len(values) < 2 {
+		return
+	}
+
+	l := utils.LoggerFromContext(g.ctx).With("source", values[1])
+	if values[0] == "sql" && len(values) >= 6 {
+		duration, _ := values[2].(time.Duration)
+		l.With(
+			"query", values[3],
+			"rows", values[5],
+			"duration_ms", float64(duration)/float64(time.Millisecond),
+		).Debugf("sql")
+		return
+	}
+
+	msg := fmt.Sprint(values[2:]...)
+	if values[0] == "error" {
+		l.Errorf("%s", msg)
+		return
+	}
+	l.Infof("%s", msg)
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	// ErrorNotFoundMagicLink .
+	ErrorNotFoundMagicLink = errors.New("not found magic link")
+	// ErrorUsedMagicLink .
+	ErrorUsedMagicLink = errors.New("magic link has already been used")
+)
+
+// MagicLink is ORM of the signin link sent by email.
+// Only 'jti' of the token is stored, the token itself is in the link.
+type MagicLink struct {
+	IDField
+	Jti       string `gorm:"size:36;unique_index;not null"`
+	UserID    uint   `gorm:"index;not null"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+
+	DateTimeFields
+}
+
+// IssueMagicLink stores jti of the token sent to the user.
+// Rows of links already expired are deleted together.
+func IssueMagicLink(con *gorm.DB, userID uint, jti string, expiresAt time.Time) error {
+	l := MagicLink{
+		Jti:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}
+	do := func(tx *gorm.DB) error {
+		err := tx.Unscoped().
+			Where("expires_at < ?", time.Now()).
+			Delete(&MagicLink{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&l).Error
+	}
+	return Transaction(con, do)
+}
+
+// ConsumeMagicLink returns the link identified by jti and marks it used.
+// Each link can be used only once.
+// Expiry is not checked here, it is already done by the token.
+func ConsumeMagicLink(con *gorm.DB, jti string) (*MagicLink, error) {
+	l := MagicLink{}
+	if con.Where("jti = ?", jti).First(&l).RecordNotFound() {
+		return nil, ErrorNotFoundMagicLink
+	}
+
+	if l.UsedAt != nil {
+		return nil, ErrorUsedMagicLink
+	}
+
+	do := func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&l).
+			Where("used_at IS NULL").
+			Update("used_at", &now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrorUsedMagicLink
+		}
+		return nil
+	}
+	if err := Transaction(con, do); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
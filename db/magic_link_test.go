@@ -0,0 +1,36 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+)
+
+func TestConsumeMagicLink(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	const userID = 1
+	jti := uuid.New().String()
+
+	_, err = ConsumeMagicLink(con, jti)
+	assert.Equal(t, ErrorNotFoundMagicLink, err)
+
+	assert.NoError(t, IssueMagicLink(con, userID, jti, time.Now().Add(time.Minute)))
+
+	l, err := ConsumeMagicLink(con, jti)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(userID), l.UserID)
+	assert.NotNil(t, l.UsedAt)
+
+	_, err = ConsumeMagicLink(con, jti)
+	assert.Equal(t, ErrorUsedMagicLink, err)
+}
@@ -0,0 +1,495 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/configs"
+)
+
+// Migration scripts are 'migrations/<version>_<name>.<up|down>.sql'.
+// Types differ by driver are written as template fields of 'migrationTypes'.
+//
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+const (
+	migrationTable   = "schema_migrations"
+	migrationLockKey = "auth_schema_migrations"
+	// pg_advisory_lock 는 숫자 키를 쓴다.
+	migrationPostgresLockKey = 7259021814
+	migrationLockTimeout     = 60
+	// 마이그레이션 도입 전에 AutoMigrate 로 만든 스키마는 처음에는 users 뿐이었고,
+	// 마지막에는 두 번째 버전까지와 같다.
+	baselineVersion = 2
+)
+
+var createTableRegExp = regexp.MustCompile(`(?i)^CREATE TABLE\s+(\w+)`)
+
+// Errors of migration.
+var (
+	ErrorMigrationLocked  = errors.New("another migration is running")
+	ErrorUnknownMigration = errors.New("applied migration is not in this version")
+)
+
+// migrationTypes are column types differ by driver.
+type migrationTypes struct {
+	ID       string
+	UInt     string
+	Bool     string
+	DateTime string
+	Blob     string
+	// SQLite 는 ALTER TABLE 로 할 수 없는 일이 있어 따로 쓴다.
+	SQLite bool
+}
+
+var migrationTypesByDriver = map[string]migrationTypes{
+	configs.DBDriverMySQL: {
+		ID:       "int unsigned AUTO_INCREMENT PRIMARY KEY",
+		UInt:     "int unsigned",
+		Bool:     "boolean",
+		DateTime: "DATETIME NULL",
+		Blob:     "varbinary(255)",
+	},
+	configs.DBDriverPostgres: {
+		ID:       "serial PRIMARY KEY",
+		UInt:     "integer",
+		Bool:     "boolean",
+		DateTime: "timestamp with time zone",
+		Blob:     "bytea",
+	},
+	configs.DBDriverSQLite: {
+		ID:       "integer PRIMARY KEY AUTOINCREMENT",
+		UInt:     "integer",
+		Bool:     "bool",
+		DateTime: "datetime",
+		Blob:     "blob",
+		SQLite:   true,
+	},
+}
+
+// Migration is a version of schema.
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus is a migration with time it was applied.
+// 'AppliedAt' is nil if it is not applied yet.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns embedded migrations in order of version.
+func Migrations() ([]Migration, error) {
+	entries, err := migrationFS.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		parts := strings.SplitN(strings.TrimSuffix(name, ".sql"), ".", 2)
+		if len(parts) != 2 || (parts[1] != "up" && parts[1] != "down") {
+			return nil, fmt.Errorf("invalid migration file name '%s'", name)
+		}
+
+		v := strings.SplitN(parts[0], "_", 2)
+		version, err := strconv.Atoi(v[0])
+		if err != nil || len(v) != 2 {
+			return nil, fmt.Errorf("invalid migration file name '%s'", name)
+		}
+
+		script, err := migrationFS.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: v[1]}
+			byVersion[version] = m
+		}
+		if m.Name != v[1] {
+			return nil, fmt.Errorf("migration version %d is duplicated", version)
+		}
+		if parts[1] == "up" {
+			m.up = string(script)
+		} else {
+			m.down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration version %d needs both up and down", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// statements renders the script for the driver and splits it into statements.
+func statements(script, driver string) ([]string, error) {
+	types, ok := migrationTypesByDriver[driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported driver '%s'", driver)
+	}
+
+	tmpl, err := template.New("migration").Option("missingkey=error").Parse(script)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, types); err != nil {
+		return nil, err
+	}
+
+	var stmts []string
+	var stmt strings.Builder
+	for _, line := range strings.Split(buf.String(), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(stmt.String()), ";"))
+			stmt.Reset()
+		}
+	}
+	if s := strings.TrimSpace(stmt.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+	return stmts, nil
+}
+
+// migrator runs migrations on a connection held during the run.
+type migrator struct {
+	driver string
+	conn   *sql.Conn
+}
+
+// rebind changes '?' placeholders for the driver.
+func (m *migrator) rebind(query string) string {
+	if m.driver != configs.DBDriverPostgres {
+		return query
+	}
+	n := 0
+	var b strings.Builder
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// lock keeps other instances from migrating at the same time.
+// SQLite has no lock across connections, migration itself is checked in transaction.
+func (m *migrator) lock(ctx context.Context) error {
+	var locked sql.NullInt64
+	switch m.driver {
+	case configs.DBDriverMySQL:
+		err := m.conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)",
+			migrationLockKey, migrationLockTimeout).Scan(&locked)
+		if err != nil {
+			return err
+		}
+		if locked.Int64 != 1 {
+			return ErrorMigrationLocked
+		}
+	case configs.DBDriverPostgres:
+		_, err := m.conn.ExecContext(ctx,
+			"SELECT pg_advisory_lock($1)", migrationPostgresLockKey)
+		return err
+	}
+	return nil
+}
+
+func (m *migrator) unlock(ctx context.Context) error {
+	var err error
+	switch m.driver {
+	case configs.DBDriverMySQL:
+		_, err = m.conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", migrationLockKey)
+	case configs.DBDriverPostgres:
+		_, err = m.conn.ExecContext(ctx,
+			"SELECT pg_advisory_unlock($1)", migrationPostgresLockKey)
+	}
+	return err
+}
+
+func (m *migrator) createTable(ctx context.Context) error {
+	types := migrationTypesByDriver[m.driver]
+	_, err := m.conn.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version bigint NOT NULL PRIMARY KEY, "+
+			"name varchar(255) NOT NULL, applied_at %s)",
+		migrationTable, types.DateTime))
+	return err
+}
+
+// applied returns applied versions with time they were applied.
+func (m *migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := m.conn.QueryContext(ctx,
+		"SELECT version, applied_at FROM "+migrationTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// createdTables returns tables created by the up script of the migration.
+func (m *migrator) createdTables(mig Migration) ([]string, error) {
+	stmts, err := statements(mig.up, m.driver)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for _, stmt := range stmts {
+		if match := createTableRegExp.FindStringSubmatch(stmt); match != nil {
+			tables = append(tables, match[1])
+		}
+	}
+	return tables, nil
+}
+
+// baseline records versions up to 'baselineVersion' as applied in order,
+// while every table they create exists, if the schema was made by AutoMigrate
+// before migrations. Versions after a missing table are applied as usual.
+func (m *migrator) baseline(ctx context.Context, con *gorm.DB, migrations []Migration) error {
+	applied, err := m.applied(ctx)
+	if err != nil || len(applied) > 0 {
+		return err
+	}
+
+	for _, mig := range migrations {
+		if mig.Version > baselineVersion {
+			return nil
+		}
+
+		tables, err := m.createdTables(mig)
+		if err != nil {
+			return err
+		}
+		for _, table := range tables {
+			if !con.HasTable(table) {
+				return nil
+			}
+		}
+
+		_, err = m.conn.ExecContext(ctx, m.rebind(
+			"INSERT INTO "+migrationTable+" (version, name, applied_at) VALUES (?, ?, ?)"),
+			mig.Version, mig.Name, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run applies the script of the migration in a transaction.
+// The version is checked again in the transaction, so that
+// the migration is not run twice without lock.
+// MySQL commits DDL implicitly, failed migration may be applied partly.
+func (m *migrator) run(ctx context.Context, mig Migration, up bool) error {
+	script := mig.down
+	if up {
+		script = mig.up
+	}
+	stmts, err := statements(script, m.driver)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx, m.rebind(
+		"SELECT COUNT(*) FROM "+migrationTable+" WHERE version = ?"), mig.Version).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if (count > 0) == up {
+		return tx.Commit()
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("migration %d_%s failed: %w", mig.Version, mig.Name, err)
+		}
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, m.rebind(
+			"INSERT INTO "+migrationTable+" (version, name, applied_at) VALUES (?, ?, ?)"),
+			mig.Version, mig.Name, time.Now())
+	} else {
+		_, err = tx.ExecContext(ctx, m.rebind(
+			"DELETE FROM "+migrationTable+" WHERE version = ?"), mig.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// withMigrator runs 'do' holding the migration lock.
+func withMigrator(con *gorm.DB, do func(ctx context.Context, m *migrator, migrations []Migration) error) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := con.DB().Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	m := &migrator{driver: con.Dialect().GetName(), conn: conn}
+	if _, ok := migrationTypesByDriver[m.driver]; !ok {
+		return fmt.Errorf("unsupported driver '%s'", m.driver)
+	}
+
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.unlock(ctx)
+
+	if err := m.createTable(ctx); err != nil {
+		return err
+	}
+	if err := m.baseline(ctx, con, migrations); err != nil {
+		return err
+	}
+	return do(ctx, m, migrations)
+}
+
+// MigrateUp applies up to 'steps' migrations not applied yet in order of version.
+// All pending migrations are applied if 'steps' is not positive.
+// It returns applied migrations.
+func MigrateUp(con *gorm.DB, steps int) ([]Migration, error) {
+	var done []Migration
+	err := withMigrator(con, func(ctx context.Context, m *migrator, migrations []Migration) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range migrations {
+			if steps > 0 && len(done) == steps {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.run(ctx, mig, true); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrateDown reverts up to 'steps' applied migrations from the latest.
+// It returns reverted migrations.
+func MigrateDown(con *gorm.DB, steps int) ([]Migration, error) {
+	var done []Migration
+	err := withMigrator(con, func(ctx context.Context, m *migrator, migrations []Migration) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		byVersion := map[int]Migration{}
+		for _, mig := range migrations {
+			byVersion[mig.Version] = mig
+		}
+
+		versions := make([]int, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		for _, v := range versions {
+			if len(done) == steps {
+				break
+			}
+			mig, ok := byVersion[v]
+			if !ok {
+				return fmt.Errorf("version %d: %w", v, ErrorUnknownMigration)
+			}
+			if err := m.run(ctx, mig, false); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrationStatuses returns every migration with whether it is applied.
+func MigrationStatuses(con *gorm.DB) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := withMigrator(con, func(ctx context.Context, m *migrator, migrations []Migration) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range migrations {
+			status := MigrationStatus{Migration: mig}
+			if at, ok := applied[mig.Version]; ok {
+				status.AppliedAt = &at
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
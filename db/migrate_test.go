@@ -0,0 +1,204 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+)
+
+func sqliteForTest(t *testing.T) *gorm.DB {
+	dsn := "file:" + filepath.Join(t.TempDir(), "auth_test.db") + "?_busy_timeout=5000"
+	con, err := Connection(configs.DBDriverSQLite, dsn, false)
+	assert.NoError(t, err)
+	return con
+}
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Equal(t, "init", migrations[0].Name)
+	for i, m := range migrations {
+		if i > 0 {
+			assert.True(t, migrations[i-1].Version < m.Version)
+		}
+
+		// 모든 드라이버에서 스크립트가 만들어져야 한다.
+		for driver := range migrationTypesByDriver {
+			up, err := statements(m.up, driver)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, up)
+			down, err := statements(m.down, driver)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, down)
+		}
+	}
+}
+
+func TestStatements(t *testing.T) {
+	script := `-- comment
+CREATE TABLE a (
+    id {{.ID}},
+    at {{.DateTime}}
+);
+
+CREATE INDEX idx_a_at ON a(at);
+`
+	stmts, err := statements(script, configs.DBDriverPostgres)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"CREATE TABLE a (\n    id serial PRIMARY KEY,\n    at timestamp with time zone\n)",
+		"CREATE INDEX idx_a_at ON a(at)",
+	}, stmts)
+
+	_, err = statements(script, "oracle")
+	assert.EqualError(t, err, "unsupported driver 'oracle'")
+
+	_, err = statements("{{.Unknown}}", configs.DBDriverMySQL)
+	assert.Error(t, err)
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	con := sqliteForTest(t)
+	defer con.Close()
+
+	migrations, err := Migrations()
+	assert.NoError(t, err)
+
+	done, err := MigrateUp(con, 0)
+	assert.NoError(t, err)
+	assert.Len(t, done, len(migrations))
+	assert.True(t, con.HasTable(&User{}))
+
+	done, err = MigrateUp(con, 0)
+	assert.NoError(t, err)
+	assert.Len(t, done, 0)
+
+	statuses, err := MigrationStatuses(con)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, len(migrations))
+	for _, s := range statuses {
+		assert.NotNil(t, s.AppliedAt)
+	}
+
+	user := User{Email: "test@mail.com"}
+	assert.NoError(t, user.Create(con, "Ok1234567!"))
+
+	done, err = MigrateDown(con, len(migrations))
+	assert.NoError(t, err)
+	assert.Len(t, done, len(migrations))
+	assert.Equal(t, 1, done[len(done)-1].Version)
+	assert.False(t, con.HasTable(&User{}))
+
+	statuses, err = MigrationStatuses(con)
+	assert.NoError(t, err)
+	for _, s := range statuses {
+		assert.Nil(t, s.AppliedAt)
+	}
+
+	// 한 단계씩 올릴 수 있다.
+	done, err = MigrateUp(con, 1)
+	assert.NoError(t, err)
+	assert.Len(t, done, 1)
+	assert.True(t, con.HasTable(&User{}))
+	assert.False(t, con.HasTable(&RefreshToken{}))
+}
+
+func TestMigrateBaseline(t *testing.T) {
+	con := sqliteForTest(t)
+	defer con.Close()
+
+	// 마이그레이션 전에 AutoMigrate 로 만든 데이터베이스
+	assert.NoError(t, con.AutoMigrate(&legacyUser{}).Error)
+	admin := legacyUser{User: User{Email: "admin@mail.com"}, IsAdmin: true}
+	assert.NoError(t, con.Create(&admin).Error)
+	assert.NoError(t, con.Create(&legacyUser{User: User{Email: "test@mail.com"}}).Error)
+
+	// users 만 있으므로 첫 버전만 적용된 것으로 보고 나머지 테이블을 만든다.
+	done, err := MigrateUp(con, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, done[0].Version)
+
+	statuses, err := MigrationStatuses(con)
+	assert.NoError(t, err)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	for _, model := range []interface{}{
+		&RefreshToken{}, &JWTKey{}, &SigninLock{}, &OutboxEvent{},
+		&Webhook{}, &WebhookDelivery{}, &WebhookAttempt{}, &Role{},
+	} {
+		assert.True(t, con.HasTable(model))
+	}
+	assert.NoError(t, con.Create(&JWTKey{Kid: "kid", Method: "HS256", Secret: "secret"}).Error)
+
+	var count int
+	assert.NoError(t, con.Model(&User{}).Count(&count).Error)
+	assert.Equal(t, 2, count)
+
+	// 관리자는 superuser 가 된다.
+	names, err := UserRoleNames(con, admin.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{SuperuserRole}, names)
+	names, err = UserRoleNames(con, admin.ID+1)
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+
+	// 되돌리면 superuser 는 다시 관리자가 된다.
+	_, err = MigrateDown(con, len(done))
+	assert.NoError(t, err)
+	var users []legacyUser
+	assert.NoError(t, con.Order("id").Find(&users).Error)
+	assert.True(t, users[0].IsAdmin)
+	assert.False(t, users[1].IsAdmin)
+}
+
+func TestMigrateBaselineWithAllTables(t *testing.T) {
+	con := sqliteForTest(t)
+	defer con.Close()
+
+	// 마이그레이션 직전에 AutoMigrate 로 모든 테이블을 만든 데이터베이스
+	_, err := MigrateUp(con, baselineVersion)
+	assert.NoError(t, err)
+	assert.NoError(t, con.Exec("DELETE FROM schema_migrations").Error)
+
+	done, err := MigrateUp(con, 0)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, done)
+	for _, m := range done {
+		assert.Greater(t, m.Version, baselineVersion)
+	}
+
+	statuses, err := MigrationStatuses(con)
+	assert.NoError(t, err)
+	for _, s := range statuses {
+		assert.NotNil(t, s.AppliedAt)
+	}
+}
+
+// legacyUser is user made by AutoMigrate before roles, admin was a column of it.
+type legacyUser struct {
+	User
+	IsAdmin bool `gorm:"default:false"`
+}
+
+func (legacyUser) TableName() string {
+	return "users"
+}
+
+func TestMigrateDownWithUnknownVersion(t *testing.T) {
+	con := sqliteForTest(t)
+	defer con.Close()
+
+	_, err := MigrateUp(con, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, con.Exec(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (99999, 'future', ?)",
+		gorm.NowFunc()).Error)
+
+	_, err = MigrateDown(con, 1)
+	assert.EqualError(t, err, "version 99999: "+ErrorUnknownMigration.Error())
+}
@@ -0,0 +1,16 @@
+-- 처음 스키마, AutoMigrate 로 만들던 테이블과 같다.
+
+CREATE TABLE users (
+    id {{.ID}},
+    email varchar(255) NOT NULL,
+    hashed_password varchar(255) NOT NULL,
+    is_admin {{.Bool}} DEFAULT false,
+    otp_secret_key varchar(16),
+    otp_backup_codes {{.Blob}},
+    otp_confirmed_at {{.DateTime}},
+    password_reset_ts integer,
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE INDEX idx_users_email ON users(email);
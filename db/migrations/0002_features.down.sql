@@ -0,0 +1,16 @@
+DROP TABLE webhook_attempts;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
+DROP TABLE outbox_events;
+DROP TABLE audit_events;
+DROP TABLE signin_locks;
+DROP TABLE magic_links;
+DROP TABLE email_codes;
+DROP TABLE web_authn_challenges;
+DROP TABLE web_authn_credentials;
+DROP TABLE revoked_tokens;
+DROP TABLE service_accounts;
+DROP TABLE o_auth_authorization_codes;
+DROP TABLE o_auth_clients;
+DROP TABLE jwt_keys;
+DROP TABLE refresh_tokens;
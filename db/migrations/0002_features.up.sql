@@ -0,0 +1,231 @@
+-- 마이그레이션 도입 전까지 더한 기능의 테이블.
+
+CREATE TABLE refresh_tokens (
+    id {{.ID}},
+    user_id {{.UInt}} NOT NULL,
+    family varchar(36) NOT NULL,
+    hashed_token varchar(64) NOT NULL,
+    auth_time bigint,
+    amr varchar(255),
+    expires_at {{.DateTime}},
+    rotated_at {{.DateTime}},
+    revoked_at {{.DateTime}},
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens(family);
+CREATE UNIQUE INDEX uix_refresh_tokens_hashed_token ON refresh_tokens(hashed_token);
+
+CREATE TABLE jwt_keys (
+    id {{.ID}},
+    kid varchar(64) NOT NULL,
+    method varchar(16) NOT NULL,
+    secret text NOT NULL,
+    promoted_at {{.DateTime}},
+    retire_at {{.DateTime}},
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE UNIQUE INDEX uix_jwt_keys_kid ON jwt_keys(kid);
+
+CREATE TABLE o_auth_clients (
+    id {{.ID}},
+    client_id varchar(64) NOT NULL,
+    hashed_secret varchar(255),
+    name varchar(255) NOT NULL,
+    redirect_uris text NOT NULL,
+    scope text,
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE UNIQUE INDEX uix_o_auth_clients_client_id ON o_auth_clients(client_id);
+
+CREATE TABLE o_auth_authorization_codes (
+    id {{.ID}},
+    hashed_code varchar(64) NOT NULL,
+    client_id varchar(64) NOT NULL,
+    user_id {{.UInt}} NOT NULL,
+    redirect_uri text NOT NULL,
+    scope text,
+    code_challenge varchar(255) NOT NULL,
+    nonce text,
+    auth_time bigint,
+    amr varchar(255),
+    expires_at {{.DateTime}},
+    used_at {{.DateTime}},
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE INDEX idx_o_auth_authorization_codes_client_id ON o_auth_authorization_codes(client_id);
+CREATE UNIQUE INDEX uix_o_auth_authorization_codes_hashed_code ON o_auth_authorization_codes(hashed_code);
+
+CREATE TABLE service_accounts (
+    id {{.ID}},
+    client_id varchar(64) NOT NULL,
+    hashed_secret varchar(255) NOT NULL,
+    name varchar(255) NOT NULL,
+    scope text,
+    disabled_at {{.DateTime}},
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE UNIQUE INDEX uix_service_accounts_client_id ON service_accounts(client_id);
+
+CREATE TABLE revoked_tokens (
+    id {{.ID}},
+    jti varchar(36) NOT NULL,
+    expires_at {{.DateTime}},
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE UNIQUE INDEX uix_revoked_tokens_jti ON revoked_tokens(jti);
+
+CREATE TABLE web_authn_credentials (
+    id {{.ID}},
+    user_id {{.UInt}} NOT NULL,
+    credential_id varchar(255) NOT NULL,
+    public_key {{.Blob}} NOT NULL,
+    sign_count {{.UInt}},
+    transports varchar(255),
+    nickname varchar(255),
+    aa_guid varchar(36),
+    last_used_at {{.DateTime}},
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE INDEX idx_web_authn_credentials_user_id ON web_authn_credentials(user_id);
+CREATE UNIQUE INDEX uix_web_authn_credentials_credential_id ON web_authn_credentials(credential_id);
+
+CREATE TABLE web_authn_challenges (
+    id {{.ID}},
+    hashed_challenge varchar(64) NOT NULL,
+    user_id {{.UInt}},
+    ceremony varchar(32) NOT NULL,
+    expires_at {{.DateTime}},
+    used_at {{.DateTime}},
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE UNIQUE INDEX uix_web_authn_challenges_hashed_challenge ON web_authn_challenges(hashed_challenge);
+
+CREATE TABLE email_codes (
+    id {{.ID}},
+    user_id {{.UInt}} NOT NULL,
+    hashed_code varchar(255) NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    expires_at {{.DateTime}},
+    used_at {{.DateTime}},
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE INDEX idx_email_codes_user_id ON email_codes(user_id);
+
+CREATE TABLE magic_links (
+    id {{.ID}},
+    jti varchar(36) NOT NULL,
+    user_id {{.UInt}} NOT NULL,
+    expires_at {{.DateTime}},
+    used_at {{.DateTime}},
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE INDEX idx_magic_links_user_id ON magic_links(user_id);
+CREATE UNIQUE INDEX uix_magic_links_jti ON magic_links(jti);
+
+CREATE TABLE signin_locks (
+    id {{.ID}},
+    subject varchar(255) NOT NULL,
+    failures integer NOT NULL DEFAULT 0,
+    last_failed_at {{.DateTime}},
+    locked_until {{.DateTime}},
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE UNIQUE INDEX uix_signin_locks_subject ON signin_locks(subject);
+
+CREATE TABLE audit_events (
+    id {{.ID}},
+    actor_id {{.UInt}},
+    actor_email varchar(255),
+    actor_client_id varchar(255),
+    target_user_id {{.UInt}},
+    target_email varchar(255),
+    action varchar(64) NOT NULL,
+    outcome varchar(16) NOT NULL,
+    status integer,
+    ip varchar(45),
+    user_agent varchar(255),
+    request_id varchar(36),
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE INDEX idx_audit_events_action ON audit_events(action);
+CREATE INDEX idx_audit_events_actor_id ON audit_events(actor_id);
+CREATE INDEX idx_audit_events_target_user_id ON audit_events(target_user_id);
+
+CREATE TABLE outbox_events (
+    id {{.ID}},
+    event_id varchar(36) NOT NULL,
+    type varchar(64) NOT NULL,
+    user_id {{.UInt}},
+    payload text,
+    published_at {{.DateTime}},
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE INDEX idx_outbox_events_published_at ON outbox_events(published_at);
+CREATE UNIQUE INDEX uix_outbox_events_event_id ON outbox_events(event_id);
+
+CREATE TABLE webhooks (
+    id {{.ID}},
+    url text NOT NULL,
+    event_types text NOT NULL,
+    secret varchar(255) NOT NULL,
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+
+CREATE TABLE webhook_deliveries (
+    id {{.ID}},
+    webhook_id {{.UInt}} NOT NULL,
+    event_id varchar(36) NOT NULL,
+    event_type varchar(64) NOT NULL,
+    payload text,
+    attempts integer NOT NULL DEFAULT 0,
+    last_status_code integer,
+    next_attempt_at {{.DateTime}},
+    delivered_at {{.DateTime}},
+    failed_at {{.DateTime}},
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id);
+CREATE INDEX idx_webhook_deliveries_next_attempt_at ON webhook_deliveries(next_attempt_at);
+
+CREATE TABLE webhook_attempts (
+    id {{.ID}},
+    delivery_id {{.UInt}} NOT NULL,
+    status_code integer,
+    error varchar(255),
+    duration_ms bigint,
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+CREATE INDEX idx_webhook_attempts_delivery_id ON webhook_attempts(delivery_id);
@@ -0,0 +1,13 @@
+-- superuser 를 가진 사용자를 다시 관리자로 만든다. 다른 역할의 권한은 잃는다.
+
+UPDATE users SET is_admin = false;
+UPDATE users SET is_admin = true WHERE id IN (
+    SELECT user_roles.user_id FROM user_roles
+    JOIN roles ON roles.id = user_roles.role_id
+    WHERE roles.name = 'superuser'
+);
+
+DROP TABLE user_roles;
+DROP TABLE role_permissions;
+DROP TABLE roles;
+DROP TABLE permissions;
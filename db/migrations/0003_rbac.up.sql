@@ -0,0 +1,61 @@
+-- 역할과 권한. 관리자는 모든 권한을 가진 기본 역할 superuser 를 받는다.
+-- users.is_admin 은 되돌릴 때 쓰려고 남겨 두고 더 이상 읽지 않는다.
+
+CREATE TABLE permissions (
+    id {{.ID}},
+    name varchar(64) NOT NULL,
+    description varchar(255)
+);
+CREATE UNIQUE INDEX uix_permissions_name ON permissions(name);
+
+CREATE TABLE roles (
+    id {{.ID}},
+    name varchar(64) NOT NULL,
+    description varchar(255),
+    builtin {{.Bool}} DEFAULT false,
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}}
+);
+CREATE UNIQUE INDEX uix_roles_name ON roles(name);
+
+CREATE TABLE role_permissions (
+    role_id {{.UInt}} NOT NULL,
+    permission_id {{.UInt}} NOT NULL,
+    PRIMARY KEY (role_id, permission_id)
+);
+CREATE INDEX idx_role_permissions_permission_id ON role_permissions(permission_id);
+
+CREATE TABLE user_roles (
+    user_id {{.UInt}} NOT NULL,
+    role_id {{.UInt}} NOT NULL,
+    created_at {{.DateTime}},
+    PRIMARY KEY (user_id, role_id)
+);
+CREATE INDEX idx_user_roles_role_id ON user_roles(role_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:read', 'Read users'),
+    ('users:delete', 'Delete users'),
+    ('otp:reset', 'Reset OTP of users'),
+    ('signin_locks:read', 'Read signin locks of users'),
+    ('signin_locks:clear', 'Clear signin locks of users'),
+    ('roles:read', 'Read roles and roles of users'),
+    ('roles:write', 'Create, change and delete roles'),
+    ('roles:assign', 'Assign roles to users and unassign them'),
+    ('jwt_keys:read', 'Read JWT keys'),
+    ('jwt_keys:write', 'Create, promote and retire JWT keys'),
+    ('oauth_clients:read', 'Read OAuth clients'),
+    ('oauth_clients:write', 'Create and delete OAuth clients'),
+    ('service_accounts:read', 'Read service accounts'),
+    ('service_accounts:write', 'Create, disable and rotate secret of service accounts'),
+    ('webhooks:read', 'Read webhooks and deliveries'),
+    ('webhooks:write', 'Create and delete webhooks and redeliver'),
+    ('audit:read', 'Read audit events');
+
+-- superuser 는 권한 목록과 관계없이 모든 권한을 가지므로 role_permissions 에 넣지 않는다.
+INSERT INTO roles (name, description, builtin, created_at, updated_at) VALUES
+    ('superuser', 'Every permission', true, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+
+INSERT INTO user_roles (user_id, role_id, created_at)
+SELECT users.id, roles.id, CURRENT_TIMESTAMP FROM users, roles
+WHERE users.is_admin = true AND roles.name = 'superuser';
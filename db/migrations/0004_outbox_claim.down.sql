@@ -0,0 +1,24 @@
+{{if .SQLite}}
+-- SQLite 3.35 전에는 열을 지울 수 없으므로 테이블을 다시 만든다.
+CREATE TABLE outbox_events_down (
+    id {{.ID}},
+    event_id varchar(36) NOT NULL,
+    type varchar(64) NOT NULL,
+    user_id {{.UInt}},
+    payload text,
+    published_at {{.DateTime}},
+    created_at {{.DateTime}},
+    updated_at {{.DateTime}},
+    deleted_at {{.DateTime}}
+);
+INSERT INTO outbox_events_down
+SELECT id, event_id, type, user_id, payload, published_at, created_at, updated_at, deleted_at
+FROM outbox_events;
+DROP TABLE outbox_events;
+ALTER TABLE outbox_events_down RENAME TO outbox_events;
+CREATE INDEX idx_outbox_events_published_at ON outbox_events(published_at);
+CREATE UNIQUE INDEX uix_outbox_events_event_id ON outbox_events(event_id);
+{{else}}
+ALTER TABLE outbox_events DROP COLUMN claimed_until;
+ALTER TABLE outbox_events DROP COLUMN claim_id;
+{{end}}
@@ -0,0 +1,6 @@
+-- 여러 인스턴스가 같은 이벤트를 동시에 전달하지 않도록 잠시 차지한다.
+-- claimed_until 이 지나면 다른 인스턴스가 다시 차지할 수 있다.
+
+ALTER TABLE outbox_events ADD COLUMN claim_id varchar(36);
+ALTER TABLE outbox_events ADD COLUMN claimed_until {{.DateTime}};
+CREATE INDEX idx_outbox_events_claim_id ON outbox_events(claim_id);
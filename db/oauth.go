@@ -0,0 +1,244 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/loganstone/auth/utils"
+)
+
+const authorizationCodeLen = 32
+
+var (
+	// ErrorNotFoundAuthorizationCode .
+	ErrorNotFoundAuthorizationCode = errors.New("not found authorization code")
+	// ErrorExpiredAuthorizationCode .
+	ErrorExpiredAuthorizationCode = errors.New("expired authorization code")
+	// ErrorUsedAuthorizationCode .
+	ErrorUsedAuthorizationCode = errors.New("authorization code has already been used")
+)
+
+// OAuthClient is OAuth 2.0 client ORM.
+// 'RedirectURIs' and 'Scope' are space separated lists.
+// Public client has no secret and must use PKCE.
+type OAuthClient struct {
+	IDField
+	ClientID     string `gorm:"size:64;unique_index;not null"`
+	HashedSecret string
+	Name         string `gorm:"not null"`
+	RedirectURIs string `gorm:"type:text;not null"`
+	Scope        string `gorm:"type:text"`
+
+	DateTimeFields
+}
+
+// JSONOAuthClient is used when payload to a request.
+// This is a structure with secret removed.
+type JSONOAuthClient struct {
+	ClientID     string   `json:"client_id"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scope        string   `json:"scope"`
+	Confidential bool     `json:"confidential"`
+	CreatedAt    int64    `json:"created_at"`
+}
+
+// MarshalJSON .
+func (c OAuthClient) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&JSONOAuthClient{
+		ClientID:     c.ClientID,
+		Name:         c.Name,
+		RedirectURIs: strings.Fields(c.RedirectURIs),
+		Scope:        c.Scope,
+		Confidential: c.Confidential(),
+		CreatedAt:    c.CreatedAt.Unix(),
+	})
+}
+
+// Confidential reports whether the client must authenticate with secret.
+func (c *OAuthClient) Confidential() bool {
+	return c.HashedSecret != ""
+}
+
+// SetSecret converts the secret into a hash string and saves it.
+func (c *OAuthClient) SetSecret(secret string) error {
+	hashedBytes, err := bcrypt.GenerateFromPassword(
+		[]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	c.HashedSecret = string(hashedBytes)
+	return nil
+}
+
+// VerifySecret verifies that the given secret is correct.
+// Public client does not have secret, so it is always true.
+func (c *OAuthClient) VerifySecret(secret string) bool {
+	if !c.Confidential() {
+		return true
+	}
+	err := bcrypt.CompareHashAndPassword(
+		[]byte(c.HashedSecret), []byte(secret))
+	return err == nil
+}
+
+// ValidRedirectURI reports whether the uri exactly matches one of registered.
+func (c *OAuthClient) ValidRedirectURI(uri string) bool {
+	for _, v := range strings.Fields(c.RedirectURIs) {
+		if v == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedScope returns the scope to be granted for the requested scope.
+// If the request is empty, every scope of the client is granted.
+// It returns false if any requested scope is not allowed to the client.
+func (c *OAuthClient) AllowedScope(scope string) (string, bool) {
+	return allowedScope(c.Scope, scope)
+}
+
+// Create saves the client in DB.
+func (c *OAuthClient) Create(con *gorm.DB) error {
+	do := func(tx *gorm.DB) error {
+		return tx.Create(c).Error
+	}
+	return Transaction(con, do)
+}
+
+// Delete deletes the client from DB.
+func (c *OAuthClient) Delete(con *gorm.DB) error {
+	do := func(tx *gorm.DB) error {
+		return tx.Delete(c).Error
+	}
+	return Transaction(con, do)
+}
+
+// FindOAuthClient returns the client or nil if not found.
+func FindOAuthClient(con *gorm.DB, clientID string) *OAuthClient {
+	client := OAuthClient{}
+	if con.Where("client_id = ?", clientID).First(&client).RecordNotFound() {
+		return nil
+	}
+	return &client
+}
+
+// OAuthAuthorizationCode is ORM of the code issued to the client
+// after the user approved the authorization request.
+type OAuthAuthorizationCode struct {
+	IDField
+	HashedCode    string `gorm:"size:64;unique_index;not null"`
+	ClientID      string `gorm:"size:64;index;not null"`
+	UserID        uint   `gorm:"not null"`
+	RedirectURI   string `gorm:"type:text;not null"`
+	Scope         string `gorm:"type:text"`
+	CodeChallenge string `gorm:"not null"`
+	Nonce         string `gorm:"type:text"`
+	AuthTime      int64
+	AMR           string
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+
+	DateTimeFields
+}
+
+// SetAuthentication keeps when and how the user signed in for ID token.
+func (a *OAuthAuthorizationCode) SetAuthentication(auth utils.Authentication) {
+	a.AuthTime = auth.AuthTime
+	a.AMR = strings.Join(auth.AMR, " ")
+}
+
+// Authentication returns when and how the user signed in.
+func (a *OAuthAuthorizationCode) Authentication() utils.Authentication {
+	return utils.Authentication{
+		AuthTime: a.AuthTime,
+		AMR:      strings.Fields(a.AMR),
+	}
+}
+
+// Issue saves the authorization code and returns the code to be given to the client.
+func (a *OAuthAuthorizationCode) Issue(con *gorm.DB, expireAfterSec int) (string, error) {
+	code, err := utils.RandomToken(authorizationCodeLen)
+	if err != nil {
+		return "", err
+	}
+
+	a.HashedCode = hashToken(code)
+	a.ExpiresAt = time.Now().Add(time.Second * time.Duration(expireAfterSec))
+	do := func(tx *gorm.DB) error {
+		return tx.Create(a).Error
+	}
+	if err := Transaction(con, do); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// FindAuthorizationCode returns the authorization code not used and not expired.
+// It is not consumed until 'Consume', so that the request is checked first.
+func FindAuthorizationCode(con *gorm.DB, code string) (*OAuthAuthorizationCode, error) {
+	a := OAuthAuthorizationCode{}
+	if con.Where("hashed_code = ?", hashToken(code)).First(&a).RecordNotFound() {
+		return nil, ErrorNotFoundAuthorizationCode
+	}
+
+	if a.UsedAt != nil {
+		return nil, ErrorUsedAuthorizationCode
+	}
+
+	if time.Now().After(a.ExpiresAt) {
+		return nil, ErrorExpiredAuthorizationCode
+	}
+	return &a, nil
+}
+
+// Consume marks the authorization code used.
+// Each code can be exchanged only once.
+func (a *OAuthAuthorizationCode) Consume(con *gorm.DB) error {
+	do := func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(a).
+			Where("used_at IS NULL").
+			Update("used_at", &now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrorUsedAuthorizationCode
+		}
+		return nil
+	}
+	return Transaction(con, do)
+}
+
+// allowedScope returns the requested scope if it is subset of the granted.
+// Every granted scope is returned if the request is empty.
+func allowedScope(granted, requested string) (string, bool) {
+	allowed := strings.Fields(granted)
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return strings.Join(allowed, " "), true
+	}
+
+	for _, s := range scopes {
+		if !containsString(allowed, s) {
+			return "", false
+		}
+	}
+	return strings.Join(scopes, " "), true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+)
+
+func TestOAuthClient(t *testing.T) {
+	client := OAuthClient{
+		ClientID:     uuid.New().String(),
+		Name:         "test client",
+		RedirectURIs: "https://example.com/callback https://example.com/other",
+		Scope:        "profile email",
+	}
+	assert.False(t, client.Confidential())
+	assert.True(t, client.VerifySecret(""))
+
+	assert.NoError(t, client.SetSecret("secret"))
+	assert.True(t, client.Confidential())
+	assert.True(t, client.VerifySecret("secret"))
+	assert.False(t, client.VerifySecret("wrong"))
+
+	assert.True(t, client.ValidRedirectURI("https://example.com/other"))
+	assert.False(t, client.ValidRedirectURI("https://example.com/callback/"))
+	assert.False(t, client.ValidRedirectURI("https://example.com"))
+
+	scope, ok := client.AllowedScope("")
+	assert.True(t, ok)
+	assert.Equal(t, "profile email", scope)
+	scope, ok = client.AllowedScope("email")
+	assert.True(t, ok)
+	assert.Equal(t, "email", scope)
+	_, ok = client.AllowedScope("email admin")
+	assert.False(t, ok)
+
+	b, err := json.Marshal(client)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), client.HashedSecret)
+	assert.Contains(t, string(b), `"confidential":true`)
+}
+
+func TestAuthorizationCode(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	a := OAuthAuthorizationCode{
+		ClientID:      uuid.New().String(),
+		UserID:        1,
+		RedirectURI:   "https://example.com/callback",
+		CodeChallenge: "challenge",
+	}
+	code, err := a.Issue(con, 60)
+	assert.NoError(t, err)
+	assert.NotEqual(t, code, a.HashedCode)
+
+	found, err := FindAuthorizationCode(con, code)
+	assert.NoError(t, err)
+	assert.Equal(t, a.ClientID, found.ClientID)
+
+	// 찾기만 한 코드는 소모되지 않는다.
+	other, err := FindAuthorizationCode(con, code)
+	assert.NoError(t, err)
+	assert.NoError(t, found.Consume(con))
+	assert.Equal(t, ErrorUsedAuthorizationCode, other.Consume(con))
+
+	_, err = FindAuthorizationCode(con, code)
+	assert.Equal(t, ErrorUsedAuthorizationCode, err)
+
+	_, err = FindAuthorizationCode(con, "unknown")
+	assert.Equal(t, ErrorNotFoundAuthorizationCode, err)
+
+	expired := OAuthAuthorizationCode{
+		ClientID:      a.ClientID,
+		UserID:        1,
+		RedirectURI:   a.RedirectURI,
+		CodeChallenge: "challenge",
+	}
+	code, err = expired.Issue(con, -1)
+	assert.NoError(t, err)
+	_, err = FindAuthorizationCode(con, code)
+	assert.Equal(t, ErrorExpiredAuthorizationCode, err)
+}
@@ -0,0 +1,199 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/utils"
+)
+
+// Types of domain event.
+const (
+	EventUserCreated     = "user.created"
+	EventUserDeleted     = "user.deleted"
+	EventPasswordChanged = "password.changed"
+	EventOTPConfirmed    = "otp.confirmed"
+	EventOTPReset        = "otp.reset"
+	EventSigninSucceeded = "signin.succeeded"
+	EventSigninFailed    = "signin.failed"
+)
+
+// EventTypes is all types of domain event.
+var EventTypes = []string{
+	EventUserCreated,
+	EventUserDeleted,
+	EventPasswordChanged,
+	EventOTPConfirmed,
+	EventOTPReset,
+	EventSigninSucceeded,
+	EventSigninFailed,
+}
+
+// outboxClaimLease is how long relaying events is kept from other instances.
+// Events not published in the lease can be claimed again.
+const outboxClaimLease = time.Minute
+
+// Reasons of 'password.changed' event.
+const (
+	PasswordChangeReason = "change"
+	PasswordResetReason  = "reset"
+)
+
+// EventData is payload of domain event.
+// Fields not related to the event are omitted.
+type EventData struct {
+	Email  string   `json:"email"`
+	IP     string   `json:"ip,omitempty"`
+	AMR    []string `json:"amr,omitempty"`
+	Reason string   `json:"reason,omitempty"`
+}
+
+// OutboxEvent is ORM of domain event waiting to be published.
+// It is written in the same transaction as the state change,
+// so the event exists if and only if the change is committed.
+// Published events are relayed at least once, consumers have to
+// deduplicate them by 'EventID'.
+// 'ClaimID' is set by the relay publishing the event until 'ClaimedUntil'.
+type OutboxEvent struct {
+	IDField
+	EventID      string `gorm:"size:36;unique_index;not null"`
+	Type         string `gorm:"size:64;not null"`
+	UserID       uint
+	Payload      string     `gorm:"type:text"`
+	PublishedAt  *time.Time `gorm:"index"`
+	ClaimID      string     `gorm:"size:36;index"`
+	ClaimedUntil *time.Time
+
+	DateTimeFields
+
+	data EventData
+}
+
+// NewOutboxEvent returns a new event about the user.
+// The event is written by the function given it, such as User.Save.
+// Zero user id is filled with the user id of the function.
+func NewOutboxEvent(eventType string, userID uint, data EventData) *OutboxEvent {
+	return &OutboxEvent{
+		EventID: uuid.New().String(),
+		Type:    eventType,
+		UserID:  userID,
+		data:    data,
+	}
+}
+
+// Event returns the event to be published.
+func (e *OutboxEvent) Event() utils.Event {
+	return utils.Event{
+		ID:         e.EventID,
+		Type:       e.Type,
+		UserID:     e.UserID,
+		OccurredAt: e.CreatedAt.Unix(),
+		Data:       json.RawMessage(e.Payload),
+	}
+}
+
+// addOutboxEvents writes the events in the transaction,
+// with webhook deliveries of them.
+func addOutboxEvents(tx *gorm.DB, userID uint, events []*OutboxEvent) error {
+	for _, e := range events {
+		if e.UserID == 0 {
+			e.UserID = userID
+		}
+
+		payload, err := json.Marshal(e.data)
+		if err != nil {
+			return err
+		}
+		e.Payload = string(payload)
+
+		if err := tx.Create(e).Error; err != nil {
+			return err
+		}
+
+		if err := enqueueWebhookDeliveries(tx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddOutboxEvents writes the events not tied to other state change.
+func AddOutboxEvents(con *gorm.DB, events ...*OutboxEvent) error {
+	do := func(tx *gorm.DB) error {
+		return addOutboxEvents(tx, 0, events)
+	}
+	return Transaction(con, do)
+}
+
+// claimOutboxEvents claims up to 'limit' events not published nor claimed by others,
+// and returns them in order of occurrence.
+// Events claimed by others are skipped, so instances relay different events.
+func claimOutboxEvents(con *gorm.DB, claimID string, limit int) ([]OutboxEvent, error) {
+	// DATETIME 에 초 단위로 저장되므로 미리 자른다.
+	now := time.Now().Truncate(time.Second)
+	unclaimed := func() *gorm.DB {
+		return con.Model(&OutboxEvent{}).
+			Where("published_at IS NULL").
+			Where("claimed_until IS NULL OR claimed_until < ?", now)
+	}
+
+	var ids []uint
+	if err := unclaimed().Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// 조건을 다시 걸어 그 사이에 다른 인스턴스가 차지한 이벤트는 빼고 차지한다.
+	err := unclaimed().Where("id IN (?)", ids).Updates(map[string]interface{}{
+		"claim_id":      claimID,
+		"claimed_until": now.Add(outboxClaimLease),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []OutboxEvent
+	err = con.Where("claim_id = ? AND published_at IS NULL", claimID).
+		Order("id").Find(&claimed).Error
+	return claimed, err
+}
+
+// RelayOutboxEvents publishes up to 'limit' events not published yet to the sink,
+// in order of occurrence. It returns the number of published events.
+// If publishing fails, the events are not marked and are relayed again next time.
+// Events are claimed while publishing, so that instances relaying at the same time
+// do not publish the same events. Events of instances are not in order each other.
+func RelayOutboxEvents(con *gorm.DB, sink utils.EventSink, limit int) (int, error) {
+	claimID := uuid.New().String()
+	pending, err := claimOutboxEvents(con, claimID, limit)
+	if err != nil || len(pending) == 0 {
+		return 0, err
+	}
+
+	events := make([]utils.Event, len(pending))
+	for i := range pending {
+		events[i] = pending[i].Event()
+	}
+
+	if err := sink.Publish(events); err != nil {
+		// 바로 다시 전달할 수 있도록 놓아 준다.
+		con.Model(&OutboxEvent{}).Where("claim_id = ?", claimID).
+			Updates(map[string]interface{}{"claim_id": nil, "claimed_until": nil})
+		return 0, err
+	}
+
+	do := func(tx *gorm.DB) error {
+		return tx.Model(&OutboxEvent{}).
+			Where("claim_id = ?", claimID).
+			Update("published_at", time.Now()).Error
+	}
+	if err := Transaction(con, do); err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/utils"
+)
+
+type failingEventSink struct{}
+
+func (failingEventSink) Publish(events []utils.Event) error {
+	return errors.New("unavailable")
+}
+
+func (failingEventSink) Close() error {
+	return nil
+}
+
+func TestRelayOutboxEvents(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	user := User{Email: uuid.New().String() + "@mail.com"}
+	assert.NoError(t, user.Create(con, "Ok1234567!"))
+	user.ConfirmOTP()
+	confirmed := NewOutboxEvent(EventOTPConfirmed, 0, EventData{Email: user.Email})
+	assert.NoError(t, user.Save(con, confirmed))
+	assert.NoError(t, user.Delete(con))
+
+	// 전달에 실패한 이벤트는 다음에 다시 전달된다.
+	_, err = RelayOutboxEvents(con, failingEventSink{}, 1000)
+	assert.EqualError(t, err, "unavailable")
+
+	sink := utils.NewMemoryEventSink()
+	for {
+		n, err := RelayOutboxEvents(con, sink, 2)
+		assert.NoError(t, err)
+		if n == 0 {
+			break
+		}
+	}
+
+	var events []utils.Event
+	for _, e := range sink.Events() {
+		if e.UserID == user.ID {
+			events = append(events, e)
+		}
+	}
+	assert.Len(t, events, 3)
+	assert.Equal(t, EventUserCreated, events[0].Type)
+	assert.Equal(t, EventOTPConfirmed, events[1].Type)
+	assert.Equal(t, confirmed.EventID, events[1].ID)
+	assert.Equal(t, EventUserDeleted, events[2].Type)
+
+	var data EventData
+	assert.NoError(t, json.Unmarshal(events[2].Data, &data))
+	assert.Equal(t, user.Email, data.Email)
+
+	var pending int
+	con.Model(&OutboxEvent{}).Where("published_at IS NULL").Count(&pending)
+	assert.Equal(t, 0, pending)
+}
+
+// slowEventSink publishes slowly, so that relays run at the same time.
+type slowEventSink struct {
+	*utils.MemoryEventSink
+}
+
+func (s slowEventSink) Publish(events []utils.Event) error {
+	time.Sleep(time.Millisecond * 10)
+	return s.MemoryEventSink.Publish(events)
+}
+
+func TestRelayOutboxEventsConcurrently(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	email := uuid.New().String() + "@mail.com"
+	var added []*OutboxEvent
+	for i := 0; i < 10; i++ {
+		added = append(added, NewOutboxEvent(EventSigninFailed, 0, EventData{Email: email}))
+	}
+	assert.NoError(t, AddOutboxEvents(con, added...))
+
+	// 다른 인스턴스가 차지한 이벤트는 차지가 끝날 때까지 전달하지 않는다.
+	claimed := added[0]
+	until := time.Now().Add(time.Hour)
+	assert.NoError(t, con.Model(claimed).Updates(map[string]interface{}{
+		"claim_id": uuid.New().String(), "claimed_until": until}).Error)
+
+	sink := slowEventSink{utils.NewMemoryEventSink()}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				n, err := RelayOutboxEvents(con, sink, 2)
+				assert.NoError(t, err)
+				if n == 0 || err != nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	published := func() map[string]int {
+		count := map[string]int{}
+		for _, e := range sink.Events() {
+			count[e.ID]++
+		}
+		return count
+	}
+	count := published()
+	assert.Zero(t, count[claimed.EventID])
+	for _, e := range added[1:] {
+		assert.Equal(t, 1, count[e.EventID])
+	}
+
+	assert.NoError(t, con.Model(claimed).Update("claimed_until", time.Now().Add(-time.Minute)).Error)
+	_, err = RelayOutboxEvents(con, sink, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, published()[claimed.EventID])
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/configs"
+)
+
+// echoKey is the setting of the pool to remember whether it logs queries,
+// so that connections bound to a context log the same.
+const echoKey = "auth:echo"
+
+// Pool returns a connection pool to be shared for the life of the application.
+// It is configured with pool values of the config.
+func Pool(c *configs.DatabaseConfig) (*gorm.DB, error) {
+	con, err := Connection(c.Driver, c.DSN(), c.Echo)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := con.DB()
+	pool.SetMaxOpenConns(c.MaxOpenConns)
+	pool.SetMaxIdleConns(c.MaxIdleConns)
+	pool.SetConnMaxLifetime(c.ConnMaxLifetimeDuration())
+	pool.SetConnMaxIdleTime(c.ConnMaxIdleTimeDuration())
+	con.SetLogger(gormLogger{context.Background()})
+	return con.Set(echoKey, c.Echo), nil
+}
+
+// WithContext returns a connection of the pool whose queries and transactions
+// run with the context, so that they are cancelled when the context is done.
+// Logs of the connection are written with the logger of the context,
+// and queries are traced as children of the span of the context.
+// The returned connection must not be closed, it does not own the pool.
+func WithContext(con *gorm.DB, ctx context.Context) *gorm.DB {
+	pool, ok := con.CommonDB().(*sql.DB)
+	if !ok {
+		return con
+	}
+
+	bound, err := gorm.Open(con.Dialect().GetName(), &contextDB{pool, ctx})
+	if err != nil {
+		return con
+	}
+	echo, _ := con.Get(echoKey)
+	bound.LogMode(echo == true)
+	bound.SetLogger(gormLogger{ctx})
+	return bound.Set(contextKey, ctx)
+}
+
+// contextDB runs every query of gorm with the context.
+// gorm v1 begins transactions with the background context,
+// so the context of it is used instead.
+type contextDB struct {
+	db  *sql.DB
+	ctx context.Context
+}
+
+func (c *contextDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(c.ctx, query, args...)
+}
+
+func (c *contextDB) Prepare(query string) (*sql.Stmt, error) {
+	return c.db.PrepareContext(c.ctx, query)
+}
+
+func (c *contextDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(c.ctx, query, args...)
+}
+
+func (c *contextDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(c.ctx, query, args...)
+}
+
+func (c *contextDB) Begin() (*sql.Tx, error) {
+	return c.db.BeginTx(c.ctx, nil)
+}
+
+func (c *contextDB) BeginTx(_ context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return c.db.BeginTx(c.ctx, opts)
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/utils"
+)
+
+func TestPool(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	dbConf.MaxOpenConns = 3
+
+	con, err := Pool(dbConf)
+	assert.NoError(t, err)
+	defer con.Close()
+	assert.Equal(t, 3, con.DB().Stats().MaxOpenConnections)
+
+	echo, ok := con.Get(echoKey)
+	assert.True(t, ok)
+	assert.Equal(t, dbConf.Echo, echo)
+}
+
+func TestWithContext(t *testing.T) {
+	con := sqliteForTest(t)
+	defer con.Close()
+	_, err := MigrateUp(con, 0)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bound := WithContext(con, ctx)
+	assert.NoError(t, bound.Create(&User{Email: "test@mail.com"}).Error)
+
+	cancel()
+	// 취소된 요청의 쿼리와 트랜잭션은 실행되지 않는다.
+	var count int
+	err = bound.Model(&User{}).Count(&count).Error
+	assert.Equal(t, context.Canceled, err)
+	err = Transaction(bound, func(tx *gorm.DB) error {
+		return tx.Create(&User{Email: "other@mail.com"}).Error
+	})
+	assert.Equal(t, context.Canceled, err)
+
+	// 풀은 그대로 쓸 수 있다.
+	assert.NoError(t, con.Model(&User{}).Count(&count).Error)
+	assert.Equal(t, 1, count)
+}
+
+func TestWithContextLogger(t *testing.T) {
+	con := sqliteForTest(t)
+	defer con.Close()
+	_, err := MigrateUp(con, 0)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	logger := utils.NewLogger(&buf, true).With("request_id", "abc")
+	ctx := utils.ContextWithLogger(context.Background(), logger)
+
+	// 쿼리 로그에 요청 정보가 붙고, 값은 남기지 않는다.
+	bound := WithContext(con.Set(echoKey, true), ctx)
+	bound.Where("email = ?", "secret@mail.com").First(&User{})
+	assert.Contains(t, buf.String(), `"request_id":"abc"`)
+	assert.Contains(t, buf.String(), `"msg":"sql"`)
+	assert.NotContains(t, buf.String(), "secret@mail.com")
+}
+
+func TestTransactionDuration(t *testing.T) {
+	con := sqliteForTest(t)
+	defer con.Close()
+	_, err := MigrateUp(con, 0)
+	assert.NoError(t, err)
+
+	commits := transactionDuration.Count(transactionCommit)
+	rollbacks := transactionDuration.Count(transactionRollback)
+	assert.NoError(t, Transaction(con, func(tx *gorm.DB) error {
+		return tx.Create(&User{Email: "test@mail.com"}).Error
+	}))
+	assert.Error(t, Transaction(con, func(tx *gorm.DB) error {
+		return errors.New("error")
+	}))
+	assert.Equal(t, commits+1, transactionDuration.Count(transactionCommit))
+	assert.Equal(t, rollbacks+1, transactionDuration.Count(transactionRollback))
+}
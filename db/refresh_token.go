@@ -0,0 +1,182 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/utils"
+)
+
+const refreshTokenLen = 32
+
+var (
+	// ErrorNotFoundRefreshToken .
+	ErrorNotFoundRefreshToken = errors.New("not found refresh token")
+	// ErrorExpiredRefreshToken .
+	ErrorExpiredRefreshToken = errors.New("expired refresh token")
+	// ErrorRevokedRefreshToken .
+	ErrorRevokedRefreshToken = errors.New("revoked refresh token")
+	// ErrorReusedRefreshToken is returned when a rotated refresh token is presented again.
+	// Every token in the same family is revoked when this happens.
+	ErrorReusedRefreshToken = errors.New("reused refresh token")
+)
+
+// RefreshToken is refresh token ORM.
+// Only the hash of the token is stored, the token itself is given to the client.
+// Tokens rotated from the same signin share a 'Family' and the authentication.
+type RefreshToken struct {
+	IDField
+	UserID      uint   `gorm:"index;not null"`
+	Family      string `gorm:"size:36;index;not null"`
+	HashedToken string `gorm:"size:64;unique_index;not null"`
+	AuthTime    int64
+	AMR         string
+	ExpiresAt   time.Time
+	RotatedAt   *time.Time
+	RevokedAt   *time.Time
+
+	DateTimeFields
+}
+
+// Authentication returns when and how the user signed in.
+func (rt *RefreshToken) Authentication() utils.Authentication {
+	return utils.Authentication{
+		AuthTime: rt.AuthTime,
+		AMR:      strings.Fields(rt.AMR),
+	}
+}
+
+func newRefreshToken(
+	tx *gorm.DB, userID uint, family string,
+	auth utils.Authentication, expiresAt time.Time) (string, error) {
+
+	token, err := utils.RandomToken(refreshTokenLen)
+	if err != nil {
+		return "", err
+	}
+
+	rt := RefreshToken{
+		UserID:      userID,
+		Family:      family,
+		HashedToken: hashToken(token),
+		AuthTime:    auth.AuthTime,
+		AMR:         strings.Join(auth.AMR, " "),
+		ExpiresAt:   expiresAt,
+	}
+	if err := tx.Create(&rt).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// IssueRefreshToken creates a refresh token which starts a new family.
+// It returns the token to be given to the client.
+// The events are written together, such as 'signin.succeeded'.
+func IssueRefreshToken(
+	con *gorm.DB, userID uint, auth utils.Authentication, expireAfterSec int,
+	events ...*OutboxEvent) (string, error) {
+	var token string
+	do := func(tx *gorm.DB) (err error) {
+		token, err = newRefreshToken(
+			tx, userID, uuid.New().String(), auth,
+			time.Now().Add(time.Second*time.Duration(expireAfterSec)))
+		if err != nil {
+			return
+		}
+		return addOutboxEvents(tx, userID, events)
+	}
+	if err := Transaction(con, do); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken exchanges the token for a new one in the same family.
+// The new token expires when the family expires, so rotation does not extend the signin.
+// The presented token can not be used again. If an already rotated token is
+// presented, the whole family is revoked and ErrorReusedRefreshToken is returned.
+func RotateRefreshToken(con *gorm.DB, token string) (string, *RefreshToken, error) {
+	rt := RefreshToken{}
+	if con.Where("hashed_token = ?", hashToken(token)).First(&rt).RecordNotFound() {
+		return "", nil, ErrorNotFoundRefreshToken
+	}
+
+	if rt.RevokedAt != nil {
+		return "", nil, ErrorRevokedRefreshToken
+	}
+
+	if rt.RotatedAt != nil {
+		if err := RevokeRefreshTokenFamily(con, rt.Family); err != nil {
+			return "", nil, err
+		}
+		return "", nil, ErrorReusedRefreshToken
+	}
+
+	if time.Now().After(rt.ExpiresAt) {
+		return "", nil, ErrorExpiredRefreshToken
+	}
+
+	var newToken string
+	do := func(tx *gorm.DB) error {
+		now := time.Now()
+		// 조건부 갱신으로 같은 토큰이 동시에 사용되면 하나만 성공한다.
+		result := tx.Model(&rt).
+			Where("rotated_at IS NULL").
+			Update("rotated_at", &now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrorReusedRefreshToken
+		}
+
+		var err error
+		newToken, err = newRefreshToken(
+			tx, rt.UserID, rt.Family, rt.Authentication(), rt.ExpiresAt)
+		return err
+	}
+	if err := Transaction(con, do); err != nil {
+		if errors.Is(err, ErrorReusedRefreshToken) {
+			if err := RevokeRefreshTokenFamily(con, rt.Family); err != nil {
+				return "", nil, err
+			}
+		}
+		return "", nil, err
+	}
+	return newToken, &rt, nil
+}
+
+// RevokeRefreshTokenFamily revokes every token rotated from the same signin.
+func RevokeRefreshTokenFamily(con *gorm.DB, family string) error {
+	do := func(tx *gorm.DB) error {
+		return tx.Model(&RefreshToken{}).
+			Where("family = ? AND revoked_at IS NULL", family).
+			Update("revoked_at", time.Now()).Error
+	}
+	return Transaction(con, do)
+}
+
+// RevokeRefreshTokens revokes every refresh token of the user.
+// It is used when the user's credentials are changed.
+func RevokeRefreshTokens(con *gorm.DB, userID uint) error {
+	do := func(tx *gorm.DB) error {
+		return tx.Model(&RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
+	}
+	return Transaction(con, do)
+}
+
+// RevokeRefreshToken revokes the family of the token.
+// It is used when the client gives up the token, e.g. signout.
+func RevokeRefreshToken(con *gorm.DB, token string) error {
+	rt := RefreshToken{}
+	if con.Where("hashed_token = ?", hashToken(token)).First(&rt).RecordNotFound() {
+		return ErrorNotFoundRefreshToken
+	}
+	return RevokeRefreshTokenFamily(con, rt.Family)
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/utils"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	var userID uint = 1
+	auth := utils.Authentication{
+		AuthTime: time.Now().Unix(),
+		AMR:      []string{utils.AMRPassword, utils.AMROTP},
+	}
+	token, err := IssueRefreshToken(con, userID, auth, 60)
+	assert.NoError(t, err)
+
+	rotated, rt, err := RotateRefreshToken(con, token)
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, rotated)
+	assert.Equal(t, userID, rt.UserID)
+	assert.Equal(t, auth, rt.Authentication())
+
+	// 교체해도 처음 발급한 토큰의 만료 시각을 넘지 않는다.
+	next := RefreshToken{}
+	assert.NoError(t, con.Where("hashed_token = ?", hashToken(rotated)).First(&next).Error)
+	assert.True(t, next.ExpiresAt.Equal(rt.ExpiresAt))
+
+	// 이미 교체된 토큰을 다시 사용하면 같은 family 의 토큰이 모두 폐기된다.
+	_, _, err = RotateRefreshToken(con, token)
+	assert.Equal(t, ErrorReusedRefreshToken, err)
+
+	_, _, err = RotateRefreshToken(con, rotated)
+	assert.Equal(t, ErrorRevokedRefreshToken, err)
+}
+
+func TestRotateRefreshTokenWithExpired(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	token, err := IssueRefreshToken(con, 1, utils.Authentication{}, -1)
+	assert.NoError(t, err)
+
+	_, _, err = RotateRefreshToken(con, token)
+	assert.Equal(t, ErrorExpiredRefreshToken, err)
+
+	_, _, err = RotateRefreshToken(con, "notissuedtoken")
+	assert.Equal(t, ErrorNotFoundRefreshToken, err)
+}
+
+func TestRevokeRefreshTokens(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	var userID uint = 2
+	token, err := IssueRefreshToken(con, userID, utils.Authentication{}, 60)
+	assert.NoError(t, err)
+
+	err = RevokeRefreshTokens(con, userID)
+	assert.NoError(t, err)
+
+	_, _, err = RotateRefreshToken(con, token)
+	assert.Equal(t, ErrorRevokedRefreshToken, err)
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	token, err := IssueRefreshToken(con, 3, utils.Authentication{}, 60)
+	assert.NoError(t, err)
+	rotated, _, err := RotateRefreshToken(con, token)
+	assert.NoError(t, err)
+
+	assert.NoError(t, RevokeRefreshToken(con, token))
+
+	_, _, err = RotateRefreshToken(con, rotated)
+	assert.Equal(t, ErrorRevokedRefreshToken, err)
+
+	assert.Equal(t, ErrorNotFoundRefreshToken, RevokeRefreshToken(con, "notissuedtoken"))
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// RevokedToken is ORM of revoked JWT identified by 'jti' claim.
+// The row is kept until the token expires, after that it is rejected anyway.
+type RevokedToken struct {
+	IDField
+	Jti       string `gorm:"size:36;unique_index;not null"`
+	ExpiresAt time.Time
+
+	DateTimeFields
+}
+
+// RevokeToken stores jti of the token so that it is no longer accepted.
+// Revoking the same token again is not an error.
+// Rows of tokens already expired are deleted together.
+func RevokeToken(con *gorm.DB, jti string, expiresAt time.Time) error {
+	do := func(tx *gorm.DB) error {
+		err := tx.Unscoped().
+			Where("expires_at < ?", time.Now()).
+			Delete(&RevokedToken{}).Error
+		if err != nil {
+			return err
+		}
+
+		rt := RevokedToken{Jti: jti, ExpiresAt: expiresAt}
+		return tx.Where(RevokedToken{Jti: jti}).FirstOrCreate(&rt).Error
+	}
+	return Transaction(con, do)
+}
+
+// IsTokenRevoked reports whether the token identified by jti has been revoked.
+func IsTokenRevoked(con *gorm.DB, jti string) (bool, error) {
+	var count int
+	err := con.Model(&RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
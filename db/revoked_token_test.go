@@ -0,0 +1,41 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+)
+
+func TestRevokeToken(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	jti := uuid.New().String()
+	revoked, err := IsTokenRevoked(con, jti)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	expiresAt := time.Now().Add(time.Minute)
+	assert.NoError(t, RevokeToken(con, jti, expiresAt))
+	assert.NoError(t, RevokeToken(con, jti, expiresAt))
+
+	revoked, err = IsTokenRevoked(con, jti)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	expired := uuid.New().String()
+	assert.NoError(t, RevokeToken(con, expired, time.Now().Add(-time.Minute)))
+	assert.NoError(t, RevokeToken(con, uuid.New().String(), expiresAt))
+
+	revoked, err = IsTokenRevoked(con, expired)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+}
@@ -0,0 +1,416 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SuperuserRole is the builtin role having every permission,
+// including permissions added later. Admins before roles were given it by migration.
+const SuperuserRole = "superuser"
+
+var (
+	// ErrorInvalidRoleName .
+	ErrorInvalidRoleName = errors.New("invalid role name")
+	// ErrorRoleAlreadyExists .
+	ErrorRoleAlreadyExists = errors.New("role already exists")
+	// ErrorBuiltinRole .
+	ErrorBuiltinRole = errors.New("builtin role can not be changed or deleted")
+	// ErrorUnknownPermission .
+	ErrorUnknownPermission = errors.New("unknown permission")
+	// ErrorLastSuperuser .
+	ErrorLastSuperuser = errors.New("the last superuser can not be unassigned or deleted")
+)
+
+var roleNameRegExp = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,63}$`)
+
+// Permission is ORM of what can be done on admin routes, like 'users:read'.
+// Permissions are added by migrations, since routes require them by name.
+type Permission struct {
+	IDField
+	Name        string `gorm:"size:64;unique_index;not null"`
+	Description string `gorm:"size:255"`
+}
+
+// JSONPermission is used when payload to a request.
+type JSONPermission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// MarshalJSON .
+func (p Permission) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&JSONPermission{
+		Name:        p.Name,
+		Description: p.Description,
+	})
+}
+
+// Role is ORM of named set of permissions assigned to users.
+// Roles are deleted from DB, so that the name can be used again.
+type Role struct {
+	IDField
+	Name        string `gorm:"size:64;unique_index;not null"`
+	Description string `gorm:"size:255"`
+	Builtin     bool   `gorm:"default:false"`
+	// Permissions are names of permissions in order, they are loaded with the role.
+	Permissions []string `gorm:"-"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// JSONRole is used when payload to a request.
+type JSONRole struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Builtin     bool     `json:"builtin"`
+	Permissions []string `json:"permissions"`
+	CreatedAt   int64    `json:"created_at"`
+}
+
+// MarshalJSON .
+func (r Role) MarshalJSON() ([]byte, error) {
+	role := &JSONRole{
+		Name:        r.Name,
+		Description: r.Description,
+		Builtin:     r.Builtin,
+		Permissions: r.Permissions,
+		CreatedAt:   r.CreatedAt.Unix(),
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	return json.Marshal(role)
+}
+
+type rolePermission struct {
+	RoleID       uint `gorm:"primary_key;auto_increment:false"`
+	PermissionID uint `gorm:"primary_key;auto_increment:false"`
+}
+
+func (rolePermission) TableName() string {
+	return "role_permissions"
+}
+
+type userRole struct {
+	UserID    uint `gorm:"primary_key;auto_increment:false"`
+	RoleID    uint `gorm:"primary_key;auto_increment:false"`
+	CreatedAt time.Time
+}
+
+func (userRole) TableName() string {
+	return "user_roles"
+}
+
+// Grants reports whether the role has the permission.
+// Superuser has every permission.
+func (r *Role) Grants(permission string) bool {
+	if r.Name == SuperuserRole {
+		return true
+	}
+	for _, p := range r.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Create saves the role with its permissions.
+// An error is returned if the name is invalid or taken, or any permission is unknown.
+func (r *Role) Create(con *gorm.DB) error {
+	if !roleNameRegExp.MatchString(r.Name) {
+		return ErrorInvalidRoleName
+	}
+	if FindRole(con, r.Name) != nil {
+		return ErrorRoleAlreadyExists
+	}
+
+	r.Builtin = false
+	do := func(tx *gorm.DB) error {
+		if err := tx.Create(r).Error; err != nil {
+			return err
+		}
+		return setRolePermissions(tx, r, r.Permissions)
+	}
+	return Transaction(con, do)
+}
+
+// SetPermissions replaces the permissions of the role.
+// Builtin role can not be changed.
+func (r *Role) SetPermissions(con *gorm.DB, permissions []string) error {
+	if r.Builtin {
+		return ErrorBuiltinRole
+	}
+
+	do := func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", r.ID).Delete(rolePermission{}).Error; err != nil {
+			return err
+		}
+		if err := setRolePermissions(tx, r, permissions); err != nil {
+			return err
+		}
+		return tx.Model(r).Update("updated_at", gorm.NowFunc()).Error
+	}
+	return Transaction(con, do)
+}
+
+// Delete deletes the role, users having it lose its permissions.
+// Builtin role can not be deleted.
+func (r *Role) Delete(con *gorm.DB) error {
+	if r.Builtin {
+		return ErrorBuiltinRole
+	}
+
+	do := func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", r.ID).Delete(rolePermission{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", r.ID).Delete(userRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(r).Error
+	}
+	return Transaction(con, do)
+}
+
+// Assign gives the role to the user.
+// Assigning the role the user already has does nothing.
+func (r *Role) Assign(con *gorm.DB, userID uint) error {
+	do := func(tx *gorm.DB) error {
+		var count int
+		err := tx.Model(userRole{}).
+			Where("user_id = ? AND role_id = ?", userID, r.ID).Count(&count).Error
+		if err != nil || count > 0 {
+			return err
+		}
+		return tx.Create(&userRole{UserID: userID, RoleID: r.ID}).Error
+	}
+	return Transaction(con, do)
+}
+
+// Unassign takes the role from the user.
+// Superuser can not be taken from the last user having it,
+// not to leave nobody to manage roles.
+func (r *Role) Unassign(con *gorm.DB, userID uint) error {
+	do := func(tx *gorm.DB) error {
+		var count int
+		err := tx.Model(userRole{}).
+			Where("user_id = ? AND role_id = ?", userID, r.ID).Count(&count).Error
+		if err != nil || count == 0 {
+			return err
+		}
+
+		if r.Name == SuperuserRole {
+			if err := checkNotLastSuperuser(tx, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Where("user_id = ? AND role_id = ?", userID, r.ID).Delete(userRole{}).Error
+	}
+	return Transaction(con, do)
+}
+
+// checkNotLastSuperuser returns 'ErrorLastSuperuser' if the user is superuser
+// and no other user, not deleted, is superuser.
+func checkNotLastSuperuser(tx *gorm.DB, userID uint) error {
+	superusers := tx.Model(userRole{}).
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("roles.name = ?", SuperuserRole)
+
+	var count int
+	if err := superusers.Where("user_roles.user_id = ?", userID).Count(&count).Error; err != nil || count == 0 {
+		return err
+	}
+
+	err := superusers.
+		Joins("JOIN users ON users.id = user_roles.user_id").
+		Where("user_roles.user_id <> ? AND users.deleted_at IS NULL", userID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrorLastSuperuser
+	}
+	return nil
+}
+
+// setRolePermissions adds the permissions to the role, and sets them in order.
+func setRolePermissions(tx *gorm.DB, r *Role, permissions []string) error {
+	names := uniqueSorted(permissions)
+	if len(names) == 0 {
+		r.Permissions = nil
+		return nil
+	}
+
+	var found []Permission
+	if err := tx.Where("name IN (?)", names).Find(&found).Error; err != nil {
+		return err
+	}
+	if len(found) != len(names) {
+		return ErrorUnknownPermission
+	}
+
+	for _, p := range found {
+		if err := tx.Create(&rolePermission{RoleID: r.ID, PermissionID: p.ID}).Error; err != nil {
+			return err
+		}
+	}
+	r.Permissions = names
+	return nil
+}
+
+func uniqueSorted(values []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// loadPermissions sets permissions of the roles.
+// Superuser has all permissions, even not in 'role_permissions'.
+func loadPermissions(con *gorm.DB, roles []Role) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(roles))
+	for i, r := range roles {
+		ids[i] = r.ID
+	}
+	var rows []struct {
+		RoleID uint
+		Name   string
+	}
+	err := con.Table("role_permissions").
+		Select("role_permissions.role_id, permissions.name").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("role_permissions.role_id IN (?)", ids).
+		Order("permissions.name").Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range roles {
+		roles[i].Permissions = nil
+		if roles[i].Name == SuperuserRole {
+			all, err := PermissionNames(con)
+			if err != nil {
+				return err
+			}
+			roles[i].Permissions = all
+			continue
+		}
+		for _, row := range rows {
+			if row.RoleID == roles[i].ID {
+				roles[i].Permissions = append(roles[i].Permissions, row.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Permissions returns all permissions in order of name.
+func Permissions(con *gorm.DB) ([]Permission, error) {
+	var permissions []Permission
+	if err := con.Order("name").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// PermissionNames returns names of all permissions in order.
+func PermissionNames(con *gorm.DB) ([]string, error) {
+	var names []string
+	if err := con.Model(&Permission{}).Order("name").Pluck("name", &names).Error; err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// Roles returns all roles in order of name with their permissions.
+func Roles(con *gorm.DB) ([]Role, error) {
+	var roles []Role
+	if err := con.Order("name").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	if err := loadPermissions(con, roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// FindRole returns the role with its permissions, or nil if not found.
+func FindRole(con *gorm.DB, name string) *Role {
+	var role Role
+	if con.Where("name = ?", name).First(&role).RecordNotFound() {
+		return nil
+	}
+	roles := []Role{role}
+	if err := loadPermissions(con, roles); err != nil {
+		return nil
+	}
+	return &roles[0]
+}
+
+// UserRoles returns roles of the user in order of name with their permissions.
+func UserRoles(con *gorm.DB, userID uint) ([]Role, error) {
+	var roles []Role
+	err := con.Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := loadPermissions(con, roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// UserRoleNames returns names of roles of the user in order.
+func UserRoleNames(con *gorm.DB, userID uint) ([]string, error) {
+	var names []string
+	err := con.Model(&Role{}).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").Pluck("roles.name", &names).Error
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// HasPermissions reports whether roles of the user grant all the permissions.
+func HasPermissions(con *gorm.DB, userID uint, permissions ...string) (bool, error) {
+	roles, err := UserRoles(con, userID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, p := range permissions {
+		granted := false
+		for i := range roles {
+			if roles[i].Grants(p) {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			return false, nil
+		}
+	}
+	return true, nil
+}
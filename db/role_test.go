@@ -0,0 +1,152 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+)
+
+func TestRole(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	user := User{Email: fmt.Sprintf(testEmailFmt, uuid.New().String())}
+	assert.NoError(t, user.Create(con, testPassword))
+
+	name := "support-" + uuid.New().String()[:8]
+	role := Role{
+		Name:        name,
+		Description: "support staff",
+		Permissions: []string{"users:read", "otp:reset", "users:read"},
+	}
+	assert.NoError(t, role.Create(con))
+	assert.Equal(t, []string{"otp:reset", "users:read"}, role.Permissions)
+	assert.Equal(t, ErrorRoleAlreadyExists, (&Role{Name: name}).Create(con))
+	assert.Equal(t, ErrorInvalidRoleName, (&Role{Name: "Bad Name"}).Create(con))
+	assert.Equal(t, ErrorUnknownPermission,
+		(&Role{Name: name + "-x", Permissions: []string{"unknown:read"}}).Create(con))
+	assert.Nil(t, FindRole(con, name+"-x"))
+
+	found := FindRole(con, name)
+	assert.NotNil(t, found)
+	assert.Equal(t, role.Permissions, found.Permissions)
+	assert.False(t, found.Builtin)
+
+	ok, err := HasPermissions(con, user.ID, "users:read")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, found.Assign(con, user.ID))
+	// 이미 가진 역할은 다시 주어도 그대로다.
+	assert.NoError(t, found.Assign(con, user.ID))
+	names, err := UserRoleNames(con, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{name}, names)
+
+	ok, err = HasPermissions(con, user.ID, "users:read", "otp:reset")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = HasPermissions(con, user.ID, "users:read", "users:delete")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, found.SetPermissions(con, []string{"users:delete"}))
+	ok, err = HasPermissions(con, user.ID, "users:delete")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"users:delete"}, FindRole(con, name).Permissions)
+	assert.Equal(t, ErrorUnknownPermission, found.SetPermissions(con, []string{"unknown:read"}))
+	assert.Equal(t, []string{"users:delete"}, FindRole(con, name).Permissions)
+
+	b, err := json.Marshal(found)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"permissions":["users:delete"]`)
+
+	// superuser 는 모든 권한을 가진다.
+	superuser := FindRole(con, SuperuserRole)
+	assert.NotNil(t, superuser)
+	assert.True(t, superuser.Builtin)
+	all, err := PermissionNames(con)
+	assert.NoError(t, err)
+	assert.Equal(t, all, superuser.Permissions)
+	assert.True(t, superuser.Grants("anything:new"))
+	assert.Equal(t, ErrorBuiltinRole, superuser.SetPermissions(con, nil))
+	assert.Equal(t, ErrorBuiltinRole, superuser.Delete(con))
+
+	roles, err := Roles(con)
+	assert.NoError(t, err)
+	var roleNames []string
+	for _, r := range roles {
+		roleNames = append(roleNames, r.Name)
+	}
+	assert.Contains(t, roleNames, name)
+	assert.Contains(t, roleNames, SuperuserRole)
+
+	assert.NoError(t, found.Unassign(con, user.ID))
+	names, err = UserRoleNames(con, user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+
+	assert.NoError(t, found.Assign(con, user.ID))
+	assert.NoError(t, found.Delete(con))
+	assert.Nil(t, FindRole(con, name))
+	names, err = UserRoleNames(con, user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestUnassignLastSuperuser(t *testing.T) {
+	con := sqliteForTest(t)
+	defer con.Close()
+	_, err := MigrateUp(con, 0)
+	assert.NoError(t, err)
+
+	superuser := FindRole(con, SuperuserRole)
+	first := User{Email: "first@mail.com"}
+	assert.NoError(t, first.Create(con, testPassword))
+	second := User{Email: "second@mail.com"}
+	assert.NoError(t, second.Create(con, testPassword))
+
+	// 갖지 않은 역할은 빼도 그대로다.
+	assert.NoError(t, superuser.Unassign(con, first.ID))
+
+	assert.NoError(t, superuser.Assign(con, first.ID))
+	assert.Equal(t, ErrorLastSuperuser, superuser.Unassign(con, first.ID))
+
+	assert.NoError(t, superuser.Assign(con, second.ID))
+	assert.NoError(t, superuser.Unassign(con, first.ID))
+
+	// 삭제된 사용자는 세지 않는다.
+	assert.NoError(t, superuser.Assign(con, first.ID))
+	assert.NoError(t, second.Delete(con))
+	assert.Equal(t, ErrorLastSuperuser, superuser.Unassign(con, first.ID))
+}
+
+func TestDeleteLastSuperuser(t *testing.T) {
+	con := sqliteForTest(t)
+	defer con.Close()
+	_, err := MigrateUp(con, 0)
+	assert.NoError(t, err)
+
+	superuser := FindRole(con, SuperuserRole)
+	first := User{Email: "first@mail.com"}
+	assert.NoError(t, first.Create(con, testPassword))
+	second := User{Email: "second@mail.com"}
+	assert.NoError(t, second.Create(con, testPassword))
+	assert.NoError(t, superuser.Assign(con, first.ID))
+	assert.NoError(t, superuser.Assign(con, second.ID))
+
+	assert.NoError(t, second.Delete(con))
+	assert.Equal(t, ErrorLastSuperuser, first.Delete(con))
+	_, err = first.Fetch(con)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ServiceAccount is ORM of non-human principal such as backend job.
+// It authenticates with client ID and secret, and is granted 'Scope' only.
+type ServiceAccount struct {
+	IDField
+	ClientID     string `gorm:"size:64;unique_index;not null"`
+	HashedSecret string `gorm:"not null"`
+	Name         string `gorm:"not null"`
+	Scope        string `gorm:"type:text"`
+	DisabledAt   *time.Time
+
+	DateTimeFields
+}
+
+// JSONServiceAccount is used when payload to a request.
+// This is a structure with secret removed.
+type JSONServiceAccount struct {
+	ClientID   string   `json:"client_id"`
+	Name       string   `json:"name"`
+	Scope      []string `json:"scope"`
+	DisabledAt *int64   `json:"disabled_at"`
+	CreatedAt  int64    `json:"created_at"`
+}
+
+// MarshalJSON .
+func (a ServiceAccount) MarshalJSON() ([]byte, error) {
+	account := &JSONServiceAccount{
+		ClientID:  a.ClientID,
+		Name:      a.Name,
+		Scope:     strings.Fields(a.Scope),
+		CreatedAt: a.CreatedAt.Unix(),
+	}
+	if account.Scope == nil {
+		account.Scope = []string{}
+	}
+	if a.DisabledAt != nil {
+		ts := a.DisabledAt.Unix()
+		account.DisabledAt = &ts
+	}
+	return json.Marshal(account)
+}
+
+// SetSecret converts the secret into a hash string and saves it.
+// Applied when calling Save.
+func (a *ServiceAccount) SetSecret(secret string) error {
+	hashedBytes, err := bcrypt.GenerateFromPassword(
+		[]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	a.HashedSecret = string(hashedBytes)
+	return nil
+}
+
+// VerifySecret verifies that the given secret is correct.
+func (a *ServiceAccount) VerifySecret(secret string) bool {
+	err := bcrypt.CompareHashAndPassword(
+		[]byte(a.HashedSecret), []byte(secret))
+	return err == nil
+}
+
+// AllowedScope returns the scope to be granted for the requested scope.
+// If the request is empty, every scope of the account is granted.
+func (a *ServiceAccount) AllowedScope(scope string) (string, bool) {
+	return allowedScope(a.Scope, scope)
+}
+
+// Disabled reports whether the account can no longer get access token.
+func (a *ServiceAccount) Disabled() bool {
+	return a.DisabledAt != nil
+}
+
+// Disable stops the account getting access token.
+// Applied when calling Save.
+func (a *ServiceAccount) Disable() {
+	now := time.Now()
+	a.DisabledAt = &now
+}
+
+// Enable lets the disabled account get access token again.
+// Applied when calling Save.
+func (a *ServiceAccount) Enable() {
+	a.DisabledAt = nil
+}
+
+// Save stores each attribute of ServiceAccount in DB.
+// If an error occurs while saving, rollback and return error.
+func (a *ServiceAccount) Save(con *gorm.DB) error {
+	do := func(tx *gorm.DB) error {
+		return tx.Save(a).Error
+	}
+	return Transaction(con, do)
+}
+
+// FindServiceAccount returns the account or nil if not found.
+func FindServiceAccount(con *gorm.DB, clientID string) *ServiceAccount {
+	account := ServiceAccount{}
+	if con.Where("client_id = ?", clientID).First(&account).RecordNotFound() {
+		return nil
+	}
+	return &account
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+)
+
+func TestServiceAccount(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	account := ServiceAccount{
+		ClientID: uuid.New().String(),
+		Name:     "test job",
+		Scope:    "users:read users:write",
+	}
+	assert.NoError(t, account.SetSecret("secret"))
+	assert.NoError(t, account.Save(con))
+
+	found := FindServiceAccount(con, account.ClientID)
+	assert.NotNil(t, found)
+	assert.True(t, found.VerifySecret("secret"))
+	assert.False(t, found.VerifySecret("wrong"))
+
+	scope, ok := found.AllowedScope("users:read")
+	assert.True(t, ok)
+	assert.Equal(t, "users:read", scope)
+	_, ok = found.AllowedScope("jwt_keys:read")
+	assert.False(t, ok)
+
+	found.Disable()
+	assert.NoError(t, found.Save(con))
+	assert.True(t, FindServiceAccount(con, account.ClientID).Disabled())
+
+	found.Enable()
+	assert.NoError(t, found.Save(con))
+	assert.False(t, FindServiceAccount(con, account.ClientID).Disabled())
+
+	b, err := json.Marshal(found)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), found.HashedSecret)
+
+	assert.Nil(t, FindServiceAccount(con, "unknown"))
+}
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SigninLock is ORM of failed signin attempts of an account or a client IP.
+// 'Subject' is made by SigninLockSubjectUser or SigninLockSubjectIP.
+// Failures older than lock duration are forgotten on the next failure.
+// Attempts are counted as failures until they succeed, see ReserveSigninAttempt.
+type SigninLock struct {
+	IDField
+	Subject      string `gorm:"size:255;unique_index;not null"`
+	Failures     int    `gorm:"not null;default:0"`
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+
+	DateTimeFields
+}
+
+// JSONSigninLock is used when payload to a request.
+type JSONSigninLock struct {
+	Failures     int    `json:"failures"`
+	LastFailedAt *int64 `json:"last_failed_at"`
+	LockedUntil  *int64 `json:"locked_until"`
+	Locked       bool   `json:"locked"`
+}
+
+// MarshalJSON .
+func (l SigninLock) MarshalJSON() ([]byte, error) {
+	lock := &JSONSigninLock{
+		Failures: l.Failures,
+		Locked:   l.IsLocked(),
+	}
+	if !l.LastFailedAt.IsZero() {
+		ts := l.LastFailedAt.Unix()
+		lock.LastFailedAt = &ts
+	}
+	if l.LockedUntil != nil {
+		ts := l.LockedUntil.Unix()
+		lock.LockedUntil = &ts
+	}
+	return json.Marshal(lock)
+}
+
+// SigninLockSubjectUser .
+func SigninLockSubjectUser(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// SigninLockSubjectIP .
+func SigninLockSubjectIP(ip string) string {
+	return "ip:" + ip
+}
+
+// IsLocked reports whether signin is locked now.
+func (l *SigninLock) IsLocked() bool {
+	return l.LockedUntil != nil && time.Now().Before(*l.LockedUntil)
+}
+
+// RetryAfter returns how long the next attempt has to wait.
+// Delay doubles from 1 second for each failure after 'freeFailures',
+// and is not longer than 'maxDelay'. Lock has priority over delay.
+func (l *SigninLock) RetryAfter(freeFailures int, maxDelay time.Duration) time.Duration {
+	now := time.Now()
+	if l.IsLocked() {
+		return l.LockedUntil.Sub(now)
+	}
+
+	n := l.Failures - freeFailures
+	if n <= 0 {
+		return 0
+	}
+
+	delay := maxDelay
+	if n <= 30 && time.Second<<uint(n-1) < maxDelay {
+		delay = time.Second << uint(n-1)
+	}
+
+	wait := l.LastFailedAt.Add(delay).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// FindSigninLock returns nil if the subject has never failed.
+func FindSigninLock(con *gorm.DB, subject string) *SigninLock {
+	l := SigninLock{}
+	if con.Where("subject = ?", subject).First(&l).RecordNotFound() {
+		return nil
+	}
+	return &l
+}
+
+// SigninLimit is how failed signin attempts of a subject are limited.
+// Attempts are delayed after 'FreeFailures', locked for 'LockFor' at 'MaxFailures'.
+type SigninLimit struct {
+	FreeFailures int
+	MaxFailures  int
+	MaxDelay     time.Duration
+	LockFor      time.Duration
+}
+
+// lockSigninLock returns the row of the subject locked until the transaction ends,
+// so that attempts at the same time are counted one by one.
+// The row is created first if the subject has never failed.
+func lockSigninLock(con *gorm.DB, subject string, do func(tx *gorm.DB, l *SigninLock) error) error {
+	if FindSigninLock(con, subject) == nil {
+		l := SigninLock{Subject: subject, LastFailedAt: time.Now().Truncate(time.Second)}
+		// 동시에 만들어 유일 인덱스에 걸린 것은 이미 있는 것이므로 무시한다.
+		if err := con.Create(&l).Error; err != nil && FindSigninLock(con, subject) == nil {
+			return err
+		}
+	}
+
+	return Transaction(con, func(tx *gorm.DB) error {
+		// 먼저 갱신해서 행을 잠근 뒤에 읽는다.
+		err := tx.Model(&SigninLock{}).
+			Where("subject = ?", subject).
+			Update("updated_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+
+		l := SigninLock{}
+		if err := tx.Where("subject = ?", subject).First(&l).Error; err != nil {
+			return err
+		}
+		return do(tx, &l)
+	})
+}
+
+// ReserveSigninAttempt counts the attempt as failure before it is verified.
+// It returns false with the lock if the subject is locked or has to wait more,
+// then the attempt is not counted.
+// The attempt must be released by ReleaseSigninAttempt if it does not fail.
+func ReserveSigninAttempt(con *gorm.DB, subject string, limit SigninLimit) (*SigninLock, bool, error) {
+	var lock SigninLock
+	reserved := false
+	do := func(tx *gorm.DB, l *SigninLock) error {
+		lock = *l
+		if l.RetryAfter(limit.FreeFailures, limit.MaxDelay) > 0 {
+			return nil
+		}
+
+		// DATETIME 에 초 단위로 저장되므로 미리 잘라 둔다.
+		now := time.Now().Truncate(time.Second)
+		lockExpired := l.LockedUntil != nil && !now.Before(*l.LockedUntil)
+		if lockExpired || now.Sub(l.LastFailedAt) > limit.LockFor {
+			l.Failures = 0
+			l.LockedUntil = nil
+		}
+
+		l.Failures++
+		l.LastFailedAt = now
+		if l.Failures >= limit.MaxFailures && l.LockedUntil == nil {
+			lockedUntil := now.Add(limit.LockFor)
+			l.LockedUntil = &lockedUntil
+		}
+		if err := tx.Save(l).Error; err != nil {
+			return err
+		}
+		lock = *l
+		reserved = true
+		return nil
+	}
+	if err := lockSigninLock(con, subject, do); err != nil {
+		return nil, false, err
+	}
+	return &lock, reserved, nil
+}
+
+// ReleaseSigninAttempt takes back the attempt counted by ReserveSigninAttempt.
+// The subject is unlocked if the attempt locked it.
+func ReleaseSigninAttempt(con *gorm.DB, subject string, maxFailures int) error {
+	do := func(tx *gorm.DB, l *SigninLock) error {
+		if l.Failures > 0 {
+			l.Failures--
+		}
+		if l.Failures < maxFailures {
+			l.LockedUntil = nil
+		}
+		return tx.Save(l).Error
+	}
+	return lockSigninLock(con, subject, do)
+}
+
+// ClearSigninLock forgets failed attempts of the subject and unlocks it.
+func ClearSigninLock(con *gorm.DB, subject string) error {
+	do := func(tx *gorm.DB) error {
+		return tx.Unscoped().
+			Where("subject = ?", subject).
+			Delete(&SigninLock{}).Error
+	}
+	return Transaction(con, do)
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+)
+
+func TestReserveSigninAttempt(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	limit := SigninLimit{FreeFailures: 3, MaxFailures: 3, LockFor: time.Minute}
+	subject := SigninLockSubjectIP(uuid.New().String())
+	assert.Nil(t, FindSigninLock(con, subject))
+
+	for i := 1; i < limit.MaxFailures; i++ {
+		l, reserved, err := ReserveSigninAttempt(con, subject, limit)
+		assert.NoError(t, err)
+		assert.True(t, reserved)
+		assert.Equal(t, i, l.Failures)
+		assert.False(t, l.IsLocked())
+	}
+
+	// 잠근 시도가 성공하면 되돌린다.
+	l, reserved, err := ReserveSigninAttempt(con, subject, limit)
+	assert.NoError(t, err)
+	assert.True(t, reserved)
+	assert.True(t, l.IsLocked())
+	assert.NoError(t, ReleaseSigninAttempt(con, subject, limit.MaxFailures))
+	l = FindSigninLock(con, subject)
+	assert.Equal(t, limit.MaxFailures-1, l.Failures)
+	assert.False(t, l.IsLocked())
+
+	_, reserved, err = ReserveSigninAttempt(con, subject, limit)
+	assert.NoError(t, err)
+	assert.True(t, reserved)
+
+	// 잠긴 동안의 시도는 세지 않는다.
+	l, reserved, err = ReserveSigninAttempt(con, subject, limit)
+	assert.NoError(t, err)
+	assert.False(t, reserved)
+	assert.True(t, l.IsLocked())
+
+	l = FindSigninLock(con, subject)
+	assert.NotNil(t, l)
+	assert.Equal(t, limit.MaxFailures, l.Failures)
+	assert.True(t, l.IsLocked())
+	assert.InDelta(t, time.Minute.Seconds(), l.RetryAfter(0, time.Hour).Seconds(), 2)
+
+	assert.NoError(t, ClearSigninLock(con, subject))
+	assert.Nil(t, FindSigninLock(con, subject))
+
+	// 잠금 시간이 지난 실패는 잊는다.
+	limit.LockFor = -time.Second
+	_, _, err = ReserveSigninAttempt(con, subject, limit)
+	assert.NoError(t, err)
+	l, _, err = ReserveSigninAttempt(con, subject, limit)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, l.Failures)
+}
+
+func TestReserveSigninAttemptConcurrently(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	limit := SigninLimit{FreeFailures: 3, MaxFailures: 5, MaxDelay: time.Minute, LockFor: time.Minute}
+	subject := SigninLockSubjectIP(uuid.New().String())
+
+	// 동시에 시도해도 하나씩 세므로 허용된 만큼만 확인할 수 있다.
+	var wg sync.WaitGroup
+	results := make(chan bool, 10)
+	for i := 0; i < cap(results); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, reserved, err := ReserveSigninAttempt(con, subject, limit)
+			assert.NoError(t, err)
+			results <- reserved
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	reserved := 0
+	for ok := range results {
+		if ok {
+			reserved++
+		}
+	}
+	assert.Equal(t, limit.FreeFailures+1, reserved)
+	assert.Equal(t, limit.FreeFailures+1, FindSigninLock(con, subject).Failures)
+}
+
+func TestSigninLockRetryAfter(t *testing.T) {
+	now := time.Now()
+	l := SigninLock{Failures: 2, LastFailedAt: now}
+	assert.Zero(t, l.RetryAfter(2, time.Minute))
+	assert.InDelta(t, time.Second.Seconds(), l.RetryAfter(1, time.Minute).Seconds(), 0.1)
+	assert.InDelta(t, (time.Second * 2).Seconds(), l.RetryAfter(0, time.Minute).Seconds(), 0.1)
+
+	l.Failures = 100
+	assert.InDelta(t, time.Minute.Seconds(), l.RetryAfter(0, time.Minute).Seconds(), 0.1)
+
+	l.LastFailedAt = now.Add(-time.Hour)
+	assert.Zero(t, l.RetryAfter(0, time.Minute))
+}
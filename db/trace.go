@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/loganstone/auth/utils"
+)
+
+// contextKey is the setting of connections bound to a context,
+// so that spans of queries are children of the span of the context.
+const contextKey = "auth:context"
+
+// spanKey is the setting of a scope for the span of the query.
+const spanKey = "auth:span"
+
+func init() {
+	registerTraceCallbacks(gorm.DefaultCallback)
+}
+
+// registerTraceCallbacks traces each create, update, delete and query of gorm.
+// Queries of connections not bound to a traced context are not traced.
+func registerTraceCallbacks(cb *gorm.Callback) {
+	cb.Create().Before("gorm:create").Register("auth:start_span", startQuerySpan("create"))
+	cb.Create().After("gorm:create").Register("auth:end_span", endQuerySpan)
+	cb.Update().Before("gorm:update").Register("auth:start_span", startQuerySpan("update"))
+	cb.Update().After("gorm:update").Register("auth:end_span", endQuerySpan)
+	cb.Delete().Before("gorm:delete").Register("auth:start_span", startQuerySpan("delete"))
+	cb.Delete().After("gorm:delete").Register("auth:end_span", endQuerySpan)
+	cb.Query().Before("gorm:query").Register("auth:start_span", startQuerySpan("query"))
+	cb.Query().After("gorm:query").Register("auth:end_span", endQuerySpan)
+	cb.RowQuery().Before("gorm:row_query").Register("auth:start_span", startQuerySpan("row_query"))
+	cb.RowQuery().After("gorm:row_query").Register("auth:end_span", endQuerySpan)
+}
+
+// contextOf returns the context the connection is bound to by 'WithContext'.
+func contextOf(con *gorm.DB) context.Context {
+	if ctx, ok := con.Get(contextKey); ok {
+		return ctx.(context.Context)
+	}
+	return context.Background()
+}
+
+func startQuerySpan(operation string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		_, span := utils.StartChildSpan(
+			contextOf(scope.DB()), operation+" "+scope.TableName(), trace.SpanKindClient,
+			attribute.String("db.system", scope.Dialect().GetName()),
+			attribute.String("db.operation", operation),
+			attribute.String("db.sql.table", scope.TableName()))
+		if span.IsRecording() {
+			scope.InstanceSet(spanKey, span)
+		}
+	}
+}
+
+// endQuerySpan ends the span with the statement without values, not to leave secrets.
+func endQuerySpan(scope *gorm.Scope) {
+	v, ok := scope.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := v.(trace.Span)
+	span.SetAttributes(
+		attribute.String("db.statement", scope.SQL),
+		attribute.Int64("db.rows_affected", scope.DB().RowsAffected))
+	if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		utils.RecordSpanError(span, err)
+	}
+	span.End()
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/loganstone/auth/utils"
+)
+
+func TestTraceQueries(t *testing.T) {
+	con := sqliteForTest(t)
+	defer con.Close()
+	_, err := MigrateUp(con, 0)
+	assert.NoError(t, err)
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := utils.NewTracerProvider(exporter, "auth", 100)
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	defer provider.Shutdown(context.Background())
+
+	// 추적 중인 요청이 아닌 쿼리는 남기지 않는다.
+	assert.NoError(t, Transaction(con, func(tx *gorm.DB) error {
+		return tx.Create(&User{Email: "background@mail.com"}).Error
+	}))
+
+	ctx, span := utils.StartSpan(context.Background(), "request", trace.SpanKindServer)
+	bound := WithContext(con, ctx)
+	assert.NoError(t, Transaction(bound, func(tx *gorm.DB) error {
+		return tx.Create(&User{Email: "test@mail.com"}).Error
+	}))
+	bound.Where("email = ?", "secret@mail.com").First(&User{})
+	span.End()
+
+	assert.NoError(t, provider.ForceFlush(context.Background()))
+	spans := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		// 같은 이름이면 마지막 span 을 본다.
+		spans[s.Name] = s
+	}
+	create, transaction, query := spans["create users"], spans["transaction"], spans["query users"]
+
+	assert.Len(t, spans, 4)
+	assert.Equal(t, transaction.SpanContext.SpanID(), create.Parent.SpanID())
+	assert.Equal(t, span.SpanContext().SpanID(), transaction.Parent.SpanID())
+	assert.Contains(t, transaction.Attributes,
+		attribute.String("db.transaction.outcome", transactionCommit))
+
+	// 없는 레코드는 실패가 아니고, 쿼리의 값은 남기지 않는다.
+	assert.Equal(t, span.SpanContext().SpanID(), query.Parent.SpanID())
+	assert.Equal(t, codes.Unset, query.Status.Code)
+	for _, a := range query.Attributes {
+		assert.NotContains(t, a.Value.Emit(), "secret@mail.com")
+	}
+}
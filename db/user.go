@@ -26,7 +26,9 @@ var (
 	ErrorFailedSetPassword = errors.New("failed set password")
 	// ErrorInvalidPassword .
 	ErrorInvalidPassword = errors.New("invalid password")
-	errEmptyOTPSecretKey = errors.New("empty 'OTPSecretKey'")
+	// ErrorUsedPasswordReset .
+	ErrorUsedPasswordReset = errors.New("password reset has already been used")
+	errEmptyOTPSecretKey   = errors.New("empty 'OTPSecretKey'")
 )
 
 var (
@@ -103,7 +105,6 @@ type User struct {
 	IDField
 	Email          string `gorm:"index;not null" binding:"required,email"`
 	HashedPassword string `gorm:"not null"`
-	IsAdmin        bool   `gorm:"default:false"`
 
 	OTPSecretKey    string `gorm:"size:16"`
 	OTPBackupCodes  Codes
@@ -117,7 +118,6 @@ type User struct {
 // This is a structure with important information removed.
 type JSONUser struct {
 	Email          string `json:"email"`
-	IsAdmin        bool   `json:"is_admin"`
 	CreatedAt      int64  `json:"created_at"`
 	UpdatedAt      int64  `json:"updated_at"`
 	DeletedAt      *int64 `json:"deleted_at"`
@@ -177,7 +177,6 @@ func (u *User) VerifyPassword(password string) bool {
 func (u User) MarshalJSON() ([]byte, error) {
 	user := &JSONUser{
 		Email:     u.Email,
-		IsAdmin:   u.IsAdmin,
 		CreatedAt: u.CreatedAt.Unix(),
 		UpdatedAt: u.UpdatedAt.Unix(),
 	}
@@ -242,7 +241,7 @@ func (u *User) ConfirmedOTP() bool {
 	return u.OTPConfirmedAt != nil
 }
 
-// Create creates a new user and saves it in the DB.
+// Create creates a new user and saves it in the DB with 'user.created' event.
 // An error is returned if there are users with duplicate emails or
 // if the password does not match the specified format.
 func (u *User) Create(con *gorm.DB, password string) error {
@@ -261,7 +260,11 @@ func (u *User) Create(con *gorm.DB, password string) error {
 	}
 
 	do := func(tx *gorm.DB) error {
-		return tx.Create(u).Error
+		if err := tx.Create(u).Error; err != nil {
+			return err
+		}
+		created := NewOutboxEvent(EventUserCreated, u.ID, EventData{Email: u.Email})
+		return addOutboxEvents(tx, u.ID, []*OutboxEvent{created})
 	}
 	if err := Transaction(con, do); err != nil {
 		return fmt.Errorf(failedCreateUserMessage, u.Email, err)
@@ -269,11 +272,14 @@ func (u *User) Create(con *gorm.DB, password string) error {
 	return nil
 }
 
-// Save stores each attribute of User in DB.
+// Save stores each attribute of User in DB with the events caused by the change.
 // If an error occurs while saving, rollback and return error.
-func (u *User) Save(con *gorm.DB) error {
+func (u *User) Save(con *gorm.DB, events ...*OutboxEvent) error {
 	do := func(tx *gorm.DB) error {
-		return tx.Save(u).Error
+		if err := tx.Save(u).Error; err != nil {
+			return err
+		}
+		return addOutboxEvents(tx, u.ID, events)
 	}
 	if err := Transaction(con, do); err != nil {
 		return err
@@ -281,11 +287,48 @@ func (u *User) Save(con *gorm.DB) error {
 	return nil
 }
 
-// Delete deletes the user data from the DB.
+// ResetPassword stores the password set by 'SetPassword' with the events,
+// consuming the password reset requested at 'resetTs'.
+// The reset is consumed by the conditional update, so only one of concurrent
+// resets with the same token succeeds, the others get 'ErrorUsedPasswordReset'.
+func (u *User) ResetPassword(con *gorm.DB, resetTs int, events ...*OutboxEvent) error {
+	if resetTs == 0 {
+		return ErrorUsedPasswordReset
+	}
+
+	do := func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).
+			Where("id = ? AND password_reset_ts = ?", u.ID, resetTs).
+			Update("password_reset_ts", 0)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrorUsedPasswordReset
+		}
+
+		u.PasswordResetTs = 0
+		if err := tx.Save(u).Error; err != nil {
+			return err
+		}
+		return addOutboxEvents(tx, u.ID, events)
+	}
+	return Transaction(con, do)
+}
+
+// Delete deletes the user data from the DB with 'user.deleted' event.
 // If an error occurs while saving, rollback and return error.
+// The last superuser can not be deleted, not to leave nobody to manage roles.
 func (u *User) Delete(con *gorm.DB) error {
 	do := func(tx *gorm.DB) error {
-		return tx.Delete(u).Error
+		if err := checkNotLastSuperuser(tx, u.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(u).Error; err != nil {
+			return err
+		}
+		deleted := NewOutboxEvent(EventUserDeleted, u.ID, EventData{Email: u.Email})
+		return addOutboxEvents(tx, u.ID, []*OutboxEvent{deleted})
 	}
 	if err := Transaction(con, do); err != nil {
 		return err
@@ -74,7 +74,7 @@ func TestMarshalJSON(t *testing.T) {
 	const zeroUnix = -62135596800
 	now := time.Now()
 	email := fmt.Sprintf(testEmailFmt, "test")
-	expected := fmt.Sprintf(`{"email":"%s","is_admin":false,"created_at":%d,"updated_at":%d,"deleted_at":%d,"otp_confirmed_at":%d}`,
+	expected := fmt.Sprintf(`{"email":"%s","created_at":%d,"updated_at":%d,"deleted_at":%d,"otp_confirmed_at":%d}`,
 		email, zeroUnix, zeroUnix, now.Unix(), now.Unix())
 	u := User{
 		Email:          email,
@@ -86,3 +86,29 @@ func TestMarshalJSON(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expected, string(v))
 }
+
+func TestResetPassword(t *testing.T) {
+	con := sqliteForTest(t)
+	defer con.Close()
+	_, err := MigrateUp(con, 0)
+	assert.NoError(t, err)
+
+	u := User{Email: fmt.Sprintf(testEmailFmt, "reset")}
+	assert.NoError(t, u.Create(con, testPassword))
+	resetTs := int(time.Now().Unix())
+	u.PasswordResetTs = resetTs
+	assert.NoError(t, u.Save(con))
+
+	// 같은 요청을 먼저 읽은 다른 재설정이 있어도 한번만 성공한다.
+	other := u
+	assert.NoError(t, u.SetPassword("Changed123!"))
+	assert.NoError(t, u.ResetPassword(con, resetTs))
+	assert.NoError(t, other.SetPassword("Other12345!"))
+	assert.Equal(t, ErrorUsedPasswordReset, other.ResetPassword(con, resetTs))
+	assert.Equal(t, ErrorUsedPasswordReset, other.ResetPassword(con, 0))
+
+	found, err := u.Fetch(con)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, found.PasswordResetTs)
+	assert.True(t, found.VerifyPassword("Changed123!"))
+}
@@ -0,0 +1,210 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/utils"
+)
+
+const webAuthnChallengeLen = 32
+
+// WebAuthn ceremonies the challenge is issued for.
+const (
+	WebAuthnRegistration   = "registration"
+	WebAuthnAuthentication = "authentication"
+)
+
+var (
+	// ErrorNotFoundWebAuthnChallenge .
+	ErrorNotFoundWebAuthnChallenge = errors.New("not found webauthn challenge")
+	// ErrorExpiredWebAuthnChallenge .
+	ErrorExpiredWebAuthnChallenge = errors.New("expired webauthn challenge")
+	// ErrorUsedWebAuthnChallenge .
+	ErrorUsedWebAuthnChallenge = errors.New("webauthn challenge has already been used")
+)
+
+// WebAuthnCredential is ORM of public key credential registered by the user.
+// 'CredentialID' is base64url encoded, 'PublicKey' is COSE encoded.
+// 'Transports' is space separated list given by the browser.
+type WebAuthnCredential struct {
+	IDField
+	UserID       uint   `gorm:"index;not null"`
+	CredentialID string `gorm:"size:255;unique_index;not null"`
+	PublicKey    []byte `gorm:"not null"`
+	SignCount    uint32
+	Transports   string
+	Nickname     string
+	AAGUID       string `gorm:"size:36"`
+	LastUsedAt   *time.Time
+
+	DateTimeFields
+}
+
+// JSONWebAuthnCredential is used when payload to a request.
+// This is a structure with public key removed.
+type JSONWebAuthnCredential struct {
+	CredentialID string   `json:"credential_id"`
+	Nickname     string   `json:"nickname"`
+	Transports   []string `json:"transports"`
+	AAGUID       string   `json:"aaguid"`
+	LastUsedAt   *int64   `json:"last_used_at"`
+	CreatedAt    int64    `json:"created_at"`
+}
+
+// MarshalJSON .
+func (c WebAuthnCredential) MarshalJSON() ([]byte, error) {
+	cred := &JSONWebAuthnCredential{
+		CredentialID: c.CredentialID,
+		Nickname:     c.Nickname,
+		Transports:   c.TransportList(),
+		AAGUID:       c.AAGUID,
+		CreatedAt:    c.CreatedAt.Unix(),
+	}
+	if c.LastUsedAt != nil {
+		ts := c.LastUsedAt.Unix()
+		cred.LastUsedAt = &ts
+	}
+	return json.Marshal(cred)
+}
+
+// TransportList returns transports as list.
+func (c *WebAuthnCredential) TransportList() []string {
+	transports := strings.Fields(c.Transports)
+	if transports == nil {
+		return []string{}
+	}
+	return transports
+}
+
+// Descriptor returns the credential to be listed in WebAuthn options.
+func (c *WebAuthnCredential) Descriptor() utils.WebAuthnCredentialDescriptor {
+	return utils.WebAuthnCredentialDescriptor{
+		Type:       utils.WebAuthnPublicKey,
+		ID:         c.CredentialID,
+		Transports: strings.Fields(c.Transports),
+	}
+}
+
+// Create saves the credential in DB.
+func (c *WebAuthnCredential) Create(con *gorm.DB) error {
+	do := func(tx *gorm.DB) error {
+		return tx.Create(c).Error
+	}
+	return Transaction(con, do)
+}
+
+// Used saves the sign count of the last authentication.
+func (c *WebAuthnCredential) Used(con *gorm.DB, signCount uint32) error {
+	now := time.Now()
+	c.SignCount = signCount
+	c.LastUsedAt = &now
+	do := func(tx *gorm.DB) error {
+		return tx.Save(c).Error
+	}
+	return Transaction(con, do)
+}
+
+// Delete deletes the credential from DB.
+func (c *WebAuthnCredential) Delete(con *gorm.DB) error {
+	do := func(tx *gorm.DB) error {
+		return tx.Unscoped().Delete(c).Error
+	}
+	return Transaction(con, do)
+}
+
+// FindWebAuthnCredential returns the credential or nil if not found.
+func FindWebAuthnCredential(con *gorm.DB, credentialID string) *WebAuthnCredential {
+	cred := WebAuthnCredential{}
+	if con.Where("credential_id = ?", credentialID).First(&cred).RecordNotFound() {
+		return nil
+	}
+	return &cred
+}
+
+// WebAuthnCredentials returns credentials registered by the user.
+func WebAuthnCredentials(con *gorm.DB, userID uint) ([]WebAuthnCredential, error) {
+	creds := []WebAuthnCredential{}
+	err := con.Where("user_id = ?", userID).Order("id").Find(&creds).Error
+	return creds, err
+}
+
+// WebAuthnChallenge is ORM of the challenge issued for WebAuthn ceremony.
+// 'UserID' is zero if the user is not known yet, such as passkey signin.
+type WebAuthnChallenge struct {
+	IDField
+	HashedChallenge string `gorm:"size:64;unique_index;not null"`
+	UserID          uint
+	Ceremony        string `gorm:"size:32;not null"`
+	ExpiresAt       time.Time
+	UsedAt          *time.Time
+
+	DateTimeFields
+}
+
+// IssueWebAuthnChallenge saves new challenge and returns it
+// to be signed by the authenticator.
+func IssueWebAuthnChallenge(
+	con *gorm.DB, userID uint, ceremony string, expireAfterSec int) (string, error) {
+
+	challenge, err := utils.RandomToken(webAuthnChallengeLen)
+	if err != nil {
+		return "", err
+	}
+
+	c := WebAuthnChallenge{
+		HashedChallenge: hashToken(challenge),
+		UserID:          userID,
+		Ceremony:        ceremony,
+		ExpiresAt:       time.Now().Add(time.Second * time.Duration(expireAfterSec)),
+	}
+	do := func(tx *gorm.DB) error {
+		return tx.Create(&c).Error
+	}
+	if err := Transaction(con, do); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// ConsumeWebAuthnChallenge returns the challenge issued for the ceremony
+// and marks it used. Each challenge can be verified only once.
+func ConsumeWebAuthnChallenge(
+	con *gorm.DB, challenge, ceremony string) (*WebAuthnChallenge, error) {
+
+	c := WebAuthnChallenge{}
+	if con.Where("hashed_challenge = ? AND ceremony = ?",
+		hashToken(challenge), ceremony).First(&c).RecordNotFound() {
+		return nil, ErrorNotFoundWebAuthnChallenge
+	}
+
+	if c.UsedAt != nil {
+		return nil, ErrorUsedWebAuthnChallenge
+	}
+
+	if time.Now().After(c.ExpiresAt) {
+		return nil, ErrorExpiredWebAuthnChallenge
+	}
+
+	do := func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&c).
+			Where("used_at IS NULL").
+			Update("used_at", &now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrorUsedWebAuthnChallenge
+		}
+		return nil
+	}
+	if err := Transaction(con, do); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
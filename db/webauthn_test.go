@@ -0,0 +1,75 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+)
+
+func TestWebAuthnCredential(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	cred := WebAuthnCredential{
+		UserID:       1,
+		CredentialID: uuid.New().String(),
+		PublicKey:    []byte{0xa5, 0x01, 0x02},
+		Transports:   "usb nfc",
+		Nickname:     "test key",
+	}
+	assert.NoError(t, cred.Create(con))
+
+	found := FindWebAuthnCredential(con, cred.CredentialID)
+	assert.NotNil(t, found)
+	assert.Equal(t, cred.PublicKey, found.PublicKey)
+	assert.Equal(t, []string{"usb", "nfc"}, found.TransportList())
+	assert.Nil(t, found.LastUsedAt)
+
+	assert.NoError(t, found.Used(con, 3))
+	found = FindWebAuthnCredential(con, cred.CredentialID)
+	assert.Equal(t, uint32(3), found.SignCount)
+	assert.NotNil(t, found.LastUsedAt)
+
+	b, err := json.Marshal(found)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"transports":["usb","nfc"]`)
+	assert.NotContains(t, string(b), "public_key")
+
+	assert.NoError(t, found.Delete(con))
+	assert.Nil(t, FindWebAuthnCredential(con, cred.CredentialID))
+}
+
+func TestConsumeWebAuthnChallenge(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	challenge, err := IssueWebAuthnChallenge(con, 1, WebAuthnRegistration, 60)
+	assert.NoError(t, err)
+
+	_, err = ConsumeWebAuthnChallenge(con, challenge, WebAuthnAuthentication)
+	assert.Equal(t, ErrorNotFoundWebAuthnChallenge, err)
+
+	consumed, err := ConsumeWebAuthnChallenge(con, challenge, WebAuthnRegistration)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), consumed.UserID)
+
+	_, err = ConsumeWebAuthnChallenge(con, challenge, WebAuthnRegistration)
+	assert.Equal(t, ErrorUsedWebAuthnChallenge, err)
+
+	challenge, err = IssueWebAuthnChallenge(con, 0, WebAuthnAuthentication, -1)
+	assert.NoError(t, err)
+	_, err = ConsumeWebAuthnChallenge(con, challenge, WebAuthnAuthentication)
+	assert.Equal(t, ErrorExpiredWebAuthnChallenge, err)
+}
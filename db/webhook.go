@@ -0,0 +1,377 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/utils"
+)
+
+// Status of webhook delivery.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+const webhookErrorMaxLen = 255
+
+// webhookClaimLease is how long a due delivery is kept from other instances.
+// Delivery not recorded in the lease is sent again.
+const webhookClaimLease = time.Minute
+
+var errDeletedWebhook = errors.New("webhook has been deleted")
+
+// Webhook is ORM of subscription to domain events.
+// 'EventTypes' is space separated list.
+// 'Secret' is kept as it is, because it signs every delivery.
+type Webhook struct {
+	IDField
+	URL        string `gorm:"type:text;not null"`
+	EventTypes string `gorm:"type:text;not null"`
+	Secret     string `gorm:"size:255;not null"`
+
+	DateTimeFields
+}
+
+// JSONWebhook is used when payload to a request.
+// This is a structure with secret removed.
+type JSONWebhook struct {
+	ID         uint     `json:"id"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	CreatedAt  int64    `json:"created_at"`
+}
+
+// MarshalJSON .
+func (w Webhook) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&JSONWebhook{
+		ID:         w.ID,
+		URL:        w.URL,
+		EventTypes: strings.Fields(w.EventTypes),
+		CreatedAt:  w.CreatedAt.Unix(),
+	})
+}
+
+// Subscribes reports whether the webhook receives the event type.
+func (w *Webhook) Subscribes(eventType string) bool {
+	for _, v := range strings.Fields(w.EventTypes) {
+		if v == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Create saves the webhook in DB.
+func (w *Webhook) Create(con *gorm.DB) error {
+	do := func(tx *gorm.DB) error {
+		return tx.Create(w).Error
+	}
+	return Transaction(con, do)
+}
+
+// Delete deletes the webhook from DB.
+// Deliveries are kept as log, pending ones are failed when they are due.
+func (w *Webhook) Delete(con *gorm.DB) error {
+	do := func(tx *gorm.DB) error {
+		return tx.Delete(w).Error
+	}
+	return Transaction(con, do)
+}
+
+// FindWebhook returns the webhook or nil if not found.
+func FindWebhook(con *gorm.DB, id uint) *Webhook {
+	w := Webhook{}
+	if con.First(&w, id).RecordNotFound() {
+		return nil
+	}
+	return &w
+}
+
+// WebhookDelivery is ORM of an event to be sent to a webhook.
+// It is retried with backoff until delivered or attempts run out.
+type WebhookDelivery struct {
+	IDField
+	WebhookID      uint   `gorm:"index;not null"`
+	EventID        string `gorm:"size:36;not null"`
+	EventType      string `gorm:"size:64;not null"`
+	Payload        string `gorm:"type:text"`
+	Attempts       int    `gorm:"not null;default:0"`
+	LastStatusCode int
+	NextAttemptAt  *time.Time `gorm:"index"`
+	DeliveredAt    *time.Time
+	FailedAt       *time.Time
+
+	DateTimeFields
+
+	Log []WebhookAttempt `gorm:"foreignkey:DeliveryID"`
+}
+
+// JSONWebhookDelivery is used when payload to a request.
+type JSONWebhookDelivery struct {
+	ID             uint             `json:"id"`
+	WebhookID      uint             `json:"webhook_id"`
+	EventID        string           `json:"event_id"`
+	EventType      string           `json:"event_type"`
+	Status         string           `json:"status"`
+	Attempts       int              `json:"attempts"`
+	LastStatusCode int              `json:"last_status_code"`
+	NextAttemptAt  *int64           `json:"next_attempt_at"`
+	DeliveredAt    *int64           `json:"delivered_at"`
+	CreatedAt      int64            `json:"created_at"`
+	Log            []WebhookAttempt `json:"log,omitempty"`
+}
+
+// MarshalJSON .
+func (d WebhookDelivery) MarshalJSON() ([]byte, error) {
+	delivery := &JSONWebhookDelivery{
+		ID:             d.ID,
+		WebhookID:      d.WebhookID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Status:         d.Status(),
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		CreatedAt:      d.CreatedAt.Unix(),
+		Log:            d.Log,
+	}
+	if d.NextAttemptAt != nil {
+		ts := d.NextAttemptAt.Unix()
+		delivery.NextAttemptAt = &ts
+	}
+	if d.DeliveredAt != nil {
+		ts := d.DeliveredAt.Unix()
+		delivery.DeliveredAt = &ts
+	}
+	return json.Marshal(delivery)
+}
+
+// Status returns one of pending, delivered and failed.
+func (d *WebhookDelivery) Status() string {
+	if d.DeliveredAt != nil {
+		return WebhookDeliveryDelivered
+	}
+	if d.FailedAt != nil {
+		return WebhookDeliveryFailed
+	}
+	return WebhookDeliveryPending
+}
+
+// WebhookAttempt is ORM of a request of webhook delivery.
+// 'StatusCode' is zero if no response was received.
+type WebhookAttempt struct {
+	IDField
+	DeliveryID uint `gorm:"index;not null"`
+	StatusCode int
+	Error      string `gorm:"size:255"`
+	DurationMs int64
+
+	DateTimeFields
+}
+
+// JSONWebhookAttempt is used when payload to a request.
+type JSONWebhookAttempt struct {
+	StatusCode  int    `json:"status_code"`
+	Error       string `json:"error,omitempty"`
+	DurationMs  int64  `json:"duration_ms"`
+	AttemptedAt int64  `json:"attempted_at"`
+}
+
+// MarshalJSON .
+func (a WebhookAttempt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&JSONWebhookAttempt{
+		StatusCode:  a.StatusCode,
+		Error:       a.Error,
+		DurationMs:  a.DurationMs,
+		AttemptedAt: a.CreatedAt.Unix(),
+	})
+}
+
+// WebhookRetry is how failed delivery is retried.
+// Delay doubles from 'Base' for each attempt, and is not longer than 'Max'.
+type WebhookRetry struct {
+	MaxAttempts int
+	Base        time.Duration
+	Max         time.Duration
+}
+
+// delay returns how long to wait after the attempts.
+func (r WebhookRetry) delay(attempts int) time.Duration {
+	delay := r.Max
+	if n := attempts - 1; n < 30 && r.Base<<uint(n) < r.Max {
+		delay = r.Base << uint(n)
+	}
+	return delay
+}
+
+// enqueueWebhookDeliveries adds deliveries of the event
+// for every webhook subscribing to it in the transaction.
+func enqueueWebhookDeliveries(tx *gorm.DB, e *OutboxEvent) error {
+	var webhooks []Webhook
+	if err := tx.Find(&webhooks).Error; err != nil {
+		return err
+	}
+
+	var payload []byte
+	for _, w := range webhooks {
+		if !w.Subscribes(e.Type) {
+			continue
+		}
+
+		if payload == nil {
+			var err error
+			if payload, err = json.Marshal(e.Event()); err != nil {
+				return err
+			}
+		}
+
+		// DATETIME 에서 반올림되면 바로 보낼 수 없으므로 초 단위로 자른다.
+		now := time.Now().Truncate(time.Second)
+		d := WebhookDelivery{
+			WebhookID:     w.ID,
+			EventID:       e.EventID,
+			EventType:     e.Type,
+			Payload:       string(payload),
+			NextAttemptAt: &now,
+		}
+		if err := tx.Create(&d).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindWebhookDelivery returns the delivery of the webhook with attempts log,
+// or nil if not found.
+func FindWebhookDelivery(con *gorm.DB, webhookID, id uint) *WebhookDelivery {
+	d := WebhookDelivery{}
+	err := con.Preload("Log", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("webhook_id = ?", webhookID).First(&d, id).Error
+	if err != nil {
+		return nil
+	}
+	return &d
+}
+
+// FindWebhookDeliveries returns deliveries of the webhook, newest first.
+func FindWebhookDeliveries(con *gorm.DB, webhookID uint, offset, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := con.Where("webhook_id = ?", webhookID).
+		Order("id desc").Limit(limit).Offset(offset).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// DeliverWebhook sends the delivery once and records the attempt.
+// Failed delivery is scheduled to be retried unless attempts run out.
+// Manual delivery does not change the schedule when it fails,
+// so that failed delivery can be tried again.
+func DeliverWebhook(
+	con *gorm.DB, client *utils.WebhookClient, d *WebhookDelivery,
+	retry WebhookRetry, manual bool) error {
+
+	var res utils.WebhookResult
+	w := Webhook{}
+	if con.First(&w, d.WebhookID).RecordNotFound() {
+		res.Err = errDeletedWebhook
+	} else {
+		res = client.Send(w.URL, w.Secret, d.EventID, d.EventType, []byte(d.Payload))
+	}
+
+	// DATETIME 에 초 단위로 저장되므로 미리 자른다.
+	now := time.Now().Truncate(time.Second)
+	attempt := WebhookAttempt{
+		DeliveryID: d.ID,
+		StatusCode: res.StatusCode,
+		DurationMs: int64(res.Duration / time.Millisecond),
+	}
+	d.Attempts++
+	d.LastStatusCode = res.StatusCode
+
+	switch {
+	case res.OK():
+		d.DeliveredAt = &now
+		d.FailedAt = nil
+		d.NextAttemptAt = nil
+	case res.Err == errDeletedWebhook || (!manual && d.Attempts >= retry.MaxAttempts):
+		d.FailedAt = &now
+		d.NextAttemptAt = nil
+	case !manual:
+		next := now.Add(retry.delay(d.Attempts))
+		d.NextAttemptAt = &next
+	}
+
+	if res.Err != nil {
+		attempt.Error = res.Err.Error()
+		if len(attempt.Error) > webhookErrorMaxLen {
+			attempt.Error = attempt.Error[:webhookErrorMaxLen]
+		}
+	}
+
+	do := func(tx *gorm.DB) error {
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+		d.Log = append(d.Log, attempt)
+		return tx.Model(d).Updates(map[string]interface{}{
+			"attempts":         d.Attempts,
+			"last_status_code": d.LastStatusCode,
+			"next_attempt_at":  d.NextAttemptAt,
+			"delivered_at":     d.DeliveredAt,
+			"failed_at":        d.FailedAt,
+		}).Error
+	}
+	return Transaction(con, do)
+}
+
+// claimWebhookDelivery moves the next attempt of the due delivery after the lease,
+// so that other instances do not send it at the same time.
+// It reports false if the delivery is not due any more.
+func claimWebhookDelivery(con *gorm.DB, d *WebhookDelivery, now time.Time) (bool, error) {
+	until := now.Add(webhookClaimLease)
+	result := con.Model(&WebhookDelivery{}).
+		Where("id = ? AND next_attempt_at <= ?", d.ID, now).
+		Update("next_attempt_at", until)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	d.NextAttemptAt = &until
+	return result.RowsAffected == 1, nil
+}
+
+// DeliverDueWebhooks sends up to 'limit' deliveries due now.
+// It returns the number of attempted deliveries.
+// Deliveries sent by other instances at the same time are skipped.
+func DeliverDueWebhooks(
+	con *gorm.DB, client *utils.WebhookClient, retry WebhookRetry, limit int) (int, error) {
+
+	now := time.Now()
+	var due []WebhookDelivery
+	err := con.Where("next_attempt_at <= ?", now).
+		Order("next_attempt_at, id").Limit(limit).Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	attempted := 0
+	for i := range due {
+		claimed, err := claimWebhookDelivery(con, &due[i], now)
+		if err != nil {
+			return attempted, err
+		}
+		if !claimed {
+			continue
+		}
+		if err := DeliverWebhook(con, client, &due[i], retry, false); err != nil {
+			return attempted, err
+		}
+		attempted++
+	}
+	return attempted, nil
+}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/utils"
+)
+
+func TestWebhookRetryDelay(t *testing.T) {
+	retry := WebhookRetry{MaxAttempts: 8, Base: time.Second * 30, Max: time.Hour}
+	assert.Equal(t, time.Second*30, retry.delay(1))
+	assert.Equal(t, time.Minute, retry.delay(2))
+	assert.Equal(t, time.Minute*2, retry.delay(3))
+	assert.Equal(t, time.Hour, retry.delay(8))
+	assert.Equal(t, time.Hour, retry.delay(100))
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	status := http.StatusServiceUnavailable
+	var received []utils.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e utils.Event
+		json.NewDecoder(r.Body).Decode(&e)
+		received = append(received, e)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	webhook := Webhook{
+		URL:        srv.URL,
+		EventTypes: EventUserCreated + " " + EventUserDeleted,
+		Secret:     "testsecrettestsecret",
+	}
+	assert.NoError(t, webhook.Create(con))
+
+	// 구독한 이벤트만 전달 대상이 된다.
+	user := User{Email: uuid.New().String() + "@mail.com"}
+	assert.NoError(t, user.Create(con, "Ok1234567!"))
+	user.ConfirmOTP()
+	assert.NoError(t, user.Save(con,
+		NewOutboxEvent(EventOTPConfirmed, 0, EventData{Email: user.Email})))
+
+	deliveries, err := FindWebhookDeliveries(con, webhook.ID, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	d := deliveries[0]
+	assert.Equal(t, EventUserCreated, d.EventType)
+	assert.Equal(t, WebhookDeliveryPending, d.Status())
+
+	retry := WebhookRetry{MaxAttempts: 2, Base: time.Minute, Max: time.Hour}
+	client := utils.NewWebhookClient(time.Second)
+	before := time.Now()
+	assert.NoError(t, DeliverWebhook(con, client, &d, retry, false))
+	assert.Len(t, received, 1)
+	assert.Equal(t, d.EventID, received[0].ID)
+	assert.Equal(t, user.ID, received[0].UserID)
+
+	found := FindWebhookDelivery(con, webhook.ID, d.ID)
+	assert.NotNil(t, found)
+	assert.Equal(t, WebhookDeliveryPending, found.Status())
+	assert.Equal(t, 1, found.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, found.LastStatusCode)
+	assert.True(t, found.NextAttemptAt.After(before.Add(time.Second*50)))
+	assert.Len(t, found.Log, 1)
+	assert.Equal(t, "unexpected status 503", found.Log[0].Error)
+
+	// 시도 횟수를 다 쓰면 실패로 끝난다.
+	assert.NoError(t, DeliverWebhook(con, client, found, retry, false))
+	found = FindWebhookDelivery(con, webhook.ID, d.ID)
+	assert.Equal(t, WebhookDeliveryFailed, found.Status())
+	assert.Nil(t, found.NextAttemptAt)
+	assert.Len(t, found.Log, 2)
+
+	// 수동 재전송은 실패한 전달도 다시 보낸다.
+	status = http.StatusNoContent
+	assert.NoError(t, DeliverWebhook(con, client, found, retry, true))
+	found = FindWebhookDelivery(con, webhook.ID, d.ID)
+	assert.Equal(t, WebhookDeliveryDelivered, found.Status())
+	assert.Equal(t, http.StatusNoContent, found.LastStatusCode)
+	assert.Len(t, found.Log, 3)
+	assert.Len(t, received, 3)
+
+	// 삭제된 웹훅의 전달은 보내지 않고 실패시킨다.
+	assert.NoError(t, user.Delete(con))
+	assert.NoError(t, webhook.Delete(con))
+	assert.Nil(t, FindWebhook(con, webhook.ID))
+
+	deliveries, err = FindWebhookDeliveries(con, webhook.ID, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 2)
+	assert.Equal(t, EventUserDeleted, deliveries[0].EventType)
+
+	_, err = DeliverDueWebhooks(con, client, retry, 1000)
+	assert.NoError(t, err)
+	found = FindWebhookDelivery(con, webhook.ID, deliveries[0].ID)
+	assert.Equal(t, WebhookDeliveryFailed, found.Status())
+	assert.Equal(t, "webhook has been deleted", found.Log[0].Error)
+	assert.Len(t, received, 3)
+}
+
+func TestDeliverDueWebhooksConcurrently(t *testing.T) {
+	configs.SetMode(configs.TestMode)
+	dbConf, err := configs.DB()
+	assert.NoError(t, err)
+	con, err := SyncModels(dbConf.Driver, dbConf.DSN(), false)
+	assert.NoError(t, err)
+	defer con.Close()
+
+	var mu sync.Mutex
+	received := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 10)
+		mu.Lock()
+		received[r.Header.Get(utils.WebhookIDHeader)]++
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	webhook := Webhook{
+		URL:        srv.URL,
+		EventTypes: EventSigninFailed,
+		Secret:     "testsecrettestsecret",
+	}
+	assert.NoError(t, webhook.Create(con))
+	defer webhook.Delete(con)
+
+	email := uuid.New().String() + "@mail.com"
+	var added []*OutboxEvent
+	for i := 0; i < 5; i++ {
+		added = append(added, NewOutboxEvent(EventSigninFailed, 0, EventData{Email: email}))
+	}
+	assert.NoError(t, AddOutboxEvents(con, added...))
+
+	// 여러 인스턴스가 함께 보내도 한 번씩만 보낸다.
+	retry := WebhookRetry{MaxAttempts: 2, Base: time.Minute, Max: time.Hour}
+	client := utils.NewWebhookClient(time.Second)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := DeliverDueWebhooks(con, client, retry, 1000)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	for _, e := range added {
+		assert.Equal(t, 1, received[e.EventID])
+	}
+	deliveries, err := FindWebhookDeliveries(con, webhook.ID, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, len(added))
+	for _, d := range deliveries {
+		assert.Equal(t, WebhookDeliveryDelivered, d.Status())
+		assert.Equal(t, 1, d.Attempts)
+	}
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/db"
+)
+
+var (
+	errSinceType   = errors.New("'since' must be unix time")
+	errUntilType   = errors.New("'until' must be unix time")
+	errOutcomeType = fmt.Errorf("'outcome' must be '%s' or '%s'",
+		db.AuditOutcomeSuccess, db.AuditOutcomeFailure)
+)
+
+// AuditEventsResponse .
+type AuditEventsResponse struct {
+	Page     int             `json:"page"`
+	PageSize int             `json:"page_size"`
+	HasNext  bool            `json:"has_next"`
+	Events   []db.AuditEvent `json:"events"`
+	Links    []Link          `json:"links"`
+}
+
+// Adjust .
+func (r *AuditEventsResponse) Adjust(pageSize int) {
+	if len(r.Events) > pageSize {
+		r.HasNext = true
+		r.Events = r.Events[:len(r.Events)-1]
+	}
+}
+
+// AttachLinks keeps query of the request except page in the links.
+func (r *AuditEventsResponse) AttachLinks(path string, query url.Values) {
+	v := url.Values{}
+	for key, values := range query {
+		v[key] = values
+	}
+	v.Set("page_size", strconv.Itoa(r.PageSize))
+
+	links := []Link{}
+	if r.HasNext {
+		v.Set("page", strconv.Itoa(r.Page+1))
+		links = append(links, Link{
+			Rel:    "next",
+			Method: "GET",
+			Href:   fmt.Sprintf("%s?%s", path, v.Encode()),
+		})
+	}
+
+	if r.Page > 0 {
+		v.Set("page", strconv.Itoa(r.Page-1))
+		links = append(links, Link{
+			Rel:    "prev",
+			Method: "GET",
+			Href:   fmt.Sprintf("%s?%s", path, v.Encode()),
+		})
+	}
+	r.Links = links
+}
+
+// setAuditTarget sets the user the request is about.
+func setAuditTarget(c *gin.Context, user *db.User) {
+	c.Set("AuditTarget", *user)
+}
+
+// Audit records the request as audit event after it is handled.
+// Only routes in 'auditActions' are recorded, outcome is decided by response status.
+// Failure of recording does not change the response, it is logged.
+// It uses the pool, so that the event is recorded even if the request is cancelled.
+func Audit(con *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		action, ok := auditActions[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		e := auditEvent(c, action)
+		if err := db.RecordAuditEvent(con, e); err != nil {
+			Logger(c).With("error", err).Errorf("failed record audit event '%s'", action)
+		}
+	}
+}
+
+func auditEvent(c *gin.Context, action string) *db.AuditEvent {
+	status := c.Writer.Status()
+	e := &db.AuditEvent{
+		Action:    action,
+		Outcome:   db.AuditOutcomeSuccess,
+		Status:    status,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		RequestID: c.GetString("RequestID"),
+	}
+	if status >= http.StatusBadRequest {
+		e.Outcome = db.AuditOutcomeFailure
+	}
+
+	if user, err := AuthorizedUser(c); err == nil {
+		e.ActorID = user.ID
+		e.ActorEmail = user.Email
+	}
+	if account, ok := AuthorizedServiceAccount(c); ok {
+		e.ActorClientID = account.ClientID
+	}
+	if v, ok := c.Get("AuditTarget"); ok {
+		if user, ok := v.(db.User); ok {
+			e.TargetUserID = user.ID
+			e.TargetEmail = user.Email
+		}
+	}
+	return e
+}
+
+func auditEventFilter(c *gin.Context) (db.AuditEventFilter, error) {
+	f := db.AuditEventFilter{
+		ActorEmail:  c.Query("actor"),
+		TargetEmail: c.Query("target"),
+		Action:      c.Query("action"),
+		Outcome:     c.Query("outcome"),
+		IP:          c.Query("ip"),
+	}
+
+	if f.Outcome != "" &&
+		f.Outcome != db.AuditOutcomeSuccess && f.Outcome != db.AuditOutcomeFailure {
+		return f, errOutcomeType
+	}
+
+	if since := c.Query("since"); since != "" {
+		ts, err := strconv.ParseInt(since, 10, 64)
+		if err != nil {
+			return f, errSinceType
+		}
+		t := time.Unix(ts, 0)
+		f.Since = &t
+	}
+
+	if until := c.Query("until"); until != "" {
+		ts, err := strconv.ParseInt(until, 10, 64)
+		if err != nil {
+			return f, errUntilType
+		}
+		t := time.Unix(ts, 0)
+		f.Until = &t
+	}
+	return f, nil
+}
+
+func respondAuditEvents(c *gin.Context, con *gorm.DB, f db.AuditEventFilter) {
+	page, err := Page(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBadPage, err))
+		return
+	}
+
+	pageSize, err := PageSize(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBadPageSize, err))
+		return
+	}
+
+	events, err := db.FindAuditEvents(con, f, page*pageSize, pageSize+1)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	r := AuditEventsResponse{
+		Page:     page,
+		PageSize: pageSize,
+		HasNext:  false,
+		Events:   events,
+	}
+	r.Adjust(pageSize)
+	r.AttachLinks(c.Request.URL.Path, c.Request.URL.Query())
+
+	c.JSON(http.StatusOK, r)
+}
+
+// AuditEvents .
+// Events are filtered by query 'actor', 'target', 'action', 'outcome', 'ip',
+// 'since' and 'until'. Emails are used for actor and target, unix time for since and until.
+func AuditEvents(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	f, err := auditEventFilter(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBadAuditFilter, err))
+		return
+	}
+
+	respondAuditEvents(c, con, f)
+}
+
+// UserActivity returns events that the user is actor or target of.
+func UserActivity(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	user := findUserByEmailOrAbort(
+		c.Param("email"), c, con, http.StatusNotFound)
+	if user == nil {
+		return
+	}
+
+	f := db.AuditEventFilter{
+		UserID: user.ID,
+		Action: c.Query("action"),
+	}
+	respondAuditEvents(c, con, f)
+}
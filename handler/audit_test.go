@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/db"
+)
+
+type auditEventsResponseForTest struct {
+	HasNext bool                `json:"has_next"`
+	Events  []db.JSONAuditEvent `json:"events"`
+	Links   []Link              `json:"links"`
+}
+
+func auditEventsForTest(t *testing.T, w *httptest.ResponseRecorder) auditEventsResponseForTest {
+	assert.Equal(t, http.StatusOK, w.Code)
+	var r auditEventsResponseForTest
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&r))
+	return r
+}
+
+func TestUserActivity(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	other, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	param := SigninParam{Email: user.Email, Password: "wrong password"}
+	w := jsonRequestForTest(router, "POST", "/signin", param, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	param.Password = testPassword
+	w = jsonRequestForTest(router, "POST", "/signin", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	uri := fmt.Sprintf("/users/%s/activity", user.Email)
+	w = jsonRequestForTest(router, "GET", uri, nil, other)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = jsonRequestForTest(router, "GET", uri+"?action=signin", nil, user)
+	r := auditEventsForTest(t, w)
+	assert.Len(t, r.Events, 2)
+	assert.False(t, r.HasNext)
+
+	// 최신 이벤트가 먼저 온다.
+	assert.Equal(t, db.AuditOutcomeSuccess, r.Events[0].Outcome)
+	assert.Equal(t, http.StatusOK, r.Events[0].Status)
+	assert.Equal(t, user.Email, r.Events[0].TargetEmail)
+	assert.Equal(t, db.AuditOutcomeFailure, r.Events[1].Outcome)
+	assert.Equal(t, http.StatusUnauthorized, r.Events[1].Status)
+
+	// 직전의 활동 조회 요청도 기록된다.
+	w = jsonRequestForTest(router, "GET", uri+"?page_size=1", nil, user)
+	r = auditEventsForTest(t, w)
+	assert.Len(t, r.Events, 1)
+	assert.True(t, r.HasNext)
+	assert.Equal(t, "user.activity.read", r.Events[0].Action)
+	assert.Equal(t, user.Email, r.Events[0].ActorEmail)
+	assert.Len(t, r.Links, 1)
+	assert.Equal(t, "next", r.Links[0].Rel)
+}
+
+func TestAuditEvents(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	uri := fmt.Sprintf("/admin/users/%s/otp", user.Email)
+	w := jsonRequestForTest(router, "DELETE", uri, nil, admin)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = jsonRequestForTest(router, "GET", "/admin/audit", nil, user)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	uri = fmt.Sprintf("/admin/audit?target=%s", user.Email)
+	w = jsonRequestForTest(router, "GET", uri, nil, admin)
+	r := auditEventsForTest(t, w)
+	assert.Len(t, r.Events, 1)
+	assert.Equal(t, "admin.otp.reset", r.Events[0].Action)
+	assert.Equal(t, admin.Email, r.Events[0].ActorEmail)
+
+	// 관리자가 아닌 사용자의 요청도 실패로 기록된다.
+	uri = fmt.Sprintf("/admin/audit?actor=%s&action=admin.audit.read&outcome=failure", user.Email)
+	w = jsonRequestForTest(router, "GET", uri, nil, admin)
+	r = auditEventsForTest(t, w)
+	assert.Len(t, r.Events, 1)
+	assert.Equal(t, http.StatusForbidden, r.Events[0].Status)
+
+	uri = fmt.Sprintf("/admin/audit?target=%s&until=0", user.Email)
+	w = jsonRequestForTest(router, "GET", uri, nil, admin)
+	r = auditEventsForTest(t, w)
+	assert.Len(t, r.Events, 0)
+
+	for _, query := range []string{"since=yesterday", "until=now", "outcome=unknown"} {
+		w = jsonRequestForTest(router, "GET", "/admin/audit?"+query, nil, admin)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, ErrorCodeBadAuditFilter, errCodeForTest(t, w))
+	}
+}
@@ -17,6 +17,14 @@ const (
 
 	ErrorCodeTmplExecute
 	ErrorCodeTmplParse
+
+	ErrorCodeLoadJWTKey
+	ErrorCodeGenerateJWTKey
+	ErrorCodeGenerateOAuthClient
+	ErrorCodeGenerateServiceAccount
+
+	ErrorCodeWebhookEnv
+	ErrorCodeGenerateWebhookSecret
 )
 
 // Parameter error codes.
@@ -29,6 +37,21 @@ const (
 	ErrorCodeExpiredToken
 
 	ErrorCodeInvalidPassword
+
+	ErrorCodeInvalidToken
+
+	ErrorCodeInvalidRefreshToken
+	ErrorCodeExpiredRefreshToken
+	ErrorCodeReusedRefreshToken
+
+	ErrorCodeBadRetireAfter
+	ErrorCodeUnsupportedSigningMethod
+
+	ErrorCodeBindForm
+
+	ErrorCodeBadAuditFilter
+
+	ErrorCodeSessionLifetimeExceeded
 )
 
 // User data error codes.
@@ -47,6 +70,70 @@ const (
 	ErrorCodeOTPProvisioningURI
 	ErrorCodeSetOTPBackupCodes
 	ErrorCodeOTPNotRegistered
+	ErrorCodeRequireVerifyWebAuthn
+
+	ErrorCodeIncorrectEmailCode
+	ErrorCodeExpiredEmailCode
+	ErrorCodeTooManyEmailCodeAttempts
+
+	ErrorCodeTooManySigninAttempts
+	ErrorCodeSigninLocked
+	ErrorCodeSigninNotLocked
+)
+
+// JWT key error codes.
+const (
+	ErrorCodeNotFoundJWTKey = iota + 5000
+	ErrorCodeRetiredJWTKey
+	ErrorCodeRetireSigningJWTKey
+)
+
+// OAuth error codes.
+const (
+	ErrorCodeNotFoundOAuthClient = iota + 6000
+	ErrorCodeInvalidRedirectURI
+	ErrorCodeUnsupportedResponseType
+	ErrorCodeInvalidScope
+	ErrorCodeInvalidCodeChallenge
+)
+
+// Service account error codes.
+const (
+	ErrorCodeNotFoundServiceAccount = iota + 7000
+	ErrorCodeNotGrantableScope
+)
+
+// WebAuthn error codes.
+const (
+	ErrorCodeInvalidWebAuthnChallenge = iota + 8000
+	ErrorCodeInvalidWebAuthnCredential
+	ErrorCodeNotFoundWebAuthnCredential
+	ErrorCodeWebAuthnCredentialAlreadyRegistered
+)
+
+// Rate limit error codes.
+const (
+	ErrorCodeRateLimited = iota + 9000
+)
+
+// Webhook error codes.
+const (
+	ErrorCodeNotFoundWebhook = iota + 10000
+	ErrorCodeNotFoundWebhookDelivery
+	ErrorCodeInvalidWebhookURL
+	ErrorCodeUnknownEventType
+	ErrorCodeInvalidWebhookSecret
+)
+
+// Role error codes.
+const (
+	ErrorCodeNotFoundRole = iota + 11000
+	ErrorCodeInvalidRoleName
+	ErrorCodeRoleAlreadyExists
+	ErrorCodeUnknownPermission
+	ErrorCodeBuiltinRole
+	ErrorCodeLastSuperuser
+	ErrorCodeNotGrantableRole
 )
 
 // Authorized User error codes.
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -24,6 +25,12 @@ const (
 	oneMinuteSeconds = 60
 )
 
+// RequestIDHeader is header of the request id, it is sent back in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen is the length of uuid, as long as 'request_id' of audit events.
+const maxRequestIDLen = 36
+
 var (
 	errNoAuthorizedUser    = errors.New("no 'AuthorizedUser'")
 	errWrongAuthorizedUser = errors.New("'AuthorizedUser' not 'db.User' type")
@@ -36,12 +43,63 @@ var (
 	errUserAlreadyExists = errors.New("user already exists")
 	errIncorrectPassword = errors.New("incorrect Password")
 	errExpiredToken      = errors.New("expired token")
+	errInvalidToken      = errors.New("invalid token")
+
+	errInvalidRefreshToken = errors.New("invalid refresh token")
+	errExpiredRefreshToken = errors.New("expired refresh token")
+	errReusedRefreshToken  = errors.New("reused refresh token. signin again")
+
+	errSessionLifetimeExceeded = errors.New("session can not be renewed any more. signin again")
+
+	errNotFoundJWTKey      = errors.New("not found jwt key")
+	errRetiredJWTKey       = errors.New("jwt key has already been retired")
+	errRetireSigningJWTKey = errors.New("signing jwt key can not be retired. promote another key first")
+
+	errNotFoundOAuthClient     = errors.New("not found oauth client")
+	errInvalidRedirectURI      = errors.New("redirect uri is not registered or invalid")
+	errUnsupportedResponseType = errors.New("unsupported response type. only 'code' is supported")
+	errInvalidScope            = errors.New("requested scope is not allowed to the client")
+	errInvalidCodeChallenge    = errors.New("'code_challenge' with 'S256' method is required")
+
+	errNotFoundServiceAccount = errors.New("not found service account")
+	errNotGrantableScope      = errors.New("scope allows permissions the requester does not have")
+
+	errInvalidWebAuthnChallenge            = errors.New("webauthn challenge is invalid, expired or already used")
+	errInvalidWebAuthnCredential           = errors.New("webauthn credential verification failed")
+	errNotFoundWebAuthnCredential          = errors.New("not found webauthn credential")
+	errWebAuthnCredentialAlreadyRegistered = errors.New("webauthn credential has already been registered")
 
 	errOTPAlreadyRegistered = errors.New("OTP has already been registered")
 	errNoOTPSecretKey       = errors.New("no OTP secert key")
 	errIncorrectOTP         = errors.New("OTP is Incorrect")
 	errNoOTPBackupCodes     = errors.New("no otp backup codes. contact administrator")
 	errRequireVerifyOTP     = errors.New("required verify OTP")
+
+	errRequireVerifyWebAuthn = errors.New("required verify security key")
+
+	errIncorrectEmailCode       = errors.New("email code is incorrect")
+	errExpiredEmailCode         = errors.New("email code has expired or not been requested")
+	errTooManyEmailCodeAttempts = errors.New("too many email code attempts. request new code")
+
+	errTooManySigninAttempts = errors.New("too many failed signin attempts. retry later")
+	errSigninLocked          = errors.New("signin is locked by failed attempts. unlock by email or retry later")
+	errSigninNotLocked       = errors.New("signin is not locked")
+
+	errRateLimited = errors.New("too many requests. retry later")
+
+	errNotFoundWebhook         = errors.New("not found webhook")
+	errNotFoundWebhookDelivery = errors.New("not found webhook delivery")
+	errInvalidWebhookURL       = errors.New("webhook url must be absolute 'http' or 'https' url")
+	errUnknownEventType        = errors.New("unknown event type")
+	errInvalidWebhookSecret    = errors.New("webhook secret must be at least 16 characters")
+
+	errNotFoundRole      = errors.New("not found role")
+	errInvalidRoleName   = errors.New("role name must be lowercase letters, digits, '-' or '_' up to 64")
+	errRoleAlreadyExists = errors.New("role already exists")
+	errUnknownPermission = errors.New("unknown permission")
+	errBuiltinRole       = errors.New("builtin role can not be changed or deleted")
+	errLastSuperuser     = errors.New("the last superuser can not be unassigned or deleted")
+	errNotGrantableRole  = errors.New("role has permissions the requester does not have")
 )
 
 var errMapByCode = map[int]error{
@@ -49,6 +107,31 @@ var errMapByCode = map[int]error{
 	ErrorCodeUserAlreadyExists: errUserAlreadyExists,
 	ErrorCodeIncorrectPassword: errIncorrectPassword,
 	ErrorCodeExpiredToken:      errExpiredToken,
+	ErrorCodeInvalidToken:      errInvalidToken,
+
+	ErrorCodeInvalidRefreshToken: errInvalidRefreshToken,
+	ErrorCodeExpiredRefreshToken: errExpiredRefreshToken,
+	ErrorCodeReusedRefreshToken:  errReusedRefreshToken,
+
+	ErrorCodeSessionLifetimeExceeded: errSessionLifetimeExceeded,
+
+	ErrorCodeNotFoundJWTKey:      errNotFoundJWTKey,
+	ErrorCodeRetiredJWTKey:       errRetiredJWTKey,
+	ErrorCodeRetireSigningJWTKey: errRetireSigningJWTKey,
+
+	ErrorCodeNotFoundOAuthClient:     errNotFoundOAuthClient,
+	ErrorCodeInvalidRedirectURI:      errInvalidRedirectURI,
+	ErrorCodeUnsupportedResponseType: errUnsupportedResponseType,
+	ErrorCodeInvalidScope:            errInvalidScope,
+	ErrorCodeInvalidCodeChallenge:    errInvalidCodeChallenge,
+
+	ErrorCodeNotFoundServiceAccount: errNotFoundServiceAccount,
+	ErrorCodeNotGrantableScope:      errNotGrantableScope,
+
+	ErrorCodeInvalidWebAuthnChallenge:            errInvalidWebAuthnChallenge,
+	ErrorCodeInvalidWebAuthnCredential:           errInvalidWebAuthnCredential,
+	ErrorCodeNotFoundWebAuthnCredential:          errNotFoundWebAuthnCredential,
+	ErrorCodeWebAuthnCredentialAlreadyRegistered: errWebAuthnCredentialAlreadyRegistered,
 
 	ErrorCodeOTPAlreadyRegistered: errOTPAlreadyRegistered,
 	ErrorCodeNoOTPSecretKey:       errNoOTPSecretKey,
@@ -56,6 +139,32 @@ var errMapByCode = map[int]error{
 	ErrorCodeNoOTPBackupCodes:     errNoOTPBackupCodes,
 	ErrorCodeRequireVerifyOTP:     errRequireVerifyOTP,
 
+	ErrorCodeRequireVerifyWebAuthn: errRequireVerifyWebAuthn,
+
+	ErrorCodeIncorrectEmailCode:       errIncorrectEmailCode,
+	ErrorCodeExpiredEmailCode:         errExpiredEmailCode,
+	ErrorCodeTooManyEmailCodeAttempts: errTooManyEmailCodeAttempts,
+
+	ErrorCodeTooManySigninAttempts: errTooManySigninAttempts,
+	ErrorCodeSigninLocked:          errSigninLocked,
+	ErrorCodeSigninNotLocked:       errSigninNotLocked,
+
+	ErrorCodeRateLimited: errRateLimited,
+
+	ErrorCodeNotFoundWebhook:         errNotFoundWebhook,
+	ErrorCodeNotFoundWebhookDelivery: errNotFoundWebhookDelivery,
+	ErrorCodeInvalidWebhookURL:       errInvalidWebhookURL,
+	ErrorCodeUnknownEventType:        errUnknownEventType,
+	ErrorCodeInvalidWebhookSecret:    errInvalidWebhookSecret,
+
+	ErrorCodeNotFoundRole:      errNotFoundRole,
+	ErrorCodeInvalidRoleName:   errInvalidRoleName,
+	ErrorCodeRoleAlreadyExists: errRoleAlreadyExists,
+	ErrorCodeUnknownPermission: errUnknownPermission,
+	ErrorCodeBuiltinRole:       errBuiltinRole,
+	ErrorCodeLastSuperuser:     errLastSuperuser,
+	ErrorCodeNotGrantableRole:  errNotGrantableRole,
+
 	ErrorCodeNoDBConn:    errNoDBConn,
 	ErrorCodeWrongDBConn: errWrongDBConn,
 }
@@ -121,6 +230,19 @@ func AuthorizedUser(c *gin.Context) (user db.User, err error) {
 	return
 }
 
+// authentication returns when and how the authorized user signed in.
+func authentication(c *gin.Context) utils.Authentication {
+	auth, _ := c.Get("Authentication")
+	v, _ := auth.(utils.Authentication)
+	return v
+}
+
+// Logger returns the logger of the request.
+// Logs of it have the request id, the route and the authorized user.
+func Logger(c *gin.Context) *utils.Logger {
+	return utils.LoggerFromContext(c.Request.Context())
+}
+
 // DBConnOrAbort .
 func DBConnOrAbort(c *gin.Context) *gorm.DB {
 	con, ok := c.Get("DBConnection")
@@ -154,12 +276,13 @@ func findUserByEmailOrAbort(email string, c *gin.Context, con *gorm.DB, httpStat
 				NewErrResWithErr(ErrorCodeAuthorizedUser, err))
 			return nil
 		}
+		setAuditTarget(c, &user)
 		return &user
 	}
 
 	// TODO(hs.lee): 테스트 케이스를 추가한다.
 	// NOTE(hs.lee): 관리자인 경우 삭제된 사용자도 검색 가능
-	if c.GetBool("AuthorizedUserIsAdmin") {
+	if c.GetBool("AuthorizedByPermission") {
 		con = con.Unscoped()
 	}
 
@@ -170,6 +293,7 @@ func findUserByEmailOrAbort(email string, c *gin.Context, con *gorm.DB, httpStat
 			NewErrRes(ErrorCodeNotFoundUser))
 		return nil
 	}
+	setAuditTarget(c, user)
 	return user
 }
 
@@ -198,8 +322,16 @@ func testEmail() string {
 
 func setAuthJWTForTest(req *http.Request, u *db.User) {
 	conf := configs.App()
+	key, err := JWTKey()
+	if err != nil {
+		log.Fatalf("failed load jwt key: %s\n", err.Error())
+	}
 	token := utils.NewJWT(10)
-	sessionToken, err := token.Session(u.ID, u.Email, conf.JWTSigninKey, conf.Org)
+	auth := utils.Authentication{
+		AuthTime: time.Now().Unix(),
+		AMR:      []string{utils.AMRPassword},
+	}
+	sessionToken, err := token.Session(u.ID, u.Email, nil, auth, key, conf.IssuerURL())
 	if err != nil {
 		log.Fatalf("failed generate session token: %s\n", err.Error())
 	}
@@ -207,22 +339,30 @@ func setAuthJWTForTest(req *http.Request, u *db.User) {
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", sessionToken))
 }
 
-func newUserForTest(con *gorm.DB, isAdmin bool) (*db.User, error) {
+func newUserForTest(con *gorm.DB, roles ...string) (*db.User, error) {
 	email := testEmail()
 	user := db.User{
-		Email:   email,
-		IsAdmin: isAdmin,
+		Email: email,
 	}
 	if err := user.Create(con, testPassword); err != nil {
 		return nil, err
 	}
+	for _, name := range roles {
+		role := db.FindRole(con, name)
+		if role == nil {
+			return nil, fmt.Errorf("not found role '%s'", name)
+		}
+		if err := role.Assign(con, user.ID); err != nil {
+			return nil, err
+		}
+	}
 	return &user, nil
 }
 
 func testUser(con *gorm.DB) (*db.User, error) {
-	return newUserForTest(con, false)
+	return newUserForTest(con)
 }
 
 func testAdmin(con *gorm.DB) (*db.User, error) {
-	return newUserForTest(con, true)
+	return newUserForTest(con, db.SuperuserRole)
 }
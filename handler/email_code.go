@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+const emailCodeLen = 6
+
+// SigninWithEmailCodeParam .
+// 'OTP' or 'WebAuthn' is required if the user registered them.
+type SigninWithEmailCodeParam struct {
+	Email string `json:"email" binding:"required"`
+	Code  string `json:"code" binding:"required,numeric"`
+	OTP   string `json:"otp"`
+
+	WebAuthn *utils.WebAuthnAuthenticationCredential `json:"webauthn"`
+}
+
+// EmailCodeData .
+type EmailCodeData struct {
+	UserEmail    string `json:"user_email"`
+	Code         string `json:"code"`
+	ExpireMin    int    `json:"expire_min"`
+	Organization string `json:"organization"`
+}
+
+func consumeEmailCodeOrAbort(c *gin.Context, con *gorm.DB, userID uint, code string) bool {
+	conf := configs.App()
+	err := db.ConsumeEmailCode(con, userID, code, conf.EmailCodeMaxAttempts)
+	if err == nil {
+		return true
+	}
+
+	switch {
+	case errors.Is(err, db.ErrorIncorrectEmailCode):
+		c.AbortWithStatusJSON(
+			http.StatusUnauthorized,
+			NewErrRes(ErrorCodeIncorrectEmailCode))
+	case errors.Is(err, db.ErrorNotFoundEmailCode),
+		errors.Is(err, db.ErrorExpiredEmailCode):
+		c.AbortWithStatusJSON(
+			http.StatusUnauthorized,
+			NewErrRes(ErrorCodeExpiredEmailCode))
+	case errors.Is(err, db.ErrorTooManyEmailCodeAttempts):
+		c.AbortWithStatusJSON(
+			http.StatusTooManyRequests,
+			NewErrRes(ErrorCodeTooManyEmailCodeAttempts))
+	default:
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+	}
+	return false
+}
+
+// SendEmailCode sends one-time numeric code to the user.
+// The code is used to signin without password,
+// or instead of OTP as second factor of Signin.
+// Code sent before is no longer valid.
+func SendEmailCode(c *gin.Context) {
+	conf := configs.App()
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param SendEmailParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	user := findUserByEmailOrAbort(
+		param.Email, c, con, http.StatusBadRequest)
+	if user == nil {
+		return
+	}
+
+	code := utils.DigitCode(emailCodeLen)
+	if err := db.IssueEmailCode(con, user.ID, code, conf.EmailCodeExpire); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	if gin.Mode() == gin.DebugMode {
+		Logger(c).Debugf("email code: %s", code)
+	}
+
+	emailTmpl, err := template.New("email code").Parse(param.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeTmplParse, err))
+		return
+	}
+
+	var body bytes.Buffer
+	data := EmailCodeData{
+		UserEmail:    param.Email,
+		Code:         code,
+		ExpireMin:    conf.EmailCodeExpire / oneMinuteSeconds,
+		Organization: conf.Org,
+	}
+
+	if err := emailTmpl.Execute(&body, data); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeTmplExecute, err))
+		return
+	}
+
+	if err = utils.NewEmail(
+		utils.NameFromEmail(param.Email),
+		conf.SupportEmail,
+		param.Email,
+		param.Subject,
+		body.String(),
+	).SendContext(c.Request.Context(), configs.SMTP().Addr()); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeSendEmail, err))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// SigninWithEmailCode signs in with the code sent by email without password.
+// Email code proves only access to the mailbox,
+// so OTP or security key is still required if the user registered them.
+func SigninWithEmailCode(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param SigninWithEmailCodeParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	attempt := newSigninAttempt(c, con)
+	if attempt == nil {
+		return
+	}
+	defer attempt.end()
+	attempt.setUser(0, param.Email)
+
+	user := findUserByEmailOrAbort(
+		param.Email, c, con, http.StatusBadRequest)
+	if user == nil {
+		return
+	}
+	attempt.setUser(user.ID, user.Email)
+
+	if attempt.isAbortedAsThrottled(accountSigninThrottle(user.ID)) {
+		return
+	}
+
+	creds := webAuthnCredentialsOrAbort(c, con, user.ID)
+	if creds == nil {
+		return
+	}
+
+	// 두 번째 인증 수단이 없으면 코드를 소모하지 않고 먼저 알려준다.
+	f := secondFactor{OTP: param.OTP, WebAuthn: param.WebAuthn}
+	if isAbortedAsRequireSecondFactor(c, user, creds, f) {
+		attempt.uncounted = true
+		return
+	}
+
+	if !consumeEmailCodeOrAbort(c, con, user.ID, param.Code) {
+		return
+	}
+
+	auth := utils.Authentication{
+		AuthTime: time.Now().Unix(),
+		AMR:      []string{utils.AMROTP},
+	}
+	if !verifySecondFactorOrAbort(c, con, user, creds, f, &auth) {
+		return
+	}
+
+	signin(c, con, user, auth)
+}
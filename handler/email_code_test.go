@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+const (
+	emailCodeSubject  = "[auth] Your sign in code."
+	emailCodeBodyTmpl = `<p>Hi {{ .UserEmail }}.</p>
+<p>Your code is</p>
+<p>{{ .Code }}</p>
+<p>It will expire in {{ .ExpireMin }} minutes.</p>`
+)
+
+var emailCodeRegexp = regexp.MustCompile(`^<p>\d{6}</p>$`)
+
+// sendEmailCodeForTest returns the code captured by mock smtp server.
+func sendEmailCodeForTest(t *testing.T, router http.Handler, email string) string {
+	conf := configs.App()
+	// 코드는 Capture 로 받으므로 비워 둔다.
+	data := EmailCodeData{
+		UserEmail:    email,
+		ExpireMin:    conf.EmailCodeExpire / oneMinuteSeconds,
+		Organization: conf.Org,
+	}
+	var emailBody bytes.Buffer
+	emailTmpl, err := template.New("email code").Parse(emailCodeBodyTmpl)
+	assert.NoError(t, err)
+	assert.NoError(t, emailTmpl.Execute(&emailBody, data))
+
+	ln, err := utils.NewLocalListener(utils.MockSMTPPort)
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	captured := make(chan string, 1)
+	go func() {
+		defer close(captured)
+		c, err := ln.Accept()
+		if err != nil {
+			t.Errorf("local listener accept: %v", err)
+			return
+		}
+		defer c.Close()
+		handler := utils.MockSMTPHandler{
+			Con:     c,
+			Name:    utils.NameFromEmail(email),
+			From:    conf.SupportEmail,
+			To:      email,
+			Subject: emailCodeSubject,
+			Body:    emailBody.String(),
+			Capture: emailCodeRegexp,
+		}
+		if err := handler.Handle(); err != nil {
+			t.Errorf("mock smtp handle error: %v", err)
+		}
+		if len(handler.Captured) > 0 {
+			captured <- handler.Captured[0]
+		}
+	}()
+	configs.SetSMTPPort(utils.MockSMTPPort)
+
+	param := SendEmailParam{
+		Email:   email,
+		Subject: emailCodeSubject,
+		Body:    emailCodeBodyTmpl,
+	}
+	w := jsonRequestForTest(router, "POST", "/signin/email_code", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	select {
+	case line := <-captured:
+		return strings.TrimSuffix(strings.TrimPrefix(line, "<p>"), "</p>")
+	case <-time.After(time.Second * 3):
+		t.Error("email code was not sent")
+		return ""
+	}
+}
+
+func signinWithEmailCodeForTest(t *testing.T, router http.Handler, param SigninWithEmailCodeParam) (int, ErrorCodeResponse, *utils.SessionClaims) {
+	w := jsonRequestForTest(router, "POST", "/signin/email_code/verification", param, nil)
+	if w.Code != http.StatusOK {
+		var errRes ErrorCodeResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&errRes))
+		return w.Code, errRes, nil
+	}
+
+	var resBody SiginResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resBody))
+	ring, err := KeyRing(testDBCon)
+	assert.NoError(t, err)
+	claims, err := utils.ParseSessionJWT(resBody.Token, ring)
+	assert.NoError(t, err)
+	return w.Code, ErrorCodeResponse{}, claims
+}
+
+func TestSigninWithEmailCode(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	code := sendEmailCodeForTest(t, router, user.Email)
+	assert.Len(t, code, emailCodeLen)
+
+	param := SigninWithEmailCodeParam{Email: user.Email, Code: code}
+	status, _, claims := signinWithEmailCodeForTest(t, router, param)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, user.ID, claims.UserID)
+	assert.Equal(t, []string{utils.AMROTP}, claims.AMR)
+
+	status, errRes, _ := signinWithEmailCodeForTest(t, router, param)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, ErrorCodeExpiredEmailCode, errRes.ErrorCode)
+}
+
+func TestSigninWithEmailCodeWithIncorrectCode(t *testing.T) {
+	os.Setenv(configs.EnvPrefix+"SIGNIN_MAX_DELAY", "0")
+	defer os.Unsetenv(configs.EnvPrefix + "SIGNIN_MAX_DELAY")
+
+	conf := configs.App()
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	code := sendEmailCodeForTest(t, router, user.Email)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	param := SigninWithEmailCodeParam{Email: user.Email, Code: wrong}
+	for i := 0; i < conf.EmailCodeMaxAttempts; i++ {
+		status, errRes, _ := signinWithEmailCodeForTest(t, router, param)
+		assert.Equal(t, http.StatusUnauthorized, status)
+		assert.Equal(t, ErrorCodeIncorrectEmailCode, errRes.ErrorCode)
+	}
+
+	param.Code = code
+	status, errRes, _ := signinWithEmailCodeForTest(t, router, param)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, ErrorCodeTooManyEmailCodeAttempts, errRes.ErrorCode)
+
+	// 틀린 코드도 로그인 실패로 센다.
+	lock := db.FindSigninLock(testDBCon, db.SigninLockSubjectUser(user.ID))
+	assert.NotNil(t, lock)
+	assert.Equal(t, conf.EmailCodeMaxAttempts+1, lock.Failures)
+}
+
+func TestSigninWithEmailCodeRequireOTP(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	_, errCodeRes := generateOTP(testDBCon, user)
+	assert.Nil(t, errCodeRes)
+	errCodeRes = confirmOTP(testDBCon, user)
+	assert.Nil(t, errCodeRes)
+
+	router := New(testDBCon)
+	code := sendEmailCodeForTest(t, router, user.Email)
+
+	param := SigninWithEmailCodeParam{Email: user.Email, Code: code}
+	status, errRes, _ := signinWithEmailCodeForTest(t, router, param)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, ErrorCodeRequireVerifyOTP, errRes.ErrorCode)
+
+	// OTP 가 없어서 실패한 경우 코드는 그대로 사용할 수 있다.
+	totp, err := user.TOTP()
+	assert.NoError(t, err)
+	param.OTP = totp.Now()
+	status, _, claims := signinWithEmailCodeForTest(t, router, param)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{utils.AMROTP, utils.AMRMultiFactor}, claims.AMR)
+}
+
+func TestSigninWithEmailCodeAsSecondFactor(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	_, errCodeRes := generateOTP(testDBCon, user)
+	assert.Nil(t, errCodeRes)
+	errCodeRes = confirmOTP(testDBCon, user)
+	assert.Nil(t, errCodeRes)
+
+	router := New(testDBCon)
+	param := SigninParam{
+		Email:     user.Email,
+		Password:  testPassword,
+		EmailCode: "000000",
+	}
+	w := jsonRequestForTest(router, "POST", "/signin", param, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var errRes ErrorCodeResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&errRes))
+	assert.Equal(t, ErrorCodeExpiredEmailCode, errRes.ErrorCode)
+
+	param.EmailCode = sendEmailCodeForTest(t, router, user.Email)
+	w = jsonRequestForTest(router, "POST", "/signin", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resBody SiginResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resBody))
+	ring, err := KeyRing(testDBCon)
+	assert.NoError(t, err)
+	claims, err := utils.ParseSessionJWT(resBody.Token, ring)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]string{utils.AMRPassword, utils.AMROTP, utils.AMRMultiFactor},
+		claims.AMR)
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/configs"
+)
+
+// Statuses of readiness and checks of dependencies.
+const (
+	ReadyStatus        = "ready"
+	NotReadyStatus     = "not_ready"
+	ShuttingDownStatus = "shutting_down"
+
+	CheckOKStatus    = "ok"
+	CheckErrorStatus = "error"
+)
+
+// CheckResult is the result of checking a dependency.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// ReadinessResponse .
+// 'Checks' are empty while shutting down, dependencies are not checked.
+type ReadinessResponse struct {
+	Status    string                 `json:"status"`
+	Checks    map[string]CheckResult `json:"checks,omitempty"`
+	CheckedAt *time.Time             `json:"checked_at,omitempty"`
+}
+
+// draining is set when graceful shutdown begins.
+var draining int32
+
+// Drain makes '/readyz' report not ready from now,
+// so that load balancers stop sending requests before the server is shut down.
+func Drain() {
+	atomic.StoreInt32(&draining, 1)
+}
+
+func isDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+type checkFunc func(ctx context.Context) error
+
+// readiness checks dependencies at once with the timeout.
+// The result is reused for the ttl, so that probes do not load dependencies,
+// and probes while checking wait for the same result.
+type readiness struct {
+	checks  map[string]checkFunc
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu   sync.Mutex
+	last *ReadinessResponse
+}
+
+func newReadiness(con *gorm.DB) *readiness {
+	conf, err := configs.Health()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	return &readiness{
+		checks: map[string]checkFunc{
+			"db": func(ctx context.Context) error {
+				return con.DB().PingContext(ctx)
+			},
+			"smtp": func(ctx context.Context) error {
+				return configs.SMTP().DialAndQuitContext(ctx)
+			},
+		},
+		timeout: conf.ReadyCheckTimeoutDuration(),
+		ttl:     conf.ReadyCacheTTLDuration(),
+	}
+}
+
+func (r *readiness) check() ReadinessResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last != nil && time.Since(*r.last.CheckedAt) < r.ttl {
+		return *r.last
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	res := ReadinessResponse{Status: ReadyStatus, Checks: map[string]CheckResult{}}
+	for name, check := range r.checks {
+		wg.Add(1)
+		go func(name string, check checkFunc) {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+			result := CheckResult{
+				Status:    CheckOKStatus,
+				LatencyMS: float64(time.Since(start)) / float64(time.Millisecond),
+			}
+			if err != nil {
+				result.Status = CheckErrorStatus
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			res.Checks[name] = result
+			if err != nil {
+				res.Status = NotReadyStatus
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	checkedAt := time.Now()
+	res.CheckedAt = &checkedAt
+	r.last = &res
+	return res
+}
+
+// Readyz reports whether the server can serve requests with status of each dependency.
+// It responds 503 if any dependency fails or the server is shutting down.
+func (r *readiness) Readyz(c *gin.Context) {
+	if isDraining() {
+		c.JSON(http.StatusServiceUnavailable, ReadinessResponse{Status: ShuttingDownStatus})
+		return
+	}
+
+	res := r.check()
+	if res.Status != ReadyStatus {
+		c.JSON(http.StatusServiceUnavailable, res)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// Healthz reports the process is alive, dependencies are not checked.
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": CheckOKStatus})
+}
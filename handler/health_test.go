@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/utils"
+)
+
+func TestHealthz(t *testing.T) {
+	router := New(testDBCon)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func readyzForTest(t *testing.T, router http.Handler) (int, ReadinessResponse) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	router.ServeHTTP(w, req)
+
+	var res ReadinessResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	return w.Code, res
+}
+
+func TestReadyz(t *testing.T) {
+	ln, err := utils.NewLocalListener(utils.MockSMTPPort)
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			handler := utils.MockSMTPHandler{Con: c}
+			handler.Handle()
+			c.Close()
+		}
+	}()
+	configs.SetSMTPPort(utils.MockSMTPPort)
+
+	router := New(testDBCon)
+	code, res := readyzForTest(t, router)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, ReadyStatus, res.Status)
+	assert.Equal(t, CheckOKStatus, res.Checks["db"].Status)
+	assert.Equal(t, CheckOKStatus, res.Checks["smtp"].Status)
+
+	// 캐시된 결과를 돌려주므로 smtp 서버가 멈춰도 바로 바뀌지 않는다.
+	ln.Close()
+	code, cached := readyzForTest(t, router)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, res.CheckedAt, cached.CheckedAt)
+}
+
+func TestReadyzWithFailedCheck(t *testing.T) {
+	var calls int32
+	ready := &readiness{
+		checks: map[string]checkFunc{
+			"db": func(ctx context.Context) error { return nil },
+			"smtp": func(ctx context.Context) error {
+				atomic.AddInt32(&calls, 1)
+				<-ctx.Done()
+				return errors.New("smtp server dial: timeout")
+			},
+		},
+		timeout: 50 * time.Millisecond,
+	}
+	router := gin.New()
+	router.GET("/readyz", ready.Readyz)
+
+	code, res := readyzForTest(t, router)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, NotReadyStatus, res.Status)
+	assert.Equal(t, CheckOKStatus, res.Checks["db"].Status)
+	assert.Equal(t, CheckErrorStatus, res.Checks["smtp"].Status)
+	assert.Equal(t, "smtp server dial: timeout", res.Checks["smtp"].Error)
+
+	// 캐시하지 않으면 매번 확인한다.
+	readyzForTest(t, router)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestReadyzWhileDraining(t *testing.T) {
+	defer atomic.StoreInt32(&draining, 0)
+	router := New(testDBCon)
+
+	Drain()
+	code, res := readyzForTest(t, router)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, ShuttingDownStatus, res.Status)
+	assert.Empty(t, res.Checks)
+
+	// 살아 있는지는 그대로 알린다.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+const (
+	oauthErrorUnauthorizedClient   = "unauthorized_client"
+	oauthErrorUnsupportedTokenType = "unsupported_token_type"
+)
+
+// OAuthTokenHintParam is introspection and revocation request.
+// 'TokenTypeHint' is accepted but not needed, every token is told apart by itself.
+// reference - https://tools.ietf.org/html/rfc7662#section-2.1
+// reference - https://tools.ietf.org/html/rfc7009#section-2.1
+type OAuthTokenHintParam struct {
+	Token         string `form:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// IntrospectionResponse .
+// Only 'active' is given if the token is not active.
+// reference - https://tools.ietf.org/html/rfc7662#section-2.2
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	JTI       string `json:"jti,omitempty"`
+}
+
+// isAbortedAsRevokedToken aborts if the token identified by jti has been revoked.
+func isAbortedAsRevokedToken(c *gin.Context, con *gorm.DB, jti string) bool {
+	revoked, err := db.IsTokenRevoked(con, jti)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return true
+	}
+
+	if revoked {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return true
+	}
+	return false
+}
+
+// authenticateClient returns ID of OAuth client or service account.
+// 'confidential' is false for public client which has no secret.
+func authenticateClient(con *gorm.DB, clientID, secret string) (id string, confidential bool, ok bool) {
+	if client := db.FindOAuthClient(con, clientID); client != nil {
+		return client.ClientID, client.Confidential(), client.VerifySecret(secret)
+	}
+
+	account := db.FindServiceAccount(con, clientID)
+	if account == nil || account.Disabled() {
+		return "", false, false
+	}
+	return account.ClientID, true, account.VerifySecret(secret)
+}
+
+func bindTokenHintParamOrAbort(c *gin.Context) *OAuthTokenHintParam {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var param OAuthTokenHintParam
+	if err := c.ShouldBind(&param); err != nil {
+		abortWithOAuthError(c, http.StatusBadRequest,
+			oauthErrorInvalidRequest, err.Error())
+		return nil
+	}
+
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		param.ClientID, param.ClientSecret = id, secret
+	}
+	return &param
+}
+
+// activeToken returns the introspection of the token.
+// Signature, expiry, revocation and the principal are all checked.
+func activeToken(con *gorm.DB, keys utils.Keys, token string) (*IntrospectionResponse, error) {
+	inactive := &IntrospectionResponse{Active: false}
+	// Access token claims are superset of session token claims.
+	claims, err := utils.ParseAccessJWT(token, keys)
+	if err != nil {
+		return inactive, nil
+	}
+
+	res := &IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		TokenType: tokenTypeBearer,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		NotBefore: claims.NotBefore,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		JTI:       claims.Id,
+	}
+
+	switch claims.Subject {
+	case utils.Session, utils.Access:
+		user := db.User{}
+		if con.First(&user, claims.UserID).RecordNotFound() ||
+			user.Email != claims.UserEmail {
+			return inactive, nil
+		}
+		res.Username = user.Email
+		res.Subject = subject(&user)
+	case utils.ServiceAccess:
+		account := db.FindServiceAccount(con, claims.ClientID)
+		if account == nil || account.Disabled() {
+			return inactive, nil
+		}
+		res.Subject = account.ClientID
+	default:
+		return inactive, nil
+	}
+
+	revoked, err := db.IsTokenRevoked(con, claims.Id)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return inactive, nil
+	}
+	return res, nil
+}
+
+// IntrospectToken tells the protected resource whether the token is active.
+// Caller must authenticate as confidential client or service account.
+func IntrospectToken(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	param := bindTokenHintParamOrAbort(c)
+	if param == nil {
+		return
+	}
+
+	_, confidential, ok := authenticateClient(con, param.ClientID, param.ClientSecret)
+	if !ok || !confidential {
+		abortWithOAuthError(c, http.StatusUnauthorized,
+			oauthErrorInvalidClient, "")
+		return
+	}
+
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
+	res, err := activeToken(con, ring, param.Token)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// RevokeToken revokes the token so that it is no longer accepted.
+// Session token and refresh token can be revoked by whoever holds them,
+// access token only by the client it was issued to.
+// Invalid token is not an error as the purpose is already achieved.
+func RevokeToken(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	param := bindTokenHintParamOrAbort(c)
+	if param == nil {
+		return
+	}
+
+	var clientID string
+	if param.ClientID != "" {
+		id, _, ok := authenticateClient(con, param.ClientID, param.ClientSecret)
+		if !ok {
+			abortWithOAuthError(c, http.StatusUnauthorized,
+				oauthErrorInvalidClient, "")
+			return
+		}
+		clientID = id
+	}
+
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
+	claims, err := utils.ParseAccessJWT(param.Token, ring)
+	if err != nil {
+		// 서명된 토큰이 아니면 refresh token 으로 취급한다.
+		err := db.RevokeRefreshToken(con, param.Token)
+		if err != nil && !errors.Is(err, db.ErrorNotFoundRefreshToken) {
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				NewErrResWithErr(ErrorCodeDBTransaction, err))
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	}
+
+	switch claims.Subject {
+	case utils.Session:
+	case utils.Access, utils.ServiceAccess:
+		if claims.ClientID != clientID {
+			abortWithOAuthError(c, http.StatusBadRequest,
+				oauthErrorUnauthorizedClient, "token was not issued to the client")
+			return
+		}
+	default:
+		abortWithOAuthError(c, http.StatusBadRequest,
+			oauthErrorUnsupportedTokenType, "")
+		return
+	}
+
+	err = db.RevokeToken(con, claims.Id, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tokenHintRequestForTest(router http.Handler, path, token, clientID, secret string) *httptest.ResponseRecorder {
+	form := url.Values{}
+	form.Set("token", token)
+	if clientID != "" {
+		form.Set("client_id", clientID)
+		form.Set("client_secret", secret)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func introspectForTest(t *testing.T, router http.Handler, token, clientID, secret string) IntrospectionResponse {
+	w := tokenHintRequestForTest(router, "/oauth/introspect", token, clientID, secret)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var res IntrospectionResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	return res
+}
+
+func TestIntrospectAndRevokeSessionToken(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	resource, err := createServiceAccountForTest(router, admin, "")
+	assert.NoError(t, err)
+	resourceID := resource.ServiceAccount.ClientID
+
+	signin, err := signinForTest(router, user.Email, testPassword)
+	assert.NoError(t, err)
+
+	w := tokenHintRequestForTest(router, "/oauth/introspect", signin.Token, "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	res := introspectForTest(t, router, signin.Token, resourceID, resource.ClientSecret)
+	assert.True(t, res.Active)
+	assert.Equal(t, user.Email, res.Username)
+	assert.Equal(t, fmt.Sprint(user.ID), res.Subject)
+	assert.NotEmpty(t, res.JTI)
+
+	w = tokenHintRequestForTest(router, "/oauth/revoke", signin.Token, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	res = introspectForTest(t, router, signin.Token, resourceID, resource.ClientSecret)
+	assert.False(t, res.Active)
+	assert.Empty(t, res.Username)
+
+	w = httptest.NewRecorder()
+	req, err := http.NewRequest("GET", fmt.Sprintf("/users/%s", user.Email), nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", signin.Token))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Refresh token
+	w = tokenHintRequestForTest(router, "/oauth/revoke", signin.RefreshToken, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = refreshTokenForTest(router, signin.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Invalid token
+	w = tokenHintRequestForTest(router, "/oauth/revoke", "invalid", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	res = introspectForTest(t, router, "invalid", resourceID, resource.ClientSecret)
+	assert.False(t, res.Active)
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	account, err := createServiceAccountForTest(router, admin, "users:read")
+	assert.NoError(t, err)
+	clientID := account.ServiceAccount.ClientID
+	accessToken := serviceAccessTokenForTest(t, router, clientID, account.ClientSecret)
+
+	res := introspectForTest(t, router, accessToken, clientID, account.ClientSecret)
+	assert.True(t, res.Active)
+	assert.Equal(t, clientID, res.ClientID)
+	assert.Equal(t, "users:read", res.Scope)
+
+	other, err := createServiceAccountForTest(router, admin, "")
+	assert.NoError(t, err)
+
+	w := tokenHintRequestForTest(router, "/oauth/revoke", accessToken, "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = tokenHintRequestForTest(router, "/oauth/revoke", accessToken,
+		other.ServiceAccount.ClientID, other.ClientSecret)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var errRes OAuthErrorResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&errRes))
+	assert.Equal(t, "unauthorized_client", errRes.Error)
+
+	w = tokenHintRequestForTest(router, "/oauth/revoke", accessToken, clientID, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = adminRequestWithAccessToken(router, "GET", "/admin/users", accessToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = tokenHintRequestForTest(router, "/oauth/revoke", accessToken, clientID, account.ClientSecret)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = adminRequestWithAccessToken(router, "GET", "/admin/users", accessToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	res = introspectForTest(t, router, accessToken, clientID, account.ClientSecret)
+	assert.False(t, res.Active)
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+// 설정이 바뀌지 않으면 매 요청마다 키 파일을 다시 읽지 않는다.
+// DB 에 저장된 키는 바뀌지 않으므로 kid 로 캐시한다.
+var jwtKeys = struct {
+	sync.Mutex
+	cache map[string]*utils.Key
+}{cache: map[string]*utils.Key{}}
+
+// JWTKey returns the key configured in the application.
+// It signs JWT until a key in DB is promoted, and verifies
+// until every JWT it signed has expired.
+func JWTKey() (*utils.Key, error) {
+	conf := configs.App()
+	id := strings.Join([]string{
+		conf.JWTSigningMethod,
+		conf.JWTSigninKey,
+		conf.JWTPrivateKeyFile,
+	}, "|")
+
+	jwtKeys.Lock()
+	defer jwtKeys.Unlock()
+	if key, ok := jwtKeys.cache[id]; ok {
+		return key, nil
+	}
+
+	key, err := utils.LoadKey(
+		conf.JWTSigningMethod, conf.JWTSigninKey, conf.JWTPrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	jwtKeys.cache[id] = key
+	return key, nil
+}
+
+func keyFromDB(k *db.JWTKey) (*utils.Key, error) {
+	jwtKeys.Lock()
+	defer jwtKeys.Unlock()
+	if key, ok := jwtKeys.cache[k.Kid]; ok {
+		return key, nil
+	}
+
+	key, err := utils.NewKey(k.Method, k.Secret, []byte(k.Secret))
+	if err != nil {
+		return nil, err
+	}
+	key.ID = k.Kid
+	jwtKeys.cache[k.Kid] = key
+	return key, nil
+}
+
+// configuredKeyRetired reports whether JWT signed by the configured key have all expired,
+// since a key in DB started signing.
+func configuredKeyRetired(con *gorm.DB, signing *db.JWTKey) (bool, error) {
+	window := time.Second * time.Duration(configs.App().LongestJWTExpire())
+	if time.Since(*signing.PromotedAt) > window {
+		return true, nil
+	}
+
+	promotedAt, err := db.FirstJWTKeyPromotedAt(con)
+	if err != nil || promotedAt == nil {
+		return false, err
+	}
+	return time.Since(*promotedAt) > window, nil
+}
+
+// keyRingTTL is how long the key ring is cached in process.
+// Keys changed by other instances are used after it at the latest.
+const keyRingTTL = time.Second * 10
+
+// 매 요청마다 DB 에서 키를 읽지 않도록 키 링을 잠시 캐시한다.
+var keyRingCache = struct {
+	sync.Mutex
+	ring       *utils.KeyRing
+	configured *utils.Key
+	expiresAt  time.Time
+}{}
+
+// invalidateKeyRing makes the next 'KeyRing' read keys from DB,
+// it is called when keys are changed.
+func invalidateKeyRing() {
+	keyRingCache.Lock()
+	defer keyRingCache.Unlock()
+	keyRingCache.ring = nil
+}
+
+// KeyRing returns keys to sign and verify JWT.
+// The most recently promoted key in DB signs. If there is none, configured key signs.
+// Configured key stops verifying once a key in DB has signed longer than any JWT lasts.
+// The ring is cached for 'keyRingTTL', or until a key in it is retired if sooner.
+func KeyRing(con *gorm.DB) (*utils.KeyRing, error) {
+	configured, err := JWTKey()
+	if err != nil {
+		return nil, err
+	}
+
+	keyRingCache.Lock()
+	defer keyRingCache.Unlock()
+	now := time.Now()
+	if keyRingCache.ring != nil && keyRingCache.configured == configured &&
+		now.Before(keyRingCache.expiresAt) {
+		return keyRingCache.ring, nil
+	}
+
+	rows, err := db.ActiveJWTKeys(con)
+	if err != nil {
+		return nil, err
+	}
+
+	ring, err := newKeyRing(con, configured, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := now.Add(keyRingTTL)
+	for _, row := range rows {
+		if row.RetireAt != nil && row.RetireAt.Before(expiresAt) {
+			expiresAt = *row.RetireAt
+		}
+	}
+	keyRingCache.ring = ring
+	keyRingCache.configured = configured
+	keyRingCache.expiresAt = expiresAt
+	return ring, nil
+}
+
+func newKeyRing(con *gorm.DB, configured *utils.Key, rows []db.JWTKey) (*utils.KeyRing, error) {
+
+	keys := make([]*utils.Key, 0, len(rows))
+	for i := range rows {
+		key, err := keyFromDB(&rows[i])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	signing := db.SigningJWTKey(rows)
+	if signing == nil {
+		return utils.NewKeyRing(configured, keys...), nil
+	}
+
+	retired, err := configuredKeyRetired(con, signing)
+	if err != nil {
+		return nil, err
+	}
+	if retired {
+		return utils.NewKeyRing(keys[0], keys[1:]...), nil
+	}
+	return utils.NewKeyRing(keys[0], append(keys[1:], configured)...), nil
+}
+
+func keyRingOrAbort(c *gin.Context, con *gorm.DB) *utils.KeyRing {
+	ring, err := KeyRing(con)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeLoadJWTKey, err))
+		return nil
+	}
+	return ring
+}
+
+// JWKS publishes public keys to verify JWT issued by this application.
+// Symmetric key is never published.
+func JWKS(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
+	jwks := utils.JWKS{Keys: []utils.JWK{}}
+	for _, key := range ring.Keys() {
+		if jwk, ok := key.JWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	c.JSON(http.StatusOK, jwks)
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/utils"
+)
+
+func TestJWKSWithHMAC(t *testing.T) {
+	router := New(testDBCon)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resBody utils.JWKS
+	err = json.NewDecoder(w.Body).Decode(&resBody)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(resBody.Keys))
+}
+
+func TestJWKSWithES256(t *testing.T) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	b, err := x509.MarshalECPrivateKey(k)
+	assert.NoError(t, err)
+
+	f, err := ioutil.TempFile("", "key*.pem")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	err = pem.Encode(f, &pem.Block{Type: "EC PRIVATE KEY", Bytes: b})
+	assert.NoError(t, err)
+	f.Close()
+
+	os.Setenv(configs.EnvPrefix+"JWT_SIGNING_METHOD", "ES256")
+	os.Setenv(configs.EnvPrefix+"JWT_PRIVATE_KEY_FILE", f.Name())
+	defer os.Unsetenv(configs.EnvPrefix + "JWT_SIGNING_METHOD")
+	defer os.Unsetenv(configs.EnvPrefix + "JWT_PRIVATE_KEY_FILE")
+
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	signinRes, err := signinForTest(router, user.Email, testPassword)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resBody utils.JWKS
+	err = json.NewDecoder(w.Body).Decode(&resBody)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(resBody.Keys))
+	assert.Equal(t, "EC", resBody.Keys[0].Kty)
+	assert.Equal(t, "ES256", resBody.Keys[0].Alg)
+
+	// 공개키만 가진 서비스도 세션 토큰을 검증할 수 있다.
+	key, err := JWTKey()
+	assert.NoError(t, err)
+	jwk, _ := key.JWK()
+	assert.Equal(t, jwk, resBody.Keys[0])
+	assert.Equal(t, &k.PublicKey, key.PublicKey())
+
+	claims, err := utils.ParseSessionJWT(signinRes.Token, key)
+	assert.NoError(t, err)
+	assert.Equal(t, user.Email, claims.UserEmail)
+}
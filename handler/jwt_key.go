@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+const kidLen = 16
+
+// CreateJWTKeyParam .
+type CreateJWTKeyParam struct {
+	Method string `json:"method" binding:"required"`
+}
+
+// retireAfter returns how long the retired key keeps verifying JWT.
+// By default it lasts until every JWT the key signed has expired.
+func retireAfter(c *gin.Context) (time.Duration, error) {
+	longest := configs.App().LongestJWTExpire()
+	sec, err := strconv.Atoi(
+		c.DefaultQuery("retire_after", strconv.Itoa(longest)))
+	if err != nil {
+		return 0, err
+	}
+	if sec < 0 {
+		sec = 0
+	}
+	return time.Second * time.Duration(sec), nil
+}
+
+func findJWTKeyOrAbort(c *gin.Context, con *gorm.DB) *db.JWTKey {
+	key := db.JWTKey{}
+	if con.Where("kid = ?", c.Param("kid")).First(&key).RecordNotFound() {
+		c.AbortWithStatusJSON(
+			http.StatusNotFound,
+			NewErrRes(ErrorCodeNotFoundJWTKey))
+		return nil
+	}
+	return &key
+}
+
+// JWTKeys .
+func JWTKeys(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var keys []db.JWTKey
+	if err := con.Order("id desc").Find(&keys).Error; err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"signing_kid": ring.SigningKey().ID,
+		"keys":        keys,
+	})
+}
+
+// CreateJWTKey generates a new key.
+// The key verifies JWT right away, but does not sign until it is promoted.
+func CreateJWTKey(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param CreateJWTKeyParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	secretkey, privateKeyPEM, err := utils.GenerateKey(param.Method)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeUnsupportedSigningMethod, err))
+		return
+	}
+
+	key := db.JWTKey{Method: param.Method, Secret: secretkey}
+	if privateKeyPEM != nil {
+		key.Secret = string(privateKeyPEM)
+	}
+
+	generated, err := utils.NewKey(param.Method, secretkey, privateKeyPEM)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeGenerateJWTKey, err))
+		return
+	}
+
+	key.Kid = generated.ID
+	if key.Kid == "" {
+		if key.Kid, err = utils.RandomToken(kidLen); err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				NewErrResWithErr(ErrorCodeGenerateJWTKey, err))
+			return
+		}
+	}
+
+	if err := key.Save(con); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+	invalidateKeyRing()
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// PromoteJWTKey makes the key sign JWT from now on.
+// The previous signing key keeps verifying until it is retired.
+func PromoteJWTKey(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	key := findJWTKeyOrAbort(c, con)
+	if key == nil {
+		return
+	}
+
+	if key.RetireAt != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeRetiredJWTKey))
+		return
+	}
+
+	key.Promote()
+	if err := key.Save(con); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+	invalidateKeyRing()
+
+	c.JSON(http.StatusOK, key)
+}
+
+// RetireJWTKey schedules the key to stop verifying JWT.
+// The signing key can not be retired, promote another key first.
+func RetireJWTKey(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	after, err := retireAfter(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBadRetireAfter, err))
+		return
+	}
+
+	key := findJWTKeyOrAbort(c, con)
+	if key == nil {
+		return
+	}
+
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
+	if ring.SigningKey().ID == key.Kid {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeRetireSigningJWTKey))
+		return
+	}
+
+	key.Retire(after)
+	if err := key.Save(con); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+	invalidateKeyRing()
+
+	c.JSON(http.StatusOK, key)
+}
@@ -0,0 +1,275 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+func createJWTKeyForTest(router http.Handler, admin *db.User, method string) (*db.JSONJWTKey, error) {
+	body, err := json.Marshal(CreateJWTKeyParam{Method: method})
+	if err != nil {
+		return nil, err
+	}
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/admin/jwt_keys", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	setAuthJWTForTest(req, admin)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		return nil, fmt.Errorf("create jwt key failed with status %d", w.Code)
+	}
+
+	var key db.JSONJWTKey
+	if err := json.NewDecoder(w.Body).Decode(&key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func kidFromJWT(t *testing.T, signedString string) string {
+	token, _, err := new(jwt.Parser).ParseUnverified(signedString, jwt.MapClaims{})
+	assert.NoError(t, err)
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+// deleteJWTKeysForTest deletes the keys and the cached key ring having them.
+func deleteJWTKeysForTest(kids ...string) {
+	testDBCon.Where("kid IN (?)", kids).Delete(&db.JWTKey{})
+	invalidateKeyRing()
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	oldSession, err := signinForTest(router, user.Email, testPassword)
+	assert.NoError(t, err)
+
+	first, err := createJWTKeyForTest(router, admin, "ES256")
+	assert.NoError(t, err)
+	second, err := createJWTKeyForTest(router, admin, "HS256")
+	assert.NoError(t, err)
+	defer deleteJWTKeysForTest(first.Kid, second.Kid)
+
+	// Promote
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("PUT", fmt.Sprintf("/admin/jwt_keys/%s/signing", first.Kid), nil)
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, admin)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	firstSession, err := signinForTest(router, user.Email, testPassword)
+	assert.NoError(t, err)
+	assert.Equal(t, first.Kid, kidFromJWT(t, firstSession.Token))
+
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(w, req)
+	var jwks utils.JWKS
+	err = json.NewDecoder(w.Body).Decode(&jwks)
+	assert.NoError(t, err)
+	kids := []string{}
+	for _, k := range jwks.Keys {
+		kids = append(kids, k.Kid)
+	}
+	assert.Contains(t, kids, first.Kid)
+	assert.NotContains(t, kids, second.Kid)
+
+	// 서명 중인 키는 폐기할 수 없다.
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("DELETE", fmt.Sprintf("/admin/jwt_keys/%s", first.Kid), nil)
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, admin)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var errRes ErrorCodeResponse
+	err = json.NewDecoder(w.Body).Decode(&errRes)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrorCodeRetireSigningJWTKey, errRes.ErrorCode)
+
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("PUT", fmt.Sprintf("/admin/jwt_keys/%s/signing", second.Kid), nil)
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, admin)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("DELETE", fmt.Sprintf("/admin/jwt_keys/%s?retire_after=0", first.Kid), nil)
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, admin)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 설정된 키와 새 서명 키로 발급한 토큰은 유효하고, 폐기된 키로 발급한 토큰은 거부된다.
+	tables := []struct {
+		Token  string
+		Status int
+	}{
+		{oldSession.Token, http.StatusOK},
+		{firstSession.Token, http.StatusUnauthorized},
+	}
+
+	secondSession, err := signinForTest(router, user.Email, testPassword)
+	assert.NoError(t, err)
+	assert.Equal(t, second.Kid, kidFromJWT(t, secondSession.Token))
+	tables = append(tables, struct {
+		Token  string
+		Status int
+	}{secondSession.Token, http.StatusOK})
+
+	for _, v := range tables {
+		w = httptest.NewRecorder()
+		req, err = http.NewRequest("GET", fmt.Sprintf("/users/%s", user.Email), nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", v.Token))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, v.Status, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/admin/jwt_keys", nil)
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, admin)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), second.Kid))
+	assert.False(t, strings.Contains(w.Body.String(), "PRIVATE KEY"))
+}
+
+func TestCreateJWTKeyWithUnsupportedMethod(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	body, err := json.Marshal(CreateJWTKeyParam{Method: "none"})
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/admin/jwt_keys", bytes.NewReader(body))
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, admin)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var errRes ErrorCodeResponse
+	err = json.NewDecoder(w.Body).Decode(&errRes)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrorCodeUnsupportedSigningMethod, errRes.ErrorCode)
+}
+
+func TestConfiguredJWTKeyRetired(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	key, err := createJWTKeyForTest(router, admin, "HS256")
+	assert.NoError(t, err)
+	defer deleteJWTKeysForTest(key.Kid)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("PUT", fmt.Sprintf("/admin/jwt_keys/%s/signing", key.Kid), nil)
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, admin)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	uri := fmt.Sprintf("/users/%s", user.Email)
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", uri, nil)
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, user)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 새 키가 어떤 토큰의 수명보다 오래 서명했으면 설정된 키로 서명한 토큰은 거부된다.
+	window := time.Second * time.Duration(configs.App().LongestJWTExpire())
+	promotedAt := time.Now().Add(-window - time.Minute)
+	err = testDBCon.Model(&db.JWTKey{}).
+		Where("kid = ?", key.Kid).Update("promoted_at", promotedAt).Error
+	assert.NoError(t, err)
+	invalidateKeyRing()
+
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", uri, nil)
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, user)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	session, err := signinForTest(router, user.Email, testPassword)
+	assert.NoError(t, err)
+	assert.Equal(t, key.Kid, kidFromJWT(t, session.Token))
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", uri, nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", session.Token))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestKeyRingCache(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	ring, err := KeyRing(testDBCon)
+	assert.NoError(t, err)
+	cached, err := KeyRing(testDBCon)
+	assert.NoError(t, err)
+	assert.Same(t, ring, cached)
+
+	// 다른 곳에서 바뀐 키는 캐시가 만료된 뒤에 쓴다.
+	key := db.JWTKey{Kid: "cached", Method: "HS256", Secret: "secret"}
+	assert.NoError(t, key.Save(testDBCon))
+	defer deleteJWTKeysForTest(key.Kid)
+	cached, err = KeyRing(testDBCon)
+	assert.NoError(t, err)
+	assert.Same(t, ring, cached)
+
+	keyRingCache.Lock()
+	keyRingCache.expiresAt = time.Now()
+	keyRingCache.Unlock()
+	cached, err = KeyRing(testDBCon)
+	assert.NoError(t, err)
+	assert.NotSame(t, ring, cached)
+	_, ok := cached.Lookup(key.Kid)
+	assert.True(t, ok)
+
+	// 키를 바꾸면 바로 다시 읽는다.
+	created, err := createJWTKeyForTest(router, admin, "HS256")
+	assert.NoError(t, err)
+	defer deleteJWTKeysForTest(created.Kid)
+	ring, err = KeyRing(testDBCon)
+	assert.NoError(t, err)
+	_, ok = ring.Lookup(created.Kid)
+	assert.True(t, ok)
+}
@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+// SigninWithMagicLinkParam .
+// 'OTP' or 'WebAuthn' is required if the user registered them.
+type SigninWithMagicLinkParam struct {
+	Token string `json:"token" binding:"required"`
+	OTP   string `json:"otp"`
+
+	WebAuthn *utils.WebAuthnAuthenticationCredential `json:"webauthn"`
+}
+
+// MagicLinkEmailData .
+type MagicLinkEmailData struct {
+	UserEmail    string `json:"user_email"`
+	SigninURL    string `json:"signin_url"`
+	ExpireMin    int    `json:"expire_min"`
+	Organization string `json:"organization"`
+}
+
+// SendMagicLinkEmail sends the link to signin without password.
+// Each link can be used once.
+func SendMagicLinkEmail(c *gin.Context) {
+	conf := configs.App()
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param SendEmailParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	user := findUserByEmailOrAbort(
+		param.Email, c, con, http.StatusBadRequest)
+	if user == nil {
+		return
+	}
+
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
+	token := utils.NewJWT(conf.MagicLinkTokenExpire)
+	magicLinkToken, err := token.MagicLink(
+		param.Email, ring.SigningKey(), conf.IssuerURL())
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeSignJWT, err))
+		return
+	}
+
+	claims, _ := token.Claims.(utils.MagicLinkClaims)
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if err := db.IssueMagicLink(con, user.ID, claims.Id, expiresAt); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	if gin.Mode() == gin.DebugMode {
+		Logger(c).Debugf("magic link token: %s", magicLinkToken)
+	}
+
+	emailTmpl, err := template.New("magic link email").Parse(param.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeTmplParse, err))
+		return
+	}
+
+	var body bytes.Buffer
+	data := MagicLinkEmailData{
+		UserEmail:    param.Email,
+		SigninURL:    conf.MagicLinkURL(magicLinkToken),
+		ExpireMin:    conf.MagicLinkTokenExpire / oneMinuteSeconds,
+		Organization: conf.Org,
+	}
+
+	if err := emailTmpl.Execute(&body, data); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeTmplExecute, err))
+		return
+	}
+
+	if err = utils.NewEmail(
+		utils.NameFromEmail(param.Email),
+		conf.SupportEmail,
+		param.Email,
+		param.Subject,
+		body.String(),
+	).SendContext(c.Request.Context(), configs.SMTP().Addr()); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeSendEmail, err))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// SigninWithMagicLink signs in with the token in the link sent by email.
+// Like email code, OTP or security key is still required
+// if the user registered them.
+func SigninWithMagicLink(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param SigninWithMagicLinkParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	attempt := newSigninAttempt(c, con)
+	if attempt == nil {
+		return
+	}
+	defer attempt.end()
+
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
+	claims, err := utils.ParseMagicLinkJWT(param.Token, ring)
+	if err != nil {
+		ve, ok := err.(*jwt.ValidationError)
+		if !ok || ve.Errors != jwt.ValidationErrorExpired {
+			// 위조된 토큰의 사용자는 믿을 수 없으니 IP 로만 실패를 센다.
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				NewErrResWithErr(ErrorCodeInvalidToken, err))
+			return
+		}
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeExpiredToken))
+		return
+	}
+
+	if claims.Subject != utils.MagicLink {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidToken))
+		return
+	}
+
+	user := findUserByEmailOrAbort(
+		claims.Email, c, con, http.StatusBadRequest)
+	if user == nil {
+		return
+	}
+	attempt.setUser(user.ID, user.Email)
+
+	if attempt.isAbortedAsThrottled(accountSigninThrottle(user.ID)) {
+		return
+	}
+
+	creds := webAuthnCredentialsOrAbort(c, con, user.ID)
+	if creds == nil {
+		return
+	}
+
+	// 두 번째 인증 수단이 없으면 링크를 소모하지 않고 먼저 알려준다.
+	f := secondFactor{OTP: param.OTP, WebAuthn: param.WebAuthn}
+	if isAbortedAsRequireSecondFactor(c, user, creds, f) {
+		attempt.uncounted = true
+		return
+	}
+
+	link, err := db.ConsumeMagicLink(con, claims.Id)
+	if err != nil {
+		if errors.Is(err, db.ErrorNotFoundMagicLink) ||
+			errors.Is(err, db.ErrorUsedMagicLink) {
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				NewErrRes(ErrorCodeInvalidToken))
+			return
+		}
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	if link.UserID != user.ID {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidToken))
+		return
+	}
+
+	auth := utils.Authentication{AuthTime: time.Now().Unix()}
+	if !verifySecondFactorOrAbort(c, con, user, creds, f, &auth) {
+		return
+	}
+
+	signin(c, con, user, auth)
+}
@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+const (
+	magicLinkEmailSubject  = "[auth] Sign in to your account."
+	magicLinkEmailBodyTmpl = `<p>Hi {{ .UserEmail }}.</p>
+<p>Click the link below to sign in.</p>
+<p><a href="{{ .SigninURL }}">Sign in</a></p>
+<p>It will expire in {{ .ExpireMin }} minutes.</p>`
+)
+
+var magicLinkRegexp = regexp.MustCompile(`^<p><a href="[^"]+/signin/magic_link/([^"]+)">Sign in</a></p>$`)
+
+// sendMagicLinkEmailForTest returns the token in the link captured by mock smtp server.
+func sendMagicLinkEmailForTest(t *testing.T, router http.Handler, email string) string {
+	conf := configs.App()
+	// 링크는 Capture 로 받으므로 비워 둔다.
+	data := MagicLinkEmailData{
+		UserEmail:    email,
+		ExpireMin:    conf.MagicLinkTokenExpire / oneMinuteSeconds,
+		Organization: conf.Org,
+	}
+	var emailBody bytes.Buffer
+	emailTmpl, err := template.New("magic link email").Parse(magicLinkEmailBodyTmpl)
+	assert.NoError(t, err)
+	assert.NoError(t, emailTmpl.Execute(&emailBody, data))
+
+	ln, err := utils.NewLocalListener(utils.MockSMTPPort)
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	captured := make(chan string, 1)
+	go func() {
+		defer close(captured)
+		c, err := ln.Accept()
+		if err != nil {
+			t.Errorf("local listener accept: %v", err)
+			return
+		}
+		defer c.Close()
+		handler := utils.MockSMTPHandler{
+			Con:     c,
+			Name:    utils.NameFromEmail(email),
+			From:    conf.SupportEmail,
+			To:      email,
+			Subject: magicLinkEmailSubject,
+			Body:    emailBody.String(),
+			Capture: magicLinkRegexp,
+		}
+		if err := handler.Handle(); err != nil {
+			t.Errorf("mock smtp handle error: %v", err)
+		}
+		if len(handler.Captured) > 0 {
+			captured <- handler.Captured[0]
+		}
+	}()
+	configs.SetSMTPPort(utils.MockSMTPPort)
+
+	param := SendEmailParam{
+		Email:   email,
+		Subject: magicLinkEmailSubject,
+		Body:    magicLinkEmailBodyTmpl,
+	}
+	w := jsonRequestForTest(router, "POST", "/signin/magic_link", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	select {
+	case line := <-captured:
+		return magicLinkRegexp.FindStringSubmatch(line)[1]
+	case <-time.After(time.Second * 3):
+		t.Error("magic link was not sent")
+		return ""
+	}
+}
+
+func signinWithMagicLinkForTest(t *testing.T, router http.Handler, param SigninWithMagicLinkParam) (int, ErrorCodeResponse, *utils.SessionClaims) {
+	w := jsonRequestForTest(router, "POST", "/signin/magic_link/verification", param, nil)
+	if w.Code != http.StatusOK {
+		var errRes ErrorCodeResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&errRes))
+		return w.Code, errRes, nil
+	}
+
+	var resBody SiginResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resBody))
+	assert.NotEmpty(t, resBody.RefreshToken)
+	ring, err := KeyRing(testDBCon)
+	assert.NoError(t, err)
+	claims, err := utils.ParseSessionJWT(resBody.Token, ring)
+	assert.NoError(t, err)
+	return w.Code, ErrorCodeResponse{}, claims
+}
+
+func TestSigninWithMagicLink(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	token := sendMagicLinkEmailForTest(t, router, user.Email)
+	assert.NotEmpty(t, token)
+
+	param := SigninWithMagicLinkParam{Token: token}
+	status, _, claims := signinWithMagicLinkForTest(t, router, param)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, user.ID, claims.UserID)
+
+	// 한 번 사용한 링크는 다시 쓸 수 없다.
+	status, errRes, _ := signinWithMagicLinkForTest(t, router, param)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, ErrorCodeInvalidToken, errRes.ErrorCode)
+}
+
+func TestSigninWithMagicLinkWithOtherToken(t *testing.T) {
+	conf := configs.App()
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	key, err := JWTKey()
+	assert.NoError(t, err)
+
+	// 발급 기록이 없는 토큰.
+	token, err := utils.NewJWT(conf.MagicLinkTokenExpire).MagicLink(user.Email, key, conf.IssuerURL())
+	assert.NoError(t, err)
+	router := New(testDBCon)
+	status, errRes, _ := signinWithMagicLinkForTest(
+		t, router, SigninWithMagicLinkParam{Token: token})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, ErrorCodeInvalidToken, errRes.ErrorCode)
+
+	// 가입 확인 토큰.
+	token, err = utils.NewJWT(conf.SignupTokenExpire).Signup(user.Email, key, conf.IssuerURL())
+	assert.NoError(t, err)
+	status, errRes, _ = signinWithMagicLinkForTest(
+		t, router, SigninWithMagicLinkParam{Token: token})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, ErrorCodeInvalidToken, errRes.ErrorCode)
+
+	token, err = utils.NewJWT(-1).MagicLink(user.Email, key, conf.IssuerURL())
+	assert.NoError(t, err)
+	status, errRes, _ = signinWithMagicLinkForTest(
+		t, router, SigninWithMagicLinkParam{Token: token})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, ErrorCodeExpiredToken, errRes.ErrorCode)
+}
+
+func TestSigninWithMagicLinkWithForgedToken(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	token := sendMagicLinkEmailForTest(t, router, user.Email)
+	assert.NotEmpty(t, token)
+
+	// 모양이 잘못되거나 서명이 다른 토큰은 잘못된 비밀번호처럼 실패로 센다.
+	const remoteAddr = "192.0.2.4:1234"
+	for _, forged := range []string{"malformed", token + "x"} {
+		body, err := json.Marshal(SigninWithMagicLinkParam{Token: forged})
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/signin/magic_link/verification", bytes.NewReader(body))
+		assert.NoError(t, err)
+		req.RemoteAddr = remoteAddr
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, ErrorCodeInvalidToken, errCodeForTest(t, w))
+	}
+
+	lock := db.FindSigninLock(testDBCon, db.SigninLockSubjectIP("192.0.2.4"))
+	assert.NotNil(t, lock)
+	assert.Equal(t, 2, lock.Failures)
+	assert.NoError(t, db.ClearSigninLock(testDBCon, lock.Subject))
+}
+
+func TestSigninWithMagicLinkRequireOTP(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	_, errCodeRes := generateOTP(testDBCon, user)
+	assert.Nil(t, errCodeRes)
+	errCodeRes = confirmOTP(testDBCon, user)
+	assert.Nil(t, errCodeRes)
+
+	router := New(testDBCon)
+	param := SigninWithMagicLinkParam{
+		Token: sendMagicLinkEmailForTest(t, router, user.Email),
+	}
+	status, errRes, _ := signinWithMagicLinkForTest(t, router, param)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, ErrorCodeRequireVerifyOTP, errRes.ErrorCode)
+
+	param.OTP = "000000"
+	status, errRes, _ = signinWithMagicLinkForTest(t, router, param)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, ErrorCodeIncorrectOTP, errRes.ErrorCode)
+
+	// 링크는 OTP 확인 전에 소모된다.
+	param.Token = sendMagicLinkEmailForTest(t, router, user.Email)
+	totp, err := user.TOTP()
+	assert.NoError(t, err)
+	param.OTP = totp.Now()
+	status, _, claims := signinWithMagicLinkForTest(t, router, param)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{utils.AMROTP, utils.AMRMultiFactor}, claims.AMR)
+}
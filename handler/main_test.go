@@ -26,11 +26,11 @@ func setup() {
 	if err != nil {
 		log.Fatalln(err)
 	}
-	err = db.Reset(dbConf.DSN(), dbConf.DBName())
+	err = db.Reset(dbConf.Driver, dbConf.DSN(), dbConf.DBName())
 	if err != nil {
 		log.Fatalln(err)
 	}
-	testDBCon, err = db.SyncModels(dbConf.DSN(), dbConf.Echo)
+	testDBCon, err = db.SyncModels(dbConf.Driver, dbConf.DSN(), dbConf.Echo)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/loganstone/auth/utils"
+)
+
+// unmatchedRoute is route label of requests not matched to any route,
+// so that paths requested by anyone do not make new series.
+const unmatchedRoute = "unmatched"
+
+var (
+	httpRequests = utils.NewCounterVec(
+		"auth_http_requests_total",
+		"HTTP requests by method, route and status.",
+		"method", "route", "status")
+	httpRequestDuration = utils.NewHistogramVec(
+		"auth_http_request_duration_seconds",
+		"Latency of HTTP requests by method, route and status.",
+		utils.DefaultBuckets, "method", "route", "status")
+	signins = utils.NewCounterVec(
+		"auth_signins_total",
+		"Signin attempts by outcome and reason of failure.",
+		"outcome", "reason")
+)
+
+// signinFailureReasons are reasons of signin failure counted by error code.
+var signinFailureReasons = map[int]string{
+	ErrorCodeIncorrectPassword:     "incorrect_password",
+	ErrorCodeIncorrectOTP:          "incorrect_otp",
+	ErrorCodeRequireVerifyOTP:      "require_verify_otp",
+	ErrorCodeRequireVerifyWebAuthn: "require_verify_webauthn",
+}
+
+func countSigninSuccess() {
+	signins.Inc(utils.MetricSuccess, "")
+}
+
+func countSigninFailure(code int) {
+	if reason, ok := signinFailureReasons[code]; ok {
+		signins.Inc(utils.MetricFailure, reason)
+	}
+}
+
+// RequestMetrics counts requests and observes the latency by route and status.
+func RequestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.Inc(c.Request.Method, route, status)
+		httpRequestDuration.Observe(
+			time.Since(start).Seconds(), c.Request.Method, route, status)
+	}
+}
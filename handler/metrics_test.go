@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/utils"
+)
+
+func TestMetrics(t *testing.T) {
+	router := New(testDBCon)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// API 로는 지표를 볼 수 없다.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	utils.MetricsHandler().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+
+	body := w.Body.String()
+	assert.Contains(t, body,
+		`auth_http_requests_total{method="GET",route="/.well-known/jwks.json",status="200"}`)
+	assert.Contains(t, body,
+		`auth_http_request_duration_seconds_count{method="GET",route="/.well-known/jwks.json",status="200"}`)
+	assert.Contains(t, body, "# TYPE auth_signins_total counter")
+}
+
+func TestRequestMetricsOfUnmatchedRoute(t *testing.T) {
+	router := New(testDBCon)
+	before := httpRequests.Value("GET", unmatchedRoute, "404")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/not/found", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, before+1, httpRequests.Value("GET", unmatchedRoute, "404"))
+}
+
+func TestSigninMetrics(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	router := New(testDBCon)
+
+	signin := func(password string) int {
+		body, err := json.Marshal(SigninParam{Email: user.Email, Password: password})
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/signin", bytes.NewReader(body))
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	success := signins.Value(utils.MetricSuccess, "")
+	failure := signins.Value(utils.MetricFailure, "incorrect_password")
+
+	assert.Equal(t, http.StatusUnauthorized, signin("wrongpassword"))
+	assert.Equal(t, failure+1, signins.Value(utils.MetricFailure, "incorrect_password"))
+
+	assert.Equal(t, http.StatusOK, signin(testPassword))
+	assert.Equal(t, success+1, signins.Value(utils.MetricSuccess, ""))
+}
@@ -1,28 +1,42 @@
 package handler
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
-	"github.com/loganstone/auth/configs"
 	"github.com/loganstone/auth/db"
 	"github.com/loganstone/auth/utils"
 )
 
 // Authorize .
+// Session token revoked by '/oauth/revoke' is rejected.
+// Requests already authorized as service account are passed.
 func Authorize() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		conf := configs.App()
+		if _, ok := AuthorizedServiceAccount(c); ok {
+			c.Next()
+			return
+		}
+
 		con := DBConnOrAbort(c)
 		if con == nil {
 			return
 		}
 
+		ring := keyRingOrAbort(c, con)
+		if ring == nil {
+			return
+		}
+
 		reqToken := c.Request.Header.Get("Authorization")
 		bearerToken := strings.Split(reqToken, " ")
 		if len(bearerToken) != 2 {
@@ -30,12 +44,22 @@ func Authorize() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := utils.ParseSessionJWT(bearerToken[1], conf.JWTSigninKey)
+		claims, err := utils.ParseSessionJWT(bearerToken[1], ring)
 		if err != nil {
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
 
+		// OAuth 클라이언트에 발급된 access token 등 다른 용도의 토큰은 거부한다.
+		if claims.Subject != utils.Session {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		if isAbortedAsRevokedToken(c, con, claims.Id) {
+			return
+		}
+
 		user := db.User{}
 		if con.First(&user, claims.UserID).RecordNotFound() {
 			c.AbortWithStatus(http.StatusUnauthorized)
@@ -48,13 +72,138 @@ func Authorize() gin.HandlerFunc {
 		}
 
 		c.Set("AuthorizedUser", user)
+		c.Set("Authentication", claims.Authentication)
+		utils.AddLogFields(c.Request.Context(), "user_id", user.ID)
 		c.Next()
 	}
 }
 
-// AuthorizedUserIsAdmin .
-func AuthorizedUserIsAdmin() gin.HandlerFunc {
+// AuthorizeAccessToken authorizes OAuth client with access token.
+// reference - https://tools.ietf.org/html/rfc6750#section-3
+func AuthorizeAccessToken() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		con := DBConnOrAbort(c)
+		if con == nil {
+			return
+		}
+
+		ring := keyRingOrAbort(c, con)
+		if ring == nil {
+			return
+		}
+
+		abort := func() {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}
+
+		reqToken := c.Request.Header.Get("Authorization")
+		bearerToken := strings.Split(reqToken, " ")
+		if len(bearerToken) != 2 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := utils.ParseAccessJWT(bearerToken[1], ring)
+		if err != nil || claims.Subject != utils.Access {
+			abort()
+			return
+		}
+
+		if isAbortedAsRevokedToken(c, con, claims.Id) {
+			return
+		}
+
+		user := db.User{}
+		if con.First(&user, claims.UserID).RecordNotFound() {
+			abort()
+			return
+		}
+
+		if user.Email != claims.UserEmail {
+			abort()
+			return
+		}
+
+		c.Set("AuthorizedUser", user)
+		c.Set("AccessClaims", *claims)
+		c.Next()
+	}
+}
+
+// AuthorizeServiceAccount authorizes service account with access token.
+// Other tokens are left to the next middleware.
+func AuthorizeServiceAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		con := DBConnOrAbort(c)
+		if con == nil {
+			return
+		}
+
+		ring := keyRingOrAbort(c, con)
+		if ring == nil {
+			return
+		}
+
+		bearerToken := strings.Split(c.Request.Header.Get("Authorization"), " ")
+		if len(bearerToken) != 2 {
+			c.Next()
+			return
+		}
+
+		claims, err := utils.ParseAccessJWT(bearerToken[1], ring)
+		if err != nil || claims.Subject != utils.ServiceAccess {
+			c.Next()
+			return
+		}
+
+		account := db.FindServiceAccount(con, claims.ClientID)
+		if account == nil || account.Disabled() {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		if isAbortedAsRevokedToken(c, con, claims.Id) {
+			return
+		}
+
+		c.Set("AuthorizedServiceAccount", *account)
+		c.Set("AccessClaims", *claims)
+		utils.AddLogFields(c.Request.Context(), "service_account", account.ClientID)
+		c.Next()
+	}
+}
+
+// requiredPermissions are permissions required by routes.
+// They must be added by migrations, it is checked in tests.
+var requiredPermissions sync.Map
+
+// RequirePermission allows users whose roles grant the permission.
+// Roles are read from DB for each request, so that unassigned role
+// is not granted by session token issued before.
+// Service account is allowed if the access token has scope for the permission.
+func RequirePermission(permission string) gin.HandlerFunc {
+	requiredPermissions.Store(permission, true)
+	return func(c *gin.Context) {
+		if _, ok := AuthorizedServiceAccount(c); ok {
+			v, _ := c.Get("AccessClaims")
+			claims, _ := v.(utils.AccessClaims)
+			if !hasPermissionScope(claims.Scope, permission) {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+
+			c.Set("AuthorizedByPermission", true)
+			c.Next()
+			return
+		}
+
+		con := DBConnOrAbort(c)
+		if con == nil {
+			return
+		}
+
 		user, err := AuthorizedUser(c)
 		if err != nil {
 			c.AbortWithStatusJSON(
@@ -63,12 +212,19 @@ func AuthorizedUserIsAdmin() gin.HandlerFunc {
 			return
 		}
 
-		if !user.IsAdmin {
+		ok, err := db.HasPermissions(con, user.ID, permission)
+		if err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				NewErrResWithErr(ErrorCodeDBTransaction, err))
+			return
+		}
+		if !ok {
 			c.AbortWithStatus(http.StatusForbidden)
 			return
 		}
 
-		c.Set("AuthorizedUserIsAdmin", true)
+		c.Set("AuthorizedByPermission", true)
 		c.Next()
 	}
 }
@@ -100,65 +256,111 @@ func RequesterIsAuthorizedUser() gin.HandlerFunc {
 	}
 }
 
-// DBConnection .
-func DBConnection() gin.HandlerFunc {
+// DBConnection sets the connection of the pool bound to the request context,
+// so queries of the request are cancelled when the request is cancelled.
+func DBConnection(con *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		dbConf, err := configs.DB()
-		if err != nil {
-			c.AbortWithStatusJSON(
-				http.StatusInternalServerError,
-				NewErrResWithErr(ErrorCodeDBEnv, err))
-			return
-		}
-		con, err := db.Connection(dbConf.DSN(), dbConf.Echo)
-		if err != nil {
-			c.AbortWithStatusJSON(
-				http.StatusInternalServerError,
-				NewErrResWithErr(ErrorCodeDBConn, err))
-			return
-		}
-		defer con.Close()
-		c.Set("DBConnection", con)
+		c.Set("DBConnection", db.WithContext(con, c.Request.Context()))
 		c.Next()
 	}
 }
 
-// RequestID .
+// RequestID identifies the request by 'X-Request-ID' header of the request,
+// or new one if the header is not valid, and sends it back in the response header.
+// The logger of the request context has the request id and the route,
+// so every log of the request has them.
 func RequestID() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Request.Header.Set("Request-ID", uuid.New().String())
+		requestID := c.GetHeader(RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+		c.Set("RequestID", requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		logger := utils.DefaultLogger().With(
+			"request_id", requestID,
+			"route", c.Request.Method+" "+c.FullPath())
+		c.Request = c.Request.WithContext(
+			utils.ContextWithLogger(c.Request.Context(), logger))
 		c.Next()
 	}
 }
 
-// Ref - https://sourcegraph.com/github.com/gin-gonic/gin/-/blob/logger.go#L131
-var logFormatter = func(param gin.LogFormatterParams) string {
-	var statusColor, methodColor, resetColor string
-	if param.IsOutputColor() {
-		statusColor = param.StatusCodeColor()
-		methodColor = param.MethodColor()
-		resetColor = param.ResetColor()
+// isValidRequestID reports whether the request id from client can be used as it is.
+// It must be printable ASCII without space, not to break log lines.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
 	}
-
-	if param.Latency > time.Minute {
-		// Truncate in a golang < 1.8 safe way
-		param.Latency = param.Latency - param.Latency%time.Second
+	for _, r := range id {
+		if r <= ' ' || r > '~' {
+			return false
+		}
 	}
+	return true
+}
 
-	requestID := param.Request.Header.Get("Request-ID")
-	return fmt.Sprintf("[REQUEST ID - %s] %v |%s %3d %s| %13v | %15s |%s %-7s %s %s\n%s",
-		requestID,
-		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
-		statusColor, param.StatusCode, resetColor,
-		param.Latency,
-		param.ClientIP,
-		methodColor, param.Method, resetColor,
-		param.Path,
-		param.ErrorMessage,
-	)
+// AccessLog writes a log for each request after it is handled.
+// Server errors are logged as error.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		logger := Logger(c).With(
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"latency_ms", float64(time.Since(start))/float64(time.Millisecond),
+			"client_ip", c.ClientIP())
+		if errs := c.Errors.ByType(gin.ErrorTypePrivate); len(errs) > 0 {
+			logger = logger.With("error", errs.String())
+		}
+
+		if status >= http.StatusInternalServerError {
+			logger.Errorf("request")
+			return
+		}
+		logger.Infof("request")
+	}
 }
 
-// LogFormat .
-func LogFormat() gin.HandlerFunc {
-	return gin.LoggerWithFormatter(logFormatter)
+// Trace traces the request in a server span continuing the trace of 'traceparent' header.
+// The span is the parent of spans of the request like queries and smtp,
+// and 'trace_id' is added to logs of the request.
+// Responses of 5xx status are marked failed.
+func Trace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		ctx := utils.ExtractTraceContext(c.Request.Context(), c.Request.Header)
+		ctx, span := utils.StartSpan(ctx, c.Request.Method+" "+route, trace.SpanKindServer,
+			attribute.String("http.method", c.Request.Method),
+			attribute.String("http.route", route),
+			attribute.String("http.target", c.Request.URL.Path),
+			attribute.String("http.client_ip", c.ClientIP()))
+		sc := span.SpanContext()
+		if !sc.IsValid() {
+			c.Next()
+			return
+		}
+		utils.AddLogFields(ctx, "trace_id", sc.TraceID().String())
+		c.Request = c.Request.WithContext(ctx)
+		defer span.End()
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		if status >= http.StatusInternalServerError {
+			if errs := c.Errors.ByType(gin.ErrorTypePrivate); len(errs) > 0 {
+				utils.RecordSpanError(span, errs.Last())
+				return
+			}
+			utils.RecordSpanError(span, errors.New(http.StatusText(status)))
+		}
+	}
 }
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+func TestDBConnection(t *testing.T) {
+	router := gin.New()
+	router.Use(DBConnection(testDBCon))
+	router.GET("/", func(c *gin.Context) {
+		con := DBConnOrAbort(c)
+		if con == nil {
+			return
+		}
+		var count int
+		if err := con.Model(&db.User{}).Count(&count).Error; err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				NewErrResWithErr(ErrorCodeDBConn, err))
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 취소된 요청의 쿼리는 실행되지 않는다.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequestWithContext(ctx, "GET", "/", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), context.Canceled.Error())
+
+	// 풀은 그대로 쓸 수 있다.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRequestID(t *testing.T) {
+	router := New(testDBCon)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	router.ServeHTTP(w, req)
+	assert.Len(t, w.Header().Get(RequestIDHeader), 36)
+
+	// 받은 요청 ID 를 그대로 돌려준다.
+	w = httptest.NewRecorder()
+	req.Header.Set(RequestIDHeader, "req-abc.123")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "req-abc.123", w.Header().Get(RequestIDHeader))
+
+	// 로그를 깨뜨릴 수 있는 값은 쓰지 않는다.
+	w = httptest.NewRecorder()
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	router.ServeHTTP(w, req)
+	assert.Len(t, w.Header().Get(RequestIDHeader), 36)
+
+	// 감사 로그에 남길 수 없는 긴 값은 쓰지 않는다.
+	long := strings.Repeat("a", maxRequestIDLen+1)
+	w = httptest.NewRecorder()
+	req.Header.Set(RequestIDHeader, long)
+	router.ServeHTTP(w, req)
+	assert.NotEqual(t, long, w.Header().Get(RequestIDHeader))
+	assert.Len(t, w.Header().Get(RequestIDHeader), 36)
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := utils.DefaultLogger()
+	utils.SetDefaultLogger(utils.NewLogger(&buf, true))
+	defer utils.SetDefaultLogger(defaultLogger)
+
+	router := gin.New()
+	router.Use(RequestID(), AccessLog())
+	router.GET("/users/:email", func(c *gin.Context) {
+		utils.AddLogFields(c.Request.Context(), "user_id", 3)
+		Logger(c).Infof("handled")
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users/test@email.com", nil)
+	req.Header.Set(RequestIDHeader, "abc")
+	router.ServeHTTP(w, req)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 2)
+	for _, line := range lines {
+		fields := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(line, &fields))
+		assert.Equal(t, "abc", fields["request_id"])
+		assert.Equal(t, "GET /users/:email", fields["route"])
+		assert.Equal(t, float64(3), fields["user_id"])
+	}
+	assert.Contains(t, string(lines[1]), `"msg":"request"`)
+	assert.Contains(t, string(lines[1]), `"status":200`)
+}
+
+func TestTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := utils.NewTracerProvider(exporter, "auth", 100)
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	defer provider.Shutdown(context.Background())
+
+	var buf bytes.Buffer
+	defaultLogger := utils.DefaultLogger()
+	utils.SetDefaultLogger(utils.NewLogger(&buf, true))
+	defer utils.SetDefaultLogger(defaultLogger)
+
+	router := gin.New()
+	router.Use(RequestID(), Trace(), DBConnection(testDBCon))
+	router.GET("/users/:email", func(c *gin.Context) {
+		con := DBConnOrAbort(c)
+		user := db.User{Email: c.Param("email")}
+		user.Fetch(con)
+		Logger(c).Infof("handled")
+		c.Status(http.StatusInternalServerError)
+	})
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users/test@email.com", nil)
+	req.Header.Set(utils.TraceparentHeader, traceparent)
+	router.ServeHTTP(w, req)
+	assert.NoError(t, provider.ForceFlush(context.Background()))
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	query, server := spans[0], spans[1]
+	assert.Equal(t, "GET /users/:email", server.Name)
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.Contains(t, server.Attributes, attribute.Int("http.status_code", 500))
+	assert.Equal(t, codes.Error, server.Status.Code)
+	assert.Equal(t, http.StatusText(http.StatusInternalServerError), server.Status.Description)
+	assert.Equal(t, "query users", query.Name)
+	assert.Equal(t, server.SpanContext.SpanID(), query.Parent.SpanID())
+
+	// 요청의 로그에 trace id 가 붙는다.
+	assert.Contains(t, buf.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+}
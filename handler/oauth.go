@@ -0,0 +1,384 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+// OAuth 2.0 parameter values.
+// reference - https://tools.ietf.org/html/rfc6749
+const (
+	responseTypeCode           = "code"
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeClientCredentials = "client_credentials"
+	tokenTypeBearer            = "Bearer"
+)
+
+// OAuth 2.0 error codes of token endpoint.
+// reference - https://tools.ietf.org/html/rfc6749#section-5.2
+const (
+	oauthErrorInvalidRequest       = "invalid_request"
+	oauthErrorInvalidClient        = "invalid_client"
+	oauthErrorInvalidGrant         = "invalid_grant"
+	oauthErrorUnsupportedGrantType = "unsupported_grant_type"
+	oauthErrorInvalidScope         = "invalid_scope"
+	oauthErrorAccessDenied         = "access_denied"
+)
+
+// OAuthAuthorizeParam is authorization request of the client.
+// It is given as query string, and posted back as JSON with the user's decision.
+type OAuthAuthorizeParam struct {
+	ResponseType        string `form:"response_type" json:"response_type" binding:"required"`
+	ClientID            string `form:"client_id" json:"client_id" binding:"required"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri" binding:"required"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+	Nonce               string `form:"nonce" json:"nonce"`
+}
+
+// OAuthConsentParam .
+type OAuthConsentParam struct {
+	OAuthAuthorizeParam
+	Approve bool `json:"approve"`
+}
+
+// OAuthConsentResponse is what the user is asked to approve.
+type OAuthConsentResponse struct {
+	Client db.OAuthClient      `json:"client"`
+	Scope  []string            `json:"scope"`
+	Params OAuthAuthorizeParam `json:"params"`
+}
+
+// OAuthRedirectResponse has the uri the user agent should be sent back to.
+type OAuthRedirectResponse struct {
+	RedirectURI string `json:"redirect_uri"`
+}
+
+// OAuthTokenParam is token request of the client.
+// Confidential client can send credentials with HTTP Basic authentication instead.
+type OAuthTokenParam struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	CodeVerifier string `form:"code_verifier"`
+	Scope        string `form:"scope"`
+}
+
+// OAuthTokenResponse .
+// 'Scope' is space separated list.
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// OAuthErrorResponse is error response of token endpoint.
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// validateAuthorizeParamOrAbort returns the client and the scope to be granted.
+// Nothing is redirected until the client and the redirect uri are validated.
+func validateAuthorizeParamOrAbort(
+	c *gin.Context, con *gorm.DB, param *OAuthAuthorizeParam) (*db.OAuthClient, string) {
+
+	client := db.FindOAuthClient(con, param.ClientID)
+	if client == nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeNotFoundOAuthClient))
+		return nil, ""
+	}
+
+	if !client.ValidRedirectURI(param.RedirectURI) {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidRedirectURI))
+		return nil, ""
+	}
+
+	if param.ResponseType != responseTypeCode {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeUnsupportedResponseType))
+		return nil, ""
+	}
+
+	scope, ok := client.AllowedScope(param.Scope)
+	if !ok {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidScope))
+		return nil, ""
+	}
+
+	if param.CodeChallengeMethod != utils.CodeChallengeMethodS256 ||
+		!utils.ValidCodeChallenge(param.CodeChallenge) {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidCodeChallenge))
+		return nil, ""
+	}
+	return client, scope
+}
+
+// redirectURIWithQuery returns the redirect uri with the parameters added.
+// The query component of the registered uri is kept.
+func redirectURIWithQuery(redirectURI string, params map[string]string) (string, error) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	for k, v := range params {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// OAuthAuthorize validates the authorization request
+// and returns what the user is asked to approve.
+func OAuthAuthorize(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param OAuthAuthorizeParam
+	if err := c.ShouldBindQuery(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindForm, err))
+		return
+	}
+
+	client, scope := validateAuthorizeParamOrAbort(c, con, &param)
+	if client == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, OAuthConsentResponse{
+		Client: *client,
+		Scope:  strings.Fields(scope),
+		Params: param,
+	})
+}
+
+// OAuthConsent issues authorization code if the user approved the request.
+// The user agent should be sent to the returned redirect uri either way.
+func OAuthConsent(c *gin.Context) {
+	conf := configs.App()
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	user, err := AuthorizedUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeAuthorizedUser, err))
+		return
+	}
+
+	var param OAuthConsentParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	client, scope := validateAuthorizeParamOrAbort(c, con, &param.OAuthAuthorizeParam)
+	if client == nil {
+		return
+	}
+
+	params := map[string]string{"state": param.State}
+	if param.Approve {
+		code := db.OAuthAuthorizationCode{
+			ClientID:      client.ClientID,
+			UserID:        user.ID,
+			RedirectURI:   param.RedirectURI,
+			Scope:         scope,
+			CodeChallenge: param.CodeChallenge,
+			Nonce:         param.Nonce,
+		}
+		code.SetAuthentication(authentication(c))
+		params["code"], err = code.Issue(con, conf.AuthorizationCodeExpire)
+		if err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				NewErrResWithErr(ErrorCodeDBTransaction, err))
+			return
+		}
+	} else {
+		params["error"] = oauthErrorAccessDenied
+	}
+
+	redirectURI, err := redirectURIWithQuery(param.RedirectURI, params)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeInvalidRedirectURI, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, OAuthRedirectResponse{redirectURI})
+}
+
+func abortWithOAuthError(c *gin.Context, httpStatusCode int, code, description string) {
+	if code == oauthErrorInvalidClient {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.AbortWithStatusJSON(httpStatusCode, OAuthErrorResponse{code, description})
+}
+
+// OAuthToken issues access token for the grant type.
+func OAuthToken(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var param OAuthTokenParam
+	if err := c.ShouldBind(&param); err != nil {
+		abortWithOAuthError(c, http.StatusBadRequest,
+			oauthErrorInvalidRequest, err.Error())
+		return
+	}
+
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		param.ClientID, param.ClientSecret = id, secret
+	}
+
+	switch param.GrantType {
+	case grantTypeAuthorizationCode:
+		authorizationCodeGrant(c, con, &param)
+	case grantTypeClientCredentials:
+		clientCredentialsGrant(c, con, &param)
+	default:
+		abortWithOAuthError(c, http.StatusBadRequest,
+			oauthErrorUnsupportedGrantType, "")
+	}
+}
+
+// authorizationCodeGrant exchanges authorization code for access token.
+// The scope granted by the user is embedded in the access token.
+// ID token is issued together if 'openid' scope is granted.
+func authorizationCodeGrant(c *gin.Context, con *gorm.DB, param *OAuthTokenParam) {
+	conf := configs.App()
+	client := db.FindOAuthClient(con, param.ClientID)
+	if client == nil || !client.VerifySecret(param.ClientSecret) {
+		abortWithOAuthError(c, http.StatusUnauthorized,
+			oauthErrorInvalidClient, "")
+		return
+	}
+
+	code, err := db.FindAuthorizationCode(con, param.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrorNotFoundAuthorizationCode),
+			errors.Is(err, db.ErrorExpiredAuthorizationCode),
+			errors.Is(err, db.ErrorUsedAuthorizationCode):
+			abortWithOAuthError(c, http.StatusBadRequest,
+				oauthErrorInvalidGrant, err.Error())
+		default:
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				NewErrResWithErr(ErrorCodeDBTransaction, err))
+		}
+		return
+	}
+
+	if code.ClientID != client.ClientID || code.RedirectURI != param.RedirectURI {
+		abortWithOAuthError(c, http.StatusBadRequest,
+			oauthErrorInvalidGrant, "client or redirect uri mismatch")
+		return
+	}
+
+	if !utils.VerifyCodeChallenge(param.CodeVerifier, code.CodeChallenge) {
+		abortWithOAuthError(c, http.StatusBadRequest,
+			oauthErrorInvalidGrant, "code verifier mismatch")
+		return
+	}
+
+	// 요청을 모두 확인한 뒤에 소모해서, 다른 클라이언트가 코드를 버리게 할 수 없다.
+	if err := code.Consume(con); err != nil {
+		if errors.Is(err, db.ErrorUsedAuthorizationCode) {
+			abortWithOAuthError(c, http.StatusBadRequest,
+				oauthErrorInvalidGrant, err.Error())
+			return
+		}
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	user := db.User{}
+	if con.First(&user, code.UserID).RecordNotFound() {
+		abortWithOAuthError(c, http.StatusBadRequest,
+			oauthErrorInvalidGrant, errNotFoundUser.Error())
+		return
+	}
+	setAuditTarget(c, &user)
+
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
+	token := utils.NewJWT(conf.SessionTokenExpire)
+	accessToken, err := token.Access(
+		user.ID, user.Email, client.ClientID, code.Scope,
+		ring.SigningKey(), conf.IssuerURL())
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeSignJWT, err))
+		return
+	}
+
+	res := OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   tokenTypeBearer,
+		ExpiresIn:   conf.SessionTokenExpire,
+		Scope:       code.Scope,
+	}
+
+	if hasScope(code.Scope, scopeOpenID) {
+		res.IDToken, err = idToken(&user, code, ring.SigningKey())
+		if err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				NewErrResWithErr(ErrorCodeSignJWT, err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+const (
+	clientIDLen     = 16
+	clientSecretLen = 32
+)
+
+// CreateOAuthClientParam .
+// Public client such as SPA or mobile app can not keep secret,
+// so it is created with 'confidential' false and relies on PKCE only.
+type CreateOAuthClientParam struct {
+	Name         string   `json:"name" binding:"required"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1"`
+	Scope        string   `json:"scope"`
+	Confidential bool     `json:"confidential"`
+}
+
+// CreateOAuthClientResponse .
+// 'ClientSecret' is shown only once when the client is created.
+type CreateOAuthClientResponse struct {
+	Client       db.OAuthClient `json:"client"`
+	ClientSecret string         `json:"client_secret,omitempty"`
+}
+
+// validRedirectURI reports whether the uri can be registered.
+// reference - https://tools.ietf.org/html/rfc6749#section-3.1.2
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return u.IsAbs() && u.Host != "" && u.Fragment == "" &&
+		!strings.ContainsAny(uri, " #")
+}
+
+func findOAuthClientOrAbort(c *gin.Context, con *gorm.DB) *db.OAuthClient {
+	client := db.FindOAuthClient(con, c.Param("client_id"))
+	if client == nil {
+		c.AbortWithStatusJSON(
+			http.StatusNotFound,
+			NewErrRes(ErrorCodeNotFoundOAuthClient))
+		return nil
+	}
+	return client
+}
+
+// OAuthClients .
+func OAuthClients(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var clients []db.OAuthClient
+	if err := con.Order("id desc").Find(&clients).Error; err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"clients": clients})
+}
+
+// OAuthClient .
+func OAuthClient(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	client := findOAuthClientOrAbort(c, con)
+	if client == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, client)
+}
+
+// CreateOAuthClient registers a new client.
+func CreateOAuthClient(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param CreateOAuthClientParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	for _, uri := range param.RedirectURIs {
+		if !validRedirectURI(uri) {
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				NewErrRes(ErrorCodeInvalidRedirectURI))
+			return
+		}
+	}
+
+	clientID, err := utils.RandomToken(clientIDLen)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeGenerateOAuthClient, err))
+		return
+	}
+
+	client := db.OAuthClient{
+		ClientID:     clientID,
+		Name:         param.Name,
+		RedirectURIs: strings.Join(param.RedirectURIs, " "),
+		Scope:        strings.Join(strings.Fields(param.Scope), " "),
+	}
+
+	var secret string
+	if param.Confidential {
+		if secret, err = utils.RandomToken(clientSecretLen); err == nil {
+			err = client.SetSecret(secret)
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				NewErrResWithErr(ErrorCodeGenerateOAuthClient, err))
+			return
+		}
+	}
+
+	if err := client.Create(con); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateOAuthClientResponse{client, secret})
+}
+
+// DeleteOAuthClient .
+func DeleteOAuthClient(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	client := findOAuthClientOrAbort(c, con)
+	if client == nil {
+		return
+	}
+
+	if err := client.Delete(con); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
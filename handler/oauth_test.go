@@ -0,0 +1,342 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+const testRedirectURI = "https://client.example.com/callback"
+
+type testOAuthClient struct {
+	Client       db.JSONOAuthClient `json:"client"`
+	ClientSecret string             `json:"client_secret"`
+}
+
+func createOAuthClientForTest(router http.Handler, admin *db.User, confidential bool) (*testOAuthClient, error) {
+	body, err := json.Marshal(CreateOAuthClientParam{
+		Name:         "test client",
+		RedirectURIs: []string{testRedirectURI},
+		Scope:        "openid profile email",
+		Confidential: confidential,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/admin/oauth_clients", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	setAuthJWTForTest(req, admin)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		return nil, fmt.Errorf("create oauth client failed with status %d", w.Code)
+	}
+
+	var client testOAuthClient
+	if err := json.NewDecoder(w.Body).Decode(&client); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func authorizeParamForTest(clientID, verifier string) OAuthAuthorizeParam {
+	return OAuthAuthorizeParam{
+		ResponseType:        "code",
+		ClientID:            clientID,
+		RedirectURI:         testRedirectURI,
+		Scope:               "email",
+		State:               "xyz",
+		CodeChallenge:       utils.CodeChallengeS256(verifier),
+		CodeChallengeMethod: utils.CodeChallengeMethodS256,
+	}
+}
+
+func consentForTest(t *testing.T, router http.Handler, user *db.User, param OAuthConsentParam) *url.URL {
+	body, err := json.Marshal(param)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/oauth/authorize", bytes.NewReader(body))
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, user)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var res OAuthRedirectResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	u, err := url.Parse(res.RedirectURI)
+	assert.NoError(t, err)
+	return u
+}
+
+func tokenRequestForTest(router http.Handler, form url.Values) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	client, err := createOAuthClientForTest(router, admin, true)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, client.ClientSecret)
+	assert.True(t, client.Client.Confidential)
+
+	verifier, err := utils.RandomToken(32)
+	assert.NoError(t, err)
+	param := authorizeParamForTest(client.Client.ClientID, verifier)
+
+	// Consent
+	query := url.Values{}
+	query.Set("response_type", param.ResponseType)
+	query.Set("client_id", param.ClientID)
+	query.Set("redirect_uri", param.RedirectURI)
+	query.Set("scope", param.Scope)
+	query.Set("state", param.State)
+	query.Set("code_challenge", param.CodeChallenge)
+	query.Set("code_challenge_method", param.CodeChallengeMethod)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/oauth/authorize?"+query.Encode(), nil)
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, user)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var consent struct {
+		Client db.JSONOAuthClient  `json:"client"`
+		Scope  []string            `json:"scope"`
+		Params OAuthAuthorizeParam `json:"params"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&consent))
+	assert.Equal(t, client.Client.ClientID, consent.Client.ClientID)
+	assert.Equal(t, []string{"email"}, consent.Scope)
+	assert.Equal(t, param, consent.Params)
+
+	// Approve
+	redirected := consentForTest(t, router, user, OAuthConsentParam{param, true})
+	assert.Equal(t, testRedirectURI, fmt.Sprintf(
+		"%s://%s%s", redirected.Scheme, redirected.Host, redirected.Path))
+	assert.Equal(t, param.State, redirected.Query().Get("state"))
+	code := redirected.Query().Get("code")
+	assert.NotEmpty(t, code)
+
+	// Token
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", testRedirectURI)
+	form.Set("client_id", client.Client.ClientID)
+	form.Set("client_secret", client.ClientSecret)
+	form.Set("code_verifier", verifier)
+
+	w = tokenRequestForTest(router, form)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	var token OAuthTokenResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&token))
+	assert.Equal(t, "Bearer", token.TokenType)
+	assert.Equal(t, "email", token.Scope)
+
+	ring, err := KeyRing(testDBCon)
+	assert.NoError(t, err)
+	claims, err := utils.ParseAccessJWT(token.AccessToken, ring)
+	assert.NoError(t, err)
+	assert.Equal(t, utils.Access, claims.Subject)
+	assert.Equal(t, user.ID, claims.UserID)
+	assert.Equal(t, client.Client.ClientID, claims.ClientID)
+	assert.Equal(t, "email", claims.Scope)
+
+	// Access token is not a session token.
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", fmt.Sprintf("/users/%s", user.Email), nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Code can be used only once.
+	w = tokenRequestForTest(router, form)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var errRes OAuthErrorResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&errRes))
+	assert.Equal(t, "invalid_grant", errRes.Error)
+}
+
+func TestOAuthTokenWithBadRequest(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	client, err := createOAuthClientForTest(router, admin, false)
+	assert.NoError(t, err)
+	assert.Empty(t, client.ClientSecret)
+
+	verifier, err := utils.RandomToken(32)
+	assert.NoError(t, err)
+	param := authorizeParamForTest(client.Client.ClientID, verifier)
+
+	newForm := func() url.Values {
+		redirected := consentForTest(t, router, user, OAuthConsentParam{param, true})
+		form := url.Values{}
+		form.Set("grant_type", "authorization_code")
+		form.Set("code", redirected.Query().Get("code"))
+		form.Set("redirect_uri", testRedirectURI)
+		form.Set("client_id", client.Client.ClientID)
+		form.Set("code_verifier", verifier)
+		return form
+	}
+
+	table := []struct {
+		Key            string
+		Value          string
+		HTTPStatusCode int
+		Error          string
+	}{
+		{"grant_type", "password", http.StatusBadRequest, "unsupported_grant_type"},
+		{"client_id", "unknown", http.StatusUnauthorized, "invalid_client"},
+		{"redirect_uri", testRedirectURI + "/other", http.StatusBadRequest, "invalid_grant"},
+		{"code_verifier", verifier + "x", http.StatusBadRequest, "invalid_grant"},
+		{"code", "unknown", http.StatusBadRequest, "invalid_grant"},
+	}
+
+	for _, v := range table {
+		form := newForm()
+		form.Set(v.Key, v.Value)
+		w := tokenRequestForTest(router, form)
+		assert.Equal(t, v.HTTPStatusCode, w.Code)
+
+		var errRes OAuthErrorResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&errRes))
+		assert.Equal(t, v.Error, errRes.Error)
+	}
+
+	// 다른 클라이언트나 맞지 않는 요청은 코드를 소모하지 않는다.
+	other, err := createOAuthClientForTest(router, admin, false)
+	assert.NoError(t, err)
+	form := newForm()
+	mismatches := url.Values{
+		"client_id":     {other.Client.ClientID},
+		"redirect_uri":  {testRedirectURI + "/other"},
+		"code_verifier": {verifier + "x"},
+	}
+	for k := range mismatches {
+		bad := url.Values{}
+		for key := range form {
+			bad.Set(key, form.Get(key))
+		}
+		bad.Set(k, mismatches.Get(k))
+		w := tokenRequestForTest(router, bad)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+
+	w := tokenRequestForTest(router, form)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 한 번 교환한 코드는 다시 쓸 수 없다.
+	w = tokenRequestForTest(router, form)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOAuthAuthorizeWithBadRequest(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	client, err := createOAuthClientForTest(router, admin, false)
+	assert.NoError(t, err)
+
+	verifier, err := utils.RandomToken(32)
+	assert.NoError(t, err)
+
+	table := []struct {
+		Modify    func(*OAuthAuthorizeParam)
+		ErrorCode int
+	}{
+		{func(p *OAuthAuthorizeParam) { p.ClientID = "unknown" }, ErrorCodeNotFoundOAuthClient},
+		{func(p *OAuthAuthorizeParam) { p.RedirectURI = "https://evil.example.com" }, ErrorCodeInvalidRedirectURI},
+		{func(p *OAuthAuthorizeParam) { p.ResponseType = "token" }, ErrorCodeUnsupportedResponseType},
+		{func(p *OAuthAuthorizeParam) { p.Scope = "admin" }, ErrorCodeInvalidScope},
+		{func(p *OAuthAuthorizeParam) { p.CodeChallengeMethod = "plain" }, ErrorCodeInvalidCodeChallenge},
+		{func(p *OAuthAuthorizeParam) { p.CodeChallenge = "" }, ErrorCodeInvalidCodeChallenge},
+	}
+
+	for _, v := range table {
+		param := authorizeParamForTest(client.Client.ClientID, verifier)
+		v.Modify(&param)
+		body, err := json.Marshal(OAuthConsentParam{param, true})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/oauth/authorize", bytes.NewReader(body))
+		assert.NoError(t, err)
+		setAuthJWTForTest(req, user)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		errRes := ErrorCodeResponse{}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&errRes))
+		assert.Equal(t, v.ErrorCode, errRes.ErrorCode)
+	}
+
+	// Deny
+	param := authorizeParamForTest(client.Client.ClientID, verifier)
+	redirected := consentForTest(t, router, user, OAuthConsentParam{param, false})
+	assert.Equal(t, "access_denied", redirected.Query().Get("error"))
+	assert.Equal(t, param.State, redirected.Query().Get("state"))
+	assert.Empty(t, redirected.Query().Get("code"))
+}
+
+func TestCreateOAuthClientWithInvalidRedirectURI(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	for _, uri := range []string{"/callback", "https://example.com/#fragment", "example.com"} {
+		body, err := json.Marshal(CreateOAuthClientParam{
+			Name:         "test client",
+			RedirectURIs: []string{uri},
+		})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/admin/oauth_clients", bytes.NewReader(body))
+		assert.NoError(t, err)
+		setAuthJWTForTest(req, admin)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		errRes := ErrorCodeResponse{}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&errRes))
+		assert.Equal(t, ErrorCodeInvalidRedirectURI, errRes.ErrorCode)
+	}
+}
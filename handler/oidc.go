@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+// OpenID Connect scopes.
+// reference - https://openid.net/specs/openid-connect-core-1_0.html#ScopeClaims
+const (
+	scopeOpenID = "openid"
+	scopeEmail  = "email"
+)
+
+// OpenIDProviderMetadata .
+// reference - https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type OpenIDProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// UserInfoResponse .
+type UserInfoResponse struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+}
+
+func hasScope(scope, s string) bool {
+	for _, v := range strings.Fields(scope) {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// subject returns identifier of the user which never changes.
+func subject(user *db.User) string {
+	return strconv.FormatUint(uint64(user.ID), 10)
+}
+
+// idToken returns ID token for the user who approved the authorization code.
+// Email is always verified since users sign up by email verification.
+func idToken(user *db.User, code *db.OAuthAuthorizationCode, key *utils.Key) (string, error) {
+	conf := configs.App()
+	claims := utils.IDClaims{
+		Nonce:          code.Nonce,
+		Authentication: code.Authentication(),
+	}
+	if hasScope(code.Scope, scopeEmail) {
+		claims.Email = user.Email
+		claims.EmailVerified = true
+	}
+
+	token := utils.NewJWT(conf.SessionTokenExpire)
+	return token.ID(claims, subject(user), code.ClientID, key, conf.IssuerURL())
+}
+
+// OpenIDConfiguration publishes the discovery document.
+// Signing algorithm follows the key currently signing JWT.
+func OpenIDConfiguration(c *gin.Context) {
+	conf := configs.App()
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
+	issuer := conf.IssuerURL()
+	c.JSON(http.StatusOK, OpenIDProviderMetadata{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserinfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		ScopesSupported:                   []string{scopeOpenID, scopeEmail},
+		ResponseTypesSupported:            []string{responseTypeCode},
+		GrantTypesSupported:               []string{grantTypeAuthorizationCode, grantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{ring.SigningKey().Method.Alg()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{utils.CodeChallengeMethodS256},
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat",
+			"email", "email_verified", "auth_time", "amr", "nonce",
+		},
+	})
+}
+
+// UserInfo returns claims about the user who granted the access token.
+// Access token must have 'openid' scope.
+func UserInfo(c *gin.Context) {
+	user, err := AuthorizedUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeAuthorizedUser, err))
+		return
+	}
+
+	v, _ := c.Get("AccessClaims")
+	claims, _ := v.(utils.AccessClaims)
+	if !hasScope(claims.Scope, scopeOpenID) {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	res := UserInfoResponse{Subject: subject(&user)}
+	if hasScope(claims.Scope, scopeEmail) {
+		res.Email = user.Email
+		res.EmailVerified = true
+	}
+	c.JSON(http.StatusOK, res)
+}
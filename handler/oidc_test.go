@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/utils"
+)
+
+func TestOpenIDConfiguration(t *testing.T) {
+	conf := configs.App()
+	router := New(testDBCon)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/.well-known/openid-configuration", nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var metadata OpenIDProviderMetadata
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&metadata))
+	assert.Equal(t, conf.IssuerURL(), metadata.Issuer)
+	assert.Equal(t, conf.IssuerURL()+"/oauth/token", metadata.TokenEndpoint)
+	assert.Equal(t, conf.IssuerURL()+"/.well-known/jwks.json", metadata.JWKSURI)
+	assert.Equal(t, []string{"code"}, metadata.ResponseTypesSupported)
+	assert.Equal(t, []string{"S256"}, metadata.CodeChallengeMethodsSupported)
+	assert.Equal(t, []string{conf.JWTSigningMethod}, metadata.IDTokenSigningAlgValuesSupported)
+}
+
+func TestIDTokenAndUserInfo(t *testing.T) {
+	conf := configs.App()
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	client, err := createOAuthClientForTest(router, admin, false)
+	assert.NoError(t, err)
+
+	verifier, err := utils.RandomToken(32)
+	assert.NoError(t, err)
+
+	token := func(scope string) OAuthTokenResponse {
+		param := authorizeParamForTest(client.Client.ClientID, verifier)
+		param.Scope = scope
+		param.Nonce = "n-0S6_WzA2Mj"
+		redirected := consentForTest(t, router, user, OAuthConsentParam{param, true})
+
+		form := url.Values{}
+		form.Set("grant_type", "authorization_code")
+		form.Set("code", redirected.Query().Get("code"))
+		form.Set("redirect_uri", testRedirectURI)
+		form.Set("client_id", client.Client.ClientID)
+		form.Set("code_verifier", verifier)
+		w := tokenRequestForTest(router, form)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var res OAuthTokenResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		return res
+	}
+
+	userInfo := func(accessToken string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/userinfo", nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	res := token("openid email")
+	assert.NotEmpty(t, res.IDToken)
+
+	ring, err := KeyRing(testDBCon)
+	assert.NoError(t, err)
+	claims, err := utils.ParseIDJWT(res.IDToken, ring)
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(int(user.ID)), claims.Subject)
+	assert.Equal(t, client.Client.ClientID, claims.Audience)
+	assert.Equal(t, conf.IssuerURL(), claims.Issuer)
+	assert.Equal(t, user.Email, claims.Email)
+	assert.True(t, claims.EmailVerified)
+	assert.Equal(t, "n-0S6_WzA2Mj", claims.Nonce)
+	assert.NotZero(t, claims.AuthTime)
+	assert.Equal(t, []string{utils.AMRPassword}, claims.AMR)
+
+	// 이 서비스가 서명한 토큰은 모두 같은 발급자를 쓴다.
+	access, err := utils.ParseAccessJWT(res.AccessToken, ring)
+	assert.NoError(t, err)
+	assert.Equal(t, conf.IssuerURL(), access.Issuer)
+	session, err := signinForTest(router, user.Email, testPassword)
+	assert.NoError(t, err)
+	sessionClaims, err := utils.ParseSessionJWT(session.Token, ring)
+	assert.NoError(t, err)
+	assert.Equal(t, conf.IssuerURL(), sessionClaims.Issuer)
+
+	w := userInfo(res.AccessToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var info UserInfoResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&info))
+	assert.Equal(t, claims.Subject, info.Subject)
+	assert.Equal(t, user.Email, info.Email)
+	assert.True(t, info.EmailVerified)
+
+	// Without 'openid' scope
+	res = token("email")
+	assert.Empty(t, res.IDToken)
+	w = userInfo(res.AccessToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Session token is not an access token.
+	signin, err := signinForTest(router, user.Email, testPassword)
+	assert.NoError(t, err)
+	w = userInfo(signin.Token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), "invalid_token")
+}
+
+func TestSessionTokenHasAuthentication(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	signin, err := signinForTest(router, user.Email, testPassword)
+	assert.NoError(t, err)
+
+	ring, err := KeyRing(testDBCon)
+	assert.NoError(t, err)
+	claims, err := utils.ParseSessionJWT(signin.Token, ring)
+	assert.NoError(t, err)
+	assert.NotZero(t, claims.AuthTime)
+	assert.Equal(t, []string{utils.AMRPassword}, claims.AMR)
+
+	w := refreshTokenForTest(router, signin.RefreshToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var refreshed TokenResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&refreshed))
+	refreshedClaims, err := utils.ParseSessionJWT(refreshed.Token, ring)
+	assert.NoError(t, err)
+	assert.Equal(t, claims.Authentication, refreshedClaims.Authentication)
+}
@@ -55,7 +55,8 @@ func confirmOTP(con *gorm.DB, user *db.User) *ErrorCodeResponse {
 		return &errRes
 	}
 
-	err = user.Save(con)
+	confirmed := db.NewOutboxEvent(db.EventOTPConfirmed, user.ID, db.EventData{Email: user.Email})
+	err = user.Save(con, confirmed)
 	if err != nil {
 		errRes := NewErrResWithErr(ErrorCodeDBTransaction, err)
 		return &errRes
@@ -65,7 +66,8 @@ func confirmOTP(con *gorm.DB, user *db.User) *ErrorCodeResponse {
 
 func resetOTP(con *gorm.DB, user *db.User) *ErrorCodeResponse {
 	user.ResetOTP()
-	if err := user.Save(con); err != nil {
+	reset := db.NewOutboxEvent(db.EventOTPReset, user.ID, db.EventData{Email: user.Email})
+	if err := user.Save(con, reset); err != nil {
 		errRes := NewErrResWithErr(ErrorCodeDBTransaction, err)
 		return &errRes
 	}
@@ -181,7 +183,7 @@ func ResetOTP(c *gin.Context) {
 		return
 	}
 
-	if !c.GetBool("AuthorizedUserIsAdmin") {
+	if !c.GetBool("AuthorizedByPermission") {
 		var param ResetOTPParam
 		if err := c.ShouldBindJSON(&param); err != nil {
 			c.AbortWithStatusJSON(
@@ -17,7 +17,7 @@ func TestGenerateOTP(t *testing.T) {
 	user, err := testUser(testDBCon)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/users/%s/otp", user.Email)
@@ -53,7 +53,7 @@ func TestConfirmOTP(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/users/%s/otp", user.Email)
@@ -89,7 +89,7 @@ func TestConfirmOTPWithoutOTPSecretKey(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/users/%s/otp", user.Email)
@@ -127,7 +127,7 @@ func TestResetOTP(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/users/%s/otp", testEmail())
@@ -162,7 +162,7 @@ func TestResetOTPAsAdmin(t *testing.T) {
 	errCodeRes = confirmOTP(testDBCon, user)
 	assert.Nil(t, errCodeRes)
 
-	router := New()
+	router := New(testDBCon)
 
 	// Reset - Admin
 	w := httptest.NewRecorder()
@@ -45,7 +45,7 @@ func pageTestHandler(c *gin.Context) {
 func TestPage(t *testing.T) {
 	page := 1
 	pageSize := 10
-	router := New()
+	router := New(testDBCon)
 	r, _ := router.(*gin.Engine)
 	r.GET(pageTestURI, pageTestHandler)
 	w := httptest.NewRecorder()
@@ -71,7 +71,7 @@ func TestPageWithBadQueryParam(t *testing.T) {
 		"page=0&page_size=bad",
 		"page=0&page_size=0",
 	}
-	router := New()
+	router := New(testDBCon)
 	r, _ := router.(*gin.Engine)
 	r.GET(pageTestURI, pageTestHandler)
 
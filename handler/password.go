@@ -3,12 +3,14 @@ package handler
 import (
 	"bytes"
 	"errors"
-	"log"
 	"net/http"
 	"text/template"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jinzhu/gorm"
+
 	"github.com/loganstone/auth/configs"
 	"github.com/loganstone/auth/db"
 	"github.com/loganstone/auth/utils"
@@ -20,6 +22,12 @@ type ChangePasswordParam struct {
 	Password        string `json:"password" binding:"required"`
 }
 
+// ResetPasswordParam .
+type ResetPasswordParam struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
 // ResetPasswordEmailData .
 type ResetPasswordEmailData struct {
 	UserEmail    string `json:"user_email"`
@@ -76,7 +84,9 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
-	err = user.Save(con)
+	changed := db.NewOutboxEvent(db.EventPasswordChanged, user.ID,
+		db.EventData{Email: user.Email, Reason: db.PasswordChangeReason})
+	err = user.Save(con, changed)
 	if err != nil {
 		c.AbortWithStatusJSON(
 			http.StatusInternalServerError,
@@ -84,6 +94,13 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
+	if err := db.RevokeRefreshTokens(con, user.ID); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
 	c.Status(http.StatusOK)
 }
 
@@ -110,9 +127,14 @@ func SendResetPasswordEmail(c *gin.Context) {
 	}
 	user.PasswordResetTs = int(time.Now().Unix())
 
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
 	token := utils.NewJWT(conf.ResetPasswordTokenExpire)
 	resetPasswordToken, err := token.ResetPassword(
-		param.Email, user.PasswordResetTs, conf.JWTSigninKey, conf.Org)
+		param.Email, user.PasswordResetTs, ring.SigningKey(), conf.IssuerURL())
 	if err != nil {
 		c.AbortWithStatusJSON(
 			http.StatusInternalServerError,
@@ -121,7 +143,7 @@ func SendResetPasswordEmail(c *gin.Context) {
 	}
 
 	if gin.Mode() == gin.DebugMode {
-		log.Println("reset password token:", resetPasswordToken)
+		Logger(c).Debugf("reset password token: %s", resetPasswordToken)
 	}
 
 	emailTmpl, err := template.New("reset password email").Parse(param.Body)
@@ -153,7 +175,7 @@ func SendResetPasswordEmail(c *gin.Context) {
 		param.Email,
 		param.Subject,
 		body.String(),
-	).Send(configs.SMTP().Addr()); err != nil {
+	).SendContext(c.Request.Context(), configs.SMTP().Addr()); err != nil {
 		c.AbortWithStatusJSON(
 			http.StatusInternalServerError,
 			NewErrResWithErr(ErrorCodeSendEmail, err))
@@ -170,3 +192,126 @@ func SendResetPasswordEmail(c *gin.Context) {
 
 	c.Status(http.StatusOK)
 }
+
+// findUserByResetPasswordTokenOrAbort returns the user the token was issued to.
+// The token is valid only while its 'PasswordResetTs' matches the user's,
+// so each reset link can be used once.
+// Malformed or forged tokens are aborted with 400 as well as expired ones.
+func findUserByResetPasswordTokenOrAbort(token string, c *gin.Context, con *gorm.DB) *db.User {
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return nil
+	}
+
+	claims, err := utils.ParseResetPasswordJWT(token, ring)
+	if err != nil {
+		ve, ok := err.(*jwt.ValidationError)
+		if !ok || ve.Errors != jwt.ValidationErrorExpired {
+			// 잘못된 모양이나 서명의 토큰은 요청의 잘못이다.
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				NewErrResWithErr(ErrorCodeInvalidToken, err))
+			return nil
+		}
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeExpiredToken))
+		return nil
+	}
+
+	// 같은 키로 서명한 다른 용도의 토큰은 거부한다.
+	if claims.Subject != utils.ResetPassword {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidToken))
+		return nil
+	}
+
+	user := findUserByEmailOrAbort(
+		claims.Email, c, con, http.StatusBadRequest)
+	if user == nil {
+		return nil
+	}
+
+	if user.PasswordResetTs == 0 || user.PasswordResetTs != claims.PasswordResetTs {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidToken))
+		return nil
+	}
+	return user
+}
+
+// VerifyResetPasswordToken .
+func VerifyResetPasswordToken(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	user := findUserByResetPasswordTokenOrAbort(c.Param("token"), c, con)
+	if user == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"email": user.Email})
+}
+
+// ResetPassword .
+func ResetPassword(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param ResetPasswordParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	user := findUserByResetPasswordTokenOrAbort(param.Token, c, con)
+	if user == nil {
+		return
+	}
+
+	err := user.SetPassword(param.Password)
+	if err != nil {
+		httpStatusCode := http.StatusInternalServerError
+		errRes := NewErrResWithErr(ErrorCodeSetPassword, err)
+		if errors.Is(err, db.ErrorInvalidPassword) {
+			httpStatusCode = http.StatusBadRequest
+			errRes = NewErrResWithErr(ErrorCodeInvalidPassword, err)
+		}
+		c.AbortWithStatusJSON(httpStatusCode, errRes)
+		return
+	}
+
+	changed := db.NewOutboxEvent(db.EventPasswordChanged, user.ID,
+		db.EventData{Email: user.Email, Reason: db.PasswordResetReason})
+	err = user.ResetPassword(con, user.PasswordResetTs, changed)
+	if err != nil {
+		// 같은 토큰으로 동시에 재설정하면 하나만 성공한다.
+		if errors.Is(err, db.ErrorUsedPasswordReset) {
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				NewErrRes(ErrorCodeInvalidToken))
+			return
+		}
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	if err := db.RevokeRefreshTokens(con, user.ID); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
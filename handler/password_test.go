@@ -8,8 +8,10 @@ import (
 	"net/http/httptest"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
 	"github.com/loganstone/auth/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -52,7 +54,7 @@ func TestChangePassword(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/users/%s/password", user.Email)
@@ -90,6 +92,16 @@ func TestChangePassword(t *testing.T) {
 	setAuthJWTForTest(req, user)
 	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	events := publishedEventsForTest(t, user.ID)
+	assert.Len(t, events, 3)
+	assert.Equal(t, db.EventUserCreated, events[0].Type)
+	assert.Equal(t, db.EventPasswordChanged, events[1].Type)
+	assert.Equal(t, db.EventSigninSucceeded, events[2].Type)
+
+	var data db.EventData
+	assert.NoError(t, json.Unmarshal(events[1].Data, &data))
+	assert.Equal(t, db.PasswordChangeReason, data.Reason)
 }
 
 func TestChangePasswordWithIncorrectCurrentPassword(t *testing.T) {
@@ -103,7 +115,7 @@ func TestChangePasswordWithIncorrectCurrentPassword(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/users/%s/password", user.Email)
@@ -129,7 +141,7 @@ func TestChangePasswordWithoutPassword(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/users/%s/password", user.Email)
@@ -196,7 +208,7 @@ func TestSendResetPasswordEmail(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("POST", "/email/reset_password", bytes.NewReader(body))
@@ -205,3 +217,201 @@ func TestSendResetPasswordEmail(t *testing.T) {
 	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func resetPasswordTokenForTest(user *db.User, expireAfterSec int) (string, error) {
+	conf := configs.App()
+	user.PasswordResetTs = int(time.Now().Unix())
+	if err := user.Save(testDBCon); err != nil {
+		return "", err
+	}
+
+	key, err := JWTKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := utils.NewJWT(expireAfterSec)
+	return token.ResetPassword(
+		user.Email, user.PasswordResetTs, key, conf.IssuerURL())
+}
+
+func TestVerifyResetPasswordToken(t *testing.T) {
+	conf := configs.App()
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	resetPasswordToken, err := resetPasswordTokenForTest(
+		user, conf.ResetPasswordTokenExpire)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	w := httptest.NewRecorder()
+	uri := fmt.Sprintf("/reset_password/email/verification/%s", resetPasswordToken)
+	req, err := http.NewRequest("GET", uri, nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resBody map[string]string
+	err = json.NewDecoder(w.Body).Decode(&resBody)
+	assert.NoError(t, err)
+	assert.Equal(t, user.Email, resBody["email"])
+}
+
+func TestVerifyResetPasswordTokenWithExpiredToken(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	resetPasswordToken, err := resetPasswordTokenForTest(user, -1)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	w := httptest.NewRecorder()
+	uri := fmt.Sprintf("/reset_password/email/verification/%s", resetPasswordToken)
+	req, err := http.NewRequest("GET", uri, nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var errRes ErrorCodeResponse
+	err = json.NewDecoder(w.Body).Decode(&errRes)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrorCodeExpiredToken, errRes.ErrorCode)
+}
+
+func TestResetPasswordWithMalformedToken(t *testing.T) {
+	conf := configs.App()
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	resetPasswordToken, err := resetPasswordTokenForTest(
+		user, conf.ResetPasswordTokenExpire)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	// 모양이 잘못되거나 서명이 다른 토큰은 요청의 잘못이다.
+	for _, token := range []string{"malformed", resetPasswordToken + "x"} {
+		body, err := json.Marshal(ResetPasswordParam{Token: token, Password: changedPassword})
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/reset_password", bytes.NewReader(body))
+		assert.NoError(t, err)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, ErrorCodeInvalidToken, errCodeForTest(t, w))
+	}
+
+	user, err = user.Fetch(testDBCon)
+	assert.NoError(t, err)
+	assert.True(t, user.VerifyPassword(testPassword))
+}
+
+func TestResetPasswordWithOtherToken(t *testing.T) {
+	conf := configs.App()
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	// 재설정한 적 없는 사용자의 'PasswordResetTs' 는 0 이라 가입 토큰과 모양이 같다.
+	key, err := JWTKey()
+	assert.NoError(t, err)
+	signupToken, err := utils.NewJWT(conf.SignupTokenExpire).Signup(user.Email, key, conf.IssuerURL())
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	w := httptest.NewRecorder()
+	uri := fmt.Sprintf("/reset_password/email/verification/%s", signupToken)
+	req, err := http.NewRequest("GET", uri, nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrorCodeInvalidToken, errCodeForTest(t, w))
+
+	body, err := json.Marshal(ResetPasswordParam{Token: signupToken, Password: changedPassword})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("POST", "/reset_password", bytes.NewReader(body))
+	assert.NoError(t, err)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrorCodeInvalidToken, errCodeForTest(t, w))
+
+	user, err = user.Fetch(testDBCon)
+	assert.NoError(t, err)
+	assert.True(t, user.VerifyPassword(testPassword))
+}
+
+func TestResetPassword(t *testing.T) {
+	conf := configs.App()
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	resetPasswordToken, err := resetPasswordTokenForTest(
+		user, conf.ResetPasswordTokenExpire)
+	assert.NoError(t, err)
+
+	reqBody := ResetPasswordParam{
+		Token:    resetPasswordToken,
+		Password: changedPassword,
+	}
+	body, err := json.Marshal(reqBody)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/reset_password", bytes.NewReader(body))
+	assert.NoError(t, err)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	user, err = user.Fetch(testDBCon)
+	assert.NoError(t, err)
+	assert.True(t, user.VerifyPassword(changedPassword))
+	assert.Equal(t, 0, user.PasswordResetTs)
+
+	// 한번 사용한 토큰은 재사용 할 수 없다.
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("POST", "/reset_password", bytes.NewReader(body))
+	assert.NoError(t, err)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var errRes ErrorCodeResponse
+	err = json.NewDecoder(w.Body).Decode(&errRes)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrorCodeInvalidToken, errRes.ErrorCode)
+}
+
+func TestResetPasswordWithInvalidPassword(t *testing.T) {
+	conf := configs.App()
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	resetPasswordToken, err := resetPasswordTokenForTest(
+		user, conf.ResetPasswordTokenExpire)
+	assert.NoError(t, err)
+
+	reqBody := ResetPasswordParam{
+		Token:    resetPasswordToken,
+		Password: "ok1234",
+	}
+	body, err := json.Marshal(reqBody)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/reset_password", bytes.NewReader(body))
+	assert.NoError(t, err)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var errRes ErrorCodeResponse
+	err = json.NewDecoder(w.Body).Decode(&errRes)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrorCodeInvalidPassword, errRes.ErrorCode)
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/utils"
+)
+
+// maxRateLimitBodySize is the largest body read to find the key.
+// Larger body is cut, then it fails to be bound by the handler.
+const maxRateLimitBodySize = 1 << 20
+
+// RateLimitPolicy is token bucket applied to requests of the same key.
+// Requests of empty key are not limited by the policy.
+type RateLimitPolicy struct {
+	Name  string
+	Limit utils.RateLimit
+	Key   func(c *gin.Context) string
+}
+
+// RateLimitByIP limits requests from the same client IP.
+// 'X-Forwarded-For' is used only from trusted proxies, see New.
+func RateLimitByIP(limit utils.RateLimit) RateLimitPolicy {
+	return RateLimitPolicy{
+		Name:  "ip",
+		Limit: limit,
+		Key: func(c *gin.Context) string {
+			return c.ClientIP()
+		},
+	}
+}
+
+// RateLimitByEmail limits requests targeting the same email in JSON body.
+// Body is restored to be bound again by the handler.
+func RateLimitByEmail(limit utils.RateLimit) RateLimitPolicy {
+	return RateLimitPolicy{
+		Name:  "email",
+		Limit: limit,
+		Key: func(c *gin.Context) string {
+			if c.Request.Body == nil {
+				return ""
+			}
+			body, err := ioutil.ReadAll(
+				http.MaxBytesReader(c.Writer, c.Request.Body, maxRateLimitBodySize))
+			c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+			if err != nil {
+				return ""
+			}
+
+			var param struct {
+				Email string `json:"email"`
+			}
+			if err := json.Unmarshal(body, &param); err != nil {
+				return ""
+			}
+			return strings.ToLower(strings.TrimSpace(param.Email))
+		},
+	}
+}
+
+// RateLimitByUser limits requests of the same authorized user.
+// It has to be used after Authorize.
+func RateLimitByUser(limit utils.RateLimit) RateLimitPolicy {
+	return RateLimitPolicy{
+		Name:  "user",
+		Limit: limit,
+		Key: func(c *gin.Context) string {
+			user, err := AuthorizedUser(c)
+			if err != nil {
+				return ""
+			}
+			return strconv.FormatUint(uint64(user.ID), 10)
+		},
+	}
+}
+
+// newRateLimitStore returns the store set in configs.
+func newRateLimitStore() utils.RateLimitStore {
+	conf, err := configs.RateLimit()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if conf.Store == configs.RateLimitRedisStore {
+		return utils.NewRedisRateLimitStore(
+			conf.RedisAddr, conf.RedisPassword, conf.RedisDB, conf.Prefix)
+	}
+	return utils.NewMemoryRateLimitStore()
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// setRateLimitHeaders sets headers of IETF draft.
+// reference - https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/
+func setRateLimitHeaders(c *gin.Context, res utils.RateLimitResult) {
+	c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	c.Header("RateLimit-Reset", ceilSeconds(res.Reset))
+}
+
+// RateLimit takes a token of each policy and aborts if any is empty.
+// 'scope' separates buckets of the same key by routes.
+// Headers are of the policy with the least remaining.
+// If the store fails, the request is not limited.
+func RateLimit(store utils.RateLimitStore, scope string, policies ...RateLimitPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var least *utils.RateLimitResult
+		for _, p := range policies {
+			key := p.Key(c)
+			if key == "" {
+				continue
+			}
+
+			res, err := store.Take(scope+":"+p.Name+":"+key, p.Limit)
+			if err != nil {
+				Logger(c).With("error", err).Errorf(
+					"failed take rate limit token of '%s'", scope+":"+p.Name)
+				continue
+			}
+
+			if !res.Allowed {
+				setRateLimitHeaders(c, res)
+				c.Header("Retry-After", ceilSeconds(res.RetryAfter))
+				c.AbortWithStatusJSON(
+					http.StatusTooManyRequests,
+					NewErrRes(ErrorCodeRateLimited))
+				return
+			}
+
+			if least == nil || res.Remaining < least.Remaining {
+				least = &res
+			}
+		}
+
+		if least != nil {
+			setRateLimitHeaders(c, *least)
+		}
+		c.Next()
+	}
+}
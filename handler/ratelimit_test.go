@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+func rateLimitRouterForTest(middleware ...gin.HandlerFunc) *gin.Engine {
+	router := gin.New()
+	_ = router.SetTrustedProxies(nil)
+	router.Use(middleware...)
+	router.POST("/", func(c *gin.Context) {
+		var param SendEmailParam
+		if err := c.ShouldBindJSON(&param); err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				NewErrResWithErr(ErrorCodeBindJSON, err))
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func TestRateLimit(t *testing.T) {
+	limit := utils.RateLimit{Limit: 2, Period: time.Minute}
+	router := rateLimitRouterForTest(RateLimit(
+		utils.NewMemoryRateLimitStore(), "test", RateLimitByIP(limit)))
+
+	const remoteAddr = "192.0.2.1:1234"
+	param := SendEmailParam{Email: testEmail(), Subject: "subject", Body: "body"}
+	for i := 1; i >= 0; i-- {
+		w := requestFromForTest(router, remoteAddr, param)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, strconv.Itoa(i), w.Header().Get("RateLimit-Remaining"))
+	}
+
+	w := requestFromForTest(router, remoteAddr, param)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, ErrorCodeRateLimited, errCodeForTest(t, w))
+
+	// 'X-Forwarded-For' 로 IP 를 바꿀 수 없다.
+	body, err := json.Marshal(param)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/", bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("X-Forwarded-For", "192.0.2.3")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// 다른 IP 는 따로 센다.
+	w = requestFromForTest(router, "192.0.2.2:1234", param)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// IP 를 알 수 없으면 제한하지 않는다.
+	w = requestFromForTest(router, "", param)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitByEmail(t *testing.T) {
+	router := New(testDBCon)
+	param := SendEmailParam{
+		Email:   testEmail(),
+		Subject: resetPasswordEmailSubject,
+		Body:    resetPasswordEmailBodyTmpl,
+	}
+	for i := 0; i < toEmailRateLimit.Limit; i++ {
+		w := jsonRequestForTest(router, "POST", "/email/reset_password", param, nil)
+		// 본문은 handler 에서 다시 읽을 수 있다.
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, ErrorCodeNotFoundUser, errCodeForTest(t, w))
+	}
+
+	w := jsonRequestForTest(router, "POST", "/email/reset_password", param, nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// 대소문자만 다른 주소도 같은 주소로 센다.
+	param.Email = strings.ToUpper(param.Email)
+	w = jsonRequestForTest(router, "POST", "/email/reset_password", param, nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func TestRateLimitByEmailWithLargeBody(t *testing.T) {
+	limit := utils.RateLimit{Limit: 1, Period: time.Minute}
+	router := rateLimitRouterForTest(RateLimit(
+		utils.NewMemoryRateLimitStore(), "test", RateLimitByEmail(limit)))
+
+	// 너무 큰 본문은 끝까지 읽지 않고, handler 에서 잘못된 요청이 된다.
+	param := SendEmailParam{
+		Email:   testEmail(),
+		Subject: "subject",
+		Body:    strings.Repeat("a", maxRateLimitBodySize),
+	}
+	for i := 0; i < 2; i++ {
+		w := requestFromForTest(router, "", param)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, ErrorCodeBindJSON, errCodeForTest(t, w))
+	}
+}
+
+func TestRateLimitByUser(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	other, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	var authorized *db.User
+	limit := utils.RateLimit{Limit: 1, Period: time.Minute}
+	router := rateLimitRouterForTest(
+		func(c *gin.Context) {
+			if authorized != nil {
+				c.Set("AuthorizedUser", *authorized)
+			}
+		},
+		RateLimit(utils.NewMemoryRateLimitStore(), "test", RateLimitByUser(limit)))
+
+	param := SendEmailParam{Email: testEmail(), Subject: "subject", Body: "body"}
+	authorized = user
+	w := jsonRequestForTest(router, "POST", "/", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = jsonRequestForTest(router, "POST", "/", param, nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	authorized = other
+	w = jsonRequestForTest(router, "POST", "/", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimitWithRedis(t *testing.T) {
+	m := miniredis.RunT(t)
+
+	limit := utils.RateLimit{Limit: 1, Period: time.Minute}
+	store := utils.NewRedisRateLimitStore(m.Addr(), "", 0, "test:")
+	router := rateLimitRouterForTest(
+		RateLimit(store, "test", RateLimitByEmail(limit)))
+
+	param := SendEmailParam{Email: testEmail(), Subject: "subject", Body: "body"}
+	w := jsonRequestForTest(router, "POST", "/", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = jsonRequestForTest(router, "POST", "/", param, nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// 저장소에 문제가 있으면 제한하지 않는다.
+	m.Close()
+	param.Email = testEmail()
+	w = jsonRequestForTest(router, "POST", "/", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
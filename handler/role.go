@@ -0,0 +1,376 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/db"
+)
+
+// CreateRoleParam .
+type CreateRoleParam struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// RolePermissionsParam .
+// Empty 'Permissions' takes every permission from the role.
+type RolePermissionsParam struct {
+	Permissions []string `json:"permissions"`
+}
+
+func findRoleOrAbort(c *gin.Context, con *gorm.DB) *db.Role {
+	role := db.FindRole(con, c.Param("role"))
+	if role == nil {
+		c.AbortWithStatusJSON(
+			http.StatusNotFound,
+			NewErrRes(ErrorCodeNotFoundRole))
+		return nil
+	}
+	return role
+}
+
+func abortWithRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, db.ErrorInvalidRoleName):
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidRoleName))
+	case errors.Is(err, db.ErrorRoleAlreadyExists):
+		c.AbortWithStatusJSON(
+			http.StatusConflict,
+			NewErrRes(ErrorCodeRoleAlreadyExists))
+	case errors.Is(err, db.ErrorUnknownPermission):
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeUnknownPermission))
+	case errors.Is(err, db.ErrorBuiltinRole):
+		c.AbortWithStatusJSON(
+			http.StatusForbidden,
+			NewErrRes(ErrorCodeBuiltinRole))
+	case errors.Is(err, db.ErrorLastSuperuser):
+		c.AbortWithStatusJSON(
+			http.StatusConflict,
+			NewErrRes(ErrorCodeLastSuperuser))
+	default:
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+	}
+}
+
+// isAbortedAsNotGrantable aborts unless the requester has every permission of the role,
+// so that nobody gets more permissions than they have by managing roles.
+// Only superuser can manage superuser, and service account can not give any permission.
+func isAbortedAsNotGrantable(c *gin.Context, con *gorm.DB, role *db.Role) bool {
+	if role.Name != db.SuperuserRole && len(role.Permissions) == 0 {
+		return false
+	}
+	return isAbortedAsNotGranted(c, con,
+		role.Name == db.SuperuserRole, role.Permissions, ErrorCodeNotGrantableRole)
+}
+
+// isAbortedAsNotDeletable aborts unless the requester can grant every role of the user,
+// so that nobody deletes users having more permissions than they have.
+func isAbortedAsNotDeletable(c *gin.Context, con *gorm.DB, user *db.User) bool {
+	roles, err := db.UserRoles(con, user.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return true
+	}
+	for i := range roles {
+		if isAbortedAsNotGrantable(c, con, &roles[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAbortedAsNotGranted aborts with the error code unless the requester has every permission,
+// or unless the requester is superuser if 'superuser' is true.
+// Service account is always aborted, since it can not give any permission.
+func isAbortedAsNotGranted(c *gin.Context, con *gorm.DB, superuser bool, permissions []string, code int) bool {
+	abort := func() {
+		c.AbortWithStatusJSON(
+			http.StatusForbidden,
+			NewErrRes(code))
+	}
+	if _, ok := AuthorizedServiceAccount(c); ok {
+		abort()
+		return true
+	}
+
+	user, err := AuthorizedUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeAuthorizedUser, err))
+		return true
+	}
+
+	roles, err := db.UserRoles(con, user.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return true
+	}
+
+	for _, r := range roles {
+		if r.Name == db.SuperuserRole {
+			return false
+		}
+	}
+	if superuser {
+		abort()
+		return true
+	}
+
+	granted := func(permission string) bool {
+		for i := range roles {
+			if roles[i].Grants(permission) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, p := range permissions {
+		if !granted(p) {
+			abort()
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions .
+func Permissions(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	permissions, err := db.Permissions(con)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"permissions": permissions})
+}
+
+// Roles .
+func Roles(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	roles, err := db.Roles(con)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// Role .
+func Role(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	role := findRoleOrAbort(c, con)
+	if role == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// CreateRole creates a new role with the permissions.
+// The requester must have the permissions.
+func CreateRole(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param CreateRoleParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	role := db.Role{
+		Name:        param.Name,
+		Description: param.Description,
+		Permissions: param.Permissions,
+	}
+	if isAbortedAsNotGrantable(c, con, &role) {
+		return
+	}
+
+	if err := role.Create(con); err != nil {
+		abortWithRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// SetRolePermissions replaces the permissions of the role.
+// The requester must have the permissions the role has and will have.
+func SetRolePermissions(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param RolePermissionsParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	role := findRoleOrAbort(c, con)
+	if role == nil {
+		return
+	}
+
+	if role.Builtin {
+		abortWithRoleError(c, db.ErrorBuiltinRole)
+		return
+	}
+	next := db.Role{Name: role.Name, Permissions: param.Permissions}
+	if isAbortedAsNotGrantable(c, con, role) || isAbortedAsNotGrantable(c, con, &next) {
+		return
+	}
+
+	if err := role.SetPermissions(con, param.Permissions); err != nil {
+		abortWithRoleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole deletes the role, users having it lose its permissions.
+func DeleteRole(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	role := findRoleOrAbort(c, con)
+	if role == nil {
+		return
+	}
+
+	if role.Builtin {
+		abortWithRoleError(c, db.ErrorBuiltinRole)
+		return
+	}
+	if isAbortedAsNotGrantable(c, con, role) {
+		return
+	}
+
+	if err := role.Delete(con); err != nil {
+		abortWithRoleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UserRoles returns roles of the user with their permissions.
+func UserRoles(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	user := findUserByEmailOrAbort(
+		c.Param("email"), c, con, http.StatusNotFound)
+	if user == nil {
+		return
+	}
+
+	roles, err := db.UserRoles(con, user.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// AssignRole gives the role to the user.
+// Session token of the user has the role from next signin or renewal.
+func AssignRole(c *gin.Context) {
+	setUserRole(c, true)
+}
+
+// UnassignRole takes the role from the user.
+// The permissions are not granted from next request,
+// even with session token issued before.
+func UnassignRole(c *gin.Context) {
+	setUserRole(c, false)
+}
+
+func setUserRole(c *gin.Context, assign bool) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	// 삭제된 사용자의 역할은 바꾸지 않는다.
+	user := findUserByEmail(c.Param("email"), con)
+	if user == nil {
+		c.AbortWithStatusJSON(
+			http.StatusNotFound,
+			NewErrRes(ErrorCodeNotFoundUser))
+		return
+	}
+	setAuditTarget(c, user)
+
+	role := findRoleOrAbort(c, con)
+	if role == nil {
+		return
+	}
+
+	if isAbortedAsNotGrantable(c, con, role) {
+		return
+	}
+
+	var err error
+	if assign {
+		err = role.Assign(con, user.ID)
+	} else {
+		err = role.Unassign(con, user.ID)
+	}
+	if err != nil {
+		abortWithRoleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
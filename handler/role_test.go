@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+func newRoleForTest(t *testing.T, permissions ...string) *db.Role {
+	role := db.Role{
+		Name:        "role-" + uuid.New().String()[:8],
+		Permissions: permissions,
+	}
+	assert.NoError(t, role.Create(testDBCon))
+	return &role
+}
+
+func TestRequiredPermissionsAreSeeded(t *testing.T) {
+	New(testDBCon)
+	names, err := db.PermissionNames(testDBCon)
+	assert.NoError(t, err)
+
+	count := 0
+	requiredPermissions.Range(func(k, v interface{}) bool {
+		count++
+		assert.Contains(t, names, k)
+		// 서비스 계정에 줄 수 있는 scope 가 정해져 있어야 한다.
+		assert.Contains(t, permissionScopes, k)
+		return true
+	})
+	assert.NotZero(t, count)
+}
+
+func TestRequirePermission(t *testing.T) {
+	router := New(testDBCon)
+
+	target, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	userPath := fmt.Sprintf("/admin/users/%s", target.Email)
+
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	w := jsonRequestForTest(router, "GET", userPath, nil, user)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 사용자를 볼 수만 있는 지원 담당자
+	support := newRoleForTest(t, "users:read", "otp:reset")
+	assert.NoError(t, support.Assign(testDBCon, user.ID))
+
+	w = jsonRequestForTest(router, "GET", userPath, nil, user)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = jsonRequestForTest(router, "DELETE", userPath+"/otp", nil, user)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = jsonRequestForTest(router, "DELETE", userPath, nil, user)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = jsonRequestForTest(router, "GET", "/admin/jwt_keys", nil, user)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 역할을 빼면 이전에 받은 세션 토큰으로도 권한이 없다.
+	assert.NoError(t, support.Unassign(testDBCon, user.ID))
+	w = jsonRequestForTest(router, "GET", userPath, nil, user)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	w = jsonRequestForTest(router, "DELETE", userPath, nil, admin)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestRoles(t *testing.T) {
+	router := New(testDBCon)
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+
+	name := "support-" + uuid.New().String()[:8]
+	w := jsonRequestForTest(router, "POST", "/admin/roles", CreateRoleParam{
+		Name:        name,
+		Description: "support staff",
+		Permissions: []string{"users:read"},
+	}, admin)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created db.JSONRole
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, name, created.Name)
+	assert.Equal(t, []string{"users:read"}, created.Permissions)
+
+	w = jsonRequestForTest(router, "POST", "/admin/roles", CreateRoleParam{Name: name}, admin)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, ErrorCodeRoleAlreadyExists, errCodeForTest(t, w))
+
+	w = jsonRequestForTest(router, "POST", "/admin/roles", CreateRoleParam{
+		Name: name + "-x", Permissions: []string{"unknown:read"},
+	}, admin)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrorCodeUnknownPermission, errCodeForTest(t, w))
+
+	w = jsonRequestForTest(router, "PUT", "/admin/roles/"+name+"/permissions", RolePermissionsParam{
+		Permissions: []string{"users:read", "signin_locks:read"},
+	}, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = jsonRequestForTest(router, "GET", "/admin/roles/"+name, nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var found db.JSONRole
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&found))
+	assert.Equal(t, []string{"signin_locks:read", "users:read"}, found.Permissions)
+
+	w = jsonRequestForTest(router, "GET", "/admin/roles", nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var roles struct {
+		Roles []db.JSONRole `json:"roles"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&roles))
+	assert.NotEmpty(t, roles.Roles)
+
+	w = jsonRequestForTest(router, "GET", "/admin/permissions", nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var permissions struct {
+		Permissions []db.JSONPermission `json:"permissions"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&permissions))
+	assert.NotEmpty(t, permissions.Permissions)
+
+	// 기본 역할은 바꾸거나 지울 수 없다.
+	w = jsonRequestForTest(router, "PUT", "/admin/roles/superuser/permissions", RolePermissionsParam{}, admin)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, ErrorCodeBuiltinRole, errCodeForTest(t, w))
+	w = jsonRequestForTest(router, "DELETE", "/admin/roles/superuser", nil, admin)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, ErrorCodeBuiltinRole, errCodeForTest(t, w))
+
+	w = jsonRequestForTest(router, "DELETE", "/admin/roles/"+name, nil, admin)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = jsonRequestForTest(router, "GET", "/admin/roles/"+name, nil, admin)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ErrorCodeNotFoundRole, errCodeForTest(t, w))
+}
+
+func TestAssignRole(t *testing.T) {
+	router := New(testDBCon)
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	role := newRoleForTest(t, "users:read")
+	rolesPath := fmt.Sprintf("/admin/users/%s/roles", user.Email)
+
+	w := jsonRequestForTest(router, "PUT", rolesPath+"/"+role.Name, nil, admin)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = jsonRequestForTest(router, "PUT", rolesPath+"/unknown", nil, admin)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = jsonRequestForTest(router, "GET", rolesPath, nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var roles struct {
+		Roles []db.JSONRole `json:"roles"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&roles))
+	assert.Len(t, roles.Roles, 1)
+	assert.Equal(t, role.Name, roles.Roles[0].Name)
+
+	// 세션 토큰에 역할이 담긴다.
+	signinRes, err := signinForTest(router, user.Email, testPassword)
+	assert.NoError(t, err)
+	key, err := JWTKey()
+	assert.NoError(t, err)
+	claims, err := utils.ParseSessionJWT(signinRes.Token, key)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{role.Name}, claims.Roles)
+
+	w = jsonRequestForTest(router, "DELETE", rolesPath+"/"+role.Name, nil, admin)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	names, err := db.UserRoleNames(testDBCon, user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestAssignRoleNotGrantable(t *testing.T) {
+	router := New(testDBCon)
+	manager, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	assert.NoError(t, newRoleForTest(t, "roles:assign", "roles:write", "users:read").
+		Assign(testDBCon, manager.ID))
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	rolesPath := fmt.Sprintf("/admin/users/%s/roles", user.Email)
+
+	// 가진 권한 안에서만 역할을 줄 수 있다.
+	w := jsonRequestForTest(router, "PUT", rolesPath+"/"+newRoleForTest(t, "users:read").Name, nil, manager)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = jsonRequestForTest(router, "PUT", rolesPath+"/"+newRoleForTest(t, "users:delete").Name, nil, manager)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, ErrorCodeNotGrantableRole, errCodeForTest(t, w))
+
+	w = jsonRequestForTest(router, "PUT", rolesPath+"/"+db.SuperuserRole, nil, manager)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, ErrorCodeNotGrantableRole, errCodeForTest(t, w))
+
+	// 서비스 계정은 권한을 줄 수 없다.
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	account, err := createServiceAccountForTest(router, admin, "roles:write")
+	assert.NoError(t, err)
+	accessToken := serviceAccessTokenForTest(
+		t, router, account.ServiceAccount.ClientID, account.ClientSecret)
+	w = adminRequestWithAccessToken(
+		router, "PUT", rolesPath+"/"+newRoleForTest(t, "users:read").Name, accessToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, ErrorCodeNotGrantableRole, errCodeForTest(t, w))
+
+	// 자기 역할에 권한을 더할 수도 없다.
+	w = jsonRequestForTest(router, "POST", "/admin/roles", CreateRoleParam{
+		Name: "role-" + uuid.New().String()[:8], Permissions: []string{"users:delete"},
+	}, manager)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, ErrorCodeNotGrantableRole, errCodeForTest(t, w))
+}
@@ -2,29 +2,187 @@ package handler
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 
 	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/utils"
 )
 
-func bind(r *gin.Engine) {
+// Rate limits of routes.
+// Sending email is limited by target email too, not to spam the address.
+var (
+	signinRateLimit    = utils.RateLimit{Limit: 20, Period: time.Minute}
+	sendEmailRateLimit = utils.RateLimit{Limit: 10, Period: time.Hour}
+	toEmailRateLimit   = utils.RateLimit{Limit: 5, Period: time.Hour}
+	publicRateLimit    = utils.RateLimit{Limit: 60, Period: time.Minute}
+	userRateLimit      = utils.RateLimit{Limit: 120, Period: time.Minute}
+)
+
+// Audit actions of routes, the key is method and path of the route.
+// Requests to routes not in here are not recorded.
+var auditActions = map[string]string{
+	"GET /admin/users":                       "admin.users.read",
+	"GET /admin/users/:email":                "admin.user.read",
+	"DELETE /admin/users/:email":             "admin.user.delete",
+	"DELETE /admin/users/:email/otp":         "admin.otp.reset",
+	"GET /admin/users/:email/signin_lock":    "admin.signin_lock.read",
+	"DELETE /admin/users/:email/signin_lock": "admin.signin_lock.clear",
+	"GET /admin/users/:email/roles":          "admin.user_roles.read",
+	"PUT /admin/users/:email/roles/:role":    "admin.role.assign",
+	"DELETE /admin/users/:email/roles/:role": "admin.role.unassign",
+
+	"GET /admin/permissions":             "admin.permissions.read",
+	"GET /admin/roles":                   "admin.roles.read",
+	"POST /admin/roles":                  "admin.role.create",
+	"GET /admin/roles/:role":             "admin.role.read",
+	"PUT /admin/roles/:role/permissions": "admin.role.set_permissions",
+	"DELETE /admin/roles/:role":          "admin.role.delete",
+
+	"GET /admin/jwt_keys":              "admin.jwt_keys.read",
+	"POST /admin/jwt_keys":             "admin.jwt_key.create",
+	"PUT /admin/jwt_keys/:kid/signing": "admin.jwt_key.promote",
+	"DELETE /admin/jwt_keys/:kid":      "admin.jwt_key.retire",
+
+	"GET /admin/oauth_clients":               "admin.oauth_clients.read",
+	"POST /admin/oauth_clients":              "admin.oauth_client.create",
+	"GET /admin/oauth_clients/:client_id":    "admin.oauth_client.read",
+	"DELETE /admin/oauth_clients/:client_id": "admin.oauth_client.delete",
+
+	"GET /admin/service_accounts":                        "admin.service_accounts.read",
+	"POST /admin/service_accounts":                       "admin.service_account.create",
+	"GET /admin/service_accounts/:client_id":             "admin.service_account.read",
+	"PUT /admin/service_accounts/:client_id/secret":      "admin.service_account.rotate_secret",
+	"PUT /admin/service_accounts/:client_id/disabled":    "admin.service_account.disable",
+	"DELETE /admin/service_accounts/:client_id/disabled": "admin.service_account.enable",
+
+	"GET /admin/webhooks":                                                 "admin.webhooks.read",
+	"POST /admin/webhooks":                                                "admin.webhook.create",
+	"GET /admin/webhooks/:webhook_id":                                     "admin.webhook.read",
+	"DELETE /admin/webhooks/:webhook_id":                                  "admin.webhook.delete",
+	"GET /admin/webhooks/:webhook_id/deliveries":                          "admin.webhook_deliveries.read",
+	"GET /admin/webhooks/:webhook_id/deliveries/:delivery_id":             "admin.webhook_delivery.read",
+	"POST /admin/webhooks/:webhook_id/deliveries/:delivery_id/redelivery": "admin.webhook_delivery.redeliver",
+
+	"GET /admin/audit": "admin.audit.read",
+
+	"GET /users/:email":                            "user.read",
+	"DELETE /users/:email":                         "user.delete",
+	"PUT /users/:email/password":                   "password.change",
+	"POST /users/:email/otp":                       "otp.generate",
+	"PUT /users/:email/otp":                        "otp.confirm",
+	"DELETE /users/:email/otp":                     "otp.reset",
+	"POST /users/:email/webauthn/challenge":        "webauthn.registration_options",
+	"GET /users/:email/webauthn":                   "webauthn.credentials.read",
+	"POST /users/:email/webauthn":                  "webauthn.register",
+	"DELETE /users/:email/webauthn/:credential_id": "webauthn.delete",
+	"PUT /users/:email/session":                    "session.renew",
+	"GET /users/:email/activity":                   "user.activity.read",
+
+	"GET /signup/email/verification/:token":         "signup.verify_token",
+	"POST /signup/email/verification":               "signup.send_email",
+	"POST /signup":                                  "signup",
+	"GET /reset_password/email/verification/:token": "password.verify_reset_token",
+	"POST /reset_password":                          "password.reset",
+	"POST /email/reset_password":                    "password.send_reset_email",
+
+	"POST /signin":                         "signin",
+	"POST /signin/webauthn/challenge":      "signin.webauthn_options",
+	"POST /signin/webauthn":                "signin.webauthn",
+	"POST /signin/email_code":              "signin.send_email_code",
+	"POST /signin/email_code/verification": "signin.email_code",
+	"POST /signin/magic_link":              "signin.send_magic_link",
+	"POST /signin/magic_link/verification": "signin.magic_link",
+	"POST /signin/unlock":                  "signin.send_unlock_email",
+	"POST /signin/unlock/verification":     "signin.unlock",
+	"POST /token/refresh":                  "token.refresh",
+
+	"GET /oauth/authorize":   "oauth.authorize",
+	"POST /oauth/authorize":  "oauth.consent",
+	"POST /oauth/token":      "oauth.token",
+	"POST /oauth/introspect": "oauth.introspect",
+	"POST /oauth/revoke":     "oauth.revoke",
+
+	"GET /userinfo":  "userinfo.read",
+	"POST /userinfo": "userinfo.read",
+}
+
+func bind(r *gin.Engine, store utils.RateLimitStore, ready *readiness) {
+	limitSignin := RateLimit(store, "signin", RateLimitByIP(signinRateLimit))
+	limitSendEmail := RateLimit(store, "email",
+		RateLimitByIP(sendEmailRateLimit), RateLimitByEmail(toEmailRateLimit))
+	limitPublic := RateLimit(store, "public", RateLimitByIP(publicRateLimit))
+	limitUser := RateLimit(store, "user", RateLimitByUser(userRateLimit))
+
 	admin := r.Group("/admin")
+	admin.Use(AuthorizeServiceAccount())
 	admin.Use(Authorize())
-	admin.Use(AuthorizedUserIsAdmin())
 	{
 		users := admin.Group("users")
-		users.GET("", Users)
-		users.GET("/:email", User)
-		users.DELETE("/:email", DeleteUser)
-		users.DELETE("/:email/otp", ResetOTP)
+		users.GET("", RequirePermission("users:read"), Users)
+		users.GET("/:email", RequirePermission("users:read"), User)
+		users.DELETE("/:email", RequirePermission("users:delete"), DeleteUser)
+		users.DELETE("/:email/otp", RequirePermission("otp:reset"), ResetOTP)
+		users.GET("/:email/signin_lock", RequirePermission("signin_locks:read"), SigninLock)
+		users.DELETE("/:email/signin_lock", RequirePermission("signin_locks:clear"), ClearSigninLock)
+		users.GET("/:email/roles", RequirePermission("roles:read"), UserRoles)
+		users.PUT("/:email/roles/:role", RequirePermission("roles:assign"), AssignRole)
+		users.DELETE("/:email/roles/:role", RequirePermission("roles:assign"), UnassignRole)
+
+		roles := admin.Group("roles")
+		roles.GET("", RequirePermission("roles:read"), Roles)
+		roles.POST("", RequirePermission("roles:write"), CreateRole)
+		roles.GET("/:role", RequirePermission("roles:read"), Role)
+		roles.PUT("/:role/permissions", RequirePermission("roles:write"), SetRolePermissions)
+		roles.DELETE("/:role", RequirePermission("roles:write"), DeleteRole)
+		admin.GET("/permissions", RequirePermission("roles:read"), Permissions)
+
+		jwtKeys := admin.Group("jwt_keys")
+		jwtKeys.GET("", RequirePermission("jwt_keys:read"), JWTKeys)
+		jwtKeys.POST("", RequirePermission("jwt_keys:write"), CreateJWTKey)
+		jwtKeys.PUT("/:kid/signing", RequirePermission("jwt_keys:write"), PromoteJWTKey)
+		jwtKeys.DELETE("/:kid", RequirePermission("jwt_keys:write"), RetireJWTKey)
+
+		oauthClients := admin.Group("oauth_clients")
+		oauthClients.GET("", RequirePermission("oauth_clients:read"), OAuthClients)
+		oauthClients.POST("", RequirePermission("oauth_clients:write"), CreateOAuthClient)
+		oauthClients.GET("/:client_id", RequirePermission("oauth_clients:read"), OAuthClient)
+		oauthClients.DELETE("/:client_id", RequirePermission("oauth_clients:write"), DeleteOAuthClient)
+
+		serviceAccounts := admin.Group("service_accounts")
+		serviceAccounts.GET("", RequirePermission("service_accounts:read"), ServiceAccounts)
+		serviceAccounts.POST("", RequirePermission("service_accounts:write"), CreateServiceAccount)
+		serviceAccounts.GET("/:client_id", RequirePermission("service_accounts:read"), ServiceAccount)
+		serviceAccounts.PUT("/:client_id/secret",
+			RequirePermission("service_accounts:write"), RotateServiceAccountSecret)
+		serviceAccounts.PUT("/:client_id/disabled",
+			RequirePermission("service_accounts:write"), DisableServiceAccount)
+		serviceAccounts.DELETE("/:client_id/disabled",
+			RequirePermission("service_accounts:write"), EnableServiceAccount)
+
+		webhooks := admin.Group("webhooks")
+		webhooks.GET("", RequirePermission("webhooks:read"), Webhooks)
+		webhooks.POST("", RequirePermission("webhooks:write"), CreateWebhook)
+		webhooks.GET("/:webhook_id", RequirePermission("webhooks:read"), Webhook)
+		webhooks.DELETE("/:webhook_id", RequirePermission("webhooks:write"), DeleteWebhook)
+		webhooks.GET("/:webhook_id/deliveries", RequirePermission("webhooks:read"), WebhookDeliveries)
+		webhooks.GET("/:webhook_id/deliveries/:delivery_id",
+			RequirePermission("webhooks:read"), WebhookDelivery)
+		webhooks.POST("/:webhook_id/deliveries/:delivery_id/redelivery",
+			RequirePermission("webhooks:write"), RedeliverWebhook)
+
+		admin.GET("/audit", RequirePermission("audit:read"), AuditEvents)
 	}
 
 	users := r.Group("/users")
 	users.Use(Authorize())
 	users.Use(RequesterIsAuthorizedUser())
+	users.Use(limitUser)
 	{
 		users.GET("/:email", User)
 		users.DELETE("/:email", DeleteUser)
@@ -34,22 +192,66 @@ func bind(r *gin.Engine) {
 		users.PUT("/:email/otp", ConfirmOTP)
 		users.DELETE("/:email/otp", ResetOTP)
 
+		users.POST("/:email/webauthn/challenge", WebAuthnRegistrationOptions)
+		users.GET("/:email/webauthn", WebAuthnCredentials)
+		users.POST("/:email/webauthn", RegisterWebAuthnCredential)
+		users.DELETE("/:email/webauthn/:credential_id", DeleteWebAuthnCredential)
+
 		users.PUT("/:email/session", RenewSession)
+
+		users.GET("/:email/activity", UserActivity)
 	}
 
 	signup := r.Group("/signup")
 	{
-		signup.GET("/email/verification/:token", VerifySignupToken)
-		signup.POST("/email/verification", SendVerificationEmail)
-		signup.POST("", Signup)
+		signup.GET("/email/verification/:token", limitPublic, VerifySignupToken)
+		signup.POST("/email/verification", limitSendEmail, SendVerificationEmail)
+		signup.POST("", limitPublic, Signup)
 	}
 
-	r.POST("/email/reset_password", SendResetPasswordEmail)
-	r.POST("/signin", Signin)
+	resetPassword := r.Group("/reset_password")
+	{
+		resetPassword.GET("/email/verification/:token", limitPublic, VerifyResetPasswordToken)
+		resetPassword.POST("", limitSignin, ResetPassword)
+	}
+
+	r.POST("/email/reset_password", limitSendEmail, SendResetPasswordEmail)
+	r.POST("/signin", limitSignin, Signin)
+	r.POST("/signin/webauthn/challenge", limitPublic, WebAuthnSigninOptions)
+	r.POST("/signin/webauthn", limitSignin, SigninWithWebAuthn)
+	r.POST("/signin/email_code", limitSendEmail, SendEmailCode)
+	r.POST("/signin/email_code/verification", limitSignin, SigninWithEmailCode)
+	r.POST("/signin/magic_link", limitSendEmail, SendMagicLinkEmail)
+	r.POST("/signin/magic_link/verification", limitSignin, SigninWithMagicLink)
+	r.POST("/signin/unlock", limitSendEmail, SendSigninUnlockEmail)
+	r.POST("/signin/unlock/verification", limitSignin, SigninUnlock)
+	r.POST("/token/refresh", limitPublic, RefreshToken)
+
+	oauth := r.Group("/oauth")
+	{
+		oauth.GET("/authorize", Authorize(), limitUser, OAuthAuthorize)
+		oauth.POST("/authorize", Authorize(), limitUser, OAuthConsent)
+		oauth.POST("/token", limitPublic, OAuthToken)
+		oauth.POST("/introspect", limitPublic, IntrospectToken)
+		oauth.POST("/revoke", limitPublic, RevokeToken)
+	}
+
+	userinfo := r.Group("/userinfo")
+	userinfo.Use(limitPublic)
+	userinfo.Use(AuthorizeAccessToken())
+	{
+		userinfo.GET("", UserInfo)
+		userinfo.POST("", UserInfo)
+	}
+
+	r.GET("/healthz", Healthz)
+	r.GET("/readyz", ready.Readyz)
+	r.GET("/.well-known/jwks.json", limitPublic, JWKS)
+	r.GET("/.well-known/openid-configuration", limitPublic, OpenIDConfiguration)
 }
 
-// New .
-func New() http.Handler {
+// New returns the handler using the connection pool for every request.
+func New(con *gorm.DB) http.Handler {
 	mode := configs.Mode()
 	gin.SetMode(mode)
 
@@ -60,14 +262,21 @@ func New() http.Handler {
 	}
 
 	router := gin.New()
+	// 신뢰하는 프록시가 아니면 'X-Forwarded-For' 를 무시하고 접속한 주소를 클라이언트 IP 로 쓴다.
+	if err := router.SetTrustedProxies(configs.App().TrustedProxies()); err != nil {
+		log.Fatalln(err)
+	}
+	router.Use(RequestID())
+	router.Use(Trace())
+	router.Use(RequestMetrics())
 	if mode != configs.TestMode {
-		router.Use(LogFormat())
-		router.Use(RequestID())
+		router.Use(AccessLog())
 		router.Use(gin.Recovery())
 	}
 
-	router.Use(DBConnection())
-	bind(router)
+	router.Use(DBConnection(con))
+	router.Use(Audit(con))
+	bind(router, newRateLimitStore(), newReadiness(con))
 
 	if mode == configs.DebugMode {
 		pprof.Register(router)
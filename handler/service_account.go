@@ -0,0 +1,347 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+// Service account scope is '<admin resource>:<read|write>'.
+// e.g. 'users:read' allows routes requiring 'users:read' permission.
+const (
+	scopeActionRead  = "read"
+	scopeActionWrite = "write"
+)
+
+var adminResources = []string{
+	"users", "otp", "signin_locks", "roles", "jwt_keys",
+	"oauth_clients", "service_accounts", "webhooks", "audit",
+}
+
+// permissionScopes are scopes allowing service account the permissions.
+// Permission not here is not allowed to any service account.
+var permissionScopes = map[string]string{
+	"users:read":             "users:read",
+	"users:delete":           "users:write",
+	"otp:reset":              "otp:write",
+	"signin_locks:read":      "signin_locks:read",
+	"signin_locks:clear":     "signin_locks:write",
+	"roles:read":             "roles:read",
+	"roles:write":            "roles:write",
+	"roles:assign":           "roles:write",
+	"jwt_keys:read":          "jwt_keys:read",
+	"jwt_keys:write":         "jwt_keys:write",
+	"oauth_clients:read":     "oauth_clients:read",
+	"oauth_clients:write":    "oauth_clients:write",
+	"service_accounts:read":  "service_accounts:read",
+	"service_accounts:write": "service_accounts:write",
+	"webhooks:read":          "webhooks:read",
+	"webhooks:write":         "webhooks:write",
+	"audit:read":             "audit:read",
+}
+
+// CreateServiceAccountParam .
+// 'Scope' is space separated list.
+type CreateServiceAccountParam struct {
+	Name  string `json:"name" binding:"required"`
+	Scope string `json:"scope"`
+}
+
+// ServiceAccountResponse .
+// 'ClientSecret' is shown only when the account is created or the secret is rotated.
+type ServiceAccountResponse struct {
+	ServiceAccount db.ServiceAccount `json:"service_account"`
+	ClientSecret   string            `json:"client_secret,omitempty"`
+}
+
+// validServiceAccountScope reports whether every scope is for admin resource.
+func validServiceAccountScope(scope string) bool {
+	for _, s := range strings.Fields(scope) {
+		v := strings.SplitN(s, ":", 2)
+		if len(v) != 2 || !hasScope(strings.Join(adminResources, " "), v[0]) {
+			return false
+		}
+		if v[1] != scopeActionRead && v[1] != scopeActionWrite {
+			return false
+		}
+	}
+	return true
+}
+
+// hasPermissionScope reports whether the scope allows the permission.
+func hasPermissionScope(scope, permission string) bool {
+	required, ok := permissionScopes[permission]
+	return ok && hasScope(scope, required)
+}
+
+// scopePermissions returns permissions the scope allows to service account.
+func scopePermissions(scope string) []string {
+	var permissions []string
+	for p := range permissionScopes {
+		if hasPermissionScope(scope, p) {
+			permissions = append(permissions, p)
+		}
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+// isAbortedAsNotGrantableScope aborts unless the requester has every permission the scope allows,
+// so that nobody gets more permissions than they have through service account.
+func isAbortedAsNotGrantableScope(c *gin.Context, con *gorm.DB, scope string) bool {
+	permissions := scopePermissions(scope)
+	if len(permissions) == 0 {
+		return false
+	}
+	return isAbortedAsNotGranted(c, con, false, permissions, ErrorCodeNotGrantableScope)
+}
+
+// AuthorizedServiceAccount returns the service account authorized by access token.
+func AuthorizedServiceAccount(c *gin.Context) (*db.ServiceAccount, bool) {
+	v, ok := c.Get("AuthorizedServiceAccount")
+	if !ok {
+		return nil, false
+	}
+	account, ok := v.(db.ServiceAccount)
+	return &account, ok
+}
+
+func findServiceAccountOrAbort(c *gin.Context, con *gorm.DB) *db.ServiceAccount {
+	account := db.FindServiceAccount(con, c.Param("client_id"))
+	if account == nil {
+		c.AbortWithStatusJSON(
+			http.StatusNotFound,
+			NewErrRes(ErrorCodeNotFoundServiceAccount))
+		return nil
+	}
+	return account
+}
+
+// setServiceAccountSecret sets new secret and returns it.
+func setServiceAccountSecret(account *db.ServiceAccount) (string, error) {
+	secret, err := utils.RandomToken(clientSecretLen)
+	if err != nil {
+		return "", err
+	}
+	if err := account.SetSecret(secret); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// clientCredentialsGrant issues access token for service account.
+// reference - https://tools.ietf.org/html/rfc6749#section-4.4
+func clientCredentialsGrant(c *gin.Context, con *gorm.DB, param *OAuthTokenParam) {
+	conf := configs.App()
+	account := db.FindServiceAccount(con, param.ClientID)
+	if account == nil || account.Disabled() || !account.VerifySecret(param.ClientSecret) {
+		abortWithOAuthError(c, http.StatusUnauthorized,
+			oauthErrorInvalidClient, "")
+		return
+	}
+
+	scope, ok := account.AllowedScope(param.Scope)
+	if !ok {
+		abortWithOAuthError(c, http.StatusBadRequest,
+			oauthErrorInvalidScope, errInvalidScope.Error())
+		return
+	}
+
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
+	token := utils.NewJWT(conf.SessionTokenExpire)
+	accessToken, err := token.ServiceAccess(
+		account.ClientID, scope, ring.SigningKey(), conf.IssuerURL())
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeSignJWT, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   tokenTypeBearer,
+		ExpiresIn:   conf.SessionTokenExpire,
+		Scope:       scope,
+	})
+}
+
+// ServiceAccounts .
+func ServiceAccounts(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var accounts []db.ServiceAccount
+	if err := con.Order("id desc").Find(&accounts).Error; err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"service_accounts": accounts})
+}
+
+// ServiceAccount .
+func ServiceAccount(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	account := findServiceAccountOrAbort(c, con)
+	if account == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// CreateServiceAccount creates a new service account.
+// The secret is shown only in this response.
+func CreateServiceAccount(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param CreateServiceAccountParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	if !validServiceAccountScope(param.Scope) {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidScope))
+		return
+	}
+
+	if isAbortedAsNotGrantableScope(c, con, param.Scope) {
+		return
+	}
+
+	clientID, err := utils.RandomToken(clientIDLen)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeGenerateServiceAccount, err))
+		return
+	}
+
+	account := db.ServiceAccount{
+		ClientID: clientID,
+		Name:     param.Name,
+		Scope:    strings.Join(strings.Fields(param.Scope), " "),
+	}
+	secret, err := setServiceAccountSecret(&account)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeGenerateServiceAccount, err))
+		return
+	}
+
+	if err := account.Save(con); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, ServiceAccountResponse{account, secret})
+}
+
+// RotateServiceAccountSecret replaces the secret.
+// The old secret can not get access token from now on.
+// The requester must have every permission the scope of the account allows.
+func RotateServiceAccountSecret(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	account := findServiceAccountOrAbort(c, con)
+	if account == nil {
+		return
+	}
+
+	if isAbortedAsNotGrantableScope(c, con, account.Scope) {
+		return
+	}
+
+	secret, err := setServiceAccountSecret(account)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeGenerateServiceAccount, err))
+		return
+	}
+
+	if err := account.Save(con); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, ServiceAccountResponse{*account, secret})
+}
+
+// DisableServiceAccount stops the account getting access token.
+// Access tokens already issued are rejected too.
+func DisableServiceAccount(c *gin.Context) {
+	setServiceAccountDisabled(c, true)
+}
+
+// EnableServiceAccount lets the disabled account get access token again.
+// The requester must have every permission the scope of the account allows.
+func EnableServiceAccount(c *gin.Context) {
+	setServiceAccountDisabled(c, false)
+}
+
+func setServiceAccountDisabled(c *gin.Context, disabled bool) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	account := findServiceAccountOrAbort(c, con)
+	if account == nil {
+		return
+	}
+
+	if disabled {
+		account.Disable()
+	} else {
+		if isAbortedAsNotGrantableScope(c, con, account.Scope) {
+			return
+		}
+		account.Enable()
+	}
+
+	if err := account.Save(con); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
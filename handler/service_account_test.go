@@ -0,0 +1,274 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/db"
+)
+
+type testServiceAccount struct {
+	ServiceAccount db.JSONServiceAccount `json:"service_account"`
+	ClientSecret   string                `json:"client_secret"`
+}
+
+func createServiceAccountForTest(router http.Handler, admin *db.User, scope string) (*testServiceAccount, error) {
+	body, err := json.Marshal(CreateServiceAccountParam{Name: "test job", Scope: scope})
+	if err != nil {
+		return nil, err
+	}
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/admin/service_accounts", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	setAuthJWTForTest(req, admin)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		return nil, fmt.Errorf("create service account failed with status %d", w.Code)
+	}
+
+	var account testServiceAccount
+	if err := json.NewDecoder(w.Body).Decode(&account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func clientCredentialsForTest(router http.Handler, clientID, secret, scope string) *httptest.ResponseRecorder {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("scope", scope)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(clientID, secret)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func serviceAccessTokenForTest(t *testing.T, router http.Handler, clientID, secret string) string {
+	w := clientCredentialsForTest(router, clientID, secret, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var res OAuthTokenResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	return res.AccessToken
+}
+
+func adminRequestWithAccessToken(router http.Handler, method, path, accessToken string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestServiceAccountClientCredentials(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	account, err := createServiceAccountForTest(router, admin, "users:read")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, account.ClientSecret)
+	assert.Equal(t, []string{"users:read"}, account.ServiceAccount.Scope)
+	clientID := account.ServiceAccount.ClientID
+
+	w := clientCredentialsForTest(router, clientID, account.ClientSecret, "users:write")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var errRes OAuthErrorResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&errRes))
+	assert.Equal(t, "invalid_scope", errRes.Error)
+
+	w = clientCredentialsForTest(router, clientID, "wrong", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	accessToken := serviceAccessTokenForTest(t, router, clientID, account.ClientSecret)
+
+	w = adminRequestWithAccessToken(router, "GET", "/admin/users", accessToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = adminRequestWithAccessToken(router, "GET", fmt.Sprintf("/admin/users/%s", admin.Email), accessToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = adminRequestWithAccessToken(router, "DELETE", fmt.Sprintf("/admin/users/%s", admin.Email), accessToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = adminRequestWithAccessToken(router, "GET", "/admin/jwt_keys", accessToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Service account is not a user.
+	w = adminRequestWithAccessToken(router, "GET", fmt.Sprintf("/users/%s", admin.Email), accessToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestServiceAccountScopeByPermission(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	router := New(testDBCon)
+
+	target, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	userPath := fmt.Sprintf("/admin/users/%s", target.Email)
+
+	// 사용자를 지울 수 있어도 OTP 와 로그인 잠금은 따로 허용해야 한다.
+	account, err := createServiceAccountForTest(router, admin, "users:write")
+	assert.NoError(t, err)
+	accessToken := serviceAccessTokenForTest(
+		t, router, account.ServiceAccount.ClientID, account.ClientSecret)
+	w := adminRequestWithAccessToken(router, "DELETE", userPath+"/otp", accessToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = adminRequestWithAccessToken(router, "DELETE", userPath+"/signin_lock", accessToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = adminRequestWithAccessToken(router, "PUT", userPath+"/roles/"+db.SuperuserRole, accessToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	account, err = createServiceAccountForTest(
+		router, admin, "otp:write signin_locks:write audit:read")
+	assert.NoError(t, err)
+	accessToken = serviceAccessTokenForTest(
+		t, router, account.ServiceAccount.ClientID, account.ClientSecret)
+	w = adminRequestWithAccessToken(router, "DELETE", userPath+"/otp", accessToken)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = adminRequestWithAccessToken(router, "DELETE", userPath+"/signin_lock", accessToken)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = adminRequestWithAccessToken(router, "GET", "/admin/audit", accessToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = adminRequestWithAccessToken(router, "DELETE", userPath, accessToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestRotateServiceAccountSecret(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	account, err := createServiceAccountForTest(router, admin, "users:read")
+	assert.NoError(t, err)
+	clientID := account.ServiceAccount.ClientID
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("PUT", fmt.Sprintf("/admin/service_accounts/%s/secret", clientID), nil)
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, admin)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var rotated testServiceAccount
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&rotated))
+	assert.NotEqual(t, account.ClientSecret, rotated.ClientSecret)
+
+	w = clientCredentialsForTest(router, clientID, account.ClientSecret, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = clientCredentialsForTest(router, clientID, rotated.ClientSecret, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestDisableServiceAccount(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	account, err := createServiceAccountForTest(router, admin, "users:read")
+	assert.NoError(t, err)
+	clientID := account.ServiceAccount.ClientID
+	accessToken := serviceAccessTokenForTest(t, router, clientID, account.ClientSecret)
+
+	path := fmt.Sprintf("/admin/service_accounts/%s/disabled", clientID)
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("PUT", path, nil)
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, admin)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = adminRequestWithAccessToken(router, "GET", "/admin/users", accessToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = clientCredentialsForTest(router, clientID, account.ClientSecret, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("DELETE", path, nil)
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, admin)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = adminRequestWithAccessToken(router, "GET", "/admin/users", accessToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestCreateServiceAccountWithInvalidScope(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	for _, scope := range []string{"users", "users:delete", "unknown:read"} {
+		body, err := json.Marshal(CreateServiceAccountParam{Name: "test job", Scope: scope})
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/admin/service_accounts", bytes.NewReader(body))
+		assert.NoError(t, err)
+		setAuthJWTForTest(req, admin)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		errRes := ErrorCodeResponse{}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&errRes))
+		assert.Equal(t, ErrorCodeInvalidScope, errRes.ErrorCode)
+	}
+}
+
+func TestServiceAccountScopeNotGrantable(t *testing.T) {
+	router := New(testDBCon)
+	manager, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	assert.NoError(t, newRoleForTest(t, "service_accounts:write").Assign(testDBCon, manager.ID))
+
+	// 가진 권한 안에서만 서비스 계정을 만들 수 있다.
+	w := jsonRequestForTest(router, "POST", "/admin/service_accounts",
+		CreateServiceAccountParam{Name: "test job", Scope: "users:write"}, manager)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, ErrorCodeNotGrantableScope, errCodeForTest(t, w))
+
+	w = jsonRequestForTest(router, "POST", "/admin/service_accounts",
+		CreateServiceAccountParam{Name: "test job", Scope: "service_accounts:write"}, manager)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// 더 큰 권한의 계정은 비밀 값을 바꾸거나 다시 켤 수 없고, 끌 수만 있다.
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	account, err := createServiceAccountForTest(router, admin, "users:write")
+	assert.NoError(t, err)
+	path := fmt.Sprintf("/admin/service_accounts/%s", account.ServiceAccount.ClientID)
+
+	w = jsonRequestForTest(router, "PUT", path+"/secret", nil, manager)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, ErrorCodeNotGrantableScope, errCodeForTest(t, w))
+
+	w = jsonRequestForTest(router, "PUT", path+"/disabled", nil, manager)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = jsonRequestForTest(router, "DELETE", path+"/disabled", nil, manager)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, ErrorCodeNotGrantableScope, errCodeForTest(t, w))
+	w = jsonRequestForTest(router, "DELETE", path+"/disabled", nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
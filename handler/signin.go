@@ -1,12 +1,12 @@
 package handler
 
 import (
-	"log"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 
-	"github.com/loganstone/auth/configs"
 	"github.com/loganstone/auth/db"
 	"github.com/loganstone/auth/utils"
 )
@@ -16,17 +16,128 @@ type SigninParam struct {
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
 	OTP      string `json:"otp"`
+
+	EmailCode string                                  `json:"email_code"`
+	WebAuthn  *utils.WebAuthnAuthenticationCredential `json:"webauthn"`
 }
 
 // SiginResponse .
 type SiginResponse struct {
-	User  db.User `json:"user"`
-	Token string  `json:"token"`
+	User         db.User `json:"user"`
+	Token        string  `json:"token"`
+	RefreshToken string  `json:"refresh_token"`
+}
+
+// secondFactor is what the user gives to verify the second factor.
+type secondFactor struct {
+	OTP       string
+	EmailCode string
+	WebAuthn  *utils.WebAuthnAuthenticationCredential
+}
+
+// isAbortedAsRequireSecondFactor reports whether the user registered
+// OTP or security key but gave nothing to verify it.
+func isAbortedAsRequireSecondFactor(
+	c *gin.Context, user *db.User, creds []db.WebAuthnCredential, f secondFactor) bool {
+
+	if !user.ConfirmedOTP() && len(creds) == 0 {
+		return false
+	}
+
+	if (f.WebAuthn != nil && len(creds) > 0) ||
+		(f.OTP != "" && user.ConfirmedOTP()) || f.EmailCode != "" {
+		return false
+	}
+
+	code := ErrorCodeRequireVerifyWebAuthn
+	if user.ConfirmedOTP() {
+		code = ErrorCodeRequireVerifyOTP
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, NewErrRes(code))
+	countSigninFailure(code)
+	return true
+}
+
+// verifySecondFactorOrAbort verifies one of second factors
+// if the user registered OTP or security key.
+// Registered security key and email code can be used instead of OTP.
+// Verified methods are added to 'auth'. It returns false if aborted.
+func verifySecondFactorOrAbort(
+	c *gin.Context, con *gorm.DB, user *db.User,
+	creds []db.WebAuthnCredential, f secondFactor, auth *utils.Authentication) bool {
+
+	if !user.ConfirmedOTP() && len(creds) == 0 {
+		return true
+	}
+
+	if isAbortedAsRequireSecondFactor(c, user, creds, f) {
+		return false
+	}
+
+	switch {
+	case f.WebAuthn != nil && len(creds) > 0:
+		_, assertion := verifyWebAuthnAssertionOrAbort(
+			c, con, f.WebAuthn, user.ID, false)
+		if assertion == nil {
+			return false
+		}
+		auth.AddMethods(utils.AMRHardwareKey)
+	case f.EmailCode != "":
+		if !consumeEmailCodeOrAbort(c, con, user.ID, f.EmailCode) {
+			return false
+		}
+		auth.AddMethods(utils.AMROTP)
+	default:
+		if !user.VerifyOTP(f.OTP) {
+			if _, ok := user.OTPBackupCodes.In(f.OTP); !ok {
+				c.AbortWithStatusJSON(
+					http.StatusUnauthorized,
+					NewErrRes(ErrorCodeIncorrectOTP))
+				countSigninFailure(ErrorCodeIncorrectOTP)
+				return false
+			}
+
+			// 백업코드 확인은 성공 했으니,
+			// 삭제를 실패해도 Signin 은 그대로 진행.
+			const message = "failed delete backup code '%s'"
+			ok, err := user.OTPBackupCodes.Del(f.OTP)
+			if err != nil {
+				Logger(c).With("error", err).Errorf(message, f.OTP)
+			}
+
+			if ok {
+				if err := user.Save(con); err != nil {
+					Logger(c).With("error", err).Errorf(message, f.OTP)
+				}
+			}
+		}
+		auth.AddMethods(utils.AMROTP)
+	}
+	auth.AddMethods(utils.AMRMultiFactor)
+	return true
+}
+
+// signin issues tokens to the user authenticated by 'auth'.
+// It is counted as signin success of every way to signin.
+func signin(c *gin.Context, con *gorm.DB, user *db.User, auth utils.Authentication) {
+	succeeded := db.NewOutboxEvent(db.EventSigninSucceeded, user.ID,
+		db.EventData{Email: user.Email, IP: c.ClientIP(), AMR: auth.AMR})
+	tokens, errRes := issueTokens(con, user, auth, succeeded)
+	if errRes != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError, errRes)
+		return
+	}
+	countSigninSuccess()
+	c.JSON(http.StatusOK, SiginResponse{
+		User:         *user,
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+	})
 }
 
 // Signin .
 func Signin(c *gin.Context) {
-	conf := configs.App()
 	con := DBConnOrAbort(c)
 	if con == nil {
 		return
@@ -40,58 +151,55 @@ func Signin(c *gin.Context) {
 		return
 	}
 
+	attempt := newSigninAttempt(c, con)
+	if attempt == nil {
+		return
+	}
+	defer attempt.end()
+	attempt.setUser(0, params.Email)
+
 	user := findUserByEmailOrAbort(
 		params.Email, c, con, http.StatusBadRequest)
 	if user == nil {
 		return
 	}
+	attempt.setUser(user.ID, user.Email)
+
+	if attempt.isAbortedAsThrottled(accountSigninThrottle(user.ID)) {
+		return
+	}
 
 	if !user.VerifyPassword(params.Password) {
 		c.AbortWithStatusJSON(
 			http.StatusUnauthorized,
 			NewErrRes(ErrorCodeIncorrectPassword))
+		countSigninFailure(ErrorCodeIncorrectPassword)
 		return
 	}
 
-	if user.ConfirmedOTP() {
-		if params.OTP == "" {
-			c.AbortWithStatusJSON(
-				http.StatusUnauthorized,
-				NewErrRes(ErrorCodeRequireVerifyOTP))
-			return
-		}
-
-		if !user.VerifyOTP(params.OTP) {
-			if _, ok := user.OTPBackupCodes.In(params.OTP); !ok {
-				c.AbortWithStatusJSON(
-					http.StatusUnauthorized,
-					NewErrRes(ErrorCodeIncorrectOTP))
-				return
-			}
-
-			// 백업코드 확인은 성공 했으니,
-			// 삭제를 실패해도 Signin 은 그대로 진행.
-			message := "failed delete backup code '%s', error '%s'"
-			ok, err := user.OTPBackupCodes.Del(params.OTP)
-			if err != nil {
-				log.Printf(message, params.OTP, err.Error())
-			}
+	creds := webAuthnCredentialsOrAbort(c, con, user.ID)
+	if creds == nil {
+		return
+	}
 
-			if ok {
-				if err := user.Save(con); err != nil {
-					log.Printf(message, params.OTP, err.Error())
-				}
-			}
-		}
+	f := secondFactor{
+		OTP:       params.OTP,
+		EmailCode: params.EmailCode,
+		WebAuthn:  params.WebAuthn,
+	}
+	// 두 번째 인증 수단을 요구하는 것은 실패로 세지 않는다.
+	if isAbortedAsRequireSecondFactor(c, user, creds, f) {
+		attempt.uncounted = true
+		return
 	}
 
-	token := utils.NewJWT(conf.SessionTokenExpire)
-	sessionToken, err := token.Session(user.ID, user.Email, conf.JWTSigninKey, conf.Org)
-	if err != nil {
-		c.AbortWithStatusJSON(
-			http.StatusInternalServerError,
-			NewErrResWithErr(ErrorCodeSignJWT, err))
+	auth := utils.Authentication{
+		AuthTime: time.Now().Unix(),
+		AMR:      []string{utils.AMRPassword},
+	}
+	if !verifySecondFactorOrAbort(c, con, user, creds, f, &auth) {
 		return
 	}
-	c.JSON(http.StatusOK, SiginResponse{User: *user, Token: sessionToken})
+
+	signin(c, con, user, auth)
 }
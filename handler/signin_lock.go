@@ -0,0 +1,381 @@
+package handler
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+// SigninUnlockParam .
+type SigninUnlockParam struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// SigninUnlockEmailData .
+type SigninUnlockEmailData struct {
+	UserEmail    string `json:"user_email"`
+	UnlockURL    string `json:"unlock_url"`
+	ExpireMin    int    `json:"expire_min"`
+	Organization string `json:"organization"`
+}
+
+// signinThrottle is the subject whose failed signin attempts are counted.
+type signinThrottle struct {
+	subject string
+	limit   db.SigninLimit
+	// account throttle is cleared when signin succeeds.
+	account bool
+}
+
+func signinLimit(freeFailures, maxFailures int) db.SigninLimit {
+	conf := configs.App()
+	return db.SigninLimit{
+		FreeFailures: freeFailures,
+		MaxFailures:  maxFailures,
+		MaxDelay:     time.Second * time.Duration(conf.SigninMaxDelay),
+		LockFor:      time.Second * time.Duration(conf.SigninLockDuration),
+	}
+}
+
+func accountSigninThrottle(userID uint) signinThrottle {
+	conf := configs.App()
+	return signinThrottle{
+		subject: db.SigninLockSubjectUser(userID),
+		limit:   signinLimit(conf.SigninFreeFailures, conf.SigninMaxFailures),
+		account: true,
+	}
+}
+
+// ipSigninThrottle returns empty subject if the client IP is unknown,
+// then attempts are not counted by IP.
+func ipSigninThrottle(ip string) signinThrottle {
+	conf := configs.App()
+	t := signinThrottle{
+		limit: signinLimit(conf.SigninFreeFailuresPerIP, conf.SigninMaxFailuresPerIP),
+	}
+	if ip != "" {
+		t.subject = db.SigninLockSubjectIP(ip)
+	}
+	return t
+}
+
+// signinAttempt is counted as failure of the throttles before verifying,
+// so that attempts at the same time are counted against each other.
+// It must be ended after the response is written.
+type signinAttempt struct {
+	c         *gin.Context
+	con       *gorm.DB
+	throttles []signinThrottle
+
+	userID uint
+	email  string
+	// uncounted is set when the attempt is rejected without failure,
+	// such as second factor is required.
+	uncounted bool
+}
+
+// newSigninAttempt starts the attempt with the throttle of the client IP.
+// It returns nil if aborted as throttled.
+func newSigninAttempt(c *gin.Context, con *gorm.DB) *signinAttempt {
+	a := &signinAttempt{c: c, con: con}
+	if a.isAbortedAsThrottled(ipSigninThrottle(c.ClientIP())) {
+		a.end()
+		return nil
+	}
+	return a
+}
+
+// setUser sets who is signing in, zero user id is given if the user is not found.
+func (a *signinAttempt) setUser(userID uint, email string) {
+	a.userID = userID
+	a.email = email
+}
+
+// isAbortedAsThrottled counts the attempt for each throttle,
+// unless any of subjects is locked or has to wait more after the last failure.
+func (a *signinAttempt) isAbortedAsThrottled(throttles ...signinThrottle) bool {
+	c := a.c
+	for _, t := range throttles {
+		if t.subject == "" {
+			continue
+		}
+
+		lock, reserved, err := db.ReserveSigninAttempt(a.con, t.subject, t.limit)
+		if err != nil {
+			a.uncounted = true
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				NewErrResWithErr(ErrorCodeDBTransaction, err))
+			return true
+		}
+		if reserved {
+			a.throttles = append(a.throttles, t)
+			continue
+		}
+
+		// 잠겨 있거나 기다려야 하는 시도는 실패로 세지 않는다.
+		a.uncounted = true
+		wait := lock.RetryAfter(t.limit.FreeFailures, t.limit.MaxDelay)
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		if lock.IsLocked() {
+			c.AbortWithStatusJSON(
+				http.StatusLocked,
+				NewErrRes(ErrorCodeSigninLocked))
+			return true
+		}
+		c.AbortWithStatusJSON(
+			http.StatusTooManyRequests,
+			NewErrRes(ErrorCodeTooManySigninAttempts))
+		return true
+	}
+	return false
+}
+
+// end keeps the attempt counted if the request was rejected
+// by what the client gave, and writes 'signin.failed' event.
+// Otherwise the attempt is taken back, and signin success clears the account throttle.
+// Signin is already responded, so errors are only logged.
+func (a *signinAttempt) end() {
+	c := a.c
+	status := c.Writer.Status()
+	failed := !a.uncounted &&
+		status >= http.StatusBadRequest && status < http.StatusInternalServerError
+	if failed {
+		event := db.NewOutboxEvent(db.EventSigninFailed, a.userID,
+			db.EventData{Email: a.email, IP: c.ClientIP()})
+		if err := db.AddOutboxEvents(a.con, event); err != nil {
+			Logger(c).With("error", err).Errorf(
+				"failed add signin failed event of '%s'", a.email)
+		}
+		return
+	}
+
+	succeeded := status < http.StatusBadRequest
+	for _, t := range a.throttles {
+		var err error
+		if succeeded && t.account {
+			err = db.ClearSigninLock(a.con, t.subject)
+		} else {
+			err = db.ReleaseSigninAttempt(a.con, t.subject, t.limit.MaxFailures)
+		}
+		if err != nil {
+			Logger(c).With("error", err).Errorf(
+				"failed release signin attempt of '%s'", t.subject)
+		}
+	}
+}
+
+// SendSigninUnlockEmail sends the link to unlock the account
+// locked by failed signin attempts.
+// The link expires when the lock does.
+func SendSigninUnlockEmail(c *gin.Context) {
+	conf := configs.App()
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param SendEmailParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	user := findUserByEmailOrAbort(
+		param.Email, c, con, http.StatusBadRequest)
+	if user == nil {
+		return
+	}
+
+	lock := db.FindSigninLock(con, db.SigninLockSubjectUser(user.ID))
+	if lock == nil || !lock.IsLocked() {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeSigninNotLocked))
+		return
+	}
+
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
+	expireAfterSec := int(math.Ceil(time.Until(*lock.LockedUntil).Seconds()))
+	token := utils.NewJWT(expireAfterSec)
+	unlockToken, err := token.SigninUnlock(
+		param.Email, lock.LockedUntil.Unix(), ring.SigningKey(), conf.IssuerURL())
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeSignJWT, err))
+		return
+	}
+
+	if gin.Mode() == gin.DebugMode {
+		Logger(c).Debugf("signin unlock token: %s", unlockToken)
+	}
+
+	emailTmpl, err := template.New("signin unlock email").Parse(param.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeTmplParse, err))
+		return
+	}
+
+	var body bytes.Buffer
+	data := SigninUnlockEmailData{
+		UserEmail:    param.Email,
+		UnlockURL:    conf.SigninUnlockURL(unlockToken),
+		ExpireMin:    int(math.Ceil(float64(expireAfterSec) / oneMinuteSeconds)),
+		Organization: conf.Org,
+	}
+
+	if err := emailTmpl.Execute(&body, data); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeTmplExecute, err))
+		return
+	}
+
+	if err = utils.NewEmail(
+		utils.NameFromEmail(param.Email),
+		conf.SupportEmail,
+		param.Email,
+		param.Subject,
+		body.String(),
+	).SendContext(c.Request.Context(), configs.SMTP().Addr()); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeSendEmail, err))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// SigninUnlock unlocks the account with the token in the link sent by email.
+// Failed attempts counted by client IP are kept.
+func SigninUnlock(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param SigninUnlockParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
+	claims, err := utils.ParseSigninUnlockJWT(param.Token, ring)
+	if err != nil {
+		ve, ok := err.(*jwt.ValidationError)
+		if !ok || ve.Errors != jwt.ValidationErrorExpired {
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				NewErrResWithErr(ErrorCodeParseJWT, err))
+			return
+		}
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeExpiredToken))
+		return
+	}
+
+	if claims.Subject != utils.SigninUnlock {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidToken))
+		return
+	}
+
+	user := findUserByEmailOrAbort(
+		claims.Email, c, con, http.StatusBadRequest)
+	if user == nil {
+		return
+	}
+
+	subject := db.SigninLockSubjectUser(user.ID)
+	lock := db.FindSigninLock(con, subject)
+	if lock == nil || lock.LockedUntil == nil ||
+		lock.LockedUntil.Unix() != claims.LockedUntil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidToken))
+		return
+	}
+
+	if err := db.ClearSigninLock(con, subject); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// SigninLock returns failed signin attempts and lock state of the user.
+func SigninLock(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	user := findUserByEmailOrAbort(
+		c.Param("email"), c, con, http.StatusNotFound)
+	if user == nil {
+		return
+	}
+
+	lock := db.FindSigninLock(con, db.SigninLockSubjectUser(user.ID))
+	if lock == nil {
+		lock = &db.SigninLock{}
+	}
+	c.JSON(http.StatusOK, lock)
+}
+
+// ClearSigninLock forgets failed signin attempts of the user and unlocks it.
+func ClearSigninLock(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	user := findUserByEmailOrAbort(
+		c.Param("email"), c, con, http.StatusNotFound)
+	if user == nil {
+		return
+	}
+
+	err := db.ClearSigninLock(con, db.SigninLockSubjectUser(user.ID))
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,304 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+const (
+	signinUnlockEmailSubject  = "[auth] Unlock your account."
+	signinUnlockEmailBodyTmpl = `<p>Hi {{ .UserEmail }}.</p>
+<p>Your account is locked by failed signin attempts.</p>
+<p><a href="{{ .UnlockURL }}">Unlock</a></p>
+<p>It will expire in {{ .ExpireMin }} minutes.</p>`
+)
+
+var signinUnlockRegexp = regexp.MustCompile(`^<p><a href="[^"]+/signin/unlock/([^"]+)">Unlock</a></p>$`)
+
+func requestFromForTest(router http.Handler, remoteAddr string, param interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(param)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", bytes.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func signinFromForTest(router http.Handler, remoteAddr string, param SigninParam) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(param)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/signin", bytes.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func errCodeForTest(t *testing.T, w *httptest.ResponseRecorder) int {
+	var errRes ErrorCodeResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&errRes))
+	return errRes.ErrorCode
+}
+
+// lockSigninForTest fails to signin until the user is locked.
+func lockSigninForTest(t *testing.T, router http.Handler, user *db.User) {
+	conf := configs.App()
+	param := SigninParam{Email: user.Email, Password: "wrong password"}
+	for i := 0; i < conf.SigninMaxFailures; i++ {
+		w := jsonRequestForTest(router, "POST", "/signin", param, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+}
+
+func sendSigninUnlockEmailForTest(t *testing.T, router http.Handler, email string) string {
+	conf := configs.App()
+	// 링크는 Capture 로 받으므로 비워 둔다.
+	data := SigninUnlockEmailData{
+		UserEmail:    email,
+		ExpireMin:    conf.SigninLockDuration / oneMinuteSeconds,
+		Organization: conf.Org,
+	}
+	var emailBody bytes.Buffer
+	emailTmpl, err := template.New("signin unlock email").Parse(signinUnlockEmailBodyTmpl)
+	assert.NoError(t, err)
+	assert.NoError(t, emailTmpl.Execute(&emailBody, data))
+
+	ln, err := utils.NewLocalListener(utils.MockSMTPPort)
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	captured := make(chan string, 1)
+	go func() {
+		defer close(captured)
+		c, err := ln.Accept()
+		if err != nil {
+			t.Errorf("local listener accept: %v", err)
+			return
+		}
+		defer c.Close()
+		handler := utils.MockSMTPHandler{
+			Con:     c,
+			Name:    utils.NameFromEmail(email),
+			From:    conf.SupportEmail,
+			To:      email,
+			Subject: signinUnlockEmailSubject,
+			Body:    emailBody.String(),
+			Capture: signinUnlockRegexp,
+		}
+		if err := handler.Handle(); err != nil {
+			t.Errorf("mock smtp handle error: %v", err)
+		}
+		if len(handler.Captured) > 0 {
+			captured <- handler.Captured[0]
+		}
+	}()
+	configs.SetSMTPPort(utils.MockSMTPPort)
+
+	param := SendEmailParam{
+		Email:   email,
+		Subject: signinUnlockEmailSubject,
+		Body:    signinUnlockEmailBodyTmpl,
+	}
+	w := jsonRequestForTest(router, "POST", "/signin/unlock", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	select {
+	case line := <-captured:
+		return signinUnlockRegexp.FindStringSubmatch(line)[1]
+	case <-time.After(time.Second * 3):
+		t.Error("signin unlock email was not sent")
+		return ""
+	}
+}
+
+func TestSigninWithDelay(t *testing.T) {
+	conf := configs.App()
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	param := SigninParam{Email: user.Email, Password: "wrong password"}
+	for i := 0; i <= conf.SigninFreeFailures; i++ {
+		w := jsonRequestForTest(router, "POST", "/signin", param, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// 올바른 비밀번호도 기다려야 한다.
+	param.Password = testPassword
+	w := jsonRequestForTest(router, "POST", "/signin", param, nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, ErrorCodeTooManySigninAttempts, errCodeForTest(t, w))
+
+	time.Sleep(time.Second)
+	w = jsonRequestForTest(router, "POST", "/signin", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 로그인에 성공하면 실패 횟수는 지워진다.
+	assert.Nil(t, db.FindSigninLock(testDBCon, db.SigninLockSubjectUser(user.ID)))
+}
+
+func TestSigninLockWithIncorrectOTP(t *testing.T) {
+	os.Setenv(configs.EnvPrefix+"SIGNIN_MAX_DELAY", "0")
+	defer os.Unsetenv(configs.EnvPrefix + "SIGNIN_MAX_DELAY")
+
+	conf := configs.App()
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	_, errCodeRes := generateOTP(testDBCon, user)
+	assert.Nil(t, errCodeRes)
+	errCodeRes = confirmOTP(testDBCon, user)
+	assert.Nil(t, errCodeRes)
+
+	router := New(testDBCon)
+	param := SigninParam{Email: user.Email, Password: testPassword}
+	for i := 0; i < conf.SigninMaxFailures; i++ {
+		// OTP 를 요구하는 것은 실패로 세지 않는다.
+		param.OTP = ""
+		w := jsonRequestForTest(router, "POST", "/signin", param, nil)
+		assert.Equal(t, ErrorCodeRequireVerifyOTP, errCodeForTest(t, w))
+
+		param.OTP = "000000"
+		w = jsonRequestForTest(router, "POST", "/signin", param, nil)
+		assert.Equal(t, ErrorCodeIncorrectOTP, errCodeForTest(t, w))
+	}
+
+	totp, err := user.TOTP()
+	assert.NoError(t, err)
+	param.OTP = totp.Now()
+	w := jsonRequestForTest(router, "POST", "/signin", param, nil)
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.Equal(t, ErrorCodeSigninLocked, errCodeForTest(t, w))
+
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	assert.InDelta(t, conf.SigninLockDuration, retryAfter, 2)
+}
+
+func TestSigninUnlock(t *testing.T) {
+	os.Setenv(configs.EnvPrefix+"SIGNIN_MAX_DELAY", "0")
+	defer os.Unsetenv(configs.EnvPrefix + "SIGNIN_MAX_DELAY")
+
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	w := jsonRequestForTest(router, "POST", "/signin/unlock", SendEmailParam{
+		Email:   user.Email,
+		Subject: signinUnlockEmailSubject,
+		Body:    signinUnlockEmailBodyTmpl,
+	}, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrorCodeSigninNotLocked, errCodeForTest(t, w))
+
+	lockSigninForTest(t, router, user)
+	token := sendSigninUnlockEmailForTest(t, router, user.Email)
+	assert.NotEmpty(t, token)
+
+	param := SigninUnlockParam{Token: token}
+	w = jsonRequestForTest(router, "POST", "/signin/unlock/verification", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	signinParam := SigninParam{Email: user.Email, Password: testPassword}
+	w = jsonRequestForTest(router, "POST", "/signin", signinParam, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 다시 잠긴 계정은 이전 링크로 풀 수 없다.
+	lockSigninForTest(t, router, user)
+	w = jsonRequestForTest(router, "POST", "/signin/unlock/verification", param, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrorCodeInvalidToken, errCodeForTest(t, w))
+}
+
+func TestSigninLockAsAdmin(t *testing.T) {
+	os.Setenv(configs.EnvPrefix+"SIGNIN_MAX_DELAY", "0")
+	defer os.Unsetenv(configs.EnvPrefix + "SIGNIN_MAX_DELAY")
+
+	conf := configs.App()
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	uri := fmt.Sprintf("/admin/users/%s/signin_lock", user.Email)
+	w := jsonRequestForTest(router, "GET", uri, nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var lock db.JSONSigninLock
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&lock))
+	assert.Equal(t, db.JSONSigninLock{}, lock)
+
+	lockSigninForTest(t, router, user)
+	w = jsonRequestForTest(router, "GET", uri, nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&lock))
+	assert.Equal(t, conf.SigninMaxFailures, lock.Failures)
+	assert.True(t, lock.Locked)
+	assert.NotNil(t, lock.LastFailedAt)
+	assert.NotNil(t, lock.LockedUntil)
+
+	w = jsonRequestForTest(router, "GET", uri, nil, user)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = jsonRequestForTest(router, "DELETE", uri, nil, admin)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	param := SigninParam{Email: user.Email, Password: testPassword}
+	w = jsonRequestForTest(router, "POST", "/signin", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSigninLockPerIP(t *testing.T) {
+	os.Setenv(configs.EnvPrefix+"SIGNIN_MAX_DELAY", "0")
+	defer os.Unsetenv(configs.EnvPrefix + "SIGNIN_MAX_DELAY")
+	// 요청 수 제한에 걸리지 않을 만큼 줄인다.
+	os.Setenv(configs.EnvPrefix+"SIGNIN_MAX_FAILURES_PER_IP", "5")
+	defer os.Unsetenv(configs.EnvPrefix + "SIGNIN_MAX_FAILURES_PER_IP")
+
+	conf := configs.App()
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	const remoteAddr = "192.0.2.1:1234"
+	// 없는 사용자로 시도한 것도 센다.
+	for i := 0; i < conf.SigninMaxFailuresPerIP; i++ {
+		w := signinFromForTest(router, remoteAddr,
+			SigninParam{Email: testEmail(), Password: testPassword})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+
+	param := SigninParam{Email: user.Email, Password: testPassword}
+	w := signinFromForTest(router, remoteAddr, param)
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.Equal(t, ErrorCodeSigninLocked, errCodeForTest(t, w))
+
+	// 신뢰하는 프록시가 아니면 'X-Forwarded-For' 로 IP 를 바꿀 수 없다.
+	body, err := json.Marshal(param)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/signin", bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("X-Forwarded-For", "192.0.2.3")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusLocked, w.Code)
+
+	w = signinFromForTest(router, "192.0.2.2:1234", param)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -8,8 +8,31 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
 )
 
+// publishedEventsForTest relays all events in outbox and returns events of the user.
+func publishedEventsForTest(t *testing.T, userID uint) []utils.Event {
+	sink := utils.NewMemoryEventSink()
+	for {
+		n, err := db.RelayOutboxEvents(testDBCon, sink, 100)
+		assert.NoError(t, err)
+		if n == 0 {
+			break
+		}
+	}
+
+	var events []utils.Event
+	for _, e := range sink.Events() {
+		if e.UserID == userID {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
 func TestSignin(t *testing.T) {
 	user, err := testUser(testDBCon)
 	assert.NoError(t, err)
@@ -21,7 +44,7 @@ func TestSignin(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("POST", "/signin", bytes.NewReader(body))
@@ -35,6 +58,7 @@ func TestSignin(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, reqBody.Email, resBody.User.Email)
 	assert.NotEqual(t, "", resBody.Token)
+	assert.NotEqual(t, "", resBody.RefreshToken)
 }
 
 func TestSigninWithWrongPassword(t *testing.T) {
@@ -48,7 +72,7 @@ func TestSigninWithWrongPassword(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("POST", "/signin", bytes.NewReader(body))
@@ -73,7 +97,7 @@ func TestSigninWithoutEmail(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("POST", "/signin", bytes.NewReader(body))
@@ -98,7 +122,7 @@ func TestSigninWithoutPassword(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("POST", "/signin", bytes.NewReader(body))
@@ -134,7 +158,7 @@ func TestSigninWithOTP(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("POST", "/signin", bytes.NewReader(body))
@@ -162,7 +186,7 @@ func TestSigninWithBackupCode(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("POST", "/signin", bytes.NewReader(body))
 	defer req.Body.Close()
@@ -193,7 +217,7 @@ func TestSigninWithIncorrectOTP(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("POST", "/signin", bytes.NewReader(body))
@@ -228,7 +252,7 @@ func TestSigninWithAllBackupCodes(t *testing.T) {
 		body, err := json.Marshal(reqBody)
 		assert.NoError(t, err)
 
-		router := New()
+		router := New(testDBCon)
 		w := httptest.NewRecorder()
 		req, err := http.NewRequest("POST", "/signin", bytes.NewReader(body))
 		defer req.Body.Close()
@@ -249,7 +273,7 @@ func TestSigninWithAllBackupCodes(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("POST", "/signin", bytes.NewReader(body))
@@ -281,7 +305,7 @@ func TestSigninWithoutOTP(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("POST", "/signin", bytes.NewReader(body))
@@ -295,3 +319,29 @@ func TestSigninWithoutOTP(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, ErrorCodeRequireVerifyOTP, errRes.ErrorCode)
 }
+
+func TestSigninEvents(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	publishedEventsForTest(t, user.ID)
+
+	router := New(testDBCon)
+
+	param := SigninParam{Email: user.Email, Password: "wrong password"}
+	w := jsonRequestForTest(router, "POST", "/signin", param, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	param.Password = testPassword
+	w = jsonRequestForTest(router, "POST", "/signin", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	events := publishedEventsForTest(t, user.ID)
+	assert.Len(t, events, 2)
+	assert.Equal(t, db.EventSigninFailed, events[0].Type)
+	assert.Equal(t, db.EventSigninSucceeded, events[1].Type)
+
+	var data db.EventData
+	assert.NoError(t, json.Unmarshal(events[1].Data, &data))
+	assert.Equal(t, user.Email, data.Email)
+	assert.Equal(t, []string{utils.AMRPassword}, data.AMR)
+}
@@ -3,12 +3,11 @@ package handler
 import (
 	"bytes"
 	"errors"
-	"log"
 	"net/http"
 	"text/template"
 
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
 
 	"github.com/loganstone/auth/configs"
 	"github.com/loganstone/auth/db"
@@ -57,8 +56,13 @@ func SendVerificationEmail(c *gin.Context) {
 		return
 	}
 
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
 	token := utils.NewJWT(conf.SignupTokenExpire)
-	signupToken, err := token.Signup(param.Email, conf.JWTSigninKey, conf.Org)
+	signupToken, err := token.Signup(param.Email, ring.SigningKey(), conf.IssuerURL())
 	if err != nil {
 		c.AbortWithStatusJSON(
 			http.StatusInternalServerError,
@@ -67,7 +71,7 @@ func SendVerificationEmail(c *gin.Context) {
 	}
 
 	if gin.Mode() == gin.DebugMode {
-		log.Println("signup token:", signupToken)
+		Logger(c).Debugf("signup token: %s", signupToken)
 	}
 
 	emailTmpl, err := template.New("verification email").Parse(param.Body)
@@ -99,7 +103,7 @@ func SendVerificationEmail(c *gin.Context) {
 		param.Email,
 		param.Subject,
 		body.String(),
-	).Send(configs.SMTP().Addr()); err != nil {
+	).SendContext(c.Request.Context(), configs.SMTP().Addr()); err != nil {
 		c.AbortWithStatusJSON(
 			http.StatusInternalServerError,
 			NewErrResWithErr(ErrorCodeSendEmail, err))
@@ -111,14 +115,18 @@ func SendVerificationEmail(c *gin.Context) {
 
 // VerifySignupToken .
 func VerifySignupToken(c *gin.Context) {
-	conf := configs.App()
 	con := DBConnOrAbort(c)
 	if con == nil {
 		return
 	}
 
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
 	token := c.Param("token")
-	claims, err := utils.ParseSignupJWT(token, conf.JWTSigninKey)
+	claims, err := utils.ParseSignupJWT(token, ring)
 	if err != nil {
 		ve, ok := err.(*jwt.ValidationError)
 		if !ok || ve.Errors != jwt.ValidationErrorExpired {
@@ -133,6 +141,14 @@ func VerifySignupToken(c *gin.Context) {
 		return
 	}
 
+	// 같은 키로 서명한 다른 용도의 토큰은 거부한다.
+	if claims.Subject != utils.Signup {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidToken))
+		return
+	}
+
 	if isAbortedAsUserExist(c, con, claims.Email) {
 		return
 	}
@@ -142,12 +158,16 @@ func VerifySignupToken(c *gin.Context) {
 
 // Signup .
 func Signup(c *gin.Context) {
-	conf := configs.App()
 	con := DBConnOrAbort(c)
 	if con == nil {
 		return
 	}
 
+	ring := keyRingOrAbort(c, con)
+	if ring == nil {
+		return
+	}
+
 	var param SignupParam
 	if err := c.ShouldBindJSON(&param); err != nil {
 		c.AbortWithStatusJSON(
@@ -156,7 +176,7 @@ func Signup(c *gin.Context) {
 		return
 	}
 
-	claims, err := utils.ParseSignupJWT(param.Token, conf.JWTSigninKey)
+	claims, err := utils.ParseSignupJWT(param.Token, ring)
 	if err != nil {
 		ve, ok := err.(*jwt.ValidationError)
 		if !ok || ve.Errors != jwt.ValidationErrorExpired {
@@ -171,6 +191,14 @@ func Signup(c *gin.Context) {
 		return
 	}
 
+	// 같은 키로 서명한 다른 용도의 토큰은 거부한다.
+	if claims.Subject != utils.Signup {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidToken))
+		return
+	}
+
 	if isAbortedAsUserExist(c, con, claims.Email) {
 		return
 	}
@@ -195,5 +223,6 @@ func Signup(c *gin.Context) {
 		return
 	}
 
+	setAuditTarget(c, &user)
 	c.JSON(http.StatusCreated, user)
 }
@@ -93,7 +93,7 @@ func TestSendVerificationEmail(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("POST", "/signup/email/verification", bytes.NewReader(body))
@@ -106,11 +106,13 @@ func TestSendVerificationEmail(t *testing.T) {
 func TestVerifySignupToken(t *testing.T) {
 	conf := configs.App()
 	email := testEmail()
+	key, err := JWTKey()
+	assert.NoError(t, err)
 	token := utils.NewJWT(conf.SignupTokenExpire)
-	signupToken, err := token.Signup(email, conf.JWTSigninKey, conf.Org)
+	signupToken, err := token.Signup(email, key, conf.IssuerURL())
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/signup/email/verification/%s", signupToken)
@@ -128,11 +130,13 @@ func TestVerifySignupToken(t *testing.T) {
 func TestVerifySignupTokenWithExpiredToken(t *testing.T) {
 	conf := configs.App()
 	email := testEmail()
+	key, err := JWTKey()
+	assert.NoError(t, err)
 	token := utils.NewJWT(-1)
-	signupToken, err := token.Signup(email, conf.JWTSigninKey, conf.Org)
+	signupToken, err := token.Signup(email, key, conf.IssuerURL())
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/signup/email/verification/%s", signupToken)
@@ -147,11 +151,43 @@ func TestVerifySignupTokenWithExpiredToken(t *testing.T) {
 	assert.Equal(t, ErrorCodeExpiredToken, resBody.ErrorCode)
 }
 
+func TestVerifySignupTokenWithOtherToken(t *testing.T) {
+	conf := configs.App()
+	email := testEmail()
+	key, err := JWTKey()
+	assert.NoError(t, err)
+	// 같은 키로 서명한 매직 링크 토큰
+	magicLinkToken, err := utils.NewJWT(conf.SignupTokenExpire).MagicLink(email, key, conf.IssuerURL())
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	w := httptest.NewRecorder()
+	uri := fmt.Sprintf("/signup/email/verification/%s", magicLinkToken)
+	req, err := http.NewRequest("GET", uri, nil)
+	assert.NoError(t, err)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrorCodeInvalidToken, errCodeForTest(t, w))
+
+	body, err := json.Marshal(SignupParam{Token: magicLinkToken, Password: testPassword})
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	req, err = http.NewRequest("POST", "/signup", bytes.NewReader(body))
+	assert.NoError(t, err)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ErrorCodeInvalidToken, errCodeForTest(t, w))
+	assert.Nil(t, findUserByEmail(email, testDBCon))
+}
+
 func TestSignup(t *testing.T) {
 	conf := configs.App()
 	email := testEmail()
+	key, err := JWTKey()
+	assert.NoError(t, err)
 	token := utils.NewJWT(conf.SignupTokenExpire)
-	signupToken, err := token.Signup(email, conf.JWTSigninKey, conf.Org)
+	signupToken, err := token.Signup(email, key, conf.IssuerURL())
 	assert.NoError(t, err)
 
 	reqBody := map[string]string{
@@ -161,7 +197,7 @@ func TestSignup(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("POST", "/signup", bytes.NewReader(body))
@@ -178,8 +214,10 @@ func TestSignup(t *testing.T) {
 func TestSignupWithShortPassword(t *testing.T) {
 	conf := configs.App()
 	email := testEmail()
+	key, err := JWTKey()
+	assert.NoError(t, err)
 	token := utils.NewJWT(conf.SignupTokenExpire)
-	signupToken, err := token.Signup(email, conf.JWTSigninKey, conf.Org)
+	signupToken, err := token.Signup(email, key, conf.IssuerURL())
 	assert.NoError(t, err)
 
 	reqBody := map[string]string{
@@ -189,7 +227,7 @@ func TestSignupWithShortPassword(t *testing.T) {
 	body, err := json.Marshal(reqBody)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("POST", "/signup", bytes.NewReader(body))
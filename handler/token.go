@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+// RefreshTokenParam .
+type RefreshTokenParam struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TokenResponse .
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// sessionLifetimeLeft returns seconds left until 'SessionMaxLifetime' from the signin.
+// Sessions of unknown signin time have no time left.
+func sessionLifetimeLeft(auth utils.Authentication) int {
+	if auth.AuthTime == 0 {
+		return 0
+	}
+	return int(auth.AuthTime + int64(configs.App().SessionMaxLifetime) - time.Now().Unix())
+}
+
+// expireWithin returns 'expire', or 'left' if it is shorter.
+func expireWithin(expire, left int) int {
+	if left < expire {
+		return left
+	}
+	return expire
+}
+
+func sessionToken(con *gorm.DB, user *db.User, auth utils.Authentication) (string, *ErrorCodeResponse) {
+	return sessionTokenExpiresIn(con, user, auth, configs.App().SessionTokenExpire)
+}
+
+func sessionTokenExpiresIn(
+	con *gorm.DB, user *db.User, auth utils.Authentication, expireAfterSec int) (string, *ErrorCodeResponse) {
+	conf := configs.App()
+	ring, err := KeyRing(con)
+	if err != nil {
+		errRes := NewErrResWithErr(ErrorCodeLoadJWTKey, err)
+		return "", &errRes
+	}
+
+	roles, err := db.UserRoleNames(con, user.ID)
+	if err != nil {
+		errRes := NewErrResWithErr(ErrorCodeDBTransaction, err)
+		return "", &errRes
+	}
+
+	token := utils.NewJWT(expireAfterSec)
+	sessionToken, err := token.Session(
+		user.ID, user.Email, roles, auth, ring.SigningKey(), conf.IssuerURL())
+	if err != nil {
+		errRes := NewErrResWithErr(ErrorCodeSignJWT, err)
+		return "", &errRes
+	}
+	return sessionToken, nil
+}
+
+// issueTokens issues session token and refresh token.
+// The refresh token expires by 'SessionMaxLifetime' from the signin,
+// and the events are written with it.
+func issueTokens(
+	con *gorm.DB, user *db.User, auth utils.Authentication,
+	events ...*db.OutboxEvent) (*TokenResponse, *ErrorCodeResponse) {
+	conf := configs.App()
+	sessionToken, errRes := sessionToken(con, user, auth)
+	if errRes != nil {
+		return nil, errRes
+	}
+
+	refreshToken, err := db.IssueRefreshToken(
+		con, user.ID, auth,
+		expireWithin(conf.RefreshTokenExpire, sessionLifetimeLeft(auth)), events...)
+	if err != nil {
+		errRes := NewErrResWithErr(ErrorCodeDBTransaction, err)
+		return nil, &errRes
+	}
+	return &TokenResponse{sessionToken, refreshToken}, nil
+}
+
+// RefreshToken exchanges a refresh token for a new session token and refresh token.
+// The new tokens expire by the refresh token exchanged and 'SessionMaxLifetime' from the signin,
+// so that refreshing does not keep the user signed in forever.
+func RefreshToken(c *gin.Context) {
+	conf := configs.App()
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param RefreshTokenParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	refreshToken, rt, err := db.RotateRefreshToken(con, param.RefreshToken)
+	if err != nil {
+		httpStatusCode := http.StatusUnauthorized
+		var errRes ErrorCodeResponse
+		switch {
+		case errors.Is(err, db.ErrorNotFoundRefreshToken),
+			errors.Is(err, db.ErrorRevokedRefreshToken):
+			errRes = NewErrRes(ErrorCodeInvalidRefreshToken)
+		case errors.Is(err, db.ErrorExpiredRefreshToken):
+			errRes = NewErrRes(ErrorCodeExpiredRefreshToken)
+		case errors.Is(err, db.ErrorReusedRefreshToken):
+			errRes = NewErrRes(ErrorCodeReusedRefreshToken)
+		default:
+			httpStatusCode = http.StatusInternalServerError
+			errRes = NewErrResWithErr(ErrorCodeDBTransaction, err)
+		}
+		c.AbortWithStatusJSON(httpStatusCode, errRes)
+		return
+	}
+
+	user := db.User{}
+	if con.First(&user, rt.UserID).RecordNotFound() {
+		c.AbortWithStatusJSON(
+			http.StatusUnauthorized,
+			NewErrRes(ErrorCodeNotFoundUser))
+		return
+	}
+	setAuditTarget(c, &user)
+
+	auth := rt.Authentication()
+	left := sessionLifetimeLeft(auth)
+	if left <= 0 {
+		if err := db.RevokeRefreshTokenFamily(con, rt.Family); err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				NewErrResWithErr(ErrorCodeDBTransaction, err))
+			return
+		}
+		c.AbortWithStatusJSON(
+			http.StatusUnauthorized,
+			NewErrRes(ErrorCodeSessionLifetimeExceeded))
+		return
+	}
+
+	sessionToken, errRes := sessionTokenExpiresIn(
+		con, &user, auth, expireWithin(conf.SessionTokenExpire, left))
+	if errRes != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError, errRes)
+		return
+	}
+
+	c.JSON(http.StatusOK, TokenResponse{sessionToken, refreshToken})
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+func signinForTest(router http.Handler, email, password string) (*SiginResponse, error) {
+	body, err := json.Marshal(SigninParam{Email: email, Password: password})
+	if err != nil {
+		return nil, err
+	}
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/signin", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("signin failed with status %d", w.Code)
+	}
+
+	var resBody SiginResponse
+	if err := json.NewDecoder(w.Body).Decode(&resBody); err != nil {
+		return nil, err
+	}
+	return &resBody, nil
+}
+
+func refreshTokenForTest(router http.Handler, refreshToken string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(RefreshTokenParam{RefreshToken: refreshToken})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/token/refresh", bytes.NewReader(body))
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRefreshToken(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	signinRes, err := signinForTest(router, user.Email, testPassword)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "", signinRes.RefreshToken)
+
+	w := refreshTokenForTest(router, signinRes.RefreshToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resBody TokenResponse
+	err = json.NewDecoder(w.Body).Decode(&resBody)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "", resBody.Token)
+	assert.NotEqual(t, "", resBody.RefreshToken)
+	assert.NotEqual(t, signinRes.RefreshToken, resBody.RefreshToken)
+
+	w = httptest.NewRecorder()
+	uri := fmt.Sprintf("/users/%s", user.Email)
+	req, err := http.NewRequest("GET", uri, nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", resBody.Token))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRefreshTokenWithReusedToken(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	signinRes, err := signinForTest(router, user.Email, testPassword)
+	assert.NoError(t, err)
+
+	w := refreshTokenForTest(router, signinRes.RefreshToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resBody TokenResponse
+	err = json.NewDecoder(w.Body).Decode(&resBody)
+	assert.NoError(t, err)
+
+	w = refreshTokenForTest(router, signinRes.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var errRes ErrorCodeResponse
+	err = json.NewDecoder(w.Body).Decode(&errRes)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrorCodeReusedRefreshToken, errRes.ErrorCode)
+
+	// 재사용이 감지되면 교체된 토큰도 사용할 수 없다.
+	w = refreshTokenForTest(router, resBody.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	err = json.NewDecoder(w.Body).Decode(&errRes)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrorCodeInvalidRefreshToken, errRes.ErrorCode)
+}
+
+func TestRefreshTokenAfterChangePassword(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+
+	signinRes, err := signinForTest(router, user.Email, testPassword)
+	assert.NoError(t, err)
+
+	body, err := json.Marshal(ChangePasswordParam{
+		CurrentPassword: testPassword,
+		Password:        changedPassword,
+	})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	uri := fmt.Sprintf("/users/%s/password", user.Email)
+	req, err := http.NewRequest("PUT", uri, bytes.NewReader(body))
+	assert.NoError(t, err)
+	setAuthJWTForTest(req, user)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = refreshTokenForTest(router, signinRes.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRefreshTokenUntilMaxLifetime(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	conf := configs.App()
+	key, err := JWTKey()
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	signinRes, err := signinForTest(router, user.Email, testPassword)
+	assert.NoError(t, err)
+
+	// 로그인할 때 받은 refresh token 도 최대 수명까지만 유효하다.
+	var rt db.RefreshToken
+	assert.NoError(t, testDBCon.Where("user_id = ?", user.ID).First(&rt).Error)
+	// 초 단위로 자른 로그인 시각과 1초 안에서 차이가 난다.
+	assert.False(t, rt.ExpiresAt.After(
+		time.Unix(rt.AuthTime+int64(conf.SessionMaxLifetime)+1, 0)))
+
+	setAuthTime := func(authTime int64) {
+		assert.NoError(t, testDBCon.Model(&db.RefreshToken{}).
+			Where("user_id = ?", user.ID).Update("auth_time", authTime).Error)
+	}
+
+	// 최대 수명이 얼마 남지 않으면 그때까지만 유효한 토큰을 준다.
+	authTime := time.Now().Unix() - int64(conf.SessionMaxLifetime) + 60
+	setAuthTime(authTime)
+	w := refreshTokenForTest(router, signinRes.RefreshToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resBody TokenResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resBody))
+	claims, err := utils.ParseSessionJWT(resBody.Token, key)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, claims.ExpiresAt, authTime+int64(conf.SessionMaxLifetime))
+
+	// 로그인한 지 최대 수명이 지나면 교체할 수 없고 같은 family 가 폐기된다.
+	setAuthTime(time.Now().Unix() - int64(conf.SessionMaxLifetime))
+	w = refreshTokenForTest(router, resBody.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, ErrorCodeSessionLifetimeExceeded, errCodeForTest(t, w))
+
+	var active int
+	assert.NoError(t, testDBCon.Model(&db.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&active).Error)
+	assert.Zero(t, active)
+}
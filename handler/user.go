@@ -10,7 +10,6 @@ import (
 
 	"github.com/loganstone/auth/configs"
 	"github.com/loganstone/auth/db"
-	"github.com/loganstone/auth/utils"
 )
 
 // UsersResponse .
@@ -121,7 +120,8 @@ func User(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
-// DeleteUser .
+// DeleteUser deletes the user.
+// Users having a role the requester can not grant, and the last superuser, are not deleted.
 func DeleteUser(c *gin.Context) {
 	con := DBConnOrAbort(c)
 	if con == nil {
@@ -134,7 +134,16 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
+	if isAbortedAsNotDeletable(c, con, user) {
+		return
+	}
+
 	if err := user.Delete(con); err != nil {
+		abortWithRoleError(c, err)
+		return
+	}
+
+	if err := db.RevokeRefreshTokens(con, user.ID); err != nil {
 		c.AbortWithStatusJSON(
 			http.StatusInternalServerError,
 			NewErrResWithErr(ErrorCodeDBTransaction, err))
@@ -144,7 +153,9 @@ func DeleteUser(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
-// RenewSession .
+// RenewSession issues a new session token with the same authentication.
+// Sessions are renewed only until 'SessionMaxLifetime' from the signin,
+// and the renewed token expires by then too.
 func RenewSession(c *gin.Context) {
 	conf := configs.App()
 	con := DBConnOrAbort(c)
@@ -158,12 +169,20 @@ func RenewSession(c *gin.Context) {
 		return
 	}
 
-	token := utils.NewJWT(conf.SessionTokenExpire)
-	sessionToken, err := token.Session(user.ID, user.Email, conf.JWTSigninKey, conf.Org)
-	if err != nil {
+	auth := authentication(c)
+	left := sessionLifetimeLeft(auth)
+	if left <= 0 {
 		c.AbortWithStatusJSON(
-			http.StatusInternalServerError,
-			NewErrResWithErr(ErrorCodeSignJWT, err))
+			http.StatusUnauthorized,
+			NewErrRes(ErrorCodeSessionLifetimeExceeded))
+		return
+	}
+
+	sessionToken, errRes := sessionTokenExpiresIn(
+		con, user, auth, expireWithin(conf.SessionTokenExpire, left))
+	if errRes != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError, errRes)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"token": sessionToken})
@@ -9,17 +9,20 @@ import (
 	"runtime"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/loganstone/auth/configs"
 	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
 )
 
 func TestUser(t *testing.T) {
 	user, err := testUser(testDBCon)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/users/%s", testEmail())
@@ -51,7 +54,7 @@ func TestUserWithNonexistentEmail(t *testing.T) {
 
 	nonexistentEmail := testEmail()
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/admin/users/%s", nonexistentEmail)
@@ -71,7 +74,7 @@ func TestDeleteUser(t *testing.T) {
 	user, err := testUser(testDBCon)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/users/%s", testEmail())
@@ -99,7 +102,7 @@ func TestDeleteUserAsOtherUser(t *testing.T) {
 	err = otherUser.Create(testDBCon, testPassword)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/users/%s", user.Email)
@@ -116,7 +119,7 @@ func TestDeleteUserAsAdmin(t *testing.T) {
 	admin, err := testAdmin(testDBCon)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/admin/users/%s", user.Email)
@@ -139,7 +142,7 @@ func TestUsersAsAdmin(t *testing.T) {
 		users[i] = user
 	}
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("GET", "/admin/users", nil)
@@ -186,7 +189,7 @@ func TestUsersAsUser(t *testing.T) {
 	user, err := testUser(testDBCon)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("GET", "/admin/users", nil)
@@ -203,7 +206,7 @@ func TestSearchUsersAsAdmin(t *testing.T) {
 	user, err := testUser(testDBCon)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	req, err := http.NewRequest("GET", "/admin/users", nil)
@@ -243,7 +246,7 @@ func TestRenewSession(t *testing.T) {
 	user, err := testUser(testDBCon)
 	assert.NoError(t, err)
 
-	router := New()
+	router := New(testDBCon)
 
 	w := httptest.NewRecorder()
 	uri := fmt.Sprintf("/users/%s/session", testEmail())
@@ -284,6 +287,52 @@ func TestRenewSession(t *testing.T) {
 	assert.Nil(t, resBody.OTPConfirmedAt)
 }
 
+func TestRenewSessionUntilMaxLifetime(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	conf := configs.App()
+	key, err := JWTKey()
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	uri := fmt.Sprintf("/users/%s/session", user.Email)
+	renew := func(authTime int64) *httptest.ResponseRecorder {
+		auth := utils.Authentication{
+			AuthTime: authTime,
+			AMR:      []string{utils.AMRPassword},
+		}
+		token, err := utils.NewJWT(10).Session(user.ID, user.Email, nil, auth, key, conf.IssuerURL())
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, err := http.NewRequest("PUT", uri, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 최대 수명이 얼마 남지 않으면 그때까지만 유효한 토큰을 준다.
+	authTime := time.Now().Unix() - int64(conf.SessionMaxLifetime) + 60
+	w := renew(authTime)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resToken map[string]string
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resToken))
+	claims, err := utils.ParseSessionJWT(resToken["token"], key)
+	assert.NoError(t, err)
+	assert.Equal(t, authTime, claims.AuthTime)
+	assert.LessOrEqual(t, claims.ExpiresAt, authTime+int64(conf.SessionMaxLifetime))
+
+	// 로그인한 지 최대 수명이 지나면 다시 로그인해야 한다.
+	w = renew(time.Now().Unix() - int64(conf.SessionMaxLifetime))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, ErrorCodeSessionLifetimeExceeded, errCodeForTest(t, w))
+
+	w = renew(0)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, ErrorCodeSessionLifetimeExceeded, errCodeForTest(t, w))
+}
+
 func BenchmarkCreateUsersWithLoop(b *testing.B) {
 	userCount := 10
 	for i := 0; i < b.N; i++ {
@@ -334,3 +383,35 @@ func BenchmarkCreateUsersWithGoroutineOnOneCPU(b *testing.B) {
 		wg.Wait()
 	}
 }
+
+func TestDeleteUserNotDeletable(t *testing.T) {
+	router := New(testDBCon)
+	manager, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	assert.NoError(t, newRoleForTest(t, "users:delete").Assign(testDBCon, manager.ID))
+
+	// 가진 권한보다 큰 역할의 사용자는 지울 수 없다.
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	w := jsonRequestForTest(router, "DELETE", "/admin/users/"+admin.Email, nil, manager)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, ErrorCodeNotGrantableRole, errCodeForTest(t, w))
+
+	support, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	assert.NoError(t, newRoleForTest(t, "users:read").Assign(testDBCon, support.ID))
+	w = jsonRequestForTest(router, "DELETE", "/admin/users/"+support.Email, nil, manager)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	w = jsonRequestForTest(router, "DELETE", "/admin/users/"+user.Email, nil, manager)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// 삭제된 사용자에게는 역할을 줄 수 없다.
+	role := newRoleForTest(t)
+	w = jsonRequestForTest(router, "PUT",
+		fmt.Sprintf("/admin/users/%s/roles/%s", user.Email, role.Name), nil, admin)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ErrorCodeNotFoundUser, errCodeForTest(t, w))
+}
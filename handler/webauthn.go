@@ -0,0 +1,428 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+// RegisterWebAuthnParam .
+type RegisterWebAuthnParam struct {
+	Nickname   string                               `json:"nickname" binding:"max=64"`
+	Credential utils.WebAuthnRegistrationCredential `json:"credential" binding:"required"`
+}
+
+// WebAuthnSigninOptionsParam .
+// Options for passkey signin are returned without 'Email'.
+// With 'Email', options are for security key as second factor of Signin.
+type WebAuthnSigninOptionsParam struct {
+	Email string `json:"email"`
+}
+
+// SigninWithWebAuthnParam .
+type SigninWithWebAuthnParam struct {
+	Credential utils.WebAuthnAuthenticationCredential `json:"credential" binding:"required"`
+}
+
+func relyingParty() *utils.WebAuthnRelyingParty {
+	conf := configs.App()
+	return &utils.WebAuthnRelyingParty{
+		ID:      conf.WebAuthnRPID,
+		Name:    conf.Org,
+		Origins: conf.WebAuthnOrigins(),
+	}
+}
+
+// webAuthnUserHandle returns the user handle stored in the authenticator.
+// It is user id, so that email is not kept in the authenticator.
+func webAuthnUserHandle(userID uint) string {
+	return utils.EncodeBase64URL([]byte(strconv.FormatUint(uint64(userID), 10)))
+}
+
+func webAuthnCredentialsOrAbort(c *gin.Context, con *gorm.DB, userID uint) []db.WebAuthnCredential {
+	creds, err := db.WebAuthnCredentials(con, userID)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return nil
+	}
+	return creds
+}
+
+func webAuthnDescriptors(creds []db.WebAuthnCredential) []utils.WebAuthnCredentialDescriptor {
+	descriptors := []utils.WebAuthnCredentialDescriptor{}
+	for _, cred := range creds {
+		descriptors = append(descriptors, cred.Descriptor())
+	}
+	return descriptors
+}
+
+func consumeWebAuthnChallengeOrAbort(
+	c *gin.Context, con *gorm.DB, challenge, ceremony string) *db.WebAuthnChallenge {
+
+	ch, err := db.ConsumeWebAuthnChallenge(con, challenge, ceremony)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrorNotFoundWebAuthnChallenge),
+			errors.Is(err, db.ErrorExpiredWebAuthnChallenge),
+			errors.Is(err, db.ErrorUsedWebAuthnChallenge):
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				NewErrResWithErr(ErrorCodeInvalidWebAuthnChallenge, err))
+		default:
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				NewErrResWithErr(ErrorCodeDBTransaction, err))
+		}
+		return nil
+	}
+	return ch
+}
+
+// verifyWebAuthnAssertionOrAbort verifies the assertion and saves the sign count.
+// 'userID' is the user signing in with password, or zero for passkey signin.
+func verifyWebAuthnAssertionOrAbort(
+	c *gin.Context, con *gorm.DB, cred *utils.WebAuthnAuthenticationCredential,
+	userID uint, requireUV bool) (*db.WebAuthnCredential, *utils.WebAuthnAssertion) {
+
+	challenge, err := cred.Challenge()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeInvalidWebAuthnCredential, err))
+		return nil, nil
+	}
+
+	ch := consumeWebAuthnChallengeOrAbort(c, con, challenge, db.WebAuthnAuthentication)
+	if ch == nil {
+		return nil, nil
+	}
+
+	stored := db.FindWebAuthnCredential(con, cred.ID)
+	if stored == nil || (userID != 0 && stored.UserID != userID) {
+		c.AbortWithStatusJSON(
+			http.StatusUnauthorized,
+			NewErrRes(ErrorCodeNotFoundWebAuthnCredential))
+		return nil, nil
+	}
+
+	// 특정 사용자에게 발급한 challenge 는 그 사용자의 credential 로만 쓸 수 있다.
+	if ch.UserID != 0 && ch.UserID != stored.UserID {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidWebAuthnChallenge))
+		return nil, nil
+	}
+
+	userHandle := cred.Response.UserHandle
+	if userHandle != "" && userHandle != webAuthnUserHandle(stored.UserID) {
+		c.AbortWithStatusJSON(
+			http.StatusUnauthorized,
+			NewErrResWithErr(ErrorCodeInvalidWebAuthnCredential,
+				errors.New("user handle mismatch")))
+		return nil, nil
+	}
+
+	assertion, err := relyingParty().VerifyAuthentication(
+		cred, challenge, stored.PublicKey, stored.SignCount, requireUV)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusUnauthorized,
+			NewErrResWithErr(ErrorCodeInvalidWebAuthnCredential, err))
+		return nil, nil
+	}
+
+	if err := stored.Used(con, assertion.SignCount); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return nil, nil
+	}
+	return stored, assertion
+}
+
+// WebAuthnRegistrationOptions issues challenge and returns options
+// to create new credential in the authenticator.
+func WebAuthnRegistrationOptions(c *gin.Context) {
+	conf := configs.App()
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	user := findUserByEmailOrAbort(
+		c.Param("email"), c, con, http.StatusNotFound)
+	if user == nil {
+		return
+	}
+
+	creds := webAuthnCredentialsOrAbort(c, con, user.ID)
+	if creds == nil {
+		return
+	}
+
+	challenge, err := db.IssueWebAuthnChallenge(
+		con, user.ID, db.WebAuthnRegistration, conf.WebAuthnChallengeExpire)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	userEntity := utils.WebAuthnUserEntity{
+		ID:          webAuthnUserHandle(user.ID),
+		Name:        user.Email,
+		DisplayName: user.Email,
+	}
+	c.JSON(http.StatusOK, relyingParty().CreationOptions(
+		challenge, userEntity, webAuthnDescriptors(creds),
+		conf.WebAuthnChallengeExpire))
+}
+
+// RegisterWebAuthnCredential verifies new credential and registers it.
+func RegisterWebAuthnCredential(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	user := findUserByEmailOrAbort(
+		c.Param("email"), c, con, http.StatusNotFound)
+	if user == nil {
+		return
+	}
+
+	var param RegisterWebAuthnParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	challenge, err := param.Credential.Challenge()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeInvalidWebAuthnCredential, err))
+		return
+	}
+
+	ch := consumeWebAuthnChallengeOrAbort(c, con, challenge, db.WebAuthnRegistration)
+	if ch == nil {
+		return
+	}
+
+	if ch.UserID != user.ID {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidWebAuthnChallenge))
+		return
+	}
+
+	attested, err := relyingParty().VerifyRegistration(
+		&param.Credential, challenge, false)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeInvalidWebAuthnCredential, err))
+		return
+	}
+
+	credentialID := utils.EncodeBase64URL(attested.ID)
+	if db.FindWebAuthnCredential(con, credentialID) != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeWebAuthnCredentialAlreadyRegistered))
+		return
+	}
+
+	cred := db.WebAuthnCredential{
+		UserID:       user.ID,
+		CredentialID: credentialID,
+		PublicKey:    attested.PublicKey,
+		SignCount:    attested.SignCount,
+		Transports:   strings.Join(param.Credential.Response.Transports, " "),
+		Nickname:     param.Nickname,
+	}
+	if aaguid, err := uuid.FromBytes(attested.AAGUID); err == nil {
+		cred.AAGUID = aaguid.String()
+	}
+
+	if err := cred.Create(con); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, cred)
+}
+
+// WebAuthnCredentials .
+func WebAuthnCredentials(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	user := findUserByEmailOrAbort(
+		c.Param("email"), c, con, http.StatusNotFound)
+	if user == nil {
+		return
+	}
+
+	creds := webAuthnCredentialsOrAbort(c, con, user.ID)
+	if creds == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credentials": creds})
+}
+
+// DeleteWebAuthnCredential .
+func DeleteWebAuthnCredential(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	user := findUserByEmailOrAbort(
+		c.Param("email"), c, con, http.StatusNotFound)
+	if user == nil {
+		return
+	}
+
+	cred := db.FindWebAuthnCredential(con, c.Param("credential_id"))
+	if cred == nil || cred.UserID != user.ID {
+		c.AbortWithStatusJSON(
+			http.StatusNotFound,
+			NewErrRes(ErrorCodeNotFoundWebAuthnCredential))
+		return
+	}
+
+	if err := cred.Delete(con); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// WebAuthnSigninOptions issues challenge and returns options
+// to sign it with the authenticator.
+// Passkey signin requires user verification such as PIN or biometrics,
+// because no password is given.
+func WebAuthnSigninOptions(c *gin.Context) {
+	conf := configs.App()
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param WebAuthnSigninOptionsParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	var userID uint
+	allow := []utils.WebAuthnCredentialDescriptor{}
+	userVerification := utils.WebAuthnUserVerificationRequired
+	if param.Email != "" {
+		user := findUserByEmailOrAbort(
+			param.Email, c, con, http.StatusBadRequest)
+		if user == nil {
+			return
+		}
+
+		creds := webAuthnCredentialsOrAbort(c, con, user.ID)
+		if creds == nil {
+			return
+		}
+
+		if len(creds) == 0 {
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				NewErrRes(ErrorCodeNotFoundWebAuthnCredential))
+			return
+		}
+		userID = user.ID
+		allow = webAuthnDescriptors(creds)
+		userVerification = utils.WebAuthnUserVerificationPreferred
+	}
+
+	challenge, err := db.IssueWebAuthnChallenge(
+		con, userID, db.WebAuthnAuthentication, conf.WebAuthnChallengeExpire)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, relyingParty().RequestOptions(
+		challenge, allow, userVerification, conf.WebAuthnChallengeExpire))
+}
+
+// SigninWithWebAuthn signs in with passkey without password.
+// Verified passkey is both possession and inherence factor,
+// so OTP is not required.
+func SigninWithWebAuthn(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param SigninWithWebAuthnParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	// 패스키는 추측할 수 없지만 IP 의 시도는 다른 방법과 함께 센다.
+	attempt := newSigninAttempt(c, con)
+	if attempt == nil {
+		return
+	}
+	defer attempt.end()
+
+	cred, assertion := verifyWebAuthnAssertionOrAbort(c, con, &param.Credential, 0, true)
+	if assertion == nil {
+		return
+	}
+
+	user := db.User{}
+	if con.First(&user, cred.UserID).RecordNotFound() {
+		c.AbortWithStatusJSON(
+			http.StatusUnauthorized,
+			NewErrRes(ErrorCodeNotFoundUser))
+		return
+	}
+	setAuditTarget(c, &user)
+	attempt.setUser(user.ID, user.Email)
+
+	auth := utils.Authentication{
+		AuthTime: time.Now().Unix(),
+		AMR:      []string{utils.AMRHardwareKey, utils.AMRMultiFactor},
+	}
+	signin(c, con, &user, auth)
+}
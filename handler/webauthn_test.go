@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+func testAuthenticator() *utils.MockAuthenticator {
+	conf := configs.App()
+	return utils.NewMockAuthenticator(conf.WebAuthnOrigins()[0])
+}
+
+func jsonRequestForTest(router http.Handler, method, uri string, param interface{}, user *db.User) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(param)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, uri, bytes.NewReader(body))
+	if user != nil {
+		setAuthJWTForTest(req, user)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func registerWebAuthnForTest(
+	t *testing.T, router http.Handler, user *db.User,
+	authenticator *utils.MockAuthenticator) *httptest.ResponseRecorder {
+
+	uri := fmt.Sprintf("/users/%s/webauthn", user.Email)
+	w := jsonRequestForTest(router, "POST", uri+"/challenge", nil, user)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var options utils.WebAuthnCreationOptions
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&options))
+
+	cred, err := authenticator.Create(&options)
+	assert.NoError(t, err)
+
+	param := RegisterWebAuthnParam{Nickname: "test key", Credential: *cred}
+	return jsonRequestForTest(router, "POST", uri, param, user)
+}
+
+func webAuthnSigninOptionsForTest(t *testing.T, router http.Handler, email string) *utils.WebAuthnRequestOptions {
+	w := jsonRequestForTest(router, "POST", "/signin/webauthn/challenge",
+		WebAuthnSigninOptionsParam{Email: email}, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var options utils.WebAuthnRequestOptions
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&options))
+	return &options
+}
+
+func TestRegisterWebAuthnCredential(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	authenticator := testAuthenticator()
+	w := registerWebAuthnForTest(t, router, user, authenticator)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var cred db.JSONWebAuthnCredential
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&cred))
+	assert.Equal(t, "test key", cred.Nickname)
+	assert.Equal(t, []string{"internal"}, cred.Transports)
+
+	uri := fmt.Sprintf("/users/%s/webauthn", user.Email)
+	w = jsonRequestForTest(router, "GET", uri, nil, user)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resBody map[string][]db.JSONWebAuthnCredential
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resBody))
+	assert.Len(t, resBody["credentials"], 1)
+	assert.Equal(t, cred.CredentialID, resBody["credentials"][0].CredentialID)
+
+	// 이미 등록한 인증기는 excludeCredentials 에 포함된다.
+	w = jsonRequestForTest(router, "POST", uri+"/challenge", nil, user)
+	var options utils.WebAuthnCreationOptions
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&options))
+	assert.Equal(t, cred.CredentialID, options.ExcludeCredentials[0].ID)
+	assert.Equal(t, configs.App().WebAuthnRPID, options.RP.ID)
+	_, err = authenticator.Create(&options)
+	assert.Error(t, err)
+}
+
+func TestRegisterWebAuthnCredentialWithUsedChallenge(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	uri := fmt.Sprintf("/users/%s/webauthn", user.Email)
+	w := jsonRequestForTest(router, "POST", uri+"/challenge", nil, user)
+	var options utils.WebAuthnCreationOptions
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&options))
+
+	cred, err := testAuthenticator().Create(&options)
+	assert.NoError(t, err)
+	param := RegisterWebAuthnParam{Credential: *cred}
+	w = jsonRequestForTest(router, "POST", uri, param, user)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = jsonRequestForTest(router, "POST", uri, param, user)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var errRes ErrorCodeResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&errRes))
+	assert.Equal(t, ErrorCodeInvalidWebAuthnChallenge, errRes.ErrorCode)
+
+	// 다른 사용자에게 발급한 challenge 로는 등록할 수 없다.
+	other, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	w = jsonRequestForTest(router, "POST", uri+"/challenge", nil, user)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&options))
+	cred, err = testAuthenticator().Create(&options)
+	assert.NoError(t, err)
+	w = jsonRequestForTest(router, "POST",
+		fmt.Sprintf("/users/%s/webauthn", other.Email),
+		RegisterWebAuthnParam{Credential: *cred}, other)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDeleteWebAuthnCredential(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	w := registerWebAuthnForTest(t, router, user, testAuthenticator())
+	var cred db.JSONWebAuthnCredential
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&cred))
+
+	other, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	uri := fmt.Sprintf("/users/%s/webauthn/%s", other.Email, cred.CredentialID)
+	w = jsonRequestForTest(router, "DELETE", uri, nil, other)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	uri = fmt.Sprintf("/users/%s/webauthn/%s", user.Email, cred.CredentialID)
+	w = jsonRequestForTest(router, "DELETE", uri, nil, user)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Nil(t, db.FindWebAuthnCredential(testDBCon, cred.CredentialID))
+
+	w = jsonRequestForTest(router, "DELETE", uri, nil, user)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSigninWithWebAuthn(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	authenticator := testAuthenticator()
+	w := registerWebAuthnForTest(t, router, user, authenticator)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	options := webAuthnSigninOptionsForTest(t, router, "")
+	assert.Empty(t, options.AllowCredentials)
+	assert.Equal(t, utils.WebAuthnUserVerificationRequired, options.UserVerification)
+
+	cred, err := authenticator.Get(options)
+	assert.NoError(t, err)
+	param := SigninWithWebAuthnParam{Credential: *cred}
+	w = jsonRequestForTest(router, "POST", "/signin/webauthn", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resBody SiginResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resBody))
+	assert.Equal(t, user.Email, resBody.User.Email)
+	assert.NotEmpty(t, resBody.Token)
+	assert.NotEmpty(t, resBody.RefreshToken)
+
+	ring, err := KeyRing(testDBCon)
+	assert.NoError(t, err)
+	claims, err := utils.ParseSessionJWT(resBody.Token, ring)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{utils.AMRHardwareKey, utils.AMRMultiFactor}, claims.AMR)
+
+	// 같은 assertion 은 다시 쓸 수 없다.
+	w = jsonRequestForTest(router, "POST", "/signin/webauthn", param, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSigninWithWebAuthnWithoutUserVerification(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	authenticator := testAuthenticator()
+	authenticator.SkipUserVerification = true
+	w := registerWebAuthnForTest(t, router, user, authenticator)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	cred, err := authenticator.Get(webAuthnSigninOptionsForTest(t, router, ""))
+	assert.NoError(t, err)
+	w = jsonRequestForTest(router, "POST", "/signin/webauthn",
+		SigninWithWebAuthnParam{Credential: *cred}, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var errRes ErrorCodeResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&errRes))
+	assert.Equal(t, ErrorCodeInvalidWebAuthnCredential, errRes.ErrorCode)
+}
+
+func TestSigninWithSecurityKey(t *testing.T) {
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+
+	router := New(testDBCon)
+	authenticator := testAuthenticator()
+	authenticator.SkipUserVerification = true
+	w := registerWebAuthnForTest(t, router, user, authenticator)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	param := SigninParam{Email: user.Email, Password: testPassword}
+	w = jsonRequestForTest(router, "POST", "/signin", param, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var errRes ErrorCodeResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&errRes))
+	assert.Equal(t, ErrorCodeRequireVerifyWebAuthn, errRes.ErrorCode)
+
+	options := webAuthnSigninOptionsForTest(t, router, user.Email)
+	assert.Len(t, options.AllowCredentials, 1)
+	param.WebAuthn, err = authenticator.Get(options)
+	assert.NoError(t, err)
+
+	w = jsonRequestForTest(router, "POST", "/signin", param, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resBody SiginResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resBody))
+	ring, err := KeyRing(testDBCon)
+	assert.NoError(t, err)
+	claims, err := utils.ParseSessionJWT(resBody.Token, ring)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]string{utils.AMRPassword, utils.AMRHardwareKey, utils.AMRMultiFactor},
+		claims.AMR)
+
+	// 다른 사용자의 보안 키는 두 번째 인증 수단으로 쓸 수 없다.
+	other, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	otherAuthenticator := testAuthenticator()
+	w = registerWebAuthnForTest(t, router, other, otherAuthenticator)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	param.WebAuthn, err = otherAuthenticator.Get(
+		webAuthnSigninOptionsForTest(t, router, other.Email))
+	assert.NoError(t, err)
+	w = jsonRequestForTest(router, "POST", "/signin", param, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,373 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+const (
+	webhookSecretLen    = 32
+	webhookSecretMinLen = 16
+)
+
+// CreateWebhookParam .
+// 'Secret' is generated if it is empty.
+type CreateWebhookParam struct {
+	URL        string   `json:"url" binding:"required"`
+	EventTypes []string `json:"event_types" binding:"required"`
+	Secret     string   `json:"secret"`
+}
+
+// WebhookResponse .
+// 'Secret' is shown only when the webhook is created.
+type WebhookResponse struct {
+	Webhook db.Webhook `json:"webhook"`
+	Secret  string     `json:"secret"`
+}
+
+// WebhookDeliveriesResponse .
+type WebhookDeliveriesResponse struct {
+	Page       int                  `json:"page"`
+	PageSize   int                  `json:"page_size"`
+	HasNext    bool                 `json:"has_next"`
+	Deliveries []db.WebhookDelivery `json:"deliveries"`
+	Links      []Link               `json:"links"`
+}
+
+// Adjust .
+func (r *WebhookDeliveriesResponse) Adjust(pageSize int) {
+	if len(r.Deliveries) > pageSize {
+		r.HasNext = true
+		r.Deliveries = r.Deliveries[:len(r.Deliveries)-1]
+	}
+}
+
+// AttachLinks .
+func (r *WebhookDeliveriesResponse) AttachLinks(path string) {
+	v := url.Values{}
+	v.Set("page_size", strconv.Itoa(r.PageSize))
+
+	links := []Link{}
+	if r.HasNext {
+		v.Set("page", strconv.Itoa(r.Page+1))
+		links = append(links, Link{
+			Rel:    "next",
+			Method: "GET",
+			Href:   fmt.Sprintf("%s?%s", path, v.Encode()),
+		})
+	}
+
+	if r.Page > 0 {
+		v.Set("page", strconv.Itoa(r.Page-1))
+		links = append(links, Link{
+			Rel:    "prev",
+			Method: "GET",
+			Href:   fmt.Sprintf("%s?%s", path, v.Encode()),
+		})
+	}
+	r.Links = links
+}
+
+// validWebhookURL reports whether the url is absolute http(s) url.
+func validWebhookURL(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validEventTypes reports whether every type is known domain event type.
+func validEventTypes(types []string) bool {
+	if len(types) == 0 {
+		return false
+	}
+	for _, t := range types {
+		if !hasScope(strings.Join(db.EventTypes, " "), t) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookRetry returns how failed webhook delivery is retried.
+func webhookRetry(conf *configs.WebhookConfig) db.WebhookRetry {
+	return db.WebhookRetry{
+		MaxAttempts: conf.MaxAttempts,
+		Base:        conf.RetryBaseDuration(),
+		Max:         conf.RetryMaxDuration(),
+	}
+}
+
+func paramIDOrZero(c *gin.Context, key string) uint {
+	id, err := strconv.ParseUint(c.Param(key), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
+
+func findWebhookOrAbort(c *gin.Context, con *gorm.DB) *db.Webhook {
+	var webhook *db.Webhook
+	if id := paramIDOrZero(c, "webhook_id"); id != 0 {
+		webhook = db.FindWebhook(con, id)
+	}
+	if webhook == nil {
+		c.AbortWithStatusJSON(
+			http.StatusNotFound,
+			NewErrRes(ErrorCodeNotFoundWebhook))
+		return nil
+	}
+	return webhook
+}
+
+func findWebhookDeliveryOrAbort(c *gin.Context, con *gorm.DB, webhook *db.Webhook) *db.WebhookDelivery {
+	var delivery *db.WebhookDelivery
+	if id := paramIDOrZero(c, "delivery_id"); id != 0 {
+		delivery = db.FindWebhookDelivery(con, webhook.ID, id)
+	}
+	if delivery == nil {
+		c.AbortWithStatusJSON(
+			http.StatusNotFound,
+			NewErrRes(ErrorCodeNotFoundWebhookDelivery))
+		return nil
+	}
+	return delivery
+}
+
+// Webhooks .
+func Webhooks(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var webhooks []db.Webhook
+	if err := con.Order("id desc").Find(&webhooks).Error; err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+}
+
+// Webhook .
+func Webhook(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	webhook := findWebhookOrAbort(c, con)
+	if webhook == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// CreateWebhook subscribes the url to the event types.
+// The secret is shown only in this response.
+func CreateWebhook(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	var param CreateWebhookParam
+	if err := c.ShouldBindJSON(&param); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBindJSON, err))
+		return
+	}
+
+	if !validWebhookURL(param.URL) {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidWebhookURL))
+		return
+	}
+
+	if !validEventTypes(param.EventTypes) {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeUnknownEventType))
+		return
+	}
+
+	secret := param.Secret
+	if secret == "" {
+		var err error
+		secret, err = utils.RandomToken(webhookSecretLen)
+		if err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				NewErrResWithErr(ErrorCodeGenerateWebhookSecret, err))
+			return
+		}
+	}
+
+	if len(secret) < webhookSecretMinLen {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrRes(ErrorCodeInvalidWebhookSecret))
+		return
+	}
+
+	webhook := db.Webhook{
+		URL:        param.URL,
+		EventTypes: strings.Join(param.EventTypes, " "),
+		Secret:     secret,
+	}
+	if err := webhook.Create(con); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, WebhookResponse{webhook, secret})
+}
+
+// DeleteWebhook stops events being sent to the webhook.
+// Deliveries are kept, pending ones fail without being sent.
+func DeleteWebhook(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	webhook := findWebhookOrAbort(c, con)
+	if webhook == nil {
+		return
+	}
+
+	if err := webhook.Delete(con); err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// WebhookDeliveries returns deliveries of the webhook, newest first.
+func WebhookDeliveries(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	webhook := findWebhookOrAbort(c, con)
+	if webhook == nil {
+		return
+	}
+
+	page, err := Page(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBadPage, err))
+		return
+	}
+
+	pageSize, err := PageSize(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			NewErrResWithErr(ErrorCodeBadPageSize, err))
+		return
+	}
+
+	deliveries, err := db.FindWebhookDeliveries(
+		con, webhook.ID, page*pageSize, pageSize+1)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	r := WebhookDeliveriesResponse{
+		Page:       page,
+		PageSize:   pageSize,
+		HasNext:    false,
+		Deliveries: deliveries,
+	}
+	r.Adjust(pageSize)
+	r.AttachLinks(c.Request.URL.Path)
+
+	c.JSON(http.StatusOK, r)
+}
+
+// WebhookDelivery returns the delivery with log of attempts.
+func WebhookDelivery(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	webhook := findWebhookOrAbort(c, con)
+	if webhook == nil {
+		return
+	}
+
+	delivery := findWebhookDeliveryOrAbort(c, con, webhook)
+	if delivery == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// RedeliverWebhook sends the delivery again right now, whatever its status is.
+// Result of the attempt is in the delivery log of the response.
+func RedeliverWebhook(c *gin.Context) {
+	con := DBConnOrAbort(c)
+	if con == nil {
+		return
+	}
+
+	conf, err := configs.Webhook()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeWebhookEnv, err))
+		return
+	}
+
+	webhook := findWebhookOrAbort(c, con)
+	if webhook == nil {
+		return
+	}
+
+	delivery := findWebhookDeliveryOrAbort(c, con, webhook)
+	if delivery == nil {
+		return
+	}
+
+	client := utils.NewWebhookClient(conf.TimeoutDuration())
+	err = db.DeliverWebhook(con, client, delivery, webhookRetry(conf), true)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			NewErrResWithErr(ErrorCodeDBTransaction, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/db"
+	"github.com/loganstone/auth/utils"
+)
+
+type webhookForTest struct {
+	Webhook db.JSONWebhook `json:"webhook"`
+	Secret  string         `json:"secret"`
+}
+
+type webhookDeliveriesForTest struct {
+	HasNext    bool                     `json:"has_next"`
+	Deliveries []db.JSONWebhookDelivery `json:"deliveries"`
+	Links      []Link                   `json:"links"`
+}
+
+type webhookDeliveryForTest struct {
+	db.JSONWebhookDelivery
+	Log []db.JSONWebhookAttempt `json:"log"`
+}
+
+func TestCreateWebhook(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	router := New(testDBCon)
+
+	param := CreateWebhookParam{
+		URL:        "https://example.com/hooks",
+		EventTypes: []string{db.EventUserCreated},
+	}
+	w := jsonRequestForTest(router, "POST", "/admin/webhooks", param, user)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = jsonRequestForTest(router, "POST", "/admin/webhooks", param, admin)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created webhookForTest
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, param.URL, created.Webhook.URL)
+	assert.Equal(t, param.EventTypes, created.Webhook.EventTypes)
+	assert.True(t, len(created.Secret) >= webhookSecretMinLen)
+
+	// 시크릿은 생성할 때만 보여준다.
+	uri := fmt.Sprintf("/admin/webhooks/%d", created.Webhook.ID)
+	w = jsonRequestForTest(router, "GET", uri, nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Secret)
+
+	w = jsonRequestForTest(router, "GET", "/admin/webhooks", nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), param.URL)
+
+	cases := []struct {
+		param CreateWebhookParam
+		code  int
+	}{
+		{CreateWebhookParam{URL: "/hooks", EventTypes: param.EventTypes}, ErrorCodeInvalidWebhookURL},
+		{CreateWebhookParam{URL: "ftp://example.com", EventTypes: param.EventTypes}, ErrorCodeInvalidWebhookURL},
+		{CreateWebhookParam{URL: param.URL, EventTypes: []string{"user.unknown"}}, ErrorCodeUnknownEventType},
+		{CreateWebhookParam{URL: param.URL, EventTypes: []string{}}, ErrorCodeUnknownEventType},
+		{CreateWebhookParam{URL: param.URL, EventTypes: param.EventTypes, Secret: "short"}, ErrorCodeInvalidWebhookSecret},
+	}
+	for _, tc := range cases {
+		w = jsonRequestForTest(router, "POST", "/admin/webhooks", tc.param, admin)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, tc.code, errCodeForTest(t, w))
+	}
+
+	w = jsonRequestForTest(router, "DELETE", uri, nil, admin)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = jsonRequestForTest(router, "GET", uri, nil, admin)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ErrorCodeNotFoundWebhook, errCodeForTest(t, w))
+
+	w = jsonRequestForTest(router, "GET", "/admin/webhooks/abc", nil, admin)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	admin, err := testAdmin(testDBCon)
+	assert.NoError(t, err)
+	router := New(testDBCon)
+
+	status := http.StatusInternalServerError
+	var secret string
+	verified := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body json.RawMessage
+		json.NewDecoder(r.Body).Decode(&body)
+		if utils.VerifyWebhookSignature(secret, r.Header, body, time.Minute) {
+			verified++
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	param := CreateWebhookParam{
+		URL:        srv.URL,
+		EventTypes: []string{db.EventPasswordChanged},
+		Secret:     "testsecrettestsecret",
+	}
+	secret = param.Secret
+	w := jsonRequestForTest(router, "POST", "/admin/webhooks", param, admin)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created webhookForTest
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, param.Secret, created.Secret)
+	uri := fmt.Sprintf("/admin/webhooks/%d/deliveries", created.Webhook.ID)
+
+	user, err := testUser(testDBCon)
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		changePassword := ChangePasswordParam{
+			CurrentPassword: testPassword,
+			Password:        testPassword,
+		}
+		w = jsonRequestForTest(router, "PUT",
+			fmt.Sprintf("/users/%s/password", user.Email), changePassword, user)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w = jsonRequestForTest(router, "GET", uri+"?page_size=1", nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var deliveries webhookDeliveriesForTest
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&deliveries))
+	assert.True(t, deliveries.HasNext)
+	assert.Len(t, deliveries.Deliveries, 1)
+	assert.Len(t, deliveries.Links, 1)
+	d := deliveries.Deliveries[0]
+	assert.Equal(t, db.EventPasswordChanged, d.EventType)
+	assert.Equal(t, db.WebhookDeliveryPending, d.Status)
+
+	redelivery := fmt.Sprintf("%s/%d/redelivery", uri, d.ID)
+	w = jsonRequestForTest(router, "POST", redelivery, nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var delivery webhookDeliveryForTest
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&delivery))
+	assert.Equal(t, db.WebhookDeliveryPending, delivery.Status)
+	assert.Equal(t, http.StatusInternalServerError, delivery.LastStatusCode)
+	assert.Len(t, delivery.Log, 1)
+
+	status = http.StatusOK
+	w = jsonRequestForTest(router, "POST", redelivery, nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = jsonRequestForTest(router, "GET", fmt.Sprintf("%s/%d", uri, d.ID), nil, admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	delivery = webhookDeliveryForTest{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&delivery))
+	assert.Equal(t, db.WebhookDeliveryDelivered, delivery.Status)
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.Len(t, delivery.Log, 2)
+	assert.Equal(t, http.StatusOK, delivery.Log[1].StatusCode)
+	assert.Equal(t, 2, verified)
+
+	w = jsonRequestForTest(router, "GET", fmt.Sprintf("%s/%d", uri, d.ID+1000000), nil, admin)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ErrorCodeNotFoundWebhookDelivery, errCodeForTest(t, w))
+}
@@ -12,11 +12,15 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/mysql"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"github.com/loganstone/auth/configs"
 	"github.com/loganstone/auth/db"
 	"github.com/loganstone/auth/handler"
+	"github.com/loganstone/auth/utils"
 )
 
 const localHost = "localhost"
@@ -24,7 +28,7 @@ const localHost = "localhost"
 // Quit .
 var Quit = make(chan os.Signal)
 
-var conf = configs.App()
+var conf *configs.AppConfig
 
 func isListen(host string, port int) bool {
 	conn, err := net.DialTimeout(
@@ -40,20 +44,116 @@ func isListen(host string, port int) bool {
 }
 
 func syncModels(c *configs.DatabaseConfig) error {
-	log.Println("sync models start ...")
-	con, err := db.SyncModels(c.DSN(), c.Echo)
+	utils.DefaultLogger().Infof("sync models start ...")
+	con, err := db.SyncModels(c.Driver, c.DSN(), c.Echo)
 	defer con.Close()
 	if err != nil {
 		return err
 	}
-	log.Println("sync models completed")
+	utils.DefaultLogger().Infof("sync models completed")
 	return nil
 }
 
-func server() *http.Server {
+func server(con *gorm.DB) *http.Server {
 	return &http.Server{
 		Addr:    fmt.Sprintf(":%d", conf.ListenPort),
-		Handler: handler.New(),
+		Handler: handler.New(con),
+	}
+}
+
+// metricsServer returns the server serving only metrics on its own port,
+// so that metrics are not open to clients of the API. It is nil if the port is zero.
+func metricsServer() *http.Server {
+	if conf.MetricsListenPort == 0 {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", utils.MetricsHandler())
+	return &http.Server{
+		Addr:    fmt.Sprintf(":%d", conf.MetricsListenPort),
+		Handler: mux,
+	}
+}
+
+func eventSink(c *configs.EventConfig) (utils.EventSink, error) {
+	switch c.Sink {
+	case configs.EventKafkaSink:
+		return utils.NewKafkaEventSink(
+			c.KafkaBrokers(), c.KafkaTopic, c.KafkaPartition), nil
+	case configs.EventNATSSink:
+		return utils.NewNATSEventSink(
+			c.NATSAddr, c.NATSSubjectPrefix, c.NATSToken), nil
+	}
+	return utils.NewFileEventSink(c.File)
+}
+
+// tracerProvider returns the provider exporting spans to the exporter of the config,
+// or nil if no exporter is set.
+func tracerProvider(c *configs.TraceConfig) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch c.Exporter {
+	case configs.TraceOTLPExporter:
+		exporter, err = utils.NewOTLPSpanExporter(
+			c.OTLPEndpoint, c.Headers(), c.ExportTimeoutDuration())
+	case configs.TraceStdoutExporter:
+		exporter, err = utils.NewWriterSpanExporter(os.Stdout)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewTracerProvider(exporter, c.ServiceName, c.SamplePercent), nil
+}
+
+// relayEvents publishes events in outbox to the sink until done is closed.
+// It does not wait while a full batch is relayed, there may be more events.
+func relayEvents(con *gorm.DB, sink utils.EventSink, c *configs.EventConfig, done <-chan struct{}) {
+	for {
+		n, err := db.RelayOutboxEvents(con, sink, c.RelayBatchSize)
+		if err != nil {
+			utils.DefaultLogger().With("error", err).Errorf("failed relay events")
+		}
+
+		wait := c.RelayIntervalDuration()
+		if err == nil && n == c.RelayBatchSize {
+			wait = 0
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// dispatchWebhooks sends webhook deliveries due until done is closed.
+// It does not wait while a full batch is sent, there may be more deliveries due.
+func dispatchWebhooks(con *gorm.DB, c *configs.WebhookConfig, done <-chan struct{}) {
+	client := utils.NewWebhookClient(c.TimeoutDuration())
+	retry := db.WebhookRetry{
+		MaxAttempts: c.MaxAttempts,
+		Base:        c.RetryBaseDuration(),
+		Max:         c.RetryMaxDuration(),
+	}
+	for {
+		n, err := db.DeliverDueWebhooks(con, client, retry, c.BatchSize)
+		if err != nil {
+			utils.DefaultLogger().With("error", err).Errorf("failed dispatch webhooks")
+		}
+
+		wait := c.DispatchIntervalDuration()
+		if err == nil && n == c.BatchSize {
+			wait = 0
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(wait):
+		}
 	}
 }
 
@@ -66,19 +166,51 @@ func checkListenPort() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(migrate(os.Args[2:], os.Stdout))
+	}
+
+	// 설정은 시작할 때 한 번 만들고, 잘못된 값은 모두 알린 뒤 끝낸다.
+	cfg, err := configs.Load()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	conf = cfg.App()
+
+	// release 모드에서는 로그를 수집하기 쉽게 JSON 으로 남긴다.
+	utils.SetDefaultLogger(
+		utils.NewLogger(os.Stderr, configs.Mode() == configs.ReleaseMode))
+
+	traceConf := cfg.Trace()
+	provider, err := tracerProvider(traceConf)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if provider != nil {
+		otel.SetTracerProvider(provider)
+		// span 을 보내지 못한 에러는 서비스의 로그로 남긴다.
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+			utils.DefaultLogger().With("error", err).Errorf("failed export spans")
+		}))
+	}
+
+	// smtp 서버가 없어도 시작하고, '/readyz' 가 준비되지 않았다고 알린다.
 	if configs.Mode() != configs.TestMode {
 		smtpConf := configs.SMTP()
 		err := smtpConf.DialAndQuit()
 		if err != nil {
-			log.Fatalln(err)
+			utils.DefaultLogger().With("error", err).Errorf("smtp server is not reachable")
 		}
 	}
 
-	dbConf, err := configs.DB()
-	if err != nil {
+	if _, err := handler.JWTKey(); err != nil {
 		log.Fatalln(err)
 	}
 
+	eventConf := cfg.Event()
+	webhookConf := cfg.Webhook()
+	dbConf := cfg.DB()
+
 	if dbConf.SyncModels {
 		if err := syncModels(dbConf); err != nil {
 			log.Fatalln(err)
@@ -87,22 +219,69 @@ func main() {
 
 	checkListenPort()
 
-	srv := server()
+	sink, err := eventSink(eventConf)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer sink.Close()
+
+	// 요청, 이벤트 전달, 웹훅 발송이 하나의 풀을 함께 쓴다.
+	pool, err := db.Pool(dbConf)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer pool.Close()
+
+	relayDone := make(chan struct{})
+	relayStopped := make(chan struct{})
 	go func() {
-		log.Printf("listen port: %d\n", conf.ListenPort)
+		defer close(relayStopped)
+		relayEvents(pool, sink, eventConf, relayDone)
+	}()
+
+	dispatchStopped := make(chan struct{})
+	go func() {
+		defer close(dispatchStopped)
+		dispatchWebhooks(pool, webhookConf, relayDone)
+	}()
+
+	srv := server(pool)
+	go func() {
+		utils.DefaultLogger().Infof("listen port: %d", conf.ListenPort)
 		// service connections
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("listen: %s\n", err)
 		}
 	}()
 
+	metricsSrv := metricsServer()
+	if metricsSrv != nil {
+		go func() {
+			utils.DefaultLogger().Infof("metrics listen port: %d", conf.MetricsListenPort)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("listen metrics: %s\n", err)
+			}
+		}()
+	}
+
 	// Graceful shutdown
 	// kill (no param) default send syscall.SIGTERM
 	// kill -2 is syscall.SIGINT
 	// kill -9 is syscall.SIGKILL but can't be catch, so don't need add it
-	signal.Notify(Quit, syscall.SIGINT, syscall.SIGTERM)
-	<-Quit
-	log.Println("shutdown server ...")
+	// signal.Notify 는 수신을 기다리지 않으므로 버퍼가 있는 채널을 따로 쓴다.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-sig:
+	case <-Quit:
+	}
+	// 로드 밸런서가 요청을 그만 보내도록 먼저 준비되지 않은 상태로 알린다.
+	handler.Drain()
+	healthConf := cfg.Health()
+	utils.DefaultLogger().Infof("draining for %s ...", healthConf.ShutdownDrainDelayDuration())
+	time.Sleep(healthConf.ShutdownDrainDelayDuration())
+
+	utils.DefaultLogger().Infof("shutdown server ...")
 
 	ctx, cancel := context.WithTimeout(
 		context.Background(),
@@ -112,6 +291,30 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("server shutdown:", err)
 	}
+	// 지표는 서버가 멈출 때까지 수집할 수 있게 나중에 멈춘다.
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(ctx); err != nil {
+			utils.DefaultLogger().With("error", err).Errorf("failed shutdown metrics server")
+		}
+	}
+
+	// 서버가 멈춘 뒤 남은 이벤트까지 전달하고 끝낸다.
+	close(relayDone)
+	<-relayStopped
+	<-dispatchStopped
+	if _, err := db.RelayOutboxEvents(pool, sink, eventConf.RelayBatchSize); err != nil {
+		utils.DefaultLogger().With("error", err).Errorf("failed relay events")
+	}
+
+	// 서버가 멈춘 뒤 남은 span 까지 보낸다.
+	if provider != nil {
+		ctx, cancel := context.WithTimeout(
+			context.Background(), traceConf.ExportTimeoutDuration())
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			utils.DefaultLogger().With("error", err).Errorf("failed export spans")
+		}
+	}
 
-	log.Println("server exiting")
+	utils.DefaultLogger().Infof("server exiting")
 }
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"syscall"
 	"testing"
@@ -24,15 +26,17 @@ func TestMain(m *testing.M) {
 
 func setup() {
 	configs.SetMode(configs.TestMode)
+	// 테스트에서는 종료 전에 기다리지 않는다.
+	os.Setenv(configs.EnvPrefix+"SHUTDOWN_DRAIN_DELAY", "0")
 	dbConf, err := configs.DB()
 	if err != nil {
 		log.Fatalln(err)
 	}
-	err = db.Reset(dbConf.DSN(), dbConf.DBName())
+	err = db.Reset(dbConf.Driver, dbConf.DSN(), dbConf.DBName())
 	if err != nil {
 		log.Fatalln(err)
 	}
-	testDBCon, err = db.Connection(dbConf.DSN(), dbConf.Echo)
+	testDBCon, err = db.Connection(dbConf.Driver, dbConf.DSN(), dbConf.Echo)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -50,6 +54,15 @@ func TestFuncMain(t *testing.T) {
 	for !isListen(localHost, conf.ListenPort) {
 		continue
 	}
+
+	// 지표는 따로 연 포트에서만 볼 수 있다.
+	for !isListen(localHost, conf.MetricsListenPort) {
+		continue
+	}
+	res, err := http.Get(fmt.Sprintf("http://%s:%d/metrics", localHost, conf.MetricsListenPort))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
 	Quit <- syscall.SIGINT
 
 	dbConf, err := configs.DB()
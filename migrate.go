@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/loganstone/auth/configs"
+	"github.com/loganstone/auth/db"
+)
+
+const migrateUsage = `usage: auth migrate <command> [steps]
+
+commands:
+  up [steps]    apply migrations not applied yet, all by default
+  down [steps]  revert applied migrations from the latest, 1 by default
+  status        show migrations and when they were applied`
+
+var errMigrateUsage = errors.New(migrateUsage)
+
+// migrate runs 'migrate' command and returns exit code.
+func migrate(args []string, w io.Writer) int {
+	if err := runMigrate(args, w); err != nil {
+		fmt.Fprintln(w, err)
+		return 1
+	}
+	return 0
+}
+
+func runMigrate(args []string, w io.Writer) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errMigrateUsage
+	}
+
+	steps := 0
+	if args[0] == "down" {
+		steps = 1
+	}
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || args[0] == "status" {
+			return errMigrateUsage
+		}
+		steps = n
+	}
+
+	cfg, err := configs.Load()
+	if err != nil {
+		return err
+	}
+	dbConf := cfg.DB()
+	con, err := db.Connection(dbConf.Driver, dbConf.DSN(), dbConf.Echo)
+	if err != nil {
+		return err
+	}
+	defer con.Close()
+
+	switch args[0] {
+	case "up":
+		done, err := db.MigrateUp(con, steps)
+		for _, m := range done {
+			fmt.Fprintf(w, "applied %d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "down":
+		done, err := db.MigrateDown(con, steps)
+		for _, m := range done {
+			fmt.Fprintf(w, "reverted %d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := db.MigrationStatuses(con)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return tw.Flush()
+	}
+	return errMigrateUsage
+}
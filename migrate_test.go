@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loganstone/auth/db"
+)
+
+func TestMigrateCommand(t *testing.T) {
+	migrations, err := db.Migrations()
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	for _, args := range [][]string{
+		{}, {"sideways"}, {"up", "0"}, {"down", "x"}, {"status", "1"}, {"up", "1", "2"},
+	} {
+		out.Reset()
+		assert.Equal(t, 1, migrate(args, &out))
+		assert.Equal(t, migrateUsage+"\n", out.String())
+	}
+
+	out.Reset()
+	assert.Equal(t, 0, migrate([]string{"up"}, &out))
+	assert.True(t, testDBCon.HasTable("users"))
+
+	out.Reset()
+	assert.Equal(t, 0, migrate([]string{"status"}, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, len(migrations)+1)
+	assert.NotContains(t, out.String(), "pending")
+
+	out.Reset()
+	assert.Equal(t, 0, migrate([]string{"down", "100"}, &out))
+	assert.Contains(t, out.String(), "reverted 1_init")
+	assert.False(t, testDBCon.HasTable("users"))
+
+	out.Reset()
+	assert.Equal(t, 0, migrate([]string{"status"}, &out))
+	assert.Contains(t, out.String(), "pending")
+
+	out.Reset()
+	assert.Equal(t, 0, migrate([]string{"up", "1"}, &out))
+	assert.Equal(t, "applied 1_init\n", out.String())
+	assert.True(t, testDBCon.HasTable("users"))
+}
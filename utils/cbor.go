@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// CBOR major types.
+// reference - https://tools.ietf.org/html/rfc8949#section-3.1
+const (
+	cborUint = iota
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+const cborMaxDepth = 16
+
+var errCBORTruncated = errors.New("cbor: unexpected end of data")
+
+// cborPair is a key-value pair of CBOR map.
+// Encoding keeps the order of pairs, so that output is deterministic.
+type cborPair struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// cborOrderedMap is CBOR map to be encoded.
+type cborOrderedMap []cborPair
+
+// decodeCBOR decodes single CBOR data item at the beginning of b.
+// It returns the item and the number of bytes read.
+// Only definite length items used by WebAuthn are supported.
+// Integers are int64, maps are map[interface{}]interface{}.
+func decodeCBOR(b []byte) (interface{}, int, error) {
+	return decodeCBORItem(b, 0)
+}
+
+func cborHead(b []byte) (major byte, arg uint64, n int, err error) {
+	if len(b) < 1 {
+		return 0, 0, 0, errCBORTruncated
+	}
+	major = b[0] >> 5
+	info := b[0] & 0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), 1, nil
+	case info == 24:
+		if len(b) < 2 {
+			return 0, 0, 0, errCBORTruncated
+		}
+		return major, uint64(b[1]), 2, nil
+	case info == 25:
+		if len(b) < 3 {
+			return 0, 0, 0, errCBORTruncated
+		}
+		return major, uint64(binary.BigEndian.Uint16(b[1:])), 3, nil
+	case info == 26:
+		if len(b) < 5 {
+			return 0, 0, 0, errCBORTruncated
+		}
+		return major, uint64(binary.BigEndian.Uint32(b[1:])), 5, nil
+	case info == 27:
+		if len(b) < 9 {
+			return 0, 0, 0, errCBORTruncated
+		}
+		return major, binary.BigEndian.Uint64(b[1:]), 9, nil
+	}
+	return 0, 0, 0, fmt.Errorf("cbor: unsupported additional information %d", info)
+}
+
+func decodeCBORItem(b []byte, depth int) (interface{}, int, error) {
+	if depth > cborMaxDepth {
+		return nil, 0, errors.New("cbor: nested too deep")
+	}
+
+	major, arg, n, err := cborHead(b)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case cborUint, cborNegInt:
+		if arg > math.MaxInt64 {
+			return nil, 0, errors.New("cbor: integer overflow")
+		}
+		if major == cborNegInt {
+			return -1 - int64(arg), n, nil
+		}
+		return int64(arg), n, nil
+	case cborBytes, cborText:
+		if uint64(len(b)-n) < arg {
+			return nil, 0, errCBORTruncated
+		}
+		end := n + int(arg)
+		if major == cborText {
+			return string(b[n:end]), end, nil
+		}
+		v := make([]byte, arg)
+		copy(v, b[n:end])
+		return v, end, nil
+	case cborArray:
+		if uint64(len(b)-n) < arg {
+			return nil, 0, errCBORTruncated
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, m, err := decodeCBORItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, item)
+			n += m
+		}
+		return items, n, nil
+	case cborMap:
+		if uint64(len(b)-n) < arg {
+			return nil, 0, errCBORTruncated
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, kn, err := decodeCBORItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += kn
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, 0, errors.New("cbor: unsupported map key type")
+			}
+
+			v, vn, err := decodeCBORItem(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += vn
+			m[k] = v
+		}
+		return m, n, nil
+	case cborSimple:
+		switch arg {
+		case 20:
+			return false, n, nil
+		case 21:
+			return true, n, nil
+		case 22:
+			return nil, n, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("cbor: unsupported major type %d", major)
+}
+
+func appendCBORHead(b []byte, major byte, arg uint64) []byte {
+	major <<= 5
+	switch {
+	case arg < 24:
+		return append(b, major|byte(arg))
+	case arg <= math.MaxUint8:
+		return append(b, major|24, byte(arg))
+	case arg <= math.MaxUint16:
+		b = append(b, major|25)
+		return append(b, byte(arg>>8), byte(arg))
+	case arg <= math.MaxUint32:
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], uint32(arg))
+		return append(append(b, major|26), buf[:]...)
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], arg)
+	return append(append(b, major|27), buf[:]...)
+}
+
+// encodeCBOR encodes the value.
+// Supported types are integers, []byte, string, bool, []interface{} and cborOrderedMap.
+func encodeCBOR(v interface{}) ([]byte, error) {
+	return appendCBOR(nil, v)
+}
+
+func appendCBOR(b []byte, v interface{}) ([]byte, error) {
+	switch t := v.(type) {
+	case int:
+		return appendCBORInt(b, int64(t)), nil
+	case int64:
+		return appendCBORInt(b, t), nil
+	case uint64:
+		return appendCBORHead(b, cborUint, t), nil
+	case []byte:
+		return append(appendCBORHead(b, cborBytes, uint64(len(t))), t...), nil
+	case string:
+		return append(appendCBORHead(b, cborText, uint64(len(t))), t...), nil
+	case bool:
+		if t {
+			return append(b, cborSimple<<5|21), nil
+		}
+		return append(b, cborSimple<<5|20), nil
+	case []interface{}:
+		b = appendCBORHead(b, cborArray, uint64(len(t)))
+		for _, item := range t {
+			var err error
+			if b, err = appendCBOR(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case cborOrderedMap:
+		b = appendCBORHead(b, cborMap, uint64(len(t)))
+		for _, p := range t {
+			var err error
+			if b, err = appendCBOR(b, p.Key); err != nil {
+				return nil, err
+			}
+			if b, err = appendCBOR(b, p.Value); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("cbor: unsupported type %T", v)
+}
+
+func appendCBORInt(b []byte, i int64) []byte {
+	if i < 0 {
+		return appendCBORHead(b, cborNegInt, uint64(-1-i))
+	}
+	return appendCBORHead(b, cborUint, uint64(i))
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCBOR(t *testing.T) {
+	encoded, err := encodeCBOR(cborOrderedMap{
+		{1, 2},
+		{-1, []byte{0x01, 0x02}},
+		{"text", "value"},
+		{"big", uint64(1 << 40)},
+		{"list", []interface{}{true, false, -300}},
+	})
+	assert.NoError(t, err)
+
+	// 뒤에 붙은 바이트는 읽지 않는다.
+	decoded, n, err := decodeCBOR(append(encoded, 0xff))
+	assert.NoError(t, err)
+	assert.Equal(t, len(encoded), n)
+	assert.Equal(t, map[interface{}]interface{}{
+		int64(1):  int64(2),
+		int64(-1): []byte{0x01, 0x02},
+		"text":    "value",
+		"big":     int64(1 << 40),
+		"list":    []interface{}{true, false, int64(-300)},
+	}, decoded)
+}
+
+func TestDecodeCBORWithMalformed(t *testing.T) {
+	for _, b := range [][]byte{
+		{},
+		{0x58, 0x05, 0x01},       // truncated bytes
+		{0x82, 0x01},             // truncated array
+		{0x9f, 0x01, 0xff},       // indefinite length array
+		{0xa1, 0x41, 0x00, 0x01}, // bytes map key
+	} {
+		_, _, err := decodeCBOR(b)
+		assert.Error(t, err)
+	}
+}
@@ -1,19 +1,25 @@
 package utils
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"math/big"
 )
 
 const digits = "0123456789"
 
-// DigitCode .
+// DigitCode returns random numeric code of length n.
+// It is used as a secret such as backup code and email code,
+// so crypto/rand is used instead of math/rand.
 func DigitCode(n int) string {
-	rand.Seed(time.Now().UnixNano())
-	code := make([]rune, n)
+	max := big.NewInt(int64(len(digits)))
+	code := make([]byte, n)
 	for i := 0; i < n; i++ {
-		idx := rand.Intn(len(digits))
-		code[i] = rune(digits[idx])
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			// crypto/rand 가 실패하면 안전한 코드를 만들 수 없다.
+			panic(err)
+		}
+		code[i] = digits[idx.Int64()]
 	}
 	return string(code)
 }
@@ -2,11 +2,15 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/mail"
 	"net/smtp"
 	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Email sends an email.
@@ -58,13 +62,37 @@ func (m *Email) makeMessage() {
 	m.message += "\r\n" + m.body
 }
 
+var emailSends = NewCounterVec(
+	"auth_email_sends_total", "Emails sent to the smtp server by outcome.", "outcome")
+
 // Send 는 local postfix 로 email 을 보낸다.
 func (m *Email) Send(addr string) error {
-	return m.sendToSMTPServer(addr)
+	return m.SendContext(context.Background(), addr)
+}
+
+// SendContext 는 Send 와 같고, 요청의 trace 에 smtp span 을 남긴다.
+func (m *Email) SendContext(ctx context.Context, addr string) error {
+	if err := m.sendToSMTPServer(ctx, addr); err != nil {
+		emailSends.Inc(MetricFailure)
+		return err
+	}
+	emailSends.Inc(MetricSuccess)
+	return nil
 }
 
-func (m *Email) sendToSMTPServer(addr string) error {
+func (m *Email) sendToSMTPServer(ctx context.Context, addr string) (err error) {
+	ctx, span := StartChildSpan(ctx, "smtp.send", trace.SpanKindClient,
+		attribute.String("net.peer.name", addr))
+	defer func() {
+		RecordSpanError(span, err)
+		span.End()
+	}()
+
+	_, dialSpan := StartChildSpan(ctx, "smtp.dial", trace.SpanKindClient,
+		attribute.String("net.peer.name", addr))
 	c, err := smtp.Dial(addr)
+	RecordSpanError(dialSpan, err)
+	dialSpan.End()
 	if err != nil {
 		return err
 	}
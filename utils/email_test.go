@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +12,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -121,9 +124,28 @@ func TestSendToSMTP(t *testing.T) {
 
 func TestSendWithBadSMTPServer(t *testing.T) {
 	expectedError := errors.New("dial tcp: address bad smtp address: missing port in address")
+	failures := emailSends.Value(MetricFailure)
 	email := NewEmail(name, from, to, subject, body)
 	err := email.Send("bad smtp address")
 	assert.EqualError(t, expectedError, fmt.Sprint(err))
+	assert.Equal(t, failures+1, emailSends.Value(MetricFailure))
+}
+
+func TestSendContextWithTrace(t *testing.T) {
+	provider, exporter := tracerForTest(t, 100)
+	ctx, span := StartSpan(context.Background(), "request", trace.SpanKindServer)
+	email := NewEmail(name, from, to, subject, body)
+	assert.Error(t, email.SendContext(ctx, "bad smtp address"))
+	span.End()
+
+	assert.NoError(t, provider.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 3)
+	assert.Equal(t, "smtp.dial", spans[0].Name)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, "smtp.send", spans[1].Name)
+	assert.Equal(t, span.SpanContext().SpanID(), spans[1].Parent.SpanID())
+	assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
 }
 
 func TestSendWithBadServerHandleForData(t *testing.T) {
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// Event is domain event published to sinks.
+// 'OccurredAt' is unix time, 'Data' is JSON payload of the event type.
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	UserID     uint            `json:"user_id"`
+	OccurredAt int64           `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// EventSink publishes events to outside of the service.
+// Publish returns nil only if all events are published.
+// Events may be published again when it failed, so sinks need not be atomic.
+type EventSink interface {
+	Publish(events []Event) error
+	Close() error
+}
+
+// MemoryEventSink keeps published events in memory.
+// It is used in tests.
+type MemoryEventSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewMemoryEventSink .
+func NewMemoryEventSink() *MemoryEventSink {
+	return &MemoryEventSink{}
+}
+
+// Publish .
+func (s *MemoryEventSink) Publish(events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+// Events returns events published so far.
+func (s *MemoryEventSink) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make([]Event, len(s.events))
+	copy(events, s.events)
+	return events
+}
+
+// Close .
+func (s *MemoryEventSink) Close() error {
+	return nil
+}
+
+// FileEventSink writes events to the file as JSON lines.
+type FileEventSink struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewFileEventSink opens the file to append events.
+// Events are written to stdout if the path is empty.
+func NewFileEventSink(path string) (*FileEventSink, error) {
+	if path == "" {
+		return newFileEventSink(os.Stdout), nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return newFileEventSink(f), nil
+}
+
+func newFileEventSink(w io.Writer) *FileEventSink {
+	return &FileEventSink{w: w, enc: json.NewEncoder(w)}
+}
+
+// Publish .
+func (s *FileEventSink) Publish(events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range events {
+		if err := s.enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the file. Stdout is not closed.
+func (s *FileEventSink) Close() error {
+	if f, ok := s.w.(*os.File); ok && f != os.Stdout {
+		return f.Close()
+	}
+	return nil
+}
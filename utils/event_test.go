@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func eventsForTest() []Event {
+	return []Event{
+		{
+			ID: "1", Type: "user.created", UserID: 1, OccurredAt: 1600000000,
+			Data: json.RawMessage(`{"email":"a@mail.com"}`),
+		},
+		{
+			ID: "2", Type: "signin.failed", UserID: 1, OccurredAt: 1600000001,
+			Data: json.RawMessage(`{"email":"a@mail.com","ip":"127.0.0.1"}`),
+		},
+	}
+}
+
+func TestMemoryEventSink(t *testing.T) {
+	sink := NewMemoryEventSink()
+	events := eventsForTest()
+	assert.NoError(t, sink.Publish(events[:1]))
+	assert.NoError(t, sink.Publish(events[1:]))
+	assert.Equal(t, events, sink.Events())
+	assert.NoError(t, sink.Close())
+}
+
+func TestFileEventSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	sink, err := NewFileEventSink(path)
+	assert.NoError(t, err)
+
+	events := eventsForTest()
+	assert.NoError(t, sink.Publish(events))
+	assert.NoError(t, sink.Close())
+
+	// 기존 파일에 이어서 쓴다.
+	sink, err = NewFileEventSink(path)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Publish(events[:1]))
+	assert.NoError(t, sink.Close())
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	var written []Event
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var e Event
+		assert.NoError(t, json.Unmarshal(s.Bytes(), &e))
+		written = append(written, e)
+	}
+	assert.Equal(t, append(events, events[0]), written)
+}
+
+// natsServerForTest runs NATS server in process, clients must give the token.
+func natsServerForTest(t *testing.T, token string) string {
+	s, err := server.NewServer(&server.Options{
+		Host:          localHost,
+		Port:          server.RANDOM_PORT,
+		Authorization: token,
+		NoLog:         true,
+		NoSigs:        true,
+	})
+	assert.NoError(t, err)
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	assert.True(t, s.ReadyForConnections(natsTimeout))
+	return s.Addr().String()
+}
+
+func TestNATSEventSink(t *testing.T) {
+	addr := natsServerForTest(t, "testtoken")
+
+	sink := NewNATSEventSink(addr, "auth.", "wrongtoken")
+	assert.EqualError(t, sink.Publish(eventsForTest()), "nats: Authorization Violation")
+
+	sub, err := nats.Connect(addr, nats.Token("testtoken"))
+	assert.NoError(t, err)
+	defer sub.Close()
+	received := make(chan *nats.Msg, 3)
+	_, err = sub.ChanSubscribe("auth.>", received)
+	assert.NoError(t, err)
+	assert.NoError(t, sub.Flush())
+
+	sink = NewNATSEventSink(addr, "auth.", "testtoken")
+	defer sink.Close()
+	events := eventsForTest()
+	assert.NoError(t, sink.Publish(events))
+	assert.NoError(t, sink.Publish(events[:1]))
+
+	messages := []*nats.Msg{}
+	for len(messages) < 3 {
+		select {
+		case m := <-received:
+			messages = append(messages, m)
+		case <-time.After(natsTimeout):
+			t.Fatal("events were not received")
+		}
+	}
+	assert.Equal(t, "auth.user.created", messages[0].Subject)
+	assert.Equal(t, "auth.signin.failed", messages[1].Subject)
+	assert.Equal(t, "auth.user.created", messages[2].Subject)
+
+	var e Event
+	assert.NoError(t, json.Unmarshal(messages[1].Data, &e))
+	assert.Equal(t, events[1], e)
+}
+
+// kafkaWriterForTest keeps messages instead of writing to Kafka.
+type kafkaWriterForTest struct {
+	messages []kafka.Message
+	err      error
+}
+
+func (w *kafkaWriterForTest) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *kafkaWriterForTest) Close() error {
+	return nil
+}
+
+func TestKafkaEventSink(t *testing.T) {
+	sink := NewKafkaEventSink([]string{"127.0.0.1:9092", "127.0.0.2:9092"}, "auth-events", 2)
+	writer, ok := sink.w.(*kafka.Writer)
+	assert.True(t, ok)
+	assert.Equal(t, "auth-events", writer.Topic)
+	assert.Equal(t, kafka.RequireAll, writer.RequiredAcks)
+	assert.Equal(t, "127.0.0.1:9092,127.0.0.2:9092", writer.Addr.String())
+	// 주어진 파티션에만 보낸다.
+	assert.Equal(t, 2, writer.Balancer.Balance(kafka.Message{}, 0, 1, 2, 3))
+
+	w := &kafkaWriterForTest{}
+	sink.w = w
+	events := eventsForTest()
+	assert.NoError(t, sink.Publish(events))
+	assert.Len(t, w.messages, len(events))
+	for i, m := range w.messages {
+		var e Event
+		assert.NoError(t, json.Unmarshal(m.Value, &e))
+		assert.Equal(t, events[i], e)
+		assert.Equal(t, e.ID, string(m.Key))
+	}
+
+	w.err = kafka.NotLeaderForPartition
+	assert.Equal(t, kafka.NotLeaderForPartition, sink.Publish(events))
+}
@@ -13,6 +13,21 @@ const (
 	Signup        = "Signup"
 	Session       = "Session"
 	ResetPassword = "ResetPassword"
+	Access        = "Access"
+	ServiceAccess = "ServiceAccess"
+	MagicLink     = "MagicLink"
+	SigninUnlock  = "SigninUnlock"
+	// IDToken is not subject of the token, it is used to count ID tokens issued.
+	IDToken = "ID"
+)
+
+// Authentication method references.
+// reference - https://tools.ietf.org/html/rfc8176
+const (
+	AMRPassword    = "pwd"
+	AMROTP         = "otp"
+	AMRMultiFactor = "mfa"
+	AMRHardwareKey = "hwk"
 )
 
 // SessionUser .
@@ -21,6 +36,29 @@ type SessionUser struct {
 	UserEmail string
 }
 
+// Authentication is when and how the user signed in.
+// It is kept in session token, so that renewed token has the same.
+type Authentication struct {
+	AuthTime int64    `json:"auth_time,omitempty"`
+	AMR      []string `json:"amr,omitempty"`
+}
+
+// AddMethods adds the methods not referenced yet.
+func (a *Authentication) AddMethods(methods ...string) {
+	for _, m := range methods {
+		found := false
+		for _, v := range a.AMR {
+			if v == m {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a.AMR = append(a.AMR, m)
+		}
+	}
+}
+
 // Token .
 type Token struct {
 	expireAfterSec time.Duration
@@ -34,8 +72,32 @@ type SignupClaims struct {
 }
 
 // SessionClaims .
+// 'Roles' are names of roles the user had when the token was issued.
+// They are for clients, permissions are checked with roles in DB.
 type SessionClaims struct {
 	SessionUser
+	Roles []string `json:"roles,omitempty"`
+	Authentication
+	jwt.StandardClaims
+}
+
+// AccessClaims is claims of access token issued to OAuth client.
+// 'Scope' is space separated list of scopes granted by the user.
+type AccessClaims struct {
+	SessionUser
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+	jwt.StandardClaims
+}
+
+// IDClaims is claims of OpenID Connect ID token.
+// 'Subject' is the user ID and 'Audience' is the client ID.
+// reference - https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+type IDClaims struct {
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	Nonce         string `json:"nonce,omitempty"`
+	Authentication
 	jwt.StandardClaims
 }
 
@@ -46,6 +108,22 @@ type ResetPasswordClaims struct {
 	jwt.StandardClaims
 }
 
+// MagicLinkClaims is claims of the token sent by email to signin without password.
+// 'Id' is stored when issued, so that the link can be used once.
+type MagicLinkClaims struct {
+	Email string
+	jwt.StandardClaims
+}
+
+// SigninUnlockClaims is claims of the token sent by email to unlock the account.
+// The token is valid only while the lock of 'LockedUntil' is kept,
+// so each unlock link can be used once.
+type SigninUnlockClaims struct {
+	Email       string
+	LockedUntil int64
+	jwt.StandardClaims
+}
+
 // JWTParseError .
 type JWTParseError struct {
 	Func         string
@@ -65,6 +143,24 @@ func NewJWT(expireAfterSec int) *Token {
 	}
 }
 
+var tokensIssued = NewCounterVec(
+	"auth_tokens_issued_total", "JWT issued by type of the token.", "type")
+
+// signedString signs the token and counts it by type of the token.
+func (t *Token) signedString(tokenType string, key *Key) (string, error) {
+	t.Method = key.Method
+	t.Header["alg"] = key.Method.Alg()
+	if key.ID != "" {
+		t.Header["kid"] = key.ID
+	}
+	signed, err := t.SignedString(key.signKey)
+	if err != nil {
+		return "", err
+	}
+	tokensIssued.Inc(tokenType)
+	return signed, nil
+}
+
 func newStandardClaims(
 	subject, audience, issuer string,
 	expireAfterSec time.Duration,
@@ -83,50 +179,108 @@ func newStandardClaims(
 }
 
 // Signup .
-func (t *Token) Signup(email, secretkey, issuer string) (string, error) {
+func (t *Token) Signup(email string, key *Key, issuer string) (string, error) {
 	t.Claims = SignupClaims{
 		email,
 		*newStandardClaims(Signup, email, issuer, t.expireAfterSec, 0),
 	}
-	return t.SignedString([]byte(secretkey))
+	return t.signedString(Signup, key)
 }
 
 // Session .
-func (t *Token) Session(userID uint, userEmail, secretkey, issuer string) (string, error) {
+func (t *Token) Session(userID uint, userEmail string, roles []string, auth Authentication, key *Key, issuer string) (string, error) {
 	t.Claims = SessionClaims{
 		SessionUser{UserID: userID, UserEmail: userEmail},
+		roles,
+		auth,
 		*newStandardClaims(Session, userEmail, issuer, t.expireAfterSec, 0),
 	}
-	return t.SignedString([]byte(secretkey))
+	return t.signedString(Session, key)
 }
 
 // ResetPassword .
-func (t *Token) ResetPassword(email string, passwordResetTs int, secretkey, issuer string) (string, error) {
+func (t *Token) ResetPassword(email string, passwordResetTs int, key *Key, issuer string) (string, error) {
 	t.Claims = ResetPasswordClaims{
 		email,
 		passwordResetTs,
 		*newStandardClaims(ResetPassword, email, issuer, t.expireAfterSec, 0),
 	}
-	return t.SignedString([]byte(secretkey))
+	return t.signedString(ResetPassword, key)
+}
+
+// Access returns access token for OAuth client.
+func (t *Token) Access(userID uint, userEmail, clientID, scope string, key *Key, issuer string) (string, error) {
+	t.Claims = AccessClaims{
+		SessionUser{UserID: userID, UserEmail: userEmail},
+		clientID,
+		scope,
+		*newStandardClaims(Access, clientID, issuer, t.expireAfterSec, 0),
+	}
+	return t.signedString(Access, key)
+}
+
+// ID returns OpenID Connect ID token for the client.
+func (t *Token) ID(claims IDClaims, subject, clientID string, key *Key, issuer string) (string, error) {
+	claims.StandardClaims = *newStandardClaims(subject, clientID, issuer, t.expireAfterSec, 0)
+	t.Claims = claims
+	return t.signedString(IDToken, key)
+}
+
+// ServiceAccess returns access token for service account.
+// Claims of the user are empty since no user is involved.
+func (t *Token) ServiceAccess(clientID, scope string, key *Key, issuer string) (string, error) {
+	t.Claims = AccessClaims{
+		SessionUser{},
+		clientID,
+		scope,
+		*newStandardClaims(ServiceAccess, clientID, issuer, t.expireAfterSec, 0),
+	}
+	return t.signedString(ServiceAccess, key)
+}
+
+// MagicLink .
+func (t *Token) MagicLink(email string, key *Key, issuer string) (string, error) {
+	t.Claims = MagicLinkClaims{
+		email,
+		*newStandardClaims(MagicLink, email, issuer, t.expireAfterSec, 0),
+	}
+	return t.signedString(MagicLink, key)
 }
 
-func parseWithClaims(signedString, secretkey string, claims jwt.Claims) (*jwt.Token, error) {
+// SigninUnlock .
+func (t *Token) SigninUnlock(email string, lockedUntil int64, key *Key, issuer string) (string, error) {
+	t.Claims = SigninUnlockClaims{
+		email,
+		lockedUntil,
+		*newStandardClaims(SigninUnlock, email, issuer, t.expireAfterSec, 0),
+	}
+	return t.signedString(SigninUnlock, key)
+}
+
+func parseWithClaims(signedString string, keys Keys, claims jwt.Claims) (*jwt.Token, error) {
 	const fnName = "parseWithClaims"
 	return jwt.ParseWithClaims(
 		signedString,
 		claims,
 		func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			kid, _ := token.Header["kid"].(string)
+			key, ok := keys.Lookup(kid)
+			if !ok {
+				err := fmt.Errorf("unknown key id '%s'", kid)
+				return nil, &JWTParseError{fnName, signedString, err}
+			}
+
+			if token.Method.Alg() != key.Method.Alg() {
 				err := fmt.Errorf("unexpected signing method '%v'", token.Header["alg"])
 				return nil, &JWTParseError{fnName, signedString, err}
 			}
-			return []byte(secretkey), nil
+			return key.verifyKey, nil
 		})
 }
 
 // ParseSignupJWT .
-func ParseSignupJWT(signedString, secretkey string) (*SignupClaims, error) {
-	token, err := parseWithClaims(signedString, secretkey, &SignupClaims{})
+func ParseSignupJWT(signedString string, keys Keys) (*SignupClaims, error) {
+	token, err := parseWithClaims(signedString, keys, &SignupClaims{})
 	if err != nil {
 		return nil, err
 	}
@@ -136,8 +290,8 @@ func ParseSignupJWT(signedString, secretkey string) (*SignupClaims, error) {
 }
 
 // ParseSessionJWT .
-func ParseSessionJWT(signedString, secretkey string) (*SessionClaims, error) {
-	token, err := parseWithClaims(signedString, secretkey, &SessionClaims{})
+func ParseSessionJWT(signedString string, keys Keys) (*SessionClaims, error) {
+	token, err := parseWithClaims(signedString, keys, &SessionClaims{})
 	if err != nil {
 		return nil, err
 	}
@@ -145,3 +299,58 @@ func ParseSessionJWT(signedString, secretkey string) (*SessionClaims, error) {
 	claims, _ := token.Claims.(*SessionClaims)
 	return claims, nil
 }
+
+// ParseResetPasswordJWT .
+func ParseResetPasswordJWT(signedString string, keys Keys) (*ResetPasswordClaims, error) {
+	token, err := parseWithClaims(signedString, keys, &ResetPasswordClaims{})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, _ := token.Claims.(*ResetPasswordClaims)
+	return claims, nil
+}
+
+// ParseAccessJWT .
+func ParseAccessJWT(signedString string, keys Keys) (*AccessClaims, error) {
+	token, err := parseWithClaims(signedString, keys, &AccessClaims{})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, _ := token.Claims.(*AccessClaims)
+	return claims, nil
+}
+
+// ParseIDJWT .
+func ParseIDJWT(signedString string, keys Keys) (*IDClaims, error) {
+	token, err := parseWithClaims(signedString, keys, &IDClaims{})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, _ := token.Claims.(*IDClaims)
+	return claims, nil
+}
+
+// ParseMagicLinkJWT .
+func ParseMagicLinkJWT(signedString string, keys Keys) (*MagicLinkClaims, error) {
+	token, err := parseWithClaims(signedString, keys, &MagicLinkClaims{})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, _ := token.Claims.(*MagicLinkClaims)
+	return claims, nil
+}
+
+// ParseSigninUnlockJWT .
+func ParseSigninUnlockJWT(signedString string, keys Keys) (*SigninUnlockClaims, error) {
+	token, err := parseWithClaims(signedString, keys, &SigninUnlockClaims{})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, _ := token.Claims.(*SigninUnlockClaims)
+	return claims, nil
+}
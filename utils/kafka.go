@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	kafkaTimeout = time.Second * 10
+	// 이벤트는 모아서 주므로 배치가 찰 때까지 기다리지 않는다.
+	kafkaBatchTimeout = time.Millisecond * 10
+)
+
+// kafkaWriter writes messages to Kafka. It is '*kafka.Writer' except in tests.
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaEventSink produces events to a partition of the topic.
+// The event id is the key of the record, the event in JSON is the value.
+// The leader of the partition is looked up from 'brokers' by the client,
+// and looked up again when the leader changes.
+type KafkaEventSink struct {
+	w kafkaWriter
+}
+
+// NewKafkaEventSink .
+// 'brokers' are addresses to look up the cluster, not all brokers need to be given.
+func NewKafkaEventSink(brokers []string, topic string, partition int) *KafkaEventSink {
+	return &KafkaEventSink{
+		w: &kafka.Writer{
+			Addr:  kafka.TCP(brokers...),
+			Topic: topic,
+			Balancer: kafka.BalancerFunc(func(kafka.Message, ...int) int {
+				return partition
+			}),
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: kafkaBatchTimeout,
+			ReadTimeout:  kafkaTimeout,
+			WriteTimeout: kafkaTimeout,
+		},
+	}
+}
+
+// Publish returns after all events are acknowledged by in-sync replicas.
+func (s *KafkaEventSink) Publish(events []Event) error {
+	messages := make([]kafka.Message, len(events))
+	for i, e := range events {
+		value, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		messages[i] = kafka.Message{Key: []byte(e.ID), Value: value}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaTimeout)
+	defer cancel()
+	return s.w.WriteMessages(ctx, messages...)
+}
+
+// Close .
+func (s *KafkaEventSink) Close() error {
+	return s.w.Close()
+}
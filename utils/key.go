@@ -0,0 +1,313 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const rsaKeyBits = 2048
+
+var curveByBits = map[int]elliptic.Curve{
+	256: elliptic.P256(),
+	384: elliptic.P384(),
+	521: elliptic.P521(),
+}
+
+// Key is used to sign and verify JWT.
+// HMAC key uses the same secret for both.
+// 'ID' is stamped as 'kid' header on signed JWT if it is not empty.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// Keys finds the key to verify JWT by 'kid' header.
+type Keys interface {
+	Lookup(kid string) (*Key, bool)
+}
+
+// KeyRing has one key to sign JWT and several keys to verify.
+type KeyRing struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS is a set of JWK.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewHMACKey returns HS256 key.
+func NewHMACKey(secretkey string) *Key {
+	return &Key{"", jwt.SigningMethodHS256, []byte(secretkey), []byte(secretkey)}
+}
+
+// NewKey returns the key for the signing method.
+// HMAC methods use the secretkey, the others use the PEM encoded private key.
+func NewKey(method, secretkey string, privateKeyPEM []byte) (*Key, error) {
+	m := jwt.GetSigningMethod(method)
+	if m == nil {
+		return nil, fmt.Errorf("unsupported signing method '%s'", method)
+	}
+
+	switch m.(type) {
+	case *jwt.SigningMethodHMAC:
+		return &Key{"", m, []byte(secretkey), []byte(secretkey)}, nil
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		k, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		return newAsymmetricKey(m, k, &k.PublicKey), nil
+	case *jwt.SigningMethodECDSA:
+		k, err := jwt.ParseECPrivateKeyFromPEM(privateKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		if k.Curve.Params().BitSize != m.(*jwt.SigningMethodECDSA).CurveBits {
+			return nil, fmt.Errorf("'%s' signing method does not match curve '%s'",
+				method, k.Curve.Params().Name)
+		}
+		return newAsymmetricKey(m, k, &k.PublicKey), nil
+	case *jwt.SigningMethodEd25519:
+		k, err := jwt.ParseEdPrivateKeyFromPEM(privateKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		edKey, ok := k.(ed25519.PrivateKey)
+		if !ok {
+			return nil, jwt.ErrNotEdPrivateKey
+		}
+		return newAsymmetricKey(m, edKey, edKey.Public()), nil
+	}
+	return nil, fmt.Errorf("unsupported signing method '%s'", method)
+}
+
+// newAsymmetricKey returns the key identified by JWK thumbprint.
+func newAsymmetricKey(m jwt.SigningMethod, signKey, verifyKey interface{}) *Key {
+	k := &Key{"", m, signKey, verifyKey}
+	if jwk, ok := k.JWK(); ok {
+		k.ID = jwk.Kid
+	}
+	return k
+}
+
+// LoadKey returns the key for the signing method.
+// The private key is read from privateKeyFile if the method is not HMAC.
+func LoadKey(method, secretkey, privateKeyFile string) (*Key, error) {
+	m := jwt.GetSigningMethod(method)
+	if m == nil {
+		return nil, fmt.Errorf("unsupported signing method '%s'", method)
+	}
+
+	if _, ok := m.(*jwt.SigningMethodHMAC); ok {
+		return NewKey(method, secretkey, nil)
+	}
+
+	if privateKeyFile == "" {
+		return nil, fmt.Errorf("'%s' signing method requires private key file", method)
+	}
+
+	pem, err := ioutil.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(method, secretkey, pem)
+}
+
+// Lookup returns the key itself if kid is empty or matches 'ID'.
+func (k *Key) Lookup(kid string) (*Key, bool) {
+	if kid == "" || kid == k.ID {
+		return k, true
+	}
+	return nil, false
+}
+
+// Symmetric reports whether the key is shared secret.
+func (k *Key) Symmetric() bool {
+	_, ok := k.Method.(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+// JWK returns the public key in JWK format.
+// Symmetric key is never published, so it returns false.
+func (k *Key) JWK() (JWK, bool) {
+	jwk := JWK{Use: "sig", Alg: k.Method.Alg()}
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeJWKParam(pub.N.Bytes())
+		jwk.E = encodeJWKParam(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = encodeJWKParam(padLeft(pub.X.Bytes(), size))
+		jwk.Y = encodeJWKParam(padLeft(pub.Y.Bytes(), size))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeJWKParam(pub)
+	default:
+		return JWK{}, false
+	}
+	jwk.Kid = k.ID
+	if jwk.Kid == "" {
+		jwk.Kid = thumbprint(jwk)
+	}
+	return jwk, true
+}
+
+// PublicKey returns the key used to verify signature.
+func (k *Key) PublicKey() crypto.PublicKey {
+	return k.verifyKey
+}
+
+func encodeJWKParam(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func padLeft(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+// thumbprint returns JWK thumbprint.
+// reference - https://tools.ietf.org/html/rfc7638
+func thumbprint(jwk JWK) string {
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	b, _ := json.Marshal(members)
+	sum := sha256.Sum256(b)
+	return encodeJWKParam(sum[:])
+}
+
+// NewKeyRing returns the key ring which signs JWT with signing key.
+// Every key including signing key is used to verify.
+func NewKeyRing(signing *Key, keys ...*Key) *KeyRing {
+	r := &KeyRing{signing, map[string]*Key{signing.ID: signing}}
+	for _, k := range keys {
+		r.keys[k.ID] = k
+	}
+	return r
+}
+
+// SigningKey returns the key to sign JWT.
+func (r *KeyRing) SigningKey() *Key {
+	return r.signing
+}
+
+// Lookup returns the key identified by kid.
+// JWT without 'kid' header is verified by the key whose 'ID' is empty.
+func (r *KeyRing) Lookup(kid string) (*Key, bool) {
+	k, ok := r.keys[kid]
+	return k, ok
+}
+
+// Keys returns every key in the key ring.
+func (r *KeyRing) Keys() []*Key {
+	keys := make([]*Key, 0, len(r.keys))
+	for _, k := range r.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// GenerateKey generates new secret for the signing method.
+// HMAC methods return random secretkey, the others return PEM encoded private key.
+func GenerateKey(method string) (secretkey string, privateKeyPEM []byte, err error) {
+	var block *pem.Block
+	switch m := jwt.GetSigningMethod(method).(type) {
+	case *jwt.SigningMethodHMAC:
+		secretkey, err = RandomToken(m.Hash.Size())
+		return
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		k, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return "", nil, err
+		}
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+	case *jwt.SigningMethodECDSA:
+		curve, ok := curveByBits[m.CurveBits]
+		if !ok {
+			return "", nil, fmt.Errorf("unsupported signing method '%s'", method)
+		}
+		k, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return "", nil, err
+		}
+		b, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return "", nil, err
+		}
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}
+	case *jwt.SigningMethodEd25519:
+		_, k, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", nil, err
+		}
+		b, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			return "", nil, err
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: b}
+	default:
+		return "", nil, fmt.Errorf("unsupported signing method '%s'", method)
+	}
+	return "", pem.EncodeToMemory(block), nil
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPrivateKeyPEM(t *testing.T, method string) []byte {
+	var block *pem.Block
+	switch method {
+	case "RS256":
+		k, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.NoError(t, err)
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+	case "ES256":
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		b, err := x509.MarshalECPrivateKey(k)
+		assert.NoError(t, err)
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}
+	case "EdDSA":
+		_, k, err := ed25519.GenerateKey(rand.Reader)
+		assert.NoError(t, err)
+		b, err := x509.MarshalPKCS8PrivateKey(k)
+		assert.NoError(t, err)
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: b}
+	}
+	return pem.EncodeToMemory(block)
+}
+
+func TestNewKey(t *testing.T) {
+	tables := []struct {
+		Method string
+		Kty    string
+	}{
+		{"RS256", "RSA"},
+		{"ES256", "EC"},
+		{"EdDSA", "OKP"},
+	}
+
+	for _, v := range tables {
+		key, err := NewKey(v.Method, "", testPrivateKeyPEM(t, v.Method))
+		assert.NoError(t, err)
+		assert.False(t, key.Symmetric())
+
+		var userID uint = 1
+		userEmail := testEmail()
+		sessionToken, err := NewJWT(5).Session(userID, userEmail, nil, Authentication{}, key, testIssuer)
+		assert.NoError(t, err)
+
+		claims, err := ParseSessionJWT(sessionToken, key)
+		assert.NoError(t, err)
+		assert.Equal(t, userEmail, claims.UserEmail)
+
+		jwk, ok := key.JWK()
+		assert.True(t, ok)
+		assert.Equal(t, v.Kty, jwk.Kty)
+		assert.Equal(t, v.Method, jwk.Alg)
+		assert.NotEqual(t, "", jwk.Kid)
+
+		_, err = ParseSessionJWT(sessionToken, testKey)
+		assert.Error(t, err)
+	}
+}
+
+func TestNewKeyWithHMAC(t *testing.T) {
+	key, err := NewKey("HS256", testSecretkey, nil)
+	assert.NoError(t, err)
+	assert.True(t, key.Symmetric())
+
+	_, ok := key.JWK()
+	assert.False(t, ok)
+}
+
+func TestNewKeyWithBadParams(t *testing.T) {
+	_, err := NewKey("none", "", nil)
+	assert.EqualError(t, err, "unsupported signing method 'none'")
+
+	_, err = NewKey("ES384", "", testPrivateKeyPEM(t, "ES256"))
+	assert.EqualError(t, err, "'ES384' signing method does not match curve 'P-256'")
+
+	_, err = NewKey("RS256", "", testPrivateKeyPEM(t, "ES256"))
+	assert.Error(t, err)
+}
+
+func TestLoadKey(t *testing.T) {
+	f, err := ioutil.TempFile("", "key*.pem")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(testPrivateKeyPEM(t, "ES256"))
+	assert.NoError(t, err)
+	f.Close()
+
+	key, err := LoadKey("ES256", "", f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "ES256", key.Method.Alg())
+
+	_, err = LoadKey("ES256", "", "")
+	assert.EqualError(t, err, "'ES256' signing method requires private key file")
+
+	key, err = LoadKey("HS256", testSecretkey, "")
+	assert.NoError(t, err)
+	assert.True(t, key.Symmetric())
+}
+
+func TestKeyRing(t *testing.T) {
+	oldKey := NewHMACKey(testSecretkey)
+	newKey, err := NewKey("ES256", "", testPrivateKeyPEM(t, "ES256"))
+	assert.NoError(t, err)
+	retiredKey, err := NewKey("EdDSA", "", testPrivateKeyPEM(t, "EdDSA"))
+	assert.NoError(t, err)
+
+	email := testEmail()
+	oldToken, err := NewJWT(5).Signup(email, oldKey, testIssuer)
+	assert.NoError(t, err)
+	retiredToken, err := NewJWT(5).Signup(email, retiredKey, testIssuer)
+	assert.NoError(t, err)
+
+	ring := NewKeyRing(newKey, oldKey)
+	assert.Equal(t, newKey, ring.SigningKey())
+	assert.Equal(t, 2, len(ring.Keys()))
+
+	newToken, err := NewJWT(5).Signup(email, ring.SigningKey(), testIssuer)
+	assert.NoError(t, err)
+
+	for _, token := range []string{oldToken, newToken} {
+		claims, err := ParseSignupJWT(token, ring)
+		assert.NoError(t, err)
+		assert.Equal(t, email, claims.Email)
+	}
+
+	_, err = ParseSignupJWT(retiredToken, ring)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown key id")
+}
+
+func TestGenerateKey(t *testing.T) {
+	for _, method := range []string{"HS256", "RS256", "PS256", "ES256", "ES384", "ES512", "EdDSA"} {
+		secretkey, privateKeyPEM, err := GenerateKey(method)
+		assert.NoError(t, err)
+
+		key, err := NewKey(method, secretkey, privateKeyPEM)
+		assert.NoError(t, err)
+
+		token, err := NewJWT(5).Signup(testEmail(), key, testIssuer)
+		assert.NoError(t, err)
+		_, err = ParseSignupJWT(token, key)
+		assert.NoError(t, err)
+	}
+
+	_, _, err := GenerateKey("none")
+	assert.EqualError(t, err, "unsupported signing method 'none'")
+}
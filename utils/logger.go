@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Levels of log line.
+const (
+	LogDebug = "debug"
+	LogInfo  = "info"
+	LogError = "error"
+)
+
+const logTimeFormat = "2006/01/02 15:04:05"
+
+// Logger writes a structured line for each log, JSON or text.
+// Fields added by 'With' are written in every line of the logger.
+type Logger struct {
+	out    *logOutput
+	fields []logField
+}
+
+type logOutput struct {
+	sync.Mutex
+	w    io.Writer
+	json bool
+}
+
+type logField struct {
+	key   string
+	value interface{}
+}
+
+// NewLogger returns a logger writing to w.
+// Lines are JSON objects if json is true, 'key=value' text otherwise.
+func NewLogger(w io.Writer, json bool) *Logger {
+	return &Logger{out: &logOutput{w: w, json: json}}
+}
+
+// With returns a logger having the fields in addition to fields of l.
+// Fields are given as key and value pairs, the key must be string.
+func (l *Logger) With(keyValues ...interface{}) *Logger {
+	fields := make([]logField, len(l.fields), len(l.fields)+len(keyValues)/2)
+	copy(fields, l.fields)
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		fields = append(fields, logField{fmt.Sprint(keyValues[i]), keyValues[i+1]})
+	}
+	return &Logger{out: l.out, fields: fields}
+}
+
+// Debugf .
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.write(LogDebug, fmt.Sprintf(format, args...))
+}
+
+// Infof .
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.write(LogInfo, fmt.Sprintf(format, args...))
+}
+
+// Errorf .
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.write(LogError, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) write(level, msg string) {
+	now := time.Now()
+	var buf bytes.Buffer
+	if l.out.json {
+		buf.WriteString(`{"time":`)
+		writeJSONValue(&buf, now.Format(time.RFC3339Nano))
+		buf.WriteString(`,"level":`)
+		writeJSONValue(&buf, level)
+		buf.WriteString(`,"msg":`)
+		writeJSONValue(&buf, msg)
+		for _, f := range l.fields {
+			buf.WriteByte(',')
+			writeJSONValue(&buf, f.key)
+			buf.WriteByte(':')
+			writeJSONValue(&buf, f.value)
+		}
+		buf.WriteString("}\n")
+	} else {
+		fmt.Fprintf(&buf, "%s %-5s %s", now.Format(logTimeFormat), strings.ToUpper(level), msg)
+		for _, f := range l.fields {
+			fmt.Fprintf(&buf, " %s=%s", f.key, textValue(f.value))
+		}
+		buf.WriteByte('\n')
+	}
+
+	l.out.Lock()
+	defer l.out.Unlock()
+	l.out.w.Write(buf.Bytes())
+}
+
+func writeJSONValue(buf *bytes.Buffer, v interface{}) {
+	if err, ok := v.(error); ok {
+		v = err.Error()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(b)
+}
+
+func textValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if err, ok := v.(error); ok {
+		s = err.Error()
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+var defaultLogger = struct {
+	sync.RWMutex
+	logger *Logger
+}{logger: NewLogger(os.Stderr, false)}
+
+// DefaultLogger returns the logger used when there is no logger of the context.
+func DefaultLogger() *Logger {
+	defaultLogger.RLock()
+	defer defaultLogger.RUnlock()
+	return defaultLogger.logger
+}
+
+// SetDefaultLogger replaces the default logger.
+func SetDefaultLogger(l *Logger) {
+	defaultLogger.Lock()
+	defer defaultLogger.Unlock()
+	defaultLogger.logger = l
+}
+
+type loggerKey struct{}
+
+// loggerRef is kept in the context,
+// so that fields added later are seen by everything having the context.
+type loggerRef struct {
+	sync.Mutex
+	logger *Logger
+}
+
+// ContextWithLogger returns a copy of ctx having the logger.
+func ContextWithLogger(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, &loggerRef{logger: l})
+}
+
+// LoggerFromContext returns the logger of the context, or the default logger if none.
+func LoggerFromContext(ctx context.Context) *Logger {
+	if ref, ok := ctx.Value(loggerKey{}).(*loggerRef); ok {
+		ref.Lock()
+		defer ref.Unlock()
+		return ref.logger
+	}
+	return DefaultLogger()
+}
+
+// AddLogFields adds the fields to the logger of the context.
+// It does nothing if the context has no logger.
+func AddLogFields(ctx context.Context, keyValues ...interface{}) {
+	if ref, ok := ctx.Value(loggerKey{}).(*loggerRef); ok {
+		ref.Lock()
+		defer ref.Unlock()
+		ref.logger = ref.logger.With(keyValues...)
+	}
+}
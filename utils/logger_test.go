@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf, true).With("request_id", "abc", "user_id", 7)
+	l.With("error", errors.New("failed")).Errorf("failed %s", "something")
+
+	line := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, LogError, line["level"])
+	assert.Equal(t, "failed something", line["msg"])
+	assert.Equal(t, "abc", line["request_id"])
+	assert.Equal(t, float64(7), line["user_id"])
+	assert.Equal(t, "failed", line["error"])
+	assert.NotEmpty(t, line["time"])
+
+	// 자식 로거의 필드는 부모에 남지 않는다.
+	buf.Reset()
+	l.Infof("done")
+	assert.NotContains(t, buf.String(), `"error"`)
+}
+
+func TestLoggerText(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf, false).With("route", "/users/:email", "ip", "192.0.2.1 x")
+	l.Infof("request")
+
+	line := strings.TrimSpace(buf.String())
+	assert.Contains(t, line, " INFO  request route=/users/:email ip=\"192.0.2.1 x\"")
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	assert.Equal(t, DefaultLogger(), LoggerFromContext(context.Background()))
+	AddLogFields(context.Background(), "user_id", 1)
+
+	var buf bytes.Buffer
+	ctx := ContextWithLogger(context.Background(), NewLogger(&buf, true).With("request_id", "abc"))
+	// 나중에 더한 필드도 같은 컨텍스트를 가진 곳에서 모두 보인다.
+	AddLogFields(ctx, "user_id", 1)
+	LoggerFromContext(ctx).Infof("hello")
+	assert.Contains(t, buf.String(), `"request_id":"abc","user_id":1`)
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Outcomes used as label of metrics.
+const (
+	MetricSuccess = "success"
+	MetricFailure = "failure"
+)
+
+// DefaultBuckets are upper bounds of histogram buckets for durations in seconds.
+var DefaultBuckets = prometheus.DefBuckets
+
+// metricsRegistry has all metrics created, with metrics of Go runtime and the process.
+var metricsRegistry = prometheus.NewRegistry()
+
+func init() {
+	metricsRegistry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+}
+
+// MetricsHandler serves all metrics in Prometheus text format.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// findMetric returns the metric of the label values collected from the collector,
+// or nil if it is not observed yet. Unlike WithLabelValues, it does not make series.
+func findMetric(c prometheus.Collector, labels, labelValues []string) *dto.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	var found *dto.Metric
+	for m := range ch {
+		var metric dto.Metric
+		if found != nil || m.Write(&metric) != nil {
+			continue
+		}
+
+		values := map[string]string{}
+		for _, pair := range metric.GetLabel() {
+			values[pair.GetName()] = pair.GetValue()
+		}
+		matched := len(labels) == len(labelValues)
+		for i := 0; matched && i < len(labels); i++ {
+			matched = values[labels[i]] == labelValues[i]
+		}
+		if matched {
+			found = &metric
+		}
+	}
+	return found
+}
+
+// CounterVec is a counter for each label values.
+type CounterVec struct {
+	*prometheus.CounterVec
+	labels []string
+}
+
+// NewCounterVec creates a counter served by 'MetricsHandler'.
+// It panics if a metric of the name already exists.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	metricsRegistry.MustRegister(c)
+	return &CounterVec{c, labels}
+}
+
+// Inc adds 1 to the counter of the label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.WithLabelValues(labelValues...).Inc()
+}
+
+// Value returns the counter of the label values.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	if m := findMetric(c, c.labels, labelValues); m != nil {
+		return m.GetCounter().GetValue()
+	}
+	return 0
+}
+
+// HistogramVec counts observed values in buckets for each label values.
+type HistogramVec struct {
+	*prometheus.HistogramVec
+	labels []string
+}
+
+// NewHistogramVec creates a histogram served by 'MetricsHandler'.
+// 'buckets' are upper bounds of buckets in increasing order.
+// It panics if a metric of the name already exists.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)
+	metricsRegistry.MustRegister(h)
+	return &HistogramVec{h, labels}
+}
+
+// Observe adds the value to the histogram of the label values.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.WithLabelValues(labelValues...).Observe(value)
+}
+
+// Count returns the number of values observed with the label values.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	if m := findMetric(h, h.labels, labelValues); m != nil {
+		return m.GetHistogram().GetSampleCount()
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func metricsForTest(t *testing.T) string {
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	assert.NoError(t, err)
+	MetricsHandler().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("test_counter_total", "Test counter.", "outcome")
+	assert.Equal(t, float64(0), c.Value(MetricSuccess))
+	c.Inc(MetricSuccess)
+	c.Inc(MetricSuccess)
+	c.Inc("quo\"te")
+	assert.Equal(t, float64(2), c.Value(MetricSuccess))
+
+	assert.Contains(t, metricsForTest(t), `# HELP test_counter_total Test counter.
+# TYPE test_counter_total counter
+test_counter_total{outcome="quo\"te"} 1
+test_counter_total{outcome="success"} 2
+`)
+
+	assert.Panics(t, func() { c.Inc() })
+	assert.Panics(t, func() { NewCounterVec("test_counter_total", "") })
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "Test histogram.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.5, "/a")
+	h.Observe(3, "/a")
+	assert.Equal(t, uint64(3), h.Count("/a"))
+	assert.Equal(t, uint64(0), h.Count("/b"))
+
+	body := metricsForTest(t)
+	// 버킷은 누적으로 센다.
+	assert.Contains(t, body, `# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/a",le="0.1"} 1
+test_duration_seconds_bucket{route="/a",le="1"} 2
+test_duration_seconds_bucket{route="/a",le="+Inf"} 3
+test_duration_seconds_sum{route="/a"} 3.55
+test_duration_seconds_count{route="/a"} 3
+`)
+	assert.NotContains(t, body, `route="/b"`)
+	assert.Contains(t, body, "go_goroutines")
+}
@@ -2,9 +2,17 @@ package utils
 
 import (
 	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -45,6 +53,8 @@ type MockHandler interface {
 }
 
 // MockSMTPHandler .
+// Lines of the body matched by 'Capture' are kept in 'Captured',
+// so that test can get values generated by the server such as email code.
 type MockSMTPHandler struct {
 	Con     net.Conn
 	Name    string
@@ -52,6 +62,9 @@ type MockSMTPHandler struct {
 	To      string
 	Subject string
 	Body    string
+
+	Capture  *regexp.Regexp
+	Captured []string
 }
 
 // Handle .
@@ -80,6 +93,9 @@ func (h *MockSMTPHandler) Handle() error {
 		case txt == "":
 		case txt == ".":
 		case strings.Contains(txt, "signup/email/verification"):
+		case strings.Contains(txt, "reset_password/email/verification"):
+		case h.Capture != nil && h.Capture.MatchString(txt):
+			h.Captured = append(h.Captured, txt)
 		case strings.Contains(h.Body, txt):
 		case txt == "QUIT":
 			send("221 127.0.0.1 Service closing transmission channel")
@@ -90,3 +106,170 @@ func (h *MockSMTPHandler) Handle() error {
 	}
 	return s.Err()
 }
+
+// MockAuthenticator is software WebAuthn authenticator to be used in test.
+// Every credential is discoverable ES256 key pair with 'none' attestation.
+type MockAuthenticator struct {
+	Origin string
+	// SkipUserVerification leaves UV flag unset like a security key without PIN.
+	SkipUserVerification bool
+
+	credentials []*mockCredential
+}
+
+type mockCredential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// NewMockAuthenticator .
+func NewMockAuthenticator(origin string) *MockAuthenticator {
+	return &MockAuthenticator{Origin: origin}
+}
+
+func (a *MockAuthenticator) clientDataJSON(ceremony, challenge string) ([]byte, error) {
+	return json.Marshal(webAuthnClientData{
+		Type:      ceremony,
+		Challenge: challenge,
+		Origin:    a.Origin,
+	})
+}
+
+func (a *MockAuthenticator) authenticatorData(rpID string, flags byte, signCount uint32) []byte {
+	if !a.SkipUserVerification {
+		flags |= authDataFlagUV
+	}
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	b := append([]byte{}, rpIDHash[:]...)
+	b = append(b, flags|authDataFlagUP)
+	var count [4]byte
+	binary.BigEndian.PutUint32(count[:], signCount)
+	return append(b, count[:]...)
+}
+
+// Create makes new credential like 'navigator.credentials.create()'.
+func (a *MockAuthenticator) Create(options *WebAuthnCreationOptions) (*WebAuthnRegistrationCredential, error) {
+	for _, exclude := range options.ExcludeCredentials {
+		for _, cred := range a.credentials {
+			if EncodeBase64URL(cred.id) == exclude.ID {
+				return nil, errors.New("credential already registered")
+			}
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	userHandle, err := DecodeBase64URL(options.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	coseKey, err := encodeCBOR(cborOrderedMap{
+		{coseKeyKty, coseKtyEC2},
+		{coseKeyAlg, COSEAlgES256},
+		{coseKeyCrv, coseCrvP256},
+		{coseKeyX, key.X.FillBytes(make([]byte, 32))},
+		{coseKeyY, key.Y.FillBytes(make([]byte, 32))},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	authData := a.authenticatorData(options.RP.ID, authDataFlagAT, 0)
+	authData = append(authData, make([]byte, 16)...) // aaguid
+	authData = append(authData, byte(len(id)>>8), byte(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, coseKey...)
+
+	attestation, err := encodeCBOR(cborOrderedMap{
+		{"fmt", WebAuthnAttestationNone},
+		{"attStmt", cborOrderedMap{}},
+		{"authData", authData},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clientData, err := a.clientDataJSON(WebAuthnCreate, options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	a.credentials = append(a.credentials, &mockCredential{
+		id:         id,
+		rpID:       options.RP.ID,
+		userHandle: userHandle,
+		key:        key,
+	})
+
+	return &WebAuthnRegistrationCredential{
+		ID:   EncodeBase64URL(id),
+		Type: WebAuthnPublicKey,
+		Response: WebAuthnAttestationResponse{
+			ClientDataJSON:    EncodeBase64URL(clientData),
+			AttestationObject: EncodeBase64URL(attestation),
+			Transports:        []string{"internal"},
+		},
+	}, nil
+}
+
+// Get signs the challenge like 'navigator.credentials.get()'.
+// The first credential allowed by the options is used.
+func (a *MockAuthenticator) Get(options *WebAuthnRequestOptions) (*WebAuthnAuthenticationCredential, error) {
+	var cred *mockCredential
+	for _, v := range a.credentials {
+		if v.rpID != options.RPID {
+			continue
+		}
+		if len(options.AllowCredentials) == 0 {
+			cred = v
+			break
+		}
+		for _, allow := range options.AllowCredentials {
+			if EncodeBase64URL(v.id) == allow.ID {
+				cred = v
+				break
+			}
+		}
+		if cred != nil {
+			break
+		}
+	}
+	if cred == nil {
+		return nil, errors.New("no credential available")
+	}
+
+	cred.signCount++
+	authData := a.authenticatorData(cred.rpID, 0, cred.signCount)
+	clientData, err := a.clientDataJSON(WebAuthnGet, options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnAuthenticationCredential{
+		ID:   EncodeBase64URL(cred.id),
+		Type: WebAuthnPublicKey,
+		Response: WebAuthnAssertionResponse{
+			ClientDataJSON:    EncodeBase64URL(clientData),
+			AuthenticatorData: EncodeBase64URL(authData),
+			Signature:         EncodeBase64URL(sig),
+			UserHandle:        EncodeBase64URL(cred.userHandle),
+		},
+	}, nil
+}
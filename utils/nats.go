@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const natsTimeout = time.Second * 5
+
+// NATSEventSink publishes events to NATS.
+// The subject is the event type with 'SubjectPrefix', e.g. "auth.user.created".
+// The connection is made at the first publish and reconnected by the client.
+type NATSEventSink struct {
+	Addr          string
+	SubjectPrefix string
+	Token         string
+
+	mu   sync.Mutex
+	conn *nats.Conn
+}
+
+// NewNATSEventSink .
+func NewNATSEventSink(addr, subjectPrefix, token string) *NATSEventSink {
+	return &NATSEventSink{
+		Addr:          addr,
+		SubjectPrefix: subjectPrefix,
+		Token:         token,
+	}
+}
+
+func (s *NATSEventSink) connect() (*nats.Conn, error) {
+	opts := []nats.Option{nats.Name("auth"), nats.Timeout(natsTimeout)}
+	if s.Token != "" {
+		opts = append(opts, nats.Token(s.Token))
+	}
+	return nats.Connect(s.Addr, opts...)
+}
+
+// Publish returns after the server has received all events,
+// so that errors of the connection are returned.
+func (s *NATSEventSink) Publish(events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil || s.conn.IsClosed() {
+		c, err := s.connect()
+		if err != nil {
+			return err
+		}
+		s.conn = c
+	}
+
+	for _, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := s.conn.Publish(s.SubjectPrefix+e.Type, b); err != nil {
+			return err
+		}
+	}
+	return s.conn.FlushTimeout(natsTimeout)
+}
+
+// Close .
+func (s *NATSEventSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	// 보내지 못한 이벤트가 있으면 보내고 닫는다.
+	var err error
+	if !s.conn.IsClosed() {
+		err = s.conn.FlushTimeout(natsTimeout)
+	}
+	s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// CodeChallengeMethodS256 is the only PKCE method supported.
+// 'plain' method is not allowed.
+const CodeChallengeMethodS256 = "S256"
+
+// reference - https://tools.ietf.org/html/rfc7636#section-4.1
+var codeVerifierRegexp = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// ValidCodeVerifier reports whether the verifier meets RFC 7636.
+func ValidCodeVerifier(verifier string) bool {
+	return codeVerifierRegexp.MatchString(verifier)
+}
+
+// ValidCodeChallenge reports whether the challenge is S256 hash encoded base64url.
+func ValidCodeChallenge(challenge string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(b) == sha256.Size
+}
+
+// CodeChallengeS256 returns code challenge derived from the verifier.
+func CodeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyCodeChallenge reports whether the verifier matches the challenge.
+func VerifyCodeChallenge(verifier, challenge string) bool {
+	if !ValidCodeVerifier(verifier) {
+		return false
+	}
+	expected := CodeChallengeS256(verifier)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
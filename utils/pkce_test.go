@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodeChallengeS256(t *testing.T) {
+	// reference - https://tools.ietf.org/html/rfc7636#appendix-B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	assert.Equal(t, challenge, CodeChallengeS256(verifier))
+	assert.True(t, ValidCodeChallenge(challenge))
+	assert.True(t, VerifyCodeChallenge(verifier, challenge))
+
+	assert.False(t, VerifyCodeChallenge(verifier+"x", challenge))
+	assert.False(t, ValidCodeChallenge("short"))
+}
+
+func TestValidCodeVerifier(t *testing.T) {
+	token, err := RandomToken(32)
+	assert.NoError(t, err)
+	assert.True(t, ValidCodeVerifier(token))
+
+	assert.False(t, ValidCodeVerifier(""))
+	assert.False(t, ValidCodeVerifier(strings.Repeat("a", 42)))
+	assert.False(t, ValidCodeVerifier(strings.Repeat("a", 129)))
+	assert.False(t, ValidCodeVerifier(strings.Repeat("a", 42)+"+"))
+}
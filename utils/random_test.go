@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandomToken(t *testing.T) {
+	var prev string
+	for i := 0; i < 100; i++ {
+		token, err := RandomToken(32)
+		assert.NoError(t, err)
+		assert.Equal(t, base64.RawURLEncoding.EncodedLen(32), len(token))
+		assert.NotEqual(t, prev, token)
+		prev = token
+	}
+}
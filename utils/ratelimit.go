@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+const memoryRateLimitSweepEvery = 1000
+
+// RateLimit is token bucket of 'Limit' tokens refilled over 'Period'.
+type RateLimit struct {
+	Limit  int
+	Period time.Duration
+}
+
+// RateLimitResult is the state of the bucket after taking a token.
+// 'Reset' is how long it takes for the bucket to be full again.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// RateLimitStore keeps buckets identified by key.
+// Take must be safe to be called concurrently.
+type RateLimitStore interface {
+	Take(key string, limit RateLimit) (RateLimitResult, error)
+}
+
+func (l RateLimit) interval() time.Duration {
+	return l.Period / time.Duration(l.Limit)
+}
+
+// takeToken takes a token from the bucket which is full at 'tat'.
+// Bucket is kept as theoretical arrival time of GCRA
+// instead of count of tokens, so that only one value is stored.
+// reference - https://en.wikipedia.org/wiki/Generic_cell_rate_algorithm
+func takeToken(tat, now time.Time, l RateLimit) (time.Time, RateLimitResult) {
+	interval := l.interval()
+	if tat.Before(now) {
+		tat = now
+	}
+
+	newTat := tat.Add(interval)
+	allowAt := newTat.Add(-l.Period)
+	if now.Before(allowAt) {
+		return tat, RateLimitResult{
+			Limit:      l.Limit,
+			RetryAfter: allowAt.Sub(now),
+			Reset:      tat.Sub(now),
+		}
+	}
+
+	return newTat, RateLimitResult{
+		Allowed:   true,
+		Limit:     l.Limit,
+		Remaining: int(now.Sub(allowAt) / interval),
+		Reset:     newTat.Sub(now),
+	}
+}
+
+// MemoryRateLimitStore keeps buckets in memory of the process.
+// Buckets already full are removed from time to time.
+type MemoryRateLimitStore struct {
+	mu    sync.Mutex
+	tats  map[string]time.Time
+	takes int
+}
+
+// NewMemoryRateLimitStore .
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{tats: map[string]time.Time{}}
+}
+
+// Take .
+func (s *MemoryRateLimitStore) Take(key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	tat, res := takeToken(s.tats[key], now, limit)
+	if res.Allowed {
+		s.tats[key] = tat
+	}
+
+	s.takes++
+	if s.takes%memoryRateLimitSweepEvery == 0 {
+		for k, v := range s.tats {
+			if !v.After(now) {
+				delete(s.tats, k)
+			}
+		}
+	}
+	return res, nil
+}
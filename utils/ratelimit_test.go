@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTakeToken(t *testing.T) {
+	l := RateLimit{Limit: 3, Period: time.Second * 3}
+	now := time.Now()
+
+	var tat time.Time
+	var res RateLimitResult
+	for i := 2; i >= 0; i-- {
+		tat, res = takeToken(tat, now, l)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+	assert.Equal(t, time.Second*3, res.Reset)
+
+	_, res = takeToken(tat, now, l)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	// 1초가 지나면 토큰 하나가 채워진다.
+	now = now.Add(time.Second)
+	tat, res = takeToken(tat, now, l)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	now = now.Add(time.Minute)
+	_, res = takeToken(tat, now, l)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 2, res.Remaining)
+}
+
+func testRateLimitStore(t *testing.T, store RateLimitStore) {
+	l := RateLimit{Limit: 2, Period: time.Minute}
+	key := fmt.Sprintf("test:%d", time.Now().UnixNano())
+	for i := 1; i >= 0; i-- {
+		res, err := store.Take(key, l)
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res, err := store.Take(key, l)
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.InDelta(t, (time.Second * 30).Seconds(), res.RetryAfter.Seconds(), 1)
+
+	// 다른 key 는 따로 센다.
+	res, err = store.Take(key+":other", l)
+	assert.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	testRateLimitStore(t, NewMemoryRateLimitStore())
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	redisPoolSize   = 8
+	redisTimeout    = time.Second
+	redisMaxRetries = 5
+)
+
+// ErrorRedisConflict is returned when the bucket is changed
+// by other clients every time it is tried to take a token.
+var ErrorRedisConflict = errors.New("redis: too many conflicts on transaction")
+
+// RedisRateLimitStore keeps buckets in redis to be shared by processes.
+// Each bucket is updated in optimistic transaction with WATCH,
+// so that it works with servers without scripting.
+type RedisRateLimitStore struct {
+	Prefix string
+
+	client *redis.Client
+}
+
+// NewRedisRateLimitStore .
+func NewRedisRateLimitStore(addr, password string, db int, prefix string) *RedisRateLimitStore {
+	return &RedisRateLimitStore{
+		Prefix: prefix,
+		client: redis.NewClient(&redis.Options{
+			Addr:         addr,
+			Password:     password,
+			DB:           db,
+			PoolSize:     redisPoolSize,
+			DialTimeout:  redisTimeout,
+			ReadTimeout:  redisTimeout,
+			WriteTimeout: redisTimeout,
+		}),
+	}
+}
+
+// Take .
+func (s *RedisRateLimitStore) Take(key string, limit RateLimit) (RateLimitResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	key = s.Prefix + key
+	for i := 0; i < redisMaxRetries; i++ {
+		var res RateLimitResult
+		take := func(tx *redis.Tx) error {
+			var tat time.Time
+			v, err := tx.Get(ctx, key).Result()
+			switch {
+			case err == nil:
+				ns, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					return err
+				}
+				tat = time.Unix(0, ns)
+			case err != redis.Nil:
+				return err
+			}
+
+			now := time.Now()
+			var newTat time.Time
+			newTat, res = takeToken(tat, now, limit)
+			if !res.Allowed {
+				return nil
+			}
+
+			// 다른 client 가 먼저 바꾸면 'redis.TxFailedErr' 로 실패한다.
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, strconv.FormatInt(newTat.UnixNano(), 10),
+					newTat.Sub(now)+time.Millisecond)
+				return nil
+			})
+			return err
+		}
+
+		err := s.client.Watch(ctx, take, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+		return res, nil
+	}
+	return RateLimitResult{}, ErrorRedisConflict
+}
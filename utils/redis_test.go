@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func redisForTest(t *testing.T) *miniredis.Miniredis {
+	m := miniredis.RunT(t)
+	m.RequireAuth("testpw")
+	return m
+}
+
+func TestRedisRateLimitStore(t *testing.T) {
+	m := redisForTest(t)
+
+	store := NewRedisRateLimitStore(m.Addr(), "testpw", 1, "test:")
+	testRateLimitStore(t, store)
+	// 선택한 DB 에 만료 시간과 함께 저장한다.
+	keys := m.DB(1).Keys()
+	assert.NotEmpty(t, keys)
+	assert.True(t, m.DB(1).TTL(keys[0]) > 0)
+}
+
+func TestRedisRateLimitStoreWithChangedBucket(t *testing.T) {
+	m := redisForTest(t)
+
+	store := NewRedisRateLimitStore(m.Addr(), "testpw", 0, "test:")
+	l := RateLimit{Limit: 2, Period: time.Minute}
+
+	// 다른 client 가 먼저 토큰을 모두 가져갔다.
+	tat := time.Now().Add(time.Minute)
+	assert.NoError(t, m.Set("test:key", strconv.FormatInt(tat.UnixNano(), 10)))
+	res, err := store.Take("key", l)
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.InDelta(t, (time.Second * 30).Seconds(), res.RetryAfter.Seconds(), 1)
+}
+
+func TestRedisRateLimitStoreConcurrently(t *testing.T) {
+	m := redisForTest(t)
+
+	store := NewRedisRateLimitStore(m.Addr(), "testpw", 0, "test:")
+	l := RateLimit{Limit: 5, Period: time.Minute}
+
+	var wg sync.WaitGroup
+	allowed := make(chan bool, 10)
+	for i := 0; i < cap(allowed); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := store.Take("concurrent", l)
+			allowed <- err == nil && res.Allowed
+		}()
+	}
+	wg.Wait()
+	close(allowed)
+
+	// 트랜잭션이 충돌해도 토큰보다 많이 허용하지 않는다.
+	count := 0
+	for ok := range allowed {
+		if ok {
+			count++
+		}
+	}
+	assert.True(t, count <= l.Limit)
+	assert.True(t, count > 0)
+}
+
+func TestRedisRateLimitStoreWithWrongPassword(t *testing.T) {
+	m := redisForTest(t)
+
+	store := NewRedisRateLimitStore(m.Addr(), "wrongpw", 0, "test:")
+	_, err := store.Take("key", RateLimit{Limit: 1, Period: time.Second})
+	assert.Error(t, err)
+}
+
+func TestRedisRateLimitStoreWithoutServer(t *testing.T) {
+	m := redisForTest(t)
+	addr := m.Addr()
+	m.Close()
+
+	store := NewRedisRateLimitStore(addr, "", 0, "test:")
+	_, err := store.Take("key", RateLimit{Limit: 1, Period: time.Second})
+	assert.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers of W3C trace context.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// traceScope is name of instrumentation library of spans of this service.
+const traceScope = "github.com/loganstone/auth"
+
+// traceContext propagates W3C 'traceparent' and 'tracestate' headers.
+var traceContext = propagation.TraceContext{}
+
+// NewTracerProvider returns a provider exporting spans to the exporter in batches.
+// 'samplePercent' is percent of traces started by this service to be exported,
+// traces continued from other services follow the decision of them.
+// The provider must be shut down to export the remaining spans.
+func NewTracerProvider(exporter sdktrace.SpanExporter, service string, samplePercent int) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(
+			sdktrace.TraceIDRatioBased(float64(samplePercent)/100))),
+		sdktrace.WithResource(traceResource(service)))
+}
+
+// ExtractTraceContext returns a copy of ctx having the span context of the headers,
+// spans started with the returned context are children of it.
+// The headers are ignored if 'traceparent' is invalid.
+func ExtractTraceContext(ctx context.Context, h http.Header) context.Context {
+	return traceContext.Extract(ctx, propagation.HeaderCarrier(h))
+}
+
+// InjectTraceContext sets the headers for the span of the context,
+// so that the next service continues the trace.
+func InjectTraceContext(ctx context.Context, h http.Header) {
+	traceContext.Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// StartSpan starts a span with the global tracer provider set by 'otel.SetTracerProvider',
+// it is a child of the span of the context if any. The returned context has the span.
+// If no provider is set, the span does nothing.
+func StartSpan(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(traceScope).Start(ctx, name,
+		trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// StartChildSpan starts a span only if the span of the context is recording,
+// so that operations out of traced requests, like background jobs, are not traced.
+// Otherwise the context is returned as it is with a span doing nothing.
+func StartChildSpan(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return StartSpan(ctx, name, kind, attrs...)
+}
+
+// RecordSpanError marks the span failed with the error, nil error is ignored.
+func RecordSpanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
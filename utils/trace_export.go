@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+// otlpTracesPath is appended to the endpoint of OTLP/HTTP exporter.
+const otlpTracesPath = "/v1/traces"
+
+// traceResource is the resource of spans, 'service.name' is the service.
+func traceResource(service string) *resource.Resource {
+	return resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(service))
+}
+
+// NewWriterSpanExporter returns an exporter writing each span as JSON.
+// It is used for local use, with stdout.
+func NewWriterSpanExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
+
+// NewOTLPSpanExporter returns an exporter sending spans to '<endpoint>/v1/traces'
+// of OpenTelemetry collector by OTLP/HTTP. 'endpoint' is url of http or https,
+// 'headers' are sent with every request, like API key of the collector.
+func NewOTLPSpanExporter(endpoint string, headers map[string]string, timeout time.Duration) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(u.Path, "/") + otlpTracesPath),
+		otlptracehttp.WithHeaders(headers),
+		otlptracehttp.WithTimeout(timeout),
+	}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(context.Background(), opts...)
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// tracerForTest sets the global tracer provider exporting to memory while the test.
+// Spans are exported after 'ForceFlush' of the provider.
+func tracerForTest(t *testing.T, samplePercent int) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewTracerProvider(exporter, "auth", samplePercent)
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		provider.Shutdown(context.Background())
+	})
+	return provider, exporter
+}
+
+func TestStartSpan(t *testing.T) {
+	// 트레이서가 없으면 span 은 아무것도 하지 않는다.
+	_, span := StartSpan(context.Background(), "disabled", trace.SpanKindInternal)
+	assert.False(t, span.IsRecording())
+	assert.False(t, span.SpanContext().IsValid())
+	span.End()
+
+	provider, exporter := tracerForTest(t, 100)
+	h := http.Header{}
+	h.Set(TraceparentHeader, testTraceparent)
+	h.Set(TracestateHeader, "vendor=value")
+	ctx := ExtractTraceContext(context.Background(), h)
+
+	ctx, parent := StartSpan(ctx, "parent", trace.SpanKindServer,
+		attribute.String("http.method", "GET"))
+	_, child := StartChildSpan(ctx, "child", trace.SpanKindClient)
+	RecordSpanError(child, errors.New("failed"))
+	RecordSpanError(child, nil)
+	child.End()
+	parent.End()
+
+	// 다음 서비스에는 현재 span 을 부모로 알린다.
+	out := http.Header{}
+	InjectTraceContext(ctx, out)
+	assert.Equal(t,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-"+parent.SpanContext().SpanID().String()+"-01",
+		out.Get(TraceparentHeader))
+	assert.Equal(t, "vendor=value", out.Get(TracestateHeader))
+
+	assert.NoError(t, provider.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, "failed", spans[0].Status.Description)
+	assert.Len(t, spans[0].Events, 1)
+	assert.Equal(t, "parent", spans[1].Name)
+	assert.Equal(t, trace.SpanKindServer, spans[1].SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[1].SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[1].Parent.SpanID().String())
+	assert.True(t, spans[1].Parent.IsRemote())
+	assert.Equal(t, []attribute.KeyValue{attribute.String("http.method", "GET")}, spans[1].Attributes)
+
+	// 부모 span 이 없으면 자식 span 을 만들지 않는다.
+	ctx, span = StartChildSpan(context.Background(), "background", trace.SpanKindInternal)
+	assert.False(t, span.IsRecording())
+	assert.False(t, trace.SpanFromContext(ctx).SpanContext().IsValid())
+
+	// 'traceparent' 가 잘못되면 헤더를 무시한다.
+	h.Set(TraceparentHeader, "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01")
+	ctx = ExtractTraceContext(context.Background(), h)
+	assert.False(t, trace.SpanContextFromContext(ctx).IsValid())
+}
+
+func TestTracerSample(t *testing.T) {
+	provider, exporter := tracerForTest(t, 0)
+	_, span := StartSpan(context.Background(), "not sampled", trace.SpanKindServer)
+	assert.False(t, span.SpanContext().IsSampled())
+	span.End()
+
+	// 호출한 서비스의 결정을 따른다.
+	h := http.Header{}
+	h.Set(TraceparentHeader, testTraceparent)
+	_, span = StartSpan(ExtractTraceContext(context.Background(), h), "sampled", trace.SpanKindServer)
+	span.End()
+
+	assert.NoError(t, provider.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "sampled", spans[0].Name)
+}
+
+func TestWriterSpanExporter(t *testing.T) {
+	var buf bytes.Buffer
+	exporter, err := NewWriterSpanExporter(&buf)
+	assert.NoError(t, err)
+	provider := NewTracerProvider(exporter, "auth", 100)
+	_, span := provider.Tracer(traceScope).Start(context.Background(), "span")
+	span.End()
+	assert.NoError(t, provider.Shutdown(context.Background()))
+
+	line := struct {
+		Name        string
+		SpanContext struct{ TraceID string }
+	}{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "span", line.Name)
+	assert.Equal(t, span.SpanContext().TraceID().String(), line.SpanContext.TraceID)
+}
+
+func TestOTLPSpanExporter(t *testing.T) {
+	req := &coltracepb.ExportTraceServiceRequest{}
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/collector/v1/traces", r.URL.Path)
+		header = r.Header
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.NoError(t, proto.Unmarshal(body, req))
+	}))
+	defer srv.Close()
+
+	exporter, err := NewOTLPSpanExporter(
+		srv.URL+"/collector/", map[string]string{"api-key": "secret"}, time.Second)
+	assert.NoError(t, err)
+	provider := NewTracerProvider(exporter, "auth", 100)
+	_, span := provider.Tracer(traceScope).Start(context.Background(), "span",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int64("db.rows_affected", 2)))
+	RecordSpanError(span, errors.New("failed"))
+	span.End()
+	assert.NoError(t, provider.Shutdown(context.Background()))
+
+	assert.Equal(t, "secret", header.Get("api-key"))
+	resourceSpans := req.GetResourceSpans()
+	assert.Len(t, resourceSpans, 1)
+	service := ""
+	for _, a := range resourceSpans[0].GetResource().GetAttributes() {
+		if a.GetKey() == "service.name" {
+			service = a.GetValue().GetStringValue()
+		}
+	}
+	assert.Equal(t, "auth", service)
+	otlpSpan := resourceSpans[0].GetScopeSpans()[0].GetSpans()[0]
+	assert.Equal(t, "span", otlpSpan.GetName())
+	var traceID trace.TraceID
+	copy(traceID[:], otlpSpan.GetTraceId())
+	assert.Equal(t, span.SpanContext().TraceID(), traceID)
+	assert.Empty(t, otlpSpan.GetParentSpanId())
+	assert.Equal(t, "failed", otlpSpan.GetStatus().GetMessage())
+	assert.Equal(t, int64(2), otlpSpan.GetAttributes()[0].GetValue().GetIntValue())
+
+	_, err = NewOTLPSpanExporter("http://%zz", nil, 0)
+	assert.Error(t, err)
+}
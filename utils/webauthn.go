@@ -0,0 +1,646 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Web Authentication ceremonies.
+// reference - https://www.w3.org/TR/webauthn-2/#dom-collectedclientdata-type
+const (
+	WebAuthnCreate = "webauthn.create"
+	WebAuthnGet    = "webauthn.get"
+)
+
+// COSE algorithms supported for credential public key.
+// reference - https://www.iana.org/assignments/cose/cose.xhtml#algorithms
+const (
+	COSEAlgES256 = -7
+	COSEAlgEdDSA = -8
+	COSEAlgRS256 = -257
+)
+
+// WebAuthn option values.
+const (
+	WebAuthnPublicKey                    = "public-key"
+	WebAuthnAttestationNone              = "none"
+	WebAuthnUserVerificationRequired     = "required"
+	WebAuthnUserVerificationPreferred    = "preferred"
+	WebAuthnResidentKeyPreferred         = "preferred"
+	webAuthnAttestationFormatPacked      = "packed"
+	webAuthnAuthenticatorDataMinLen      = 37
+	webAuthnAttestedCredentialDataMinLen = 18
+)
+
+// Authenticator data flags.
+// reference - https://www.w3.org/TR/webauthn-2/#sctn-authenticator-data
+const (
+	authDataFlagUP = 0x01
+	authDataFlagUV = 0x04
+	authDataFlagAT = 0x40
+	authDataFlagED = 0x80
+)
+
+// COSE key parameters.
+// reference - https://tools.ietf.org/html/rfc8152#section-13
+const (
+	coseKeyKty = 1
+	coseKeyAlg = 3
+	coseKeyCrv = -1
+	coseKeyX   = -2
+	coseKeyY   = -3
+	coseKeyN   = -1
+	coseKeyE   = -2
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+// WebAuthnRelyingParty is this application as WebAuthn relying party.
+// 'Origins' are origins of the frontend allowed to run ceremonies.
+type WebAuthnRelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// WebAuthnRPEntity .
+type WebAuthnRPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// WebAuthnUserEntity .
+// 'ID' is base64url encoded user handle.
+type WebAuthnUserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// WebAuthnCredentialParameter .
+type WebAuthnCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// WebAuthnCredentialDescriptor .
+// 'ID' is base64url encoded credential id.
+type WebAuthnCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// WebAuthnAuthenticatorSelection .
+type WebAuthnAuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// WebAuthnCreationOptions is options for 'navigator.credentials.create()'.
+// Field names follow the JSON form of the specification so that
+// the frontend can pass them to the browser as they are.
+// reference - https://www.w3.org/TR/webauthn-3/#dictdef-publickeycredentialcreationoptionsjson
+type WebAuthnCreationOptions struct {
+	Challenge              string                         `json:"challenge"`
+	RP                     WebAuthnRPEntity               `json:"rp"`
+	User                   WebAuthnUserEntity             `json:"user"`
+	PubKeyCredParams       []WebAuthnCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                            `json:"timeout"`
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection WebAuthnAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                         `json:"attestation"`
+}
+
+// WebAuthnRequestOptions is options for 'navigator.credentials.get()'.
+// Empty 'AllowCredentials' lets the user choose one of discoverable credentials.
+// reference - https://www.w3.org/TR/webauthn-3/#dictdef-publickeycredentialrequestoptionsjson
+type WebAuthnRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	Timeout          int                            `json:"timeout"`
+	RPID             string                         `json:"rpId"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+// WebAuthnAttestationResponse .
+// Binary values are base64url encoded.
+type WebAuthnAttestationResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON" binding:"required"`
+	AttestationObject string   `json:"attestationObject" binding:"required"`
+	Transports        []string `json:"transports"`
+}
+
+// WebAuthnRegistrationCredential is the result of 'navigator.credentials.create()'.
+type WebAuthnRegistrationCredential struct {
+	ID       string                      `json:"id" binding:"required"`
+	Type     string                      `json:"type" binding:"required"`
+	Response WebAuthnAttestationResponse `json:"response" binding:"required"`
+}
+
+// WebAuthnAssertionResponse .
+// Binary values are base64url encoded.
+type WebAuthnAssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+	AuthenticatorData string `json:"authenticatorData" binding:"required"`
+	Signature         string `json:"signature" binding:"required"`
+	UserHandle        string `json:"userHandle"`
+}
+
+// WebAuthnAuthenticationCredential is the result of 'navigator.credentials.get()'.
+type WebAuthnAuthenticationCredential struct {
+	ID       string                    `json:"id" binding:"required"`
+	Type     string                    `json:"type" binding:"required"`
+	Response WebAuthnAssertionResponse `json:"response" binding:"required"`
+}
+
+// WebAuthnAttestedCredential is verified new credential to be registered.
+// 'PublicKey' is COSE encoded.
+type WebAuthnAttestedCredential struct {
+	ID           []byte
+	PublicKey    []byte
+	SignCount    uint32
+	AAGUID       []byte
+	UserVerified bool
+}
+
+// WebAuthnAssertion is verified result of authentication ceremony.
+type WebAuthnAssertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+type webAuthnClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+// DecodeBase64URL decodes base64url string with or without padding.
+func DecodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// EncodeBase64URL encodes bytes to base64url string without padding.
+func EncodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func parseClientData(encoded string) (*webAuthnClientData, []byte, error) {
+	raw, err := DecodeBase64URL(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("webauthn: decode client data: %w", err)
+	}
+	clientData := webAuthnClientData{}
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return nil, nil, fmt.Errorf("webauthn: parse client data: %w", err)
+	}
+	return &clientData, raw, nil
+}
+
+// Challenge returns the challenge signed by the authenticator.
+func (c *WebAuthnRegistrationCredential) Challenge() (string, error) {
+	clientData, _, err := parseClientData(c.Response.ClientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	return clientData.Challenge, nil
+}
+
+// Challenge returns the challenge signed by the authenticator.
+func (c *WebAuthnAuthenticationCredential) Challenge() (string, error) {
+	clientData, _, err := parseClientData(c.Response.ClientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	return clientData.Challenge, nil
+}
+
+// CreationOptions returns options of registration ceremony with the challenge.
+// Credentials already registered are excluded so that one authenticator
+// is not registered twice.
+func (rp *WebAuthnRelyingParty) CreationOptions(
+	challenge string, user WebAuthnUserEntity,
+	exclude []WebAuthnCredentialDescriptor, timeoutSec int) *WebAuthnCreationOptions {
+
+	if exclude == nil {
+		exclude = []WebAuthnCredentialDescriptor{}
+	}
+	return &WebAuthnCreationOptions{
+		Challenge: challenge,
+		RP:        WebAuthnRPEntity{ID: rp.ID, Name: rp.Name},
+		User:      user,
+		PubKeyCredParams: []WebAuthnCredentialParameter{
+			{Type: WebAuthnPublicKey, Alg: COSEAlgES256},
+			{Type: WebAuthnPublicKey, Alg: COSEAlgEdDSA},
+			{Type: WebAuthnPublicKey, Alg: COSEAlgRS256},
+		},
+		Timeout:            timeoutSec * 1000,
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: WebAuthnAuthenticatorSelection{
+			ResidentKey:      WebAuthnResidentKeyPreferred,
+			UserVerification: WebAuthnUserVerificationPreferred,
+		},
+		Attestation: WebAuthnAttestationNone,
+	}
+}
+
+// RequestOptions returns options of authentication ceremony with the challenge.
+func (rp *WebAuthnRelyingParty) RequestOptions(
+	challenge string, allow []WebAuthnCredentialDescriptor,
+	userVerification string, timeoutSec int) *WebAuthnRequestOptions {
+
+	if allow == nil {
+		allow = []WebAuthnCredentialDescriptor{}
+	}
+	return &WebAuthnRequestOptions{
+		Challenge:        challenge,
+		Timeout:          timeoutSec * 1000,
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+func (rp *WebAuthnRelyingParty) verifyClientData(
+	clientData *webAuthnClientData, ceremony, challenge string) error {
+
+	if clientData.Type != ceremony {
+		return fmt.Errorf("webauthn: unexpected client data type '%s'", clientData.Type)
+	}
+
+	if subtle.ConstantTimeCompare(
+		[]byte(clientData.Challenge), []byte(challenge)) != 1 {
+		return errors.New("webauthn: challenge mismatch")
+	}
+
+	if clientData.CrossOrigin {
+		return errors.New("webauthn: cross origin is not allowed")
+	}
+
+	for _, origin := range rp.Origins {
+		if clientData.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("webauthn: unexpected origin '%s'", clientData.Origin)
+}
+
+func (rp *WebAuthnRelyingParty) verifyAuthenticatorData(
+	authData *authenticatorData, requireUV bool) error {
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return errors.New("webauthn: rp id hash mismatch")
+	}
+
+	if authData.flags&authDataFlagUP == 0 {
+		return errors.New("webauthn: user is not present")
+	}
+
+	if requireUV && authData.flags&authDataFlagUV == 0 {
+		return errors.New("webauthn: user is not verified")
+	}
+	return nil
+}
+
+// VerifyRegistration verifies the result of registration ceremony
+// and returns the credential to be registered.
+// Attestation is only checked for its integrity and is not used to trust
+// the authenticator model, so 'none' and 'packed' formats are accepted.
+// reference - https://www.w3.org/TR/webauthn-2/#sctn-registering-a-new-credential
+func (rp *WebAuthnRelyingParty) VerifyRegistration(
+	cred *WebAuthnRegistrationCredential, challenge string,
+	requireUV bool) (*WebAuthnAttestedCredential, error) {
+
+	if cred.Type != WebAuthnPublicKey {
+		return nil, fmt.Errorf("webauthn: unexpected credential type '%s'", cred.Type)
+	}
+
+	clientData, rawClientData, err := parseClientData(cred.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rp.verifyClientData(clientData, WebAuthnCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	rawAttestation, err := DecodeBase64URL(cred.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: decode attestation object: %w", err)
+	}
+
+	decoded, n, err := decodeCBOR(rawAttestation)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: parse attestation object: %w", err)
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok || n != len(rawAttestation) {
+		return nil, errors.New("webauthn: malformed attestation object")
+	}
+
+	format, _ := attestation["fmt"].(string)
+	attStmt, _ := attestation["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := attestation["authData"].([]byte)
+	if attStmt == nil || rawAuthData == nil {
+		return nil, errors.New("webauthn: malformed attestation object")
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rp.verifyAuthenticatorData(authData, requireUV); err != nil {
+		return nil, err
+	}
+
+	if authData.flags&authDataFlagAT == 0 {
+		return nil, errors.New("webauthn: no attested credential data")
+	}
+
+	alg, pub, err := parseCOSEKey(authData.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialID, err := DecodeBase64URL(cred.ID)
+	if err != nil || !bytes.Equal(credentialID, authData.credentialID) {
+		return nil, errors.New("webauthn: credential id mismatch")
+	}
+
+	clientDataHash := sha256.Sum256(rawClientData)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	switch format {
+	case WebAuthnAttestationNone:
+		if len(attStmt) != 0 {
+			return nil, errors.New("webauthn: 'none' attestation has statement")
+		}
+	case webAuthnAttestationFormatPacked:
+		if err := verifyPackedAttestation(attStmt, alg, pub, signed); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("webauthn: unsupported attestation format '%s'", format)
+	}
+
+	return &WebAuthnAttestedCredential{
+		ID:           authData.credentialID,
+		PublicKey:    authData.publicKey,
+		SignCount:    authData.signCount,
+		AAGUID:       authData.aaguid,
+		UserVerified: authData.flags&authDataFlagUV != 0,
+	}, nil
+}
+
+// verifyPackedAttestation verifies signature of 'packed' attestation statement.
+// Certificate chain of 'x5c' is not validated.
+// reference - https://www.w3.org/TR/webauthn-2/#sctn-packed-attestation
+func verifyPackedAttestation(
+	attStmt map[interface{}]interface{},
+	credAlg int64, credPub crypto.PublicKey, signed []byte) error {
+
+	alg, ok := attStmt["alg"].(int64)
+	if !ok {
+		return errors.New("webauthn: 'packed' attestation has no alg")
+	}
+	sig, ok := attStmt["sig"].([]byte)
+	if !ok {
+		return errors.New("webauthn: 'packed' attestation has no sig")
+	}
+
+	x5c, ok := attStmt["x5c"].([]interface{})
+	if !ok {
+		// self attestation
+		if alg != credAlg {
+			return errors.New("webauthn: attestation alg mismatch")
+		}
+		return verifyCOSESignature(alg, credPub, signed, sig)
+	}
+
+	if len(x5c) == 0 {
+		return errors.New("webauthn: empty x5c")
+	}
+	der, _ := x5c[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("webauthn: parse attestation certificate: %w", err)
+	}
+	return verifyCOSESignature(alg, cert.PublicKey, signed, sig)
+}
+
+// VerifyAuthentication verifies the result of authentication ceremony
+// with the public key and the sign count of registered credential.
+// reference - https://www.w3.org/TR/webauthn-2/#sctn-verifying-assertion
+func (rp *WebAuthnRelyingParty) VerifyAuthentication(
+	cred *WebAuthnAuthenticationCredential, challenge string,
+	publicKey []byte, signCount uint32, requireUV bool) (*WebAuthnAssertion, error) {
+
+	if cred.Type != WebAuthnPublicKey {
+		return nil, fmt.Errorf("webauthn: unexpected credential type '%s'", cred.Type)
+	}
+
+	clientData, rawClientData, err := parseClientData(cred.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rp.verifyClientData(clientData, WebAuthnGet, challenge); err != nil {
+		return nil, err
+	}
+
+	rawAuthData, err := DecodeBase64URL(cred.Response.AuthenticatorData)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: decode authenticator data: %w", err)
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rp.verifyAuthenticatorData(authData, requireUV); err != nil {
+		return nil, err
+	}
+
+	sig, err := DecodeBase64URL(cred.Response.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: decode signature: %w", err)
+	}
+
+	alg, pub, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(rawClientData)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	if err := verifyCOSESignature(alg, pub, signed, sig); err != nil {
+		return nil, err
+	}
+
+	// 인증기가 sign count 를 지원하지 않으면 항상 0 이다.
+	// 지원하는데 증가하지 않았다면 복제된 인증기일 수 있다.
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return nil, errors.New("webauthn: sign count did not increase. authenticator may be cloned")
+	}
+
+	return &WebAuthnAssertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&authDataFlagUV != 0,
+	}, nil
+}
+
+func parseAuthenticatorData(b []byte) (*authenticatorData, error) {
+	if len(b) < webAuthnAuthenticatorDataMinLen {
+		return nil, errors.New("webauthn: authenticator data too short")
+	}
+
+	authData := authenticatorData{
+		rpIDHash:  b[:32],
+		flags:     b[32],
+		signCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+
+	rest := b[webAuthnAuthenticatorDataMinLen:]
+	if authData.flags&authDataFlagAT != 0 {
+		if len(rest) < webAuthnAttestedCredentialDataMinLen {
+			return nil, errors.New("webauthn: attested credential data too short")
+		}
+		authData.aaguid = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[webAuthnAttestedCredentialDataMinLen:]
+		if len(rest) < idLen {
+			return nil, errors.New("webauthn: credential id too short")
+		}
+		authData.credentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("webauthn: parse credential public key: %w", err)
+		}
+		authData.publicKey = rest[:n]
+		rest = rest[n:]
+	}
+
+	if authData.flags&authDataFlagED != 0 {
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("webauthn: parse extensions: %w", err)
+		}
+		rest = rest[n:]
+	}
+
+	if len(rest) != 0 {
+		return nil, errors.New("webauthn: trailing bytes in authenticator data")
+	}
+	return &authData, nil
+}
+
+// parseCOSEKey returns the algorithm and the public key of COSE encoded key.
+func parseCOSEKey(b []byte) (int64, crypto.PublicKey, error) {
+	decoded, _, err := decodeCBOR(b)
+	if err != nil {
+		return 0, nil, fmt.Errorf("webauthn: parse cose key: %w", err)
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return 0, nil, errors.New("webauthn: malformed cose key")
+	}
+
+	kty, _ := key[int64(coseKeyKty)].(int64)
+	alg, _ := key[int64(coseKeyAlg)].(int64)
+	switch {
+	case kty == coseKtyEC2 && alg == COSEAlgES256:
+		crv, _ := key[int64(coseKeyCrv)].(int64)
+		x, _ := key[int64(coseKeyX)].([]byte)
+		y, _ := key[int64(coseKeyY)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return 0, nil, errors.New("webauthn: malformed ec2 key")
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return 0, nil, errors.New("webauthn: ec2 key is not on curve")
+		}
+		return alg, pub, nil
+	case kty == coseKtyRSA && alg == COSEAlgRS256:
+		n, _ := key[int64(coseKeyN)].([]byte)
+		e, _ := key[int64(coseKeyE)].([]byte)
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return 0, nil, errors.New("webauthn: malformed rsa key")
+		}
+		return alg, &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case kty == coseKtyOKP && alg == COSEAlgEdDSA:
+		crv, _ := key[int64(coseKeyCrv)].(int64)
+		x, _ := key[int64(coseKeyX)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return 0, nil, errors.New("webauthn: malformed okp key")
+		}
+		return alg, ed25519.PublicKey(x), nil
+	}
+	return 0, nil, fmt.Errorf("webauthn: unsupported cose key type %d with alg %d", kty, alg)
+}
+
+func verifyCOSESignature(alg int64, pub crypto.PublicKey, signed, sig []byte) error {
+	digest := sha256.Sum256(signed)
+	verified := false
+	switch alg {
+	case COSEAlgES256:
+		if k, ok := pub.(*ecdsa.PublicKey); ok {
+			verified = ecdsa.VerifyASN1(k, digest[:], sig)
+		}
+	case COSEAlgRS256:
+		if k, ok := pub.(*rsa.PublicKey); ok {
+			verified = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+		}
+	case COSEAlgEdDSA:
+		if k, ok := pub.(ed25519.PublicKey); ok {
+			verified = ed25519.Verify(k, signed, sig)
+		}
+	default:
+		return fmt.Errorf("webauthn: unsupported alg %d", alg)
+	}
+
+	if !verified {
+		return errors.New("webauthn: invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testOrigin = "https://auth.example.com"
+
+var testRelyingParty = WebAuthnRelyingParty{
+	ID:      "auth.example.com",
+	Name:    testIssuer,
+	Origins: []string{testOrigin},
+}
+
+func registerForTest(t *testing.T, authenticator *MockAuthenticator) *WebAuthnAttestedCredential {
+	challenge, err := RandomToken(32)
+	assert.NoError(t, err)
+
+	user := WebAuthnUserEntity{ID: EncodeBase64URL([]byte("1")), Name: testEmail()}
+	options := testRelyingParty.CreationOptions(challenge, user, nil, 60)
+	cred, err := authenticator.Create(options)
+	assert.NoError(t, err)
+
+	c, err := cred.Challenge()
+	assert.NoError(t, err)
+	assert.Equal(t, challenge, c)
+
+	attested, err := testRelyingParty.VerifyRegistration(cred, challenge, true)
+	assert.NoError(t, err)
+	return attested
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	authenticator := NewMockAuthenticator(testOrigin)
+	attested := registerForTest(t, authenticator)
+	assert.Len(t, attested.ID, 16)
+	assert.NotEmpty(t, attested.PublicKey)
+	assert.Zero(t, attested.SignCount)
+	assert.True(t, attested.UserVerified)
+
+	alg, _, err := parseCOSEKey(attested.PublicKey)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(COSEAlgES256), alg)
+}
+
+func TestWebAuthnRegistrationWithBadClientData(t *testing.T) {
+	user := WebAuthnUserEntity{ID: EncodeBase64URL([]byte("1")), Name: testEmail()}
+	options := testRelyingParty.CreationOptions("challenge", user, nil, 60)
+
+	cred, err := NewMockAuthenticator("https://evil.example.com").Create(options)
+	assert.NoError(t, err)
+	_, err = testRelyingParty.VerifyRegistration(cred, "challenge", false)
+	assert.EqualError(t, err, "webauthn: unexpected origin 'https://evil.example.com'")
+
+	cred, err = NewMockAuthenticator(testOrigin).Create(options)
+	assert.NoError(t, err)
+	_, err = testRelyingParty.VerifyRegistration(cred, "other", false)
+	assert.EqualError(t, err, "webauthn: challenge mismatch")
+
+	rp := testRelyingParty
+	rp.ID = "example.com"
+	_, err = rp.VerifyRegistration(cred, "challenge", false)
+	assert.EqualError(t, err, "webauthn: rp id hash mismatch")
+
+	authenticator := NewMockAuthenticator(testOrigin)
+	authenticator.SkipUserVerification = true
+	cred, err = authenticator.Create(options)
+	assert.NoError(t, err)
+	_, err = testRelyingParty.VerifyRegistration(cred, "challenge", true)
+	assert.EqualError(t, err, "webauthn: user is not verified")
+}
+
+func TestWebAuthnAuthentication(t *testing.T) {
+	authenticator := NewMockAuthenticator(testOrigin)
+	attested := registerForTest(t, authenticator)
+	allow := []WebAuthnCredentialDescriptor{
+		{Type: WebAuthnPublicKey, ID: EncodeBase64URL(attested.ID)},
+	}
+
+	options := testRelyingParty.RequestOptions(
+		"challenge", allow, WebAuthnUserVerificationRequired, 60)
+	cred, err := authenticator.Get(options)
+	assert.NoError(t, err)
+	assert.Equal(t, EncodeBase64URL(attested.ID), cred.ID)
+
+	assertion, err := testRelyingParty.VerifyAuthentication(
+		cred, "challenge", attested.PublicKey, attested.SignCount, true)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), assertion.SignCount)
+	assert.True(t, assertion.UserVerified)
+
+	// 같은 assertion 을 다시 쓰면 sign count 가 증가하지 않는다.
+	_, err = testRelyingParty.VerifyAuthentication(
+		cred, "challenge", attested.PublicKey, assertion.SignCount, true)
+	assert.Error(t, err)
+
+	_, err = testRelyingParty.VerifyAuthentication(
+		cred, "other", attested.PublicKey, attested.SignCount, true)
+	assert.EqualError(t, err, "webauthn: challenge mismatch")
+
+	other := registerForTest(t, NewMockAuthenticator(testOrigin))
+	_, err = testRelyingParty.VerifyAuthentication(
+		cred, "challenge", other.PublicKey, attested.SignCount, true)
+	assert.EqualError(t, err, "webauthn: invalid signature")
+
+	cred.Response.Signature = EncodeBase64URL([]byte("bad"))
+	_, err = testRelyingParty.VerifyAuthentication(
+		cred, "challenge", attested.PublicKey, attested.SignCount, true)
+	assert.EqualError(t, err, "webauthn: invalid signature")
+}
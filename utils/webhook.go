@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of webhook request.
+// Receivers verify 'Webhook-Signature' with the secret of the webhook
+// and reject old 'Webhook-Timestamp' not to accept replayed requests.
+const (
+	WebhookIDHeader        = "Webhook-ID"
+	WebhookEventHeader     = "Webhook-Event"
+	WebhookTimestampHeader = "Webhook-Timestamp"
+	WebhookSignatureHeader = "Webhook-Signature"
+)
+
+const webhookSignaturePrefix = "sha256="
+
+// SignWebhook returns HMAC-SHA256 signature of the timestamp and the body
+// joined with '.', so that the timestamp can not be changed.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return webhookSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature reports whether the request is signed with the secret
+// within 'tolerance' from now.
+func VerifyWebhookSignature(secret string, header http.Header, body []byte, tolerance time.Duration) bool {
+	timestamp, err := strconv.ParseInt(header.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil {
+		return false
+	}
+
+	diff := time.Since(time.Unix(timestamp, 0))
+	if diff > tolerance || diff < -tolerance {
+		return false
+	}
+
+	expected := SignWebhook(secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(header.Get(WebhookSignatureHeader)))
+}
+
+// WebhookResult is the result of a webhook request.
+// 'StatusCode' is zero if no response was received.
+type WebhookResult struct {
+	StatusCode int
+	Err        error
+	Duration   time.Duration
+}
+
+// OK reports whether the receiver accepted the request with 2xx status.
+func (r WebhookResult) OK() bool {
+	return r.Err == nil
+}
+
+// WebhookClient sends signed webhook requests.
+type WebhookClient struct {
+	HTTP *http.Client
+}
+
+// NewWebhookClient .
+// Redirects are not followed, the receiver has to give the final url.
+func NewWebhookClient(timeout time.Duration) *WebhookClient {
+	return &WebhookClient{
+		HTTP: &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Send posts the body to the url with signature headers.
+// Response other than 2xx is an error.
+func (c *WebhookClient) Send(url, secret, id, eventType string, body []byte) WebhookResult {
+	start := time.Now()
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return WebhookResult{Err: err}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "auth-webhook")
+	req.Header.Set(WebhookIDHeader, id)
+	req.Header.Set(WebhookEventHeader, eventType)
+	timestamp := start.Unix()
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(secret, timestamp, body))
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return WebhookResult{Err: err, Duration: time.Since(start)}
+	}
+	defer res.Body.Close()
+	// 연결을 재사용할 수 있도록 응답을 조금 읽고 버린다.
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4096))
+
+	result := WebhookResult{StatusCode: res.StatusCode, Duration: time.Since(start)}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		result.Err = fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return result
+}
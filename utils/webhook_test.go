@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	sig := SignWebhook("secret", 1600000000, body)
+	assert.Equal(t, sig, SignWebhook("secret", 1600000000, body))
+	assert.NotEqual(t, sig, SignWebhook("other", 1600000000, body))
+	assert.NotEqual(t, sig, SignWebhook("secret", 1600000001, body))
+	assert.Equal(t, len(webhookSignaturePrefix)+64, len(sig))
+
+	header := http.Header{}
+	now := time.Now().Unix()
+	header.Set(WebhookTimestampHeader, strconv.FormatInt(now, 10))
+	header.Set(WebhookSignatureHeader, SignWebhook("secret", now, body))
+	assert.True(t, VerifyWebhookSignature("secret", header, body, time.Minute))
+	assert.False(t, VerifyWebhookSignature("other", header, body, time.Minute))
+	assert.False(t, VerifyWebhookSignature("secret", header, []byte("{}"), time.Minute))
+
+	// 오래된 요청은 서명이 맞아도 거부한다.
+	old := now - 600
+	header.Set(WebhookTimestampHeader, strconv.FormatInt(old, 10))
+	header.Set(WebhookSignatureHeader, SignWebhook("secret", old, body))
+	assert.False(t, VerifyWebhookSignature("secret", header, body, time.Minute))
+}
+
+func TestWebhookClientSend(t *testing.T) {
+	status := http.StatusOK
+	var received http.Header
+	var receivedBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		receivedBody, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	client := NewWebhookClient(time.Second)
+	body := []byte(`{"id":"1"}`)
+	res := client.Send(srv.URL, "secret", "1", "user.created", body)
+	assert.True(t, res.OK())
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, body, receivedBody)
+	assert.Equal(t, "1", received.Get(WebhookIDHeader))
+	assert.Equal(t, "user.created", received.Get(WebhookEventHeader))
+	assert.True(t, VerifyWebhookSignature("secret", received, body, time.Minute))
+
+	status = http.StatusInternalServerError
+	res = client.Send(srv.URL, "secret", "1", "user.created", body)
+	assert.False(t, res.OK())
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	assert.EqualError(t, res.Err, "unexpected status 500")
+
+	// 리다이렉트는 따라가지 않고 실패로 본다.
+	status = http.StatusFound
+	res = client.Send(srv.URL, "secret", "1", "user.created", body)
+	assert.False(t, res.OK())
+	assert.Equal(t, http.StatusFound, res.StatusCode)
+
+	srv.Close()
+	res = client.Send(srv.URL, "secret", "1", "user.created", body)
+	assert.False(t, res.OK())
+	assert.Equal(t, 0, res.StatusCode)
+}